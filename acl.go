@@ -0,0 +1,140 @@
+package daggo
+
+import (
+	"fmt"
+)
+
+// ACLEntry grants or denies a permission to a principal on a node and, unless overridden, on its descendants
+type ACLEntry struct {
+	NodeID     int    `db:"node_id"`
+	Principal  string `db:"principal"`
+	Permission string `db:"permission"`
+	Allow      bool   `db:"allow"`
+}
+
+const createACLTableQuery = `
+	CREATE TABLE IF NOT EXISTS dag_acl (
+		node_id INTEGER NOT NULL,
+		principal TEXT NOT NULL,
+		permission TEXT NOT NULL,
+		allow BOOLEAN NOT NULL,
+		PRIMARY KEY (node_id, principal, permission)
+	);
+	CREATE INDEX IF NOT EXISTS dag_acl_principal_idx ON dag_acl (principal);
+`
+
+// CreateACLTable creates the side table used to store ACL entries
+func (d *Daggo) CreateACLTable() error {
+	_, err := d.db.Exec(createACLTableQuery)
+	if err != nil {
+		return fmt.Errorf("failed to create ACL table: %v", err)
+	}
+
+	return nil
+}
+
+// GrantPermission allows principal to use permission on the node and the descendants that do not override it
+func (d *Daggo) GrantPermission(nodeID int, principal string, permission string) error {
+	return d.setACLEntry(ACLEntry{NodeID: nodeID, Principal: principal, Permission: permission, Allow: true})
+}
+
+// DenyPermission explicitly denies permission to principal on the node, overriding grants inherited from ancestors
+func (d *Daggo) DenyPermission(nodeID int, principal string, permission string) error {
+	return d.setACLEntry(ACLEntry{NodeID: nodeID, Principal: principal, Permission: permission, Allow: false})
+}
+
+// RevokePermission removes the entry for permission set directly on the node, so it is inherited again
+func (d *Daggo) RevokePermission(nodeID int, principal string, permission string) error {
+	query := "DELETE FROM dag_acl WHERE node_id = $1 AND principal = $2 AND permission = $3"
+	_, err := d.db.Exec(query, nodeID, principal, permission)
+	if err != nil {
+		return fmt.Errorf("failed to revoke permission: %v", err)
+	}
+
+	return nil
+}
+
+// ListACL returns the entries set directly on the given node ID
+func (d *Daggo) ListACL(nodeID int) ([]ACLEntry, error) {
+	entries := make([]ACLEntry, 0)
+
+	query := "SELECT * FROM dag_acl WHERE node_id = $1 ORDER BY principal ASC, permission ASC"
+	err := d.db.Select(&entries, query, nodeID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list ACL: %v", err)
+	}
+
+	return entries, nil
+}
+
+// EffectivePermissions returns the permissions principal holds on the given node ID. For each permission the
+// entries on the nearest nodes, walking up every parent edge from the node itself to its roots, decide whether it
+// is allowed; a node inherits from all of its parents, and a deny wins over a grant at the same distance.
+func (d *Daggo) EffectivePermissions(principal string, nodeID int) ([]string, error) {
+	permissions := make([]string, 0)
+
+	query := `
+		WITH RECURSIVE lineage AS (
+			SELECT id, 0 AS depth
+			FROM dag
+			WHERE id = $2
+			UNION
+			SELECT dag_edge.parent_id, lineage.depth + 1
+			FROM dag_edge
+			JOIN lineage ON dag_edge.child_id = lineage.id
+		),
+		entries AS (
+			SELECT acl.permission, acl.allow, MIN(lineage.depth) AS depth
+			FROM dag_acl acl
+			JOIN lineage ON acl.node_id = lineage.id
+			WHERE acl.principal = $1
+			GROUP BY acl.node_id, acl.permission, acl.allow
+		),
+		nearest AS (
+			SELECT permission, bool_and(allow) AS allow
+			FROM entries
+			WHERE (permission, depth) IN (SELECT permission, MIN(depth) FROM entries GROUP BY permission)
+			GROUP BY permission
+		)
+		SELECT permission FROM nearest WHERE allow ORDER BY permission
+	`
+	err := d.db.Select(&permissions, query, principal, nodeID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get effective permissions: %v", err)
+	}
+
+	return permissions, nil
+}
+
+// HasPermission reports whether principal effectively holds permission on the given node ID
+func (d *Daggo) HasPermission(principal string, nodeID int, permission string) (bool, error) {
+	permissions, err := d.EffectivePermissions(principal, nodeID)
+	if err != nil {
+		return false, err
+	}
+
+	for _, p := range permissions {
+		if p == permission {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (d *Daggo) setACLEntry(entry ACLEntry) error {
+	if entry.Principal == "" || entry.Permission == "" {
+		return fmt.Errorf("principal and permission cannot be empty")
+	}
+
+	query := `
+		INSERT INTO dag_acl (node_id, principal, permission, allow)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT (node_id, principal, permission) DO UPDATE SET allow = EXCLUDED.allow
+	`
+	_, err := d.db.Exec(query, entry.NodeID, entry.Principal, entry.Permission, entry.Allow)
+	if err != nil {
+		return fmt.Errorf("failed to set ACL entry: %v", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,206 @@
+package daggo
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+)
+
+// TraversalStrategy is a way of answering ancestor/descendant queries
+type TraversalStrategy int
+
+const (
+	// StrategyRecursiveCTE walks the adjacency list with a recursive query; it needs no extra storage
+	StrategyRecursiveCTE TraversalStrategy = iota
+	// StrategyClosureTable reads the precomputed dag_closure table of LayoutClosure
+	StrategyClosureTable
+	// StrategyPathIndex reads the ancestor arrays of LayoutPathIndex, for traversals without a depth bound
+	StrategyPathIndex
+)
+
+// String returns the name of the strategy
+func (s TraversalStrategy) String() string {
+	switch s {
+	case StrategyRecursiveCTE:
+		return "recursive_cte"
+	case StrategyClosureTable:
+		return "closure_table"
+	case StrategyPathIndex:
+		return "path_index"
+	default:
+		return fmt.Sprintf("TraversalStrategy(%d)", int(s))
+	}
+}
+
+// strategyState is what the choice of a traversal strategy depends on. It is read once per layout state and
+// dropped whenever a layout of this Daggo changes phase.
+type strategyState struct {
+	// ready holds the strategies whose layout is verified or active
+	ready map[TraversalStrategy]bool
+	// estimates holds the planner's estimate of a Down and an Up traversal
+	estimates map[Direction]int64
+}
+
+// WithAdaptiveTraversal makes GetDescendants, GetAncestors and Traverse switch from the recursive query to the
+// closure table or the path index when the planner estimates a traversal at threshold rows or more, and the
+// layout of the strategy is verified or active. The choice is made once per layout state rather than per call.
+func WithAdaptiveTraversal(threshold int64) Option {
+	return func(d *Daggo) {
+		d.adaptiveThreshold = threshold
+	}
+}
+
+// EstimateTraversalSize returns the planner's estimate of the number of rows a Down or Up traversal from the
+// given node ID would return, without running it
+func (d *Daggo) EstimateTraversalSize(nodeID int, dir Direction) (int64, error) {
+	return d.EstimateTraversalSizeContext(context.Background(), nodeID, dir)
+}
+
+// EstimateTraversalSizeContext is EstimateTraversalSize with a context bounding its queries
+func (d *Daggo) EstimateTraversalSizeContext(ctx context.Context, nodeID int, dir Direction) (int64, error) {
+	step, err := d.traversalStep(dir)
+	if err != nil {
+		return 0, err
+	}
+
+	var plan []byte
+	err = d.db.GetContext(ctx, &plan, "EXPLAIN (FORMAT JSON) "+recursiveTraversalQuery(step), nodeID)
+	if err != nil {
+		return 0, fmt.Errorf("failed to explain traversal: %v", err)
+	}
+
+	var explained []struct {
+		Plan struct {
+			Rows float64 `json:"Plan Rows"`
+		} `json:"Plan"`
+	}
+	err = json.Unmarshal(plan, &explained)
+	if err != nil || len(explained) == 0 {
+		return 0, fmt.Errorf("failed to read traversal plan: %v", err)
+	}
+
+	return int64(explained[0].Plan.Rows), nil
+}
+
+// ChooseTraversalStrategy returns the strategy GetDescendants, GetAncestors and Traverse use for the given node
+// ID and direction without a depth bound
+func (d *Daggo) ChooseTraversalStrategy(nodeID int, dir Direction) (TraversalStrategy, error) {
+	return d.ChooseTraversalStrategyContext(context.Background(), nodeID, dir)
+}
+
+// ChooseTraversalStrategyContext is ChooseTraversalStrategy with a context bounding its queries
+func (d *Daggo) ChooseTraversalStrategyContext(ctx context.Context, nodeID int, dir Direction) (TraversalStrategy, error) {
+	return d.chooseTraversalStrategy(ctx, dir, traversalOptions{})
+}
+
+// chooseTraversalStrategy returns the strategy of a Down or Up traversal with options. An active closure or path
+// index layout is always read; otherwise adaptive traversal picks one whose layout is verified or active.
+func (d *Daggo) chooseTraversalStrategy(ctx context.Context, dir Direction, options traversalOptions) (TraversalStrategy, error) {
+	if dir == Both || options.boundary != StopAtGraphBoundary {
+		return StrategyRecursiveCTE, nil
+	}
+	layout := d.layout()
+	if layout.closure {
+		return StrategyClosureTable, nil
+	}
+	if layout.pathIndex && options.maxDepth <= 0 {
+		return StrategyPathIndex, nil
+	}
+	if d.adaptiveThreshold <= 0 {
+		return StrategyRecursiveCTE, nil
+	}
+
+	state, err := d.strategyState(ctx)
+	if err != nil {
+		return StrategyRecursiveCTE, err
+	}
+	if state.estimates[dir] < d.adaptiveThreshold {
+		return StrategyRecursiveCTE, nil
+	}
+	if state.ready[StrategyClosureTable] {
+		return StrategyClosureTable, nil
+	}
+	if state.ready[StrategyPathIndex] && options.maxDepth <= 0 {
+		return StrategyPathIndex, nil
+	}
+
+	return StrategyRecursiveCTE, nil
+}
+
+// strategyState returns the cached strategy state, reading it from the database when the layouts changed
+func (d *Daggo) strategyState(ctx context.Context) (*strategyState, error) {
+	d.mu.RLock()
+	state := d.strategies
+	d.mu.RUnlock()
+	if state != nil {
+		return state, nil
+	}
+
+	state = &strategyState{ready: make(map[TraversalStrategy]bool), estimates: make(map[Direction]int64)}
+
+	var exists bool
+	err := d.db.GetContext(ctx, &exists, "SELECT to_regclass('dag_storage_layout') IS NOT NULL")
+	if err != nil {
+		return nil, fmt.Errorf("failed to check storage layout table: %v", err)
+	}
+	if exists {
+		var names []string
+		query := "SELECT name FROM dag_storage_layout WHERE phase IN ($1, $2)"
+		err = d.db.SelectContext(ctx, &names, query, LayoutVerified, LayoutActive)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get verified layouts: %v", err)
+		}
+		for _, name := range names {
+			switch {
+			case storageLayouts[name].closure:
+				state.ready[StrategyClosureTable] = true
+			case storageLayouts[name].pathIndex:
+				state.ready[StrategyPathIndex] = true
+			}
+		}
+	}
+
+	// The planner estimates a recursive traversal from the statistics of the edges, whatever its start node
+	if len(state.ready) > 0 {
+		for _, dir := range []Direction{Down, Up} {
+			state.estimates[dir], err = d.EstimateTraversalSizeContext(ctx, 0, dir)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	d.mu.Lock()
+	d.strategies = state
+	d.mu.Unlock()
+
+	return state, nil
+}
+
+// invalidateStrategies makes the next traversal read the strategy state again
+func (d *Daggo) invalidateStrategies() {
+	d.mu.Lock()
+	d.strategies = nil
+	d.mu.Unlock()
+}
+
+// closureTraversalQuery returns the query reading a Down or Up traversal from the closure table, through at most
+// $4 edges when depthLimited
+func closureTraversalQuery(dir Direction, depthLimited bool) string {
+	from, to := "ancestor_id", "descendant_id"
+	if dir == Up {
+		from, to = to, from
+	}
+	depth := "c.depth > 0"
+	if depthLimited {
+		depth += " AND c.depth <= $4"
+	}
+
+	return `
+		SELECT dag.*
+		FROM dag_closure c
+		JOIN dag ON dag.id = c.` + to + `
+		WHERE c.` + from + ` = $1 AND ` + depth + `
+		ORDER BY dag.id ASC
+	`
+}
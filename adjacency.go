@@ -0,0 +1,230 @@
+package daggo
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"sort"
+
+	"github.com/lib/pq"
+)
+
+// adjacencyPlan is a validated adjacency map, ready to be inserted
+type adjacencyPlan struct {
+	// ids lists every node in ascending order
+	ids []int
+	// parents maps a node to its parents in ascending order, the first being its primary parent
+	parents map[int][]int
+	// rootOf maps a node to the root of its graph
+	rootOf map[int]int
+	roots  []int
+}
+
+// planAdjacency validates adjacency, which maps a parent ID to the IDs of its children: it must have no self
+// edges, no duplicate edges and no cycles, and the parents of a node must all descend from the same root
+func planAdjacency(adjacency map[int][]int) (*adjacencyPlan, error) {
+	plan := &adjacencyPlan{parents: make(map[int][]int), rootOf: make(map[int]int)}
+
+	nodes := make(map[int]bool)
+	for parentID, childIDs := range adjacency {
+		nodes[parentID] = true
+		seen := make(map[int]bool, len(childIDs))
+		for _, childID := range childIDs {
+			if childID == parentID {
+				return nil, fmt.Errorf("%w: node %d", ErrSelfEdge, childID)
+			}
+			if seen[childID] {
+				return nil, fmt.Errorf("%w: from %d to %d", ErrDuplicateEdge, parentID, childID)
+			}
+			seen[childID] = true
+			nodes[childID] = true
+			plan.parents[childID] = append(plan.parents[childID], parentID)
+		}
+	}
+	for id := range nodes {
+		plan.ids = append(plan.ids, id)
+		sort.Ints(plan.parents[id])
+	}
+	sort.Ints(plan.ids)
+
+	// Kahn's algorithm visits every node once its parents are visited, unless some lie on a cycle
+	indegree := make(map[int]int, len(plan.ids))
+	queue := make([]int, 0)
+	for _, id := range plan.ids {
+		indegree[id] = len(plan.parents[id])
+		if indegree[id] == 0 {
+			queue = append(queue, id)
+		}
+	}
+	visited := 0
+	for len(queue) > 0 {
+		id := queue[0]
+		queue = queue[1:]
+		visited++
+
+		parents := plan.parents[id]
+		if len(parents) == 0 {
+			plan.rootOf[id] = id
+			plan.roots = append(plan.roots, id)
+		} else {
+			plan.rootOf[id] = plan.rootOf[parents[0]]
+			for _, parentID := range parents[1:] {
+				if plan.rootOf[parentID] != plan.rootOf[id] {
+					return nil, fmt.Errorf("parents %d and %d of node %d belong to different graphs", parents[0], parentID, id)
+				}
+			}
+		}
+
+		for _, childID := range adjacency[id] {
+			indegree[childID]--
+			if indegree[childID] == 0 {
+				queue = append(queue, childID)
+			}
+		}
+	}
+	if visited < len(plan.ids) {
+		return nil, fmt.Errorf("%w: adjacency contains a cycle", ErrCycleDetected)
+	}
+	sort.Ints(plan.roots)
+
+	return plan, nil
+}
+
+// CreateGraphFromAdjacency creates the graphs described by adjacency, which maps a parent ID to the IDs of its
+// children, in one transaction and returns their roots in ascending order. Nodes without parents become roots.
+// A node may have several parents as long as they belong to the same graph; the smallest is its primary parent.
+// payloads optionally maps node IDs to values stored, encoded as JSON, as their payload. The whole structure is
+// validated before anything is written and none of the IDs may exist yet.
+func (d *Daggo) CreateGraphFromAdjacency(adjacency map[int][]int, payloads map[int]interface{}) ([]int, error) {
+	return d.CreateGraphFromAdjacencyContext(context.Background(), adjacency, payloads)
+}
+
+// CreateGraphFromAdjacencyContext is CreateGraphFromAdjacency with a context bounding its queries
+func (d *Daggo) CreateGraphFromAdjacencyContext(ctx context.Context, adjacency map[int][]int, payloads map[int]interface{}) ([]int, error) {
+	plan, err := planAdjacency(adjacency)
+	if err != nil {
+		return nil, err
+	}
+
+	encoded := make(map[int]string, len(payloads))
+	for id, value := range payloads {
+		if _, ok := plan.rootOf[id]; !ok {
+			return nil, fmt.Errorf("payload given for node %d which is not in the adjacency", id)
+		}
+		payload, err := json.Marshal(value)
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode payload of node %d: %v", id, err)
+		}
+		encoded[id] = string(payload)
+	}
+
+	nodeIDs := make([]int, 0, len(plan.ids))
+	primaryIDs := make([]sql.NullInt64, 0, len(plan.ids))
+	rootIDs := make([]int, 0, len(plan.ids))
+	nodePayloads := make([]string, 0, len(plan.ids))
+	edgeParentIDs := make([]int, 0)
+	edgeChildIDs := make([]int, 0)
+	for _, id := range plan.ids {
+		nodeIDs = append(nodeIDs, id)
+		rootIDs = append(rootIDs, plan.rootOf[id])
+
+		parents := plan.parents[id]
+		if len(parents) == 0 {
+			primaryIDs = append(primaryIDs, sql.NullInt64{})
+		} else {
+			primaryIDs = append(primaryIDs, sql.NullInt64{Int64: int64(parents[0]), Valid: true})
+		}
+		// The trigger mirrors primary parents into dag_edge, the others are inserted explicitly
+		for _, parentID := range parents[1:] {
+			edgeParentIDs = append(edgeParentIDs, parentID)
+			edgeChildIDs = append(edgeChildIDs, id)
+		}
+
+		payload, ok := encoded[id]
+		if !ok {
+			payload = "{}"
+		}
+		nodePayloads = append(nodePayloads, payload)
+	}
+
+	// Start a transaction
+	tx, err := d.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %v", err)
+	}
+	defer func() {
+		// Rollback the transaction if it failed to commit
+		if p := recover(); p != nil {
+			tx.Rollback()
+			panic(p)
+		} else if err != nil {
+			tx.Rollback()
+		}
+	}()
+
+	err = d.setTxActor(ctx, tx)
+	if err != nil {
+		return nil, err
+	}
+
+	existing := make([]int, 0)
+	err = tx.SelectContext(ctx, &existing, "SELECT id FROM dag WHERE id = ANY($1) ORDER BY id", pq.Array(nodeIDs))
+	if err != nil {
+		return nil, fmt.Errorf("failed to check for existing nodes: %v", err)
+	}
+	if len(existing) > 0 {
+		err = fmt.Errorf("%w: %v", ErrNodeExists, existing)
+		return nil, err
+	}
+
+	// Refuse the insert if it would exceed the quotas set for the graphs ahead of their creation
+	if d.enforceQuotas {
+		newNodes := make(map[int]int64)
+		for _, id := range plan.ids {
+			newNodes[plan.rootOf[id]]++
+		}
+		for _, rootID := range plan.roots {
+			err = checkQuota(ctx, tx, rootID, newNodes[rootID])
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	// The payload column is only written when payloads are given, so that it is not required otherwise
+	if len(payloads) == 0 {
+		_, err = tx.ExecContext(ctx, `
+			INSERT INTO dag (id, parent_id, root_id)
+			SELECT * FROM unnest($1::int[], $2::int[], $3::int[])
+		`, pq.Array(nodeIDs), pq.Array(primaryIDs), pq.Array(rootIDs))
+	} else {
+		_, err = tx.ExecContext(ctx, `
+			INSERT INTO dag (id, parent_id, root_id, payload)
+			SELECT * FROM unnest($1::int[], $2::int[], $3::int[], $4::jsonb[])
+		`, pq.Array(nodeIDs), pq.Array(primaryIDs), pq.Array(rootIDs), pq.Array(nodePayloads))
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to create nodes: %v", err)
+	}
+
+	if len(edgeParentIDs) > 0 {
+		_, err = tx.ExecContext(ctx, `
+			INSERT INTO dag_edge (parent_id, child_id)
+			SELECT * FROM unnest($1::int[], $2::int[])
+		`, pq.Array(edgeParentIDs), pq.Array(edgeChildIDs))
+		if err != nil {
+			return nil, fmt.Errorf("failed to create edges: %v", err)
+		}
+	}
+
+	// Commit the transaction
+	err = tx.Commit()
+	if err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %v", err)
+	}
+
+	d.InvalidatePlanCache()
+
+	return plan.roots, nil
+}
@@ -0,0 +1,93 @@
+package daggo
+
+import (
+	"fmt"
+	"time"
+)
+
+// Annotation is an operational note left on a node by a human or a service
+type Annotation struct {
+	ID        int       `db:"id"`
+	NodeID    int       `db:"node_id"`
+	Author    string    `db:"author"`
+	Text      string    `db:"text"`
+	CreatedAt time.Time `db:"created_at"`
+}
+
+const createAnnotationTableQuery = `
+	CREATE TABLE IF NOT EXISTS dag_annotation (
+		id SERIAL PRIMARY KEY,
+		node_id INTEGER NOT NULL,
+		author TEXT NOT NULL,
+		text TEXT NOT NULL,
+		created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+	);
+	CREATE INDEX IF NOT EXISTS dag_annotation_node_id_idx ON dag_annotation (node_id);
+`
+
+// CreateAnnotationTable creates the side table used to store node annotations
+func (d *Daggo) CreateAnnotationTable() error {
+	_, err := d.db.Exec(createAnnotationTableQuery)
+	if err != nil {
+		return fmt.Errorf("failed to create annotation table: %v", err)
+	}
+
+	return nil
+}
+
+// AddAnnotation attaches a note written by author to the node with the given ID
+func (d *Daggo) AddAnnotation(nodeID int, author string, text string) (*Annotation, error) {
+	// Check that the node being annotated exists
+	node, err := d.GetNodeByID(nodeID)
+	if err != nil {
+		return nil, err
+	}
+	if node == nil {
+		return nil, fmt.Errorf("%w: %d", ErrNodeNotFound, nodeID)
+	}
+
+	var annotation Annotation
+
+	query := `
+		INSERT INTO dag_annotation (node_id, author, text)
+		VALUES ($1, $2, $3)
+		RETURNING id, node_id, author, text, created_at
+	`
+	err = d.db.Get(&annotation, query, nodeID, author, text)
+	if err != nil {
+		return nil, fmt.Errorf("failed to add annotation: %v", err)
+	}
+
+	return &annotation, nil
+}
+
+// ListAnnotations returns the annotations of the given node ID, oldest first
+func (d *Daggo) ListAnnotations(nodeID int) ([]Annotation, error) {
+	annotations := make([]Annotation, 0)
+
+	query := "SELECT * FROM dag_annotation WHERE node_id = $1 ORDER BY created_at ASC, id ASC"
+	err := d.db.Select(&annotations, query, nodeID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list annotations: %v", err)
+	}
+
+	return annotations, nil
+}
+
+// DeleteAnnotation deletes the annotation with the given ID
+func (d *Daggo) DeleteAnnotation(annotationID int) error {
+	result, err := d.db.Exec("DELETE FROM dag_annotation WHERE id = $1", annotationID)
+	if err != nil {
+		return fmt.Errorf("failed to delete annotation: %v", err)
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to delete annotation: %v", err)
+	}
+	if rows == 0 {
+		return fmt.Errorf("annotation with ID %d does not exist", annotationID)
+	}
+
+	return nil
+}
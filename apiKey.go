@@ -0,0 +1,373 @@
+package daggo
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// ErrInvalidAPIKey is returned for API keys that are unknown, revoked or expired
+var ErrInvalidAPIKey = errors.New("invalid API key")
+
+// ErrAPIKeyForbidden is returned when a valid API key does not cover the graph or operation of a request
+var ErrAPIKeyForbidden = errors.New("API key not allowed")
+
+// apiKeyPrefix starts every key so leaked keys are easy to recognize
+const apiKeyPrefix = "dgk_"
+
+// APIScope is the set of operations an API key allows; each scope includes the ones before it
+type APIScope string
+
+const (
+	// ScopeRead allows reading graphs
+	ScopeRead APIScope = "read"
+	// ScopeWrite allows reading and changing graphs
+	ScopeWrite APIScope = "write"
+	// ScopeAdmin also allows managing jobs and API keys
+	ScopeAdmin APIScope = "admin"
+)
+
+var scopeRanks = map[APIScope]int{ScopeRead: 1, ScopeWrite: 2, ScopeAdmin: 3}
+
+// Includes reports whether the scope allows the operations of other
+func (s APIScope) Includes(other APIScope) bool {
+	return scopeRanks[s] > 0 && scopeRanks[s] >= scopeRanks[other]
+}
+
+// Only a SHA-256 hash of each key is stored; the key itself is shown once by CreateAPIKey
+const createAPIKeyTableQuery = `
+	CREATE TABLE IF NOT EXISTS dag_api_key (
+		id BIGSERIAL PRIMARY KEY,
+		name TEXT NOT NULL,
+		prefix TEXT NOT NULL,
+		key_hash BYTEA NOT NULL UNIQUE,
+		scope TEXT NOT NULL CHECK (scope IN ('read', 'write', 'admin')),
+		root_ids INTEGER[] NOT NULL DEFAULT '{}',
+		created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+		expires_at TIMESTAMPTZ,
+		last_used_at TIMESTAMPTZ,
+		revoked_at TIMESTAMPTZ
+	);
+`
+
+// apiKeyColumns are the columns of the API key table but the hash
+const apiKeyColumns = "id, name, prefix, scope, root_ids, created_at, expires_at, last_used_at, revoked_at"
+
+// APIKey grants access to the graphs served over HTTP
+type APIKey struct {
+	ID   int64  `db:"id" json:"id"`
+	Name string `db:"name" json:"name"`
+	// Prefix is the start of the key, to tell keys apart without storing them
+	Prefix string   `db:"prefix" json:"prefix"`
+	Scope  APIScope `db:"scope" json:"scope"`
+	// RootIDs are the graphs the key gives access to; empty for every graph
+	RootIDs    pq.Int64Array `db:"root_ids" json:"root_ids"`
+	CreatedAt  time.Time     `db:"created_at" json:"created_at"`
+	ExpiresAt  *time.Time    `db:"expires_at" json:"expires_at,omitempty"`
+	LastUsedAt *time.Time    `db:"last_used_at" json:"last_used_at,omitempty"`
+	RevokedAt  *time.Time    `db:"revoked_at" json:"revoked_at,omitempty"`
+}
+
+// AllowsGraph reports whether the key gives access to the graph rooted at rootID
+func (k *APIKey) AllowsGraph(rootID int) bool {
+	if len(k.RootIDs) == 0 {
+		return true
+	}
+	for _, id := range k.RootIDs {
+		if int(id) == rootID {
+			return true
+		}
+	}
+	return false
+}
+
+// Authorize returns ErrAPIKeyForbidden unless the key allows scope on the graph rooted at rootID, or on every
+// graph when rootID is nil
+func (k *APIKey) Authorize(scope APIScope, rootID *int) error {
+	if !k.Scope.Includes(scope) {
+		return fmt.Errorf("%w: key %s has scope %s, the request needs %s", ErrAPIKeyForbidden, k.Prefix, k.Scope, scope)
+	}
+	if rootID == nil && len(k.RootIDs) > 0 {
+		return fmt.Errorf("%w: key %s is limited to some graphs and the request names none", ErrAPIKeyForbidden, k.Prefix)
+	}
+	if rootID != nil && !k.AllowsGraph(*rootID) {
+		return fmt.Errorf("%w: key %s does not cover graph %d", ErrAPIKeyForbidden, k.Prefix, *rootID)
+	}
+
+	return nil
+}
+
+// CreateAPIKeyTable creates the side table storing API keys
+func (d *Daggo) CreateAPIKeyTable() error {
+	_, err := d.db.Exec(createAPIKeyTableQuery)
+	if err != nil {
+		return fmt.Errorf("failed to create API key table: %v", err)
+	}
+
+	return nil
+}
+
+// CreateAPIKey mints a key with the given scope on the graphs rooted at rootIDs, or on every graph when rootIDs
+// is empty, valid for ttl or forever when ttl is 0. The key is returned once and cannot be recovered later.
+func (d *Daggo) CreateAPIKey(ctx context.Context, name string, scope APIScope, rootIDs []int, ttl time.Duration) (string, *APIKey, error) {
+	if name == "" {
+		return "", nil, fmt.Errorf("API key name cannot be empty")
+	}
+	if scopeRanks[scope] == 0 {
+		return "", nil, fmt.Errorf("unknown API key scope %q", scope)
+	}
+	if ttl < 0 {
+		return "", nil, fmt.Errorf("API key TTL cannot be negative")
+	}
+
+	secret := make([]byte, 24)
+	_, err := rand.Read(secret)
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to generate API key: %v", err)
+	}
+	key := apiKeyPrefix + base64.RawURLEncoding.EncodeToString(secret)
+
+	roots := make(pq.Int64Array, 0, len(rootIDs))
+	for _, id := range rootIDs {
+		roots = append(roots, int64(id))
+	}
+	var expiresAt *time.Time
+	if ttl > 0 {
+		t := time.Now().Add(ttl)
+		expiresAt = &t
+	}
+
+	var apiKey APIKey
+
+	query := `
+		INSERT INTO dag_api_key (name, prefix, key_hash, scope, root_ids, expires_at)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		RETURNING ` + apiKeyColumns
+	err = d.db.GetContext(ctx, &apiKey, query, name, key[:len(apiKeyPrefix)+8], hashAPIKey(key), scope, roots, expiresAt)
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to create API key: %v", err)
+	}
+
+	return key, &apiKey, nil
+}
+
+// ListAPIKeys returns every API key, revoked and expired ones included, ordered by ID
+func (d *Daggo) ListAPIKeys(ctx context.Context) ([]APIKey, error) {
+	keys := make([]APIKey, 0)
+
+	err := d.db.SelectContext(ctx, &keys, "SELECT "+apiKeyColumns+" FROM dag_api_key ORDER BY id ASC")
+	if err != nil {
+		return nil, fmt.Errorf("failed to list API keys: %v", err)
+	}
+
+	return keys, nil
+}
+
+// RevokeAPIKey revokes the API key with the given ID; revoking a revoked key is a no-op
+func (d *Daggo) RevokeAPIKey(ctx context.Context, id int64) error {
+	result, err := d.db.ExecContext(ctx, "UPDATE dag_api_key SET revoked_at = COALESCE(revoked_at, now()) WHERE id = $1", id)
+	if err != nil {
+		return fmt.Errorf("failed to revoke API key: %v", err)
+	}
+	updated, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to revoke API key: %v", err)
+	}
+	if updated == 0 {
+		return fmt.Errorf("API key with ID %d does not exist", id)
+	}
+
+	return nil
+}
+
+// AuthenticateAPIKey returns the API key matching key, or ErrInvalidAPIKey if it is unknown, revoked or expired
+func (d *Daggo) AuthenticateAPIKey(ctx context.Context, key string) (*APIKey, error) {
+	if !strings.HasPrefix(key, apiKeyPrefix) {
+		return nil, ErrInvalidAPIKey
+	}
+
+	var apiKey APIKey
+
+	// Recording the last use at most once a minute keeps busy keys from writing on every request
+	query := `
+		UPDATE dag_api_key
+		SET last_used_at = CASE WHEN last_used_at IS NULL OR last_used_at < now() - interval '1 minute' THEN now() ELSE last_used_at END
+		WHERE key_hash = $1 AND revoked_at IS NULL AND (expires_at IS NULL OR expires_at > now())
+		RETURNING ` + apiKeyColumns
+	err := d.db.GetContext(ctx, &apiKey, query, hashAPIKey(key))
+	if err == sql.ErrNoRows {
+		return nil, ErrInvalidAPIKey
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to authenticate API key: %v", err)
+	}
+
+	return &apiKey, nil
+}
+
+func hashAPIKey(key string) []byte {
+	hash := sha256.Sum256([]byte(key))
+	return hash[:]
+}
+
+type apiKeyKey struct{}
+
+// APIKeyFromContext returns the API key that authenticated the request of ctx, or nil
+func APIKeyFromContext(ctx context.Context) *APIKey {
+	key, _ := ctx.Value(apiKeyKey{}).(*APIKey)
+	return key
+}
+
+// RequireAPIKey authenticates the requests to handler with the API key in their Authorization: Bearer or
+// X-API-Key header. GET and HEAD requests need ScopeRead and others ScopeWrite, raised to minScope. Requests
+// naming a graph with a root_id query parameter need a key covering it; the others need a key covering every
+// graph. The key is available to handler through APIKeyFromContext and attributes its writes as
+// "api-key:<name>".
+func RequireAPIKey(d *Daggo, minScope APIScope, handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token := r.Header.Get("X-API-Key")
+		if auth := r.Header.Get("Authorization"); strings.HasPrefix(auth, "Bearer ") {
+			token = strings.TrimPrefix(auth, "Bearer ")
+		}
+		if token == "" {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			http.Error(w, "missing API key", http.StatusUnauthorized)
+			return
+		}
+
+		key, err := d.AuthenticateAPIKey(r.Context(), token)
+		if errors.Is(err, ErrInvalidAPIKey) {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+			return
+		} else if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		scope := ScopeWrite
+		if r.Method == http.MethodGet || r.Method == http.MethodHead {
+			scope = ScopeRead
+		}
+		if minScope.Includes(scope) {
+			scope = minScope
+		}
+		var rootID *int
+		if param := r.URL.Query().Get("root_id"); param != "" {
+			id, err := strconv.Atoi(param)
+			if err != nil {
+				http.Error(w, "invalid root_id", http.StatusBadRequest)
+				return
+			}
+			rootID = &id
+		}
+		if err := key.Authorize(scope, rootID); err != nil {
+			http.Error(w, err.Error(), http.StatusForbidden)
+			return
+		}
+
+		ctx := context.WithValue(r.Context(), apiKeyKey{}, key)
+		ctx = WithActor(ctx, "api-key:"+key.Name)
+		handler.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// APIKeysHandler manages API keys over HTTP; serve it behind RequireAPIKey with ScopeAdmin:
+//
+//	GET  /api-keys
+//	POST /api-keys with {"name": "ci", "scope": "read", "root_ids": [1], "ttl_seconds": 86400}
+//	POST /api-keys/{id}/revoke
+func APIKeysHandler(d *Daggo) http.Handler {
+	mux := http.NewServeMux()
+
+	mux.HandleFunc("/api-keys", func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			keys, err := d.ListAPIKeys(r.Context())
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			writeJSON(w, keys)
+		case http.MethodPost:
+			var request struct {
+				Name       string   `json:"name"`
+				Scope      APIScope `json:"scope"`
+				RootIDs    []int    `json:"root_ids"`
+				TTLSeconds int64    `json:"ttl_seconds"`
+			}
+			if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+				http.Error(w, "invalid request body", http.StatusBadRequest)
+				return
+			}
+			if request.Name == "" || scopeRanks[request.Scope] == 0 || request.TTLSeconds < 0 {
+				http.Error(w, "name, a scope of read, write or admin and a non-negative ttl_seconds are required", http.StatusBadRequest)
+				return
+			}
+			// A key cannot mint keys reaching further than itself
+			if caller := APIKeyFromContext(r.Context()); caller != nil {
+				if !caller.Scope.Includes(request.Scope) || !coversGraphs(caller, request.RootIDs) {
+					http.Error(w, "cannot create a key broader than the calling key", http.StatusForbidden)
+					return
+				}
+			}
+
+			key, apiKey, err := d.CreateAPIKey(r.Context(), request.Name, request.Scope, request.RootIDs, time.Duration(request.TTLSeconds)*time.Second)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			w.WriteHeader(http.StatusCreated)
+			writeJSON(w, struct {
+				Key string `json:"key"`
+				*APIKey
+			}{key, apiKey})
+		default:
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		}
+	})
+
+	mux.HandleFunc("/api-keys/", func(w http.ResponseWriter, r *http.Request) {
+		path := strings.TrimPrefix(r.URL.Path, "/api-keys/")
+		if !strings.HasSuffix(path, "/revoke") || r.Method != http.MethodPost {
+			http.Error(w, "not found", http.StatusNotFound)
+			return
+		}
+		id, err := strconv.ParseInt(strings.TrimSuffix(path, "/revoke"), 10, 64)
+		if err != nil {
+			http.Error(w, "invalid API key ID", http.StatusBadRequest)
+			return
+		}
+
+		if err := d.RevokeAPIKey(r.Context(), id); err != nil {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})
+
+	return mux
+}
+
+// coversGraphs reports whether key gives access to every graph in rootIDs, or to all graphs when rootIDs is empty
+func coversGraphs(key *APIKey, rootIDs []int) bool {
+	if len(rootIDs) == 0 {
+		return len(key.RootIDs) == 0
+	}
+	for _, id := range rootIDs {
+		if !key.AllowsGraph(id) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,36 @@
+package daggo_test
+
+import (
+	"testing"
+
+	"daggo"
+)
+
+func TestAPIScopeIncludes(t *testing.T) {
+	tests := []struct {
+		scope daggo.APIScope
+		other daggo.APIScope
+		want  bool
+	}{
+		{daggo.ScopeRead, daggo.ScopeRead, true},
+		{daggo.ScopeRead, daggo.ScopeWrite, false},
+		{daggo.ScopeRead, daggo.ScopeAdmin, false},
+		{daggo.ScopeWrite, daggo.ScopeRead, true},
+		{daggo.ScopeWrite, daggo.ScopeWrite, true},
+		{daggo.ScopeWrite, daggo.ScopeAdmin, false},
+		{daggo.ScopeAdmin, daggo.ScopeRead, true},
+		{daggo.ScopeAdmin, daggo.ScopeWrite, true},
+		{daggo.ScopeAdmin, daggo.ScopeAdmin, true},
+		{daggo.APIScope("unknown"), daggo.ScopeRead, false},
+		{daggo.APIScope(""), daggo.APIScope(""), false},
+		{daggo.ScopeRead, daggo.APIScope("unknown"), true},
+	}
+
+	for _, tt := range tests {
+		t.Run(string(tt.scope)+"/"+string(tt.other), func(t *testing.T) {
+			if got := tt.scope.Includes(tt.other); got != tt.want {
+				t.Errorf("%q.Includes(%q) = %v, want %v", tt.scope, tt.other, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,110 @@
+package daggo
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+)
+
+// Inheritance rules of an attribute
+const (
+	// InheritDefault makes the value apply to the node and its descendants until a descendant overrides it
+	InheritDefault = "inherit"
+	// InheritFinal makes the value apply to the node and its descendants; descendants cannot override it
+	InheritFinal = "final"
+	// InheritLocal makes the value apply to the node only
+	InheritLocal = "local"
+)
+
+// EffectiveValue is the value an attribute resolves to on a node, and where it comes from
+type EffectiveValue struct {
+	Value        json.RawMessage `db:"value"`
+	SourceNodeID int             `db:"node_id"`
+	Rule         string          `db:"rule"`
+}
+
+const createAttributeTableQuery = `
+	CREATE TABLE IF NOT EXISTS dag_attr (
+		node_id INTEGER NOT NULL,
+		key TEXT NOT NULL,
+		value JSONB NOT NULL,
+		rule TEXT NOT NULL DEFAULT 'inherit' CHECK (rule IN ('inherit', 'final', 'local')),
+		PRIMARY KEY (node_id, key)
+	);
+`
+
+// CreateAttributeTable creates the side table used to store inheritable node attributes
+func (d *Daggo) CreateAttributeTable() error {
+	_, err := d.db.Exec(createAttributeTableQuery)
+	if err != nil {
+		return fmt.Errorf("failed to create attribute table: %v", err)
+	}
+
+	return nil
+}
+
+// SetAttribute sets key to value, encoded as JSON, on the given node with the given inheritance rule
+func (d *Daggo) SetAttribute(nodeID int, key string, value interface{}, rule string) error {
+	if rule != InheritDefault && rule != InheritFinal && rule != InheritLocal {
+		return fmt.Errorf("unknown inheritance rule %q", rule)
+	}
+	encoded, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Errorf("failed to encode attribute: %v", err)
+	}
+
+	query := `
+		INSERT INTO dag_attr (node_id, key, value, rule)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT (node_id, key) DO UPDATE SET value = EXCLUDED.value, rule = EXCLUDED.rule
+	`
+	_, err = d.db.Exec(query, nodeID, key, encoded, rule)
+	if err != nil {
+		return fmt.Errorf("failed to set attribute: %v", err)
+	}
+
+	return nil
+}
+
+// DeleteAttribute removes key from the given node, which then inherits it again
+func (d *Daggo) DeleteAttribute(nodeID int, key string) error {
+	_, err := d.db.Exec("DELETE FROM dag_attr WHERE node_id = $1 AND key = $2", nodeID, key)
+	if err != nil {
+		return fmt.Errorf("failed to delete attribute: %v", err)
+	}
+
+	return nil
+}
+
+// EffectiveAttribute resolves key on the given node by walking up its ancestors. The nearest value wins, except
+// that the topmost final value cannot be overridden and local values are not inherited. It returns nil if the
+// attribute is set nowhere on the lineage.
+func (d *Daggo) EffectiveAttribute(nodeID int, key string) (*EffectiveValue, error) {
+	var value EffectiveValue
+
+	query := `
+		WITH RECURSIVE lineage AS (
+			SELECT id, parent_id, 0 AS depth
+			FROM dag
+			WHERE id = $1
+			UNION ALL
+			SELECT dag.id, dag.parent_id, lineage.depth + 1
+			FROM dag
+			JOIN lineage ON dag.id = lineage.parent_id
+		)
+		SELECT attr.value, attr.node_id, attr.rule
+		FROM dag_attr attr
+		JOIN lineage ON attr.node_id = lineage.id
+		WHERE attr.key = $2 AND (lineage.depth = 0 OR attr.rule <> 'local')
+		ORDER BY attr.rule = 'final' DESC, CASE WHEN attr.rule = 'final' THEN lineage.depth END DESC, lineage.depth ASC
+		LIMIT 1
+	`
+	err := d.db.Get(&value, query, nodeID, key)
+	if err == sql.ErrNoRows {
+		return nil, nil // The attribute is not set on the lineage
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to resolve attribute: %v", err)
+	}
+
+	return &value, nil
+}
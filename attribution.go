@@ -0,0 +1,94 @@
+package daggo
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/jmoiron/sqlx"
+)
+
+type actorKey struct{}
+
+// WithActor returns a context identifying the user or service performing the mutations run with it
+func WithActor(ctx context.Context, actor string) context.Context {
+	return context.WithValue(ctx, actorKey{}, actor)
+}
+
+// ActorFromContext returns the actor set with WithActor, or "" if there is none
+func ActorFromContext(ctx context.Context) string {
+	actor, _ := ctx.Value(actorKey{}).(string)
+	return actor
+}
+
+// WithAttribution records who created and last updated each node in the created_by and updated_by columns
+// (see CreateAttributionColumns). The actor comes from the context of the mutation when set with WithActor,
+// and defaults to defaultActor otherwise.
+func WithAttribution(defaultActor string) Option {
+	return func(d *Daggo) {
+		d.attribution = true
+		d.defaultActor = defaultActor
+	}
+}
+
+// Writes that do not name an actor explicitly are attributed to the daggo.actor setting of their transaction
+const createAttributionColumnsQuery = `
+	ALTER TABLE dag ADD COLUMN IF NOT EXISTS created_by TEXT;
+	ALTER TABLE dag ADD COLUMN IF NOT EXISTS updated_by TEXT;
+
+	CREATE OR REPLACE FUNCTION dag_attribute() RETURNS trigger AS $$
+	DECLARE
+		actor TEXT := nullif(current_setting('daggo.actor', true), '');
+	BEGIN
+		IF TG_OP = 'INSERT' THEN
+			NEW.created_by := COALESCE(NEW.created_by, actor);
+			NEW.updated_by := COALESCE(NEW.updated_by, NEW.created_by);
+		ELSE
+			NEW.created_by := OLD.created_by;
+			NEW.updated_by := COALESCE(actor, NEW.updated_by);
+		END IF;
+		RETURN NEW;
+	END;
+	$$ LANGUAGE plpgsql;
+
+	DROP TRIGGER IF EXISTS dag_attribute_trigger ON dag;
+	CREATE TRIGGER dag_attribute_trigger
+		BEFORE INSERT OR UPDATE ON dag
+		FOR EACH ROW EXECUTE FUNCTION dag_attribute();
+`
+
+// CreateAttributionColumns adds the created_by and updated_by columns to the dag table and installs the trigger
+// maintaining them. The history table records the updated_by of every change as its actor.
+func (d *Daggo) CreateAttributionColumns() error {
+	_, err := d.db.Exec(createAttributionColumnsQuery)
+	if err != nil {
+		return fmt.Errorf("failed to create attribution columns: %v", err)
+	}
+
+	return nil
+}
+
+// actor returns the actor of a mutation run with ctx, or "" when attribution is disabled
+func (d *Daggo) actor(ctx context.Context) string {
+	if !d.attribution {
+		return ""
+	}
+	if actor := ActorFromContext(ctx); actor != "" {
+		return actor
+	}
+	return d.defaultActor
+}
+
+// setTxActor makes the attribution trigger credit the writes of tx to the actor of ctx
+func (d *Daggo) setTxActor(ctx context.Context, tx *sqlx.Tx) error {
+	actor := d.actor(ctx)
+	if actor == "" {
+		return nil
+	}
+
+	_, err := tx.ExecContext(ctx, "SELECT set_config('daggo.actor', $1, true)", actor)
+	if err != nil {
+		return fmt.Errorf("failed to set actor: %v", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,146 @@
+package benchmarks
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"testing"
+
+	"daggo"
+	"daggo/daggotest"
+
+	"github.com/jmoiron/sqlx"
+	_ "github.com/lib/pq"
+)
+
+// setup connects to the benchmark database, started with testcontainers unless DAGGO_BENCH_DSN names one, and
+// empties the dag tables
+func setup(b *testing.B) (*daggo.Daggo, *sqlx.DB) {
+	b.Helper()
+
+	dsn := os.Getenv("DAGGO_BENCH_DSN")
+	if dsn == "" {
+		dsn = daggotest.PostgresDSN(b)
+	}
+
+	db, err := sqlx.Connect("postgres", dsn)
+	if err != nil {
+		b.Fatalf("failed to connect: %v", err)
+	}
+	b.Cleanup(func() { db.Close() })
+
+	d, err := daggo.NewDaggo(dsn)
+	if err != nil {
+		b.Fatalf("failed to create daggo: %v", err)
+	}
+	b.Cleanup(func() { d.Close() })
+
+	if err := d.Migrate(context.Background()); err != nil {
+		b.Fatalf("failed to migrate schema: %v", err)
+	}
+	if _, err := db.Exec("TRUNCATE dag, dag_edge"); err != nil {
+		b.Fatalf("failed to truncate dag tables: %v", err)
+	}
+
+	return d, db
+}
+
+// seedTree inserts a complete tree of the given depth and fan-out rooted at rootID with set-based SQL and
+// returns the number of nodes created
+func seedTree(b *testing.B, db *sqlx.DB, rootID int, depth int, fanOut int) int {
+	b.Helper()
+
+	if _, err := db.Exec("INSERT INTO dag (id, parent_id, root_id) VALUES ($1, NULL, $1)", rootID); err != nil {
+		b.Fatalf("failed to seed root: %v", err)
+	}
+
+	// Nodes of a level are numbered contiguously after the previous level
+	total, levelStart, levelSize, nextID := 1, rootID, 1, rootID+1
+	for level := 1; level <= depth; level++ {
+		query := `
+			INSERT INTO dag (id, parent_id, root_id)
+			SELECT $1 + (p - $2) * $3 + c, p, $4
+			FROM generate_series($2, $2 + $5 - 1) AS p, generate_series(0, $3 - 1) AS c
+		`
+		if _, err := db.Exec(query, nextID, levelStart, fanOut, rootID, levelSize); err != nil {
+			b.Fatalf("failed to seed level %d: %v", level, err)
+		}
+		levelStart, levelSize = nextID, levelSize*fanOut
+		nextID += levelSize
+		total += levelSize
+	}
+
+	return total
+}
+
+func BenchmarkAddRootNode(b *testing.B) {
+	d, _ := setup(b)
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := d.AddRootNode(i + 1); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkAddChildNode(b *testing.B) {
+	d, db := setup(b)
+	seedTree(b, db, 1, 0, 0)
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := d.AddChildNode(i+2, 1); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkDescendants(b *testing.B) {
+	shapes := []struct{ depth, fanOut int }{
+		{3, 10},
+		{5, 5},
+		{10, 2},
+		{2, 300},
+	}
+
+	for _, shape := range shapes {
+		b.Run(fmt.Sprintf("depth=%d/fanout=%d", shape.depth, shape.fanOut), func(b *testing.B) {
+			d, db := setup(b)
+			size := seedTree(b, db, 1, shape.depth, shape.fanOut)
+
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				nodes, err := d.Traverse(1, daggo.Down)
+				if err != nil {
+					b.Fatal(err)
+				}
+				if len(nodes) != size-1 {
+					b.Fatalf("expected %d descendants, got %d", size-1, len(nodes))
+				}
+			}
+			b.ReportMetric(float64(size), "nodes")
+		})
+	}
+}
+
+func BenchmarkDeleteSubtree(b *testing.B) {
+	for _, fanOut := range []int{10, 30} {
+		b.Run(fmt.Sprintf("depth=3/fanout=%d", fanOut), func(b *testing.B) {
+			d, db := setup(b)
+
+			for i := 0; i < b.N; i++ {
+				b.StopTimer()
+				if _, err := db.Exec("TRUNCATE dag, dag_edge"); err != nil {
+					b.Fatal(err)
+				}
+				seedTree(b, db, 1, 3, fanOut)
+				b.StartTimer()
+
+				if _, err := d.DeleteNodeAndDescendants(1); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
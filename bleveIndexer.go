@@ -0,0 +1,100 @@
+package daggo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+
+	"github.com/blevesearch/bleve/v2"
+	"github.com/blevesearch/bleve/v2/search/query"
+)
+
+// BleveIndexer indexes nodes in an embedded Bleve index, for deployments without a search cluster
+type BleveIndexer struct {
+	index bleve.Index
+}
+
+// NewBleveIndexer returns an indexer writing to index, which the caller closes
+func NewBleveIndexer(index bleve.Index) *BleveIndexer {
+	return &BleveIndexer{index: index}
+}
+
+// OpenBleveIndexer opens the Bleve index stored at path, creating it with the default mapping when it does not
+// exist. Close releases it.
+func OpenBleveIndexer(path string) (*BleveIndexer, error) {
+	index, err := bleve.Open(path)
+	if errors.Is(err, bleve.ErrorIndexPathDoesNotExist) {
+		index, err = bleve.New(path, bleve.NewIndexMapping())
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to open search index: %v", err)
+	}
+
+	return &BleveIndexer{index: index}, nil
+}
+
+// Close closes the index
+func (b *BleveIndexer) Close() error {
+	return b.index.Close()
+}
+
+// Index creates or replaces the given documents in one batch
+func (b *BleveIndexer) Index(ctx context.Context, docs []SearchDocument) error {
+	if len(docs) == 0 {
+		return nil
+	}
+
+	batch := b.index.NewBatch()
+	for _, doc := range docs {
+		err := batch.Index(strconv.Itoa(doc.NodeID), doc)
+		if err != nil {
+			return fmt.Errorf("failed to index node %d: %v", doc.NodeID, err)
+		}
+	}
+
+	return b.index.Batch(batch)
+}
+
+// Delete removes the documents of the given node IDs in one batch
+func (b *BleveIndexer) Delete(ctx context.Context, nodeIDs []int) error {
+	if len(nodeIDs) == 0 {
+		return nil
+	}
+
+	batch := b.index.NewBatch()
+	for _, id := range nodeIDs {
+		batch.Delete(strconv.Itoa(id))
+	}
+
+	return b.index.Batch(batch)
+}
+
+// Search runs a query string query over the document fields
+func (b *BleveIndexer) Search(ctx context.Context, queryString string, rootID int, limit int) ([]int, error) {
+	var q query.Query = bleve.NewQueryStringQuery(queryString)
+	if rootID != 0 {
+		// Numbers are indexed as float64
+		value := float64(rootID)
+		inclusive := true
+		graph := bleve.NewNumericRangeInclusiveQuery(&value, &value, &inclusive, &inclusive)
+		graph.SetField("root_id")
+		q = bleve.NewConjunctionQuery(q, graph)
+	}
+
+	result, err := b.index.SearchInContext(ctx, bleve.NewSearchRequestOptions(q, limit, 0, false))
+	if err != nil {
+		return nil, err
+	}
+
+	ids := make([]int, 0, len(result.Hits))
+	for _, hit := range result.Hits {
+		id, err := strconv.Atoi(hit.ID)
+		if err != nil {
+			return nil, fmt.Errorf("invalid document ID %q in search index", hit.ID)
+		}
+		ids = append(ids, id)
+	}
+
+	return ids, nil
+}
@@ -0,0 +1,239 @@
+package daggo
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// BootstrapOptions tune Bootstrap; the zero value migrates the core schema and checks the database
+type BootstrapOptions struct {
+	// Features also creates the tables of the optional features, as InitSchema does
+	Features bool
+	// SeedDemo adds a small demo graph rooted at node 1 when the database has no nodes yet
+	SeedDemo bool
+}
+
+// ReadinessCheck is the outcome of one step of Bootstrap
+type ReadinessCheck struct {
+	Name   string `json:"name"`
+	OK     bool   `json:"ok"`
+	Detail string `json:"detail,omitempty"`
+}
+
+// ReadinessReport tells whether a database is ready for the library, step by step
+type ReadinessReport struct {
+	SchemaVersion int              `json:"schema_version"`
+	Checks        []ReadinessCheck `json:"checks"`
+	// DemoRootID is the root of the demo graph seeded by Bootstrap, 0 when none was
+	DemoRootID int           `json:"demo_root_id,omitempty"`
+	Duration   time.Duration `json:"duration"`
+}
+
+// Ready reports whether every check passed
+func (r *ReadinessReport) Ready() bool {
+	for _, check := range r.Checks {
+		if !check.OK {
+			return false
+		}
+	}
+	return true
+}
+
+// String lists the checks one per line, e.g. "ok      schema: version 7"
+func (r *ReadinessReport) String() string {
+	var b strings.Builder
+	for _, check := range r.Checks {
+		status := "ok"
+		if !check.OK {
+			status = "FAILED"
+		}
+		fmt.Fprintf(&b, "%-7s %s", status, check.Name)
+		if check.Detail != "" {
+			fmt.Fprintf(&b, ": %s", check.Detail)
+		}
+		b.WriteString("\n")
+	}
+	return b.String()
+}
+
+// add records the outcome of a step
+func (r *ReadinessReport) add(name string, err error, detail string) {
+	check := ReadinessCheck{Name: name, OK: err == nil, Detail: detail}
+	if err != nil {
+		check.Detail = err.Error()
+	}
+	r.Checks = append(r.Checks, check)
+}
+
+// coreIndexesQuery recreates the indexes of the core schema that a database adopted with hand-written tables
+// may lack
+const coreIndexesQuery = `
+	CREATE INDEX IF NOT EXISTS dag_parent_id_idx ON dag (parent_id);
+	CREATE INDEX IF NOT EXISTS dag_root_id_idx ON dag (root_id);
+	CREATE INDEX IF NOT EXISTS dag_edge_child_id_idx ON dag_edge (child_id);
+` + createPayloadIndexQuery
+
+// Index builds that failed, e.g. concurrent ones, leave invalid indexes the planner ignores
+const invalidIndexesQuery = `
+	SELECT idx.relname
+	FROM pg_index
+	JOIN pg_class idx ON idx.oid = pg_index.indexrelid
+	JOIN pg_class tbl ON tbl.oid = pg_index.indrelid
+	WHERE tbl.relname LIKE 'dag%' AND NOT pg_index.indisvalid
+	ORDER BY idx.relname
+`
+
+// The privileges writes need; several privileges passed at once to has_table_privilege only need one of them
+const missingPrivilegesQuery = `
+	SELECT tbl.name || ' ' || p.privilege
+	FROM (VALUES ('dag'), ('dag_edge')) AS tbl(name)
+	CROSS JOIN (VALUES ('SELECT'), ('INSERT'), ('UPDATE'), ('DELETE')) AS p(privilege)
+	WHERE NOT has_table_privilege(tbl.name, p.privilege)
+	UNION ALL
+	SELECT 'dag_id_seq USAGE' WHERE NOT has_sequence_privilege('dag_id_seq', 'USAGE')
+	UNION ALL
+	SELECT 'schema CREATE' WHERE NOT has_schema_privilege(current_schema(), 'CREATE')
+`
+
+// Bootstrap prepares a database for the library in one call: it checks the connection, runs Migrate, or
+// InitSchema with Features, recreates missing core indexes, verifies the privileges of the current user and
+// optionally seeds a demo graph, so that a new deployment goes from go get to a working system at once. It
+// returns an error when a step that later ones depend on fails, and otherwise reports failed checks in the
+// readiness report, e.g. missing privileges. It is idempotent.
+func (d *Daggo) Bootstrap(ctx context.Context, opts BootstrapOptions) (*ReadinessReport, error) {
+	start := time.Now()
+	report := &ReadinessReport{Checks: make([]ReadinessCheck, 0)}
+	defer func() {
+		report.Duration = time.Since(start)
+	}()
+
+	err := d.db.PingContext(ctx)
+	report.add("connection", err, d.Dialect().Name())
+	if err != nil {
+		return report, fmt.Errorf("failed to connect: %v", err)
+	}
+
+	if opts.Features {
+		err = d.InitSchema(ctx)
+	} else {
+		err = d.Migrate(ctx)
+	}
+	if err != nil {
+		report.add("schema", err, "")
+		return report, err
+	}
+	detail := fmt.Sprintf("%s tables created", d.Dialect().Name())
+	if d.Dialect() == DialectPostgres {
+		report.SchemaVersion, err = d.SchemaVersion(ctx)
+		if err != nil {
+			report.add("schema", err, "")
+			return report, err
+		}
+		detail = fmt.Sprintf("version %d", report.SchemaVersion)
+	}
+	report.add("schema", nil, detail)
+
+	// The other dialects have no version tracking nor privilege functions to check against
+	if d.Dialect() == DialectPostgres {
+		detail, err = d.checkIndexes(ctx)
+		report.add("indexes", err, detail)
+		detail, err = d.checkPrivileges(ctx)
+		report.add("permissions", err, detail)
+	}
+
+	if opts.SeedDemo {
+		rootID, err := d.seedDemoGraph(ctx)
+		detail := "skipped, the database already has nodes"
+		if rootID != 0 {
+			report.DemoRootID = rootID
+			detail = fmt.Sprintf("graph rooted at node %d", rootID)
+		}
+		report.add("demo graph", err, detail)
+	}
+
+	return report, nil
+}
+
+// checkIndexes recreates the missing core indexes and reports the invalid ones
+func (d *Daggo) checkIndexes(ctx context.Context) (string, error) {
+	_, err := d.db.ExecContext(ctx, coreIndexesQuery)
+	if err != nil {
+		return "", fmt.Errorf("failed to create indexes: %v", err)
+	}
+
+	invalid := make([]string, 0)
+	err = d.db.SelectContext(ctx, &invalid, invalidIndexesQuery)
+	if err != nil {
+		return "", fmt.Errorf("failed to check indexes: %v", err)
+	}
+	if len(invalid) > 0 {
+		return "", fmt.Errorf("invalid indexes, drop and recreate them: %s", strings.Join(invalid, ", "))
+	}
+
+	return "core indexes valid", nil
+}
+
+// checkPrivileges reports the privileges the current user lacks
+func (d *Daggo) checkPrivileges(ctx context.Context) (string, error) {
+	missing := make([]string, 0)
+	err := d.db.SelectContext(ctx, &missing, missingPrivilegesQuery)
+	if err != nil {
+		return "", fmt.Errorf("failed to check privileges: %v", err)
+	}
+	if len(missing) > 0 {
+		return "", fmt.Errorf("missing privileges: %s", strings.Join(missing, ", "))
+	}
+
+	return "read, write and create tables", nil
+}
+
+// seedDemoGraph adds a small graph, a diamond of tasks below a project, when the database has no nodes, and
+// returns its root ID or 0 when it did not
+func (d *Daggo) seedDemoGraph(ctx context.Context) (int, error) {
+	var count int
+	err := d.db.GetContext(ctx, &count, "SELECT count(*) FROM dag")
+	if err != nil {
+		return 0, fmt.Errorf("failed to count nodes: %v", err)
+	}
+	if count > 0 {
+		return 0, nil
+	}
+
+	names := map[int]string{1: "project", 2: "design", 3: "build", 4: "test", 5: "release"}
+	err = d.Tx(ctx, func(txDaggo *Daggo) error {
+		err := txDaggo.AddRootNodeContext(ctx, 1)
+		if err != nil {
+			return err
+		}
+		for _, edge := range [][2]int{{1, 2}, {1, 3}, {2, 4}, {4, 5}} {
+			err = txDaggo.AddChildNodeContext(ctx, edge[1], edge[0])
+			if err != nil {
+				return err
+			}
+		}
+		// Testing waits for both the design and the build
+		err = txDaggo.AddEdgeContext(ctx, 3, 4)
+		if err != nil {
+			return err
+		}
+
+		// Payloads need the JSONB column of Postgres
+		if txDaggo.Dialect() != DialectPostgres {
+			return nil
+		}
+		for id := 1; id <= len(names); id++ {
+			err = txDaggo.SetNodePayloadContext(ctx, id, map[string]string{"name": names[id]})
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to seed demo graph: %v", err)
+	}
+
+	return 1, nil
+}
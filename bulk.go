@@ -0,0 +1,293 @@
+package daggo
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"sort"
+
+	"github.com/lib/pq"
+)
+
+// NewNode describes a node inserted by AddNodesBulk
+type NewNode struct {
+	ID int
+	// ParentIDs lists the parents of the node, the first being its primary parent; none makes it a root
+	ParentIDs []int
+	// Payload is stored, encoded as JSON, as the payload of the node when not nil
+	Payload interface{}
+	// Type is a node type registered with RegisterNodeType, whose schema the payload must match, recorded on the
+	// node as by SetTypedNodePayload; empty for untyped nodes
+	Type string
+}
+
+// bulkPlan is a validated batch of new nodes, ready to be inserted once its external parents are resolved
+type bulkPlan struct {
+	nodes map[int]NewNode
+	// order lists the IDs of the batch so that every node comes after its parents in the batch
+	order []int
+	// external lists the parents outside of the batch in ascending order
+	external []int
+}
+
+// planBulk validates nodes on their own: IDs are unique, edges are neither self edges nor duplicated, and the
+// edges between nodes of the batch have no cycle
+func planBulk(nodes []NewNode) (*bulkPlan, error) {
+	plan := &bulkPlan{nodes: make(map[int]NewNode, len(nodes))}
+	for _, node := range nodes {
+		if _, ok := plan.nodes[node.ID]; ok {
+			return nil, fmt.Errorf("node %d appears more than once in the batch", node.ID)
+		}
+		plan.nodes[node.ID] = node
+	}
+
+	children := make(map[int][]int)
+	pending := make(map[int]int, len(nodes))
+	external := make(map[int]bool)
+	for _, node := range nodes {
+		seen := make(map[int]bool, len(node.ParentIDs))
+		for _, parentID := range node.ParentIDs {
+			if parentID == node.ID {
+				return nil, fmt.Errorf("%w: node %d", ErrSelfEdge, node.ID)
+			}
+			if seen[parentID] {
+				return nil, fmt.Errorf("%w: from %d to %d", ErrDuplicateEdge, parentID, node.ID)
+			}
+			seen[parentID] = true
+
+			if _, ok := plan.nodes[parentID]; ok {
+				children[parentID] = append(children[parentID], node.ID)
+				pending[node.ID]++
+			} else {
+				external[parentID] = true
+			}
+		}
+	}
+	for id := range external {
+		plan.external = append(plan.external, id)
+	}
+	sort.Ints(plan.external)
+
+	// Kahn's algorithm orders the batch, unless some of its nodes lie on a cycle
+	queue := make([]int, 0)
+	for _, node := range nodes {
+		if pending[node.ID] == 0 {
+			queue = append(queue, node.ID)
+		}
+	}
+	for len(queue) > 0 {
+		id := queue[0]
+		queue = queue[1:]
+		plan.order = append(plan.order, id)
+
+		for _, childID := range children[id] {
+			pending[childID]--
+			if pending[childID] == 0 {
+				queue = append(queue, childID)
+			}
+		}
+	}
+	if len(plan.order) < len(nodes) {
+		return nil, fmt.Errorf("%w: batch contains a cycle", ErrCycleDetected)
+	}
+
+	return plan, nil
+}
+
+// AddNodesBulk inserts nodes in one transaction with a single statement per table, which is much faster than
+// adding them one at a time. The whole batch is validated before anything is written: its IDs must be unique
+// and not exist yet, the parents of every node must exist or be in the batch and belong to the same graph, and
+// the batch may not contain cycles. Nodes may be given in any order.
+func (d *Daggo) AddNodesBulk(nodes []NewNode) error {
+	return d.AddNodesBulkContext(context.Background(), nodes)
+}
+
+// AddNodesBulkContext is AddNodesBulk with a context bounding its queries
+func (d *Daggo) AddNodesBulkContext(ctx context.Context, nodes []NewNode) error {
+	if len(nodes) == 0 {
+		return nil
+	}
+
+	plan, err := planBulk(nodes)
+	if err != nil {
+		return err
+	}
+
+	encoded := make(map[int]string)
+	typed := false
+	for _, node := range nodes {
+		if node.Type != "" {
+			typed = true
+			err = d.validateData(node.Type, node.Payload)
+			if err != nil {
+				return fmt.Errorf("node %d: %w", node.ID, err)
+			}
+		}
+		if node.Payload == nil {
+			continue
+		}
+		payload, err := json.Marshal(node.Payload)
+		if err != nil {
+			return fmt.Errorf("failed to encode payload of node %d: %v", node.ID, err)
+		}
+		encoded[node.ID] = string(payload)
+	}
+
+	// Start a transaction
+	tx, err := d.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %v", err)
+	}
+	defer func() {
+		// Rollback the transaction if it failed to commit
+		if p := recover(); p != nil {
+			tx.Rollback()
+			panic(p)
+		} else if err != nil {
+			tx.Rollback()
+		}
+	}()
+
+	err = d.setTxActor(ctx, tx)
+	if err != nil {
+		return err
+	}
+
+	ids := make([]int, 0, len(nodes))
+	for _, node := range nodes {
+		ids = append(ids, node.ID)
+	}
+	existing := make([]int, 0)
+	err = tx.SelectContext(ctx, &existing, "SELECT id FROM dag WHERE id = ANY($1) ORDER BY id", pq.Array(ids))
+	if err != nil {
+		return fmt.Errorf("failed to check for existing nodes: %v", err)
+	}
+	if len(existing) > 0 {
+		err = fmt.Errorf("%w: %v", ErrNodeExists, existing)
+		return err
+	}
+
+	// Lock the parents outside of the batch so that they cannot be deleted or moved before the insert
+	rootOf := make(map[int]int, len(nodes)+len(plan.external))
+	if len(plan.external) > 0 {
+		parents := make([]DagNode, 0, len(plan.external))
+		query := "SELECT * FROM dag WHERE id = ANY($1) ORDER BY id FOR SHARE"
+		err = tx.SelectContext(ctx, &parents, query, pq.Array(plan.external))
+		if err != nil {
+			return fmt.Errorf("failed to get parent nodes: %v", err)
+		}
+		for _, parent := range parents {
+			rootOf[parent.ID] = parent.RootID
+		}
+		for _, parentID := range plan.external {
+			if _, ok := rootOf[parentID]; !ok {
+				err = fmt.Errorf("%w: %d", ErrParentNotFound, parentID)
+				return err
+			}
+		}
+	}
+
+	nodeIDs := make([]int, 0, len(nodes))
+	primaryIDs := make([]sql.NullInt64, 0, len(nodes))
+	rootIDs := make([]int, 0, len(nodes))
+	nodePayloads := make([]string, 0, len(nodes))
+	nodeTypes := make([]sql.NullString, 0, len(nodes))
+	edgeParentIDs := make([]int, 0)
+	edgeChildIDs := make([]int, 0)
+	newNodes := make(map[int]int64)
+	for _, id := range plan.order {
+		node := plan.nodes[id]
+
+		if len(node.ParentIDs) == 0 {
+			rootOf[id] = id
+			primaryIDs = append(primaryIDs, sql.NullInt64{})
+		} else {
+			rootOf[id] = rootOf[node.ParentIDs[0]]
+			for _, parentID := range node.ParentIDs[1:] {
+				if rootOf[parentID] != rootOf[id] {
+					err = fmt.Errorf("parents %d and %d of node %d belong to different graphs", node.ParentIDs[0], parentID, id)
+					return err
+				}
+				// The trigger mirrors primary parents into dag_edge, the others are inserted explicitly
+				edgeParentIDs = append(edgeParentIDs, parentID)
+				edgeChildIDs = append(edgeChildIDs, id)
+			}
+			primaryIDs = append(primaryIDs, sql.NullInt64{Int64: int64(node.ParentIDs[0]), Valid: true})
+		}
+		nodeIDs = append(nodeIDs, id)
+		rootIDs = append(rootIDs, rootOf[id])
+		newNodes[rootOf[id]]++
+
+		payload, ok := encoded[id]
+		if !ok {
+			payload = "{}"
+		}
+		nodePayloads = append(nodePayloads, payload)
+		nodeTypes = append(nodeTypes, sql.NullString{String: node.Type, Valid: node.Type != ""})
+	}
+
+	// Refuse the insert if it would exceed the graph or tenant quotas
+	if d.enforceQuotas {
+		for rootID, count := range newNodes {
+			err = checkQuota(ctx, tx, rootID, count)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	// The payload and node type columns are only written when payloads or types are given, so that they are not
+	// required otherwise
+	switch {
+	case typed:
+		_, err = tx.ExecContext(ctx, `
+			INSERT INTO dag (id, parent_id, root_id, payload, node_type)
+			SELECT * FROM unnest($1::int[], $2::int[], $3::int[], $4::jsonb[], $5::text[])
+		`, pq.Array(nodeIDs), pq.Array(primaryIDs), pq.Array(rootIDs), pq.Array(nodePayloads), pq.Array(nodeTypes))
+	case len(encoded) == 0:
+		_, err = tx.ExecContext(ctx, `
+			INSERT INTO dag (id, parent_id, root_id)
+			SELECT * FROM unnest($1::int[], $2::int[], $3::int[])
+		`, pq.Array(nodeIDs), pq.Array(primaryIDs), pq.Array(rootIDs))
+	default:
+		_, err = tx.ExecContext(ctx, `
+			INSERT INTO dag (id, parent_id, root_id, payload)
+			SELECT * FROM unnest($1::int[], $2::int[], $3::int[], $4::jsonb[])
+		`, pq.Array(nodeIDs), pq.Array(primaryIDs), pq.Array(rootIDs), pq.Array(nodePayloads))
+	}
+	if err != nil {
+		return fmt.Errorf("failed to add nodes: %v", err)
+	}
+
+	if len(edgeParentIDs) > 0 {
+		_, err = tx.ExecContext(ctx, `
+			INSERT INTO dag_edge (parent_id, child_id)
+			SELECT * FROM unnest($1::int[], $2::int[])
+		`, pq.Array(edgeParentIDs), pq.Array(edgeChildIDs))
+		if err != nil {
+			return fmt.Errorf("failed to add edges: %v", err)
+		}
+	}
+
+	if d.notifications {
+		events := make([]DagEvent, 0, len(plan.order))
+		for i, id := range nodeIDs {
+			events = append(events, DagEvent{Kind: DagEventNodeAdded, NodeID: id, RootID: rootIDs[i], ParentIDs: plan.nodes[id].ParentIDs})
+		}
+		err = d.notify(ctx, tx, events...)
+		if err != nil {
+			return err
+		}
+	}
+
+	// Commit the transaction
+	err = tx.Commit()
+	if err != nil {
+		return fmt.Errorf("failed to commit transaction: %v", err)
+	}
+
+	d.InvalidatePlanCache()
+
+	return nil
+}
@@ -0,0 +1,101 @@
+package daggo
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestPlanBulk(t *testing.T) {
+	tests := []struct {
+		name         string
+		nodes        []NewNode
+		wantErr      bool
+		errIs        error
+		wantExternal []int
+	}{
+		{
+			name:  "roots only",
+			nodes: []NewNode{{ID: 1}, {ID: 2}},
+		},
+		{
+			name:  "children before parents",
+			nodes: []NewNode{{ID: 3, ParentIDs: []int{2}}, {ID: 2, ParentIDs: []int{1}}, {ID: 1}},
+		},
+		{
+			name:  "several parents in the batch",
+			nodes: []NewNode{{ID: 4, ParentIDs: []int{2, 3}}, {ID: 2, ParentIDs: []int{1}}, {ID: 3, ParentIDs: []int{1}}, {ID: 1}},
+		},
+		{
+			name:         "external parents",
+			nodes:        []NewNode{{ID: 10, ParentIDs: []int{7}}, {ID: 11, ParentIDs: []int{10, 5}}, {ID: 12, ParentIDs: []int{7}}},
+			wantExternal: []int{5, 7},
+		},
+		{
+			name:    "duplicate ID",
+			nodes:   []NewNode{{ID: 1}, {ID: 1}},
+			wantErr: true,
+		},
+		{
+			name:    "self edge",
+			nodes:   []NewNode{{ID: 1, ParentIDs: []int{1}}},
+			wantErr: true,
+			errIs:   ErrSelfEdge,
+		},
+		{
+			name:    "duplicate edge",
+			nodes:   []NewNode{{ID: 1}, {ID: 2, ParentIDs: []int{1, 1}}},
+			wantErr: true,
+			errIs:   ErrDuplicateEdge,
+		},
+		{
+			name:    "cycle",
+			nodes:   []NewNode{{ID: 1, ParentIDs: []int{3}}, {ID: 2, ParentIDs: []int{1}}, {ID: 3, ParentIDs: []int{2}}},
+			wantErr: true,
+			errIs:   ErrCycleDetected,
+		},
+		{
+			name:    "cycle below a root",
+			nodes:   []NewNode{{ID: 1}, {ID: 2, ParentIDs: []int{1, 3}}, {ID: 3, ParentIDs: []int{2}}},
+			wantErr: true,
+			errIs:   ErrCycleDetected,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			plan, err := planBulk(tt.nodes)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("planBulk succeeded, want an error")
+				}
+				if tt.errIs != nil && !errors.Is(err, tt.errIs) {
+					t.Fatalf("planBulk error = %v, want %v", err, tt.errIs)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("planBulk failed: %v", err)
+			}
+
+			if len(plan.order) != len(tt.nodes) {
+				t.Fatalf("plan orders %d nodes, want %d", len(plan.order), len(tt.nodes))
+			}
+			position := make(map[int]int, len(plan.order))
+			for i, id := range plan.order {
+				position[id] = i
+			}
+			for _, node := range tt.nodes {
+				for _, parentID := range node.ParentIDs {
+					if _, inBatch := position[parentID]; inBatch && position[parentID] > position[node.ID] {
+						t.Errorf("node %d is ordered before its parent %d", node.ID, parentID)
+					}
+				}
+			}
+
+			if !reflect.DeepEqual(plan.external, tt.wantExternal) {
+				t.Errorf("external parents = %v, want %v", plan.external, tt.wantExternal)
+			}
+		})
+	}
+}
@@ -0,0 +1,297 @@
+package daggo
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+)
+
+// BundleFormatVersion is the version of the .daggo bundle layout written by Pack
+const BundleFormatVersion = 1
+
+// BundleManifest describes a graph template
+type BundleManifest struct {
+	FormatVersion int       `json:"format_version"`
+	Name          string    `json:"name"`
+	Description   string    `json:"description,omitempty"`
+	Labels        []string  `json:"labels,omitempty"`
+	CreatedAt     time.Time `json:"created_at"`
+}
+
+// BundleNode is a node of a template. Keys are local to the bundle; the node with key 0 is the root.
+type BundleNode struct {
+	Key    int  `json:"key"`
+	Parent *int `json:"parent,omitempty"`
+}
+
+// Bundle is a portable graph template: its structure, the schemas of its payloads and its metadata.
+// It is stored as a zip archive (.daggo) holding manifest.json, graph.json and schemas/<type>.json.
+type Bundle struct {
+	Manifest BundleManifest
+	Nodes    []BundleNode
+	Schemas  map[string]json.RawMessage
+}
+
+// Pack writes the bundle to w as a .daggo archive
+func Pack(w io.Writer, bundle *Bundle) error {
+	zw := zip.NewWriter(w)
+
+	manifest := bundle.Manifest
+	manifest.FormatVersion = BundleFormatVersion
+	files := []struct {
+		name  string
+		value interface{}
+	}{
+		{"manifest.json", manifest},
+		{"graph.json", bundle.Nodes},
+	}
+	typeNames := make([]string, 0, len(bundle.Schemas))
+	for name := range bundle.Schemas {
+		typeNames = append(typeNames, name)
+	}
+	sort.Strings(typeNames)
+	for _, name := range typeNames {
+		files = append(files, struct {
+			name  string
+			value interface{}
+		}{"schemas/" + name + ".json", bundle.Schemas[name]})
+	}
+
+	for _, file := range files {
+		fw, err := zw.Create(file.name)
+		if err != nil {
+			return fmt.Errorf("failed to write %s: %v", file.name, err)
+		}
+		encoder := json.NewEncoder(fw)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(file.value); err != nil {
+			return fmt.Errorf("failed to write %s: %v", file.name, err)
+		}
+	}
+
+	return zw.Close()
+}
+
+// Unpack reads a .daggo archive written by Pack
+func Unpack(r io.Reader) (*Bundle, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read bundle: %v", err)
+	}
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, fmt.Errorf("failed to open bundle: %v", err)
+	}
+
+	bundle := &Bundle{Schemas: make(map[string]json.RawMessage)}
+	var hasManifest, hasGraph bool
+	for _, file := range zr.File {
+		var target interface{}
+		switch {
+		case file.Name == "manifest.json":
+			target, hasManifest = &bundle.Manifest, true
+		case file.Name == "graph.json":
+			target, hasGraph = &bundle.Nodes, true
+		case strings.HasPrefix(file.Name, "schemas/") && strings.HasSuffix(file.Name, ".json"):
+			var schema json.RawMessage
+			name := strings.TrimSuffix(strings.TrimPrefix(file.Name, "schemas/"), ".json")
+			if err := readZipJSON(file, &schema); err != nil {
+				return nil, err
+			}
+			bundle.Schemas[name] = schema
+			continue
+		default:
+			continue // Unknown files are ignored for forward compatibility
+		}
+		if err := readZipJSON(file, target); err != nil {
+			return nil, err
+		}
+	}
+
+	if !hasManifest || !hasGraph {
+		return nil, fmt.Errorf("bundle is missing manifest.json or graph.json")
+	}
+	if bundle.Manifest.FormatVersion > BundleFormatVersion {
+		return nil, fmt.Errorf("unsupported bundle format version %d", bundle.Manifest.FormatVersion)
+	}
+
+	return bundle, nil
+}
+
+func readZipJSON(file *zip.File, target interface{}) error {
+	rc, err := file.Open()
+	if err != nil {
+		return fmt.Errorf("failed to read %s: %v", file.Name, err)
+	}
+	defer rc.Close()
+
+	if err := json.NewDecoder(rc).Decode(target); err != nil {
+		return fmt.Errorf("failed to decode %s: %v", file.Name, err)
+	}
+	return nil
+}
+
+// ExportBundle captures the graph rooted at rootID as a template, with its metadata when it is registered
+// and the schemas of every registered node type
+func (d *Daggo) ExportBundle(rootID int) (*Bundle, error) {
+	nodes := make([]DagNode, 0)
+	query := `
+		WITH RECURSIVE bfs AS (
+			SELECT id, 0 AS depth FROM dag WHERE id = $1
+			UNION ALL
+			SELECT dag.id, bfs.depth + 1 FROM dag JOIN bfs ON dag.parent_id = bfs.id
+		)
+		SELECT dag.* FROM dag JOIN bfs ON dag.id = bfs.id ORDER BY bfs.depth ASC, dag.id ASC
+	`
+	err := d.db.Select(&nodes, query, rootID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get graph nodes: %v", err)
+	}
+	if len(nodes) == 0 {
+		return nil, fmt.Errorf("%w: %d", ErrNodeNotFound, rootID)
+	}
+
+	bundle := &Bundle{
+		Manifest: BundleManifest{FormatVersion: BundleFormatVersion, Name: fmt.Sprintf("graph %d", rootID), CreatedAt: time.Now().UTC()},
+		Nodes:    make([]BundleNode, 0, len(nodes)),
+		Schemas:  make(map[string]json.RawMessage),
+	}
+
+	keys := make(map[int]int, len(nodes))
+	for i, node := range nodes {
+		keys[node.ID] = i
+		bundleNode := BundleNode{Key: i}
+		if i > 0 && node.ParentID.Valid {
+			parentKey := keys[int(node.ParentID.Int64)]
+			bundleNode.Parent = &parentKey
+		}
+		bundle.Nodes = append(bundle.Nodes, bundleNode)
+	}
+
+	graph, err := d.GetGraph(rootID)
+	if err != nil && !isUndefinedTable(err) {
+		return nil, err
+	}
+	if graph != nil {
+		bundle.Manifest.Name = graph.Name
+		bundle.Manifest.Description = graph.Description
+		bundle.Manifest.Labels = graph.Labels
+	}
+
+	d.mu.RLock()
+	for name, schema := range d.nodeTypes {
+		raw, err := json.Marshal(schema)
+		if err == nil {
+			bundle.Schemas[name] = raw
+		}
+	}
+	d.mu.RUnlock()
+
+	return bundle, nil
+}
+
+// InstantiateBundle creates a new graph from a template, numbering its nodes from rootID in key order, and
+// registers the node types of the bundle. It returns the mapping from bundle keys to node IDs.
+func (d *Daggo) InstantiateBundle(bundle *Bundle, rootID int) (map[int]int, error) {
+	for name, schema := range bundle.Schemas {
+		if err := d.RegisterNodeType(name, schema); err != nil {
+			return nil, err
+		}
+	}
+
+	keys := make([]int, 0, len(bundle.Nodes))
+	seen := make(map[int]bool, len(bundle.Nodes))
+	for _, node := range bundle.Nodes {
+		if node.Key < 0 || seen[node.Key] {
+			return nil, fmt.Errorf("invalid or duplicate bundle key %d", node.Key)
+		}
+		seen[node.Key] = true
+		keys = append(keys, node.Key)
+	}
+	if !seen[0] {
+		return nil, fmt.Errorf("bundle has no root node")
+	}
+	sort.Ints(keys)
+	ids := make(map[int]int, len(keys))
+	for i, key := range keys {
+		ids[key] = rootID + i
+	}
+
+	events := make([]Event, 0, len(bundle.Nodes))
+	added := make(map[int]bool, len(bundle.Nodes))
+	// Parents are added before their children; the bundle keeps them in that order but is not trusted to
+	for len(added) < len(bundle.Nodes) {
+		progress := false
+		for _, node := range bundle.Nodes {
+			if added[node.Key] {
+				continue
+			}
+			event := Event{Kind: EventNodeAdded, NodeID: ids[node.Key]}
+			if node.Key != 0 {
+				if node.Parent == nil {
+					return nil, fmt.Errorf("bundle node %d has no parent", node.Key)
+				}
+				parentID, ok := ids[*node.Parent]
+				if !ok {
+					return nil, fmt.Errorf("bundle node %d has unknown parent %d", node.Key, *node.Parent)
+				}
+				if !added[*node.Parent] {
+					continue
+				}
+				event.ParentID.Int64, event.ParentID.Valid = int64(parentID), true
+			}
+			events = append(events, event)
+			added[node.Key] = true
+			progress = true
+		}
+		if !progress {
+			return nil, fmt.Errorf("%w: bundle graph contains a cycle", ErrCycleDetected)
+		}
+	}
+
+	// Apply the structure in one transaction without recording it in the event log
+	tx, err := d.db.Beginx()
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %v", err)
+	}
+	defer func() {
+		// Rollback the transaction if it failed to commit
+		if p := recover(); p != nil {
+			tx.Rollback()
+			panic(p)
+		} else if err != nil {
+			tx.Rollback()
+		}
+	}()
+
+	for _, event := range events {
+		_, err = projectEvent(context.Background(), tx, event)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// Refuse the graph if it exceeds the quota set for it ahead of its creation
+	if d.enforceQuotas {
+		err = checkQuota(context.Background(), tx, rootID, 0)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// Commit the transaction
+	err = tx.Commit()
+	if err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %v", err)
+	}
+
+	d.InvalidatePlanCache()
+
+	return ids, nil
+}
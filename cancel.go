@@ -0,0 +1,64 @@
+package daggo
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+)
+
+// Operation kinds used to tag the long-running queries daggo issues
+const (
+	OpTraverse     = "traverse"
+	OpDescendants  = "descendants"
+	OpAncestors    = "ancestors"
+	OpLoadDag      = "load_dag"
+	OpWalk         = "walk"
+	OpShortestPath = "shortest_path"
+	OpPath         = "path"
+	OpScan         = "scan"
+)
+
+// WithOperation returns a context tagging the queries run with it with the given operation kind, so they can
+// be cancelled with CancelRunning
+func WithOperation(ctx context.Context, op string) context.Context {
+	return WithQueryTags(ctx, map[string]string{"op": op})
+}
+
+// WithApplicationName sets the Postgres application_name of every connection and tags every query with it,
+// scoping CancelRunning to the queries of this application. It implies WithSQLComments.
+func WithApplicationName(name string) Option {
+	return func(d *Daggo) {
+		d.applicationName = name
+		d.sqlComments = true
+		if d.staticQueryTags == nil {
+			d.staticQueryTags = make(map[string]string)
+		}
+		d.staticQueryTags["application"] = name
+	}
+}
+
+// CancelRunning cancels the in-flight queries tagged with the given operation kind using pg_cancel_backend and
+// returns how many were cancelled, giving operators a way to shed load during incidents. Queries are only
+// tagged when the Daggo was created with WithSQLComments or WithApplicationName.
+func (d *Daggo) CancelRunning(ctx context.Context, opKind string) (int, error) {
+	if !d.sqlComments {
+		return 0, fmt.Errorf("queries are not tagged: enable WithSQLComments or WithApplicationName")
+	}
+
+	var cancelled int
+	query := `
+		SELECT count(*) FILTER (WHERE pg_cancel_backend(pid))
+		FROM pg_stat_activity
+		WHERE pid <> pg_backend_pid()
+			AND state = 'active'
+			AND strpos(query, $1) > 0
+			AND ($2 = '' OR application_name = $2)
+	`
+	tag := fmt.Sprintf("op='%s'", url.QueryEscape(opKind))
+	err := d.db.GetContext(ctx, &cancelled, query, tag, d.applicationName)
+	if err != nil {
+		return 0, fmt.Errorf("failed to cancel running queries: %v", err)
+	}
+
+	return cancelled, nil
+}
@@ -0,0 +1,134 @@
+package daggo
+
+import (
+	"fmt"
+	"sort"
+)
+
+// CentralityKind selects the metric computed by Centrality
+type CentralityKind int
+
+const (
+	// CentralityPaths counts the source-to-sink paths passing through each node
+	CentralityPaths CentralityKind = iota
+	// CentralityReach counts the descendants reachable from each node
+	CentralityReach
+)
+
+// NodeScore is the centrality score of a node
+type NodeScore struct {
+	NodeID int
+	Score  float64
+}
+
+// Centrality ranks the nodes of the graph rooted at rootID by the given metric, most critical first
+func (d *Daggo) Centrality(rootID int, kind CentralityKind) ([]NodeScore, error) {
+	edges, err := d.loadGraphEdges(rootID)
+	if err != nil {
+		return nil, err
+	}
+
+	order, children, parents, err := topoOrder(rootID, edges)
+	if err != nil {
+		return nil, err
+	}
+
+	scores := make(map[int]float64, len(order))
+	switch kind {
+	case CentralityPaths:
+		// Paths from any source to a node, and from a node to any sink
+		from := make(map[int]float64, len(order))
+		to := make(map[int]float64, len(order))
+		for _, id := range order {
+			if len(parents[id]) == 0 {
+				from[id] = 1
+			}
+			for _, parentID := range parents[id] {
+				from[id] += from[parentID]
+			}
+		}
+		for i := len(order) - 1; i >= 0; i-- {
+			id := order[i]
+			if len(children[id]) == 0 {
+				to[id] = 1
+			}
+			for _, childID := range children[id] {
+				to[id] += to[childID]
+			}
+		}
+		for _, id := range order {
+			scores[id] = from[id] * to[id]
+		}
+	case CentralityReach:
+		reach := make(map[int]map[int]bool, len(order))
+		for i := len(order) - 1; i >= 0; i-- {
+			id := order[i]
+			reach[id] = make(map[int]bool)
+			for _, childID := range children[id] {
+				reach[id][childID] = true
+				for descendant := range reach[childID] {
+					reach[id][descendant] = true
+				}
+			}
+			scores[id] = float64(len(reach[id]))
+		}
+	default:
+		return nil, fmt.Errorf("unknown centrality kind %d", kind)
+	}
+
+	ranking := make([]NodeScore, 0, len(scores))
+	for id, score := range scores {
+		ranking = append(ranking, NodeScore{NodeID: id, Score: score})
+	}
+	sort.Slice(ranking, func(i, j int) bool {
+		if ranking[i].Score != ranking[j].Score {
+			return ranking[i].Score > ranking[j].Score
+		}
+		return ranking[i].NodeID < ranking[j].NodeID
+	})
+
+	return ranking, nil
+}
+
+// topoOrder orders the nodes of a graph so that parents come before their children, using Kahn's algorithm.
+// It also returns the adjacency in both directions and fails if the edges contain a cycle.
+func topoOrder(rootID int, edges []graphEdge) ([]int, map[int][]int, map[int][]int, error) {
+	children := make(map[int][]int)
+	parents := make(map[int][]int)
+	inDegree := map[int]int{rootID: 0}
+	for _, edge := range edges {
+		children[edge.ParentID] = append(children[edge.ParentID], edge.ChildID)
+		parents[edge.ChildID] = append(parents[edge.ChildID], edge.ParentID)
+		if _, ok := inDegree[edge.ParentID]; !ok {
+			inDegree[edge.ParentID] = 0
+		}
+		inDegree[edge.ChildID]++
+	}
+
+	ready := make([]int, 0)
+	for id, degree := range inDegree {
+		if degree == 0 {
+			ready = append(ready, id)
+		}
+	}
+	sort.Ints(ready)
+
+	order := make([]int, 0, len(inDegree))
+	for len(ready) > 0 {
+		id := ready[0]
+		ready = ready[1:]
+		order = append(order, id)
+		for _, childID := range children[id] {
+			inDegree[childID]--
+			if inDegree[childID] == 0 {
+				ready = append(ready, childID)
+			}
+		}
+	}
+
+	if len(order) != len(inDegree) {
+		return nil, nil, nil, fmt.Errorf("%w: graph rooted at %d contains a cycle", ErrCycleDetected, rootID)
+	}
+
+	return order, children, parents, nil
+}
@@ -0,0 +1,53 @@
+package daggo
+
+import (
+	"fmt"
+	"time"
+)
+
+// updated_at is bumped by a trigger so that writes made outside of daggo, including moves, are noticed too
+const createTimestampColumnsQuery = `
+	ALTER TABLE dag ADD COLUMN IF NOT EXISTS created_at TIMESTAMPTZ NOT NULL DEFAULT now();
+	ALTER TABLE dag ADD COLUMN IF NOT EXISTS updated_at TIMESTAMPTZ NOT NULL DEFAULT now();
+	CREATE INDEX IF NOT EXISTS dag_root_id_updated_at_idx ON dag (root_id, updated_at);
+	CREATE INDEX IF NOT EXISTS dag_parent_id_created_at_idx ON dag (parent_id, created_at);
+
+	CREATE OR REPLACE FUNCTION dag_touch_updated_at() RETURNS trigger AS $$
+	BEGIN
+		-- created_at is immutable once set
+		NEW.created_at := OLD.created_at;
+		NEW.updated_at := now();
+		RETURN NEW;
+	END;
+	$$ LANGUAGE plpgsql;
+
+	DROP TRIGGER IF EXISTS dag_touch_updated_at_trigger ON dag;
+	CREATE TRIGGER dag_touch_updated_at_trigger
+		BEFORE UPDATE ON dag
+		FOR EACH ROW EXECUTE FUNCTION dag_touch_updated_at();
+`
+
+// CreateTimestampColumns adds the created_at and updated_at columns to the dag table and installs the trigger
+// keeping updated_at current
+func (d *Daggo) CreateTimestampColumns() error {
+	_, err := d.db.Exec(createTimestampColumnsQuery)
+	if err != nil {
+		return fmt.Errorf("failed to create timestamp columns: %v", err)
+	}
+
+	return nil
+}
+
+// GetChangedSince returns the nodes of the graph rooted at rootID created, updated or moved after the given
+// time, oldest change first
+func (d *Daggo) GetChangedSince(rootID int, since time.Time) ([]DagNode, error) {
+	nodes := make([]DagNode, 0)
+
+	query := "SELECT * FROM dag WHERE root_id = $1 AND updated_at > $2 ORDER BY updated_at ASC, id ASC"
+	err := d.db.Select(&nodes, query, rootID, since)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get changed nodes: %v", err)
+	}
+
+	return nodes, nil
+}
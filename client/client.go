@@ -0,0 +1,391 @@
+// Package client reads graphs from a server started with `daggo serve`. Node lookups issued close together are
+// batched into one request, subtree reads of the graphs followed with Follow are cached until the change feed
+// reports a change in the graph, and failed requests are retried with exponential backoff.
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"daggo"
+)
+
+// ErrNotFound is returned for unknown nodes
+var ErrNotFound = errors.New("node not found")
+
+// StatusError is returned when the server answers with an error status
+type StatusError struct {
+	StatusCode int
+	Message    string
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("daggo server returned %d: %s", e.StatusCode, e.Message)
+}
+
+// Option configures a Client
+type Option func(*Client)
+
+// WithAPIKey authenticates every request with the given API key
+func WithAPIKey(key string) Option {
+	return func(c *Client) {
+		c.apiKey = key
+	}
+}
+
+// WithRootID names the graph rooted at rootID in every request, which API keys limited to some graphs require.
+// Nodes of other graphs then read as not found.
+func WithRootID(rootID int) Option {
+	return func(c *Client) {
+		c.rootID = strconv.Itoa(rootID)
+	}
+}
+
+// WithHTTPClient sends the requests with the given HTTP client instead of http.DefaultClient
+func WithHTTPClient(httpClient *http.Client) Option {
+	return func(c *Client) {
+		c.http = httpClient
+	}
+}
+
+// WithRetries retries requests failing with a network error or a 429 or 5xx status up to n times, waiting
+// backoff before the first retry and twice as long before each following one. The default is 3 retries from
+// 100ms.
+func WithRetries(n int, backoff time.Duration) Option {
+	return func(c *Client) {
+		c.retries = n
+		c.backoff = backoff
+	}
+}
+
+// WithBatching waits up to window for more node lookups before sending them in one request of at most
+// maxBatch IDs. The default is 2ms and 100 IDs; a zero window sends every lookup on its own.
+func WithBatching(window time.Duration, maxBatch int) Option {
+	return func(c *Client) {
+		c.window = window
+		c.maxBatch = maxBatch
+	}
+}
+
+// Client reads nodes from a daggo server. It is safe for concurrent use.
+type Client struct {
+	baseURL  string
+	apiKey   string
+	rootID   string
+	http     *http.Client
+	retries  int
+	backoff  time.Duration
+	window   time.Duration
+	maxBatch int
+
+	mu      sync.Mutex
+	pending map[int][]chan lookupResult
+	timer   *time.Timer
+	graphs  map[int]*graphCache
+}
+
+// graphCache holds the reads of a followed graph; generation changes with every invalidation so that reads
+// racing with one are not cached
+type graphCache struct {
+	generation  uint64
+	nodes       map[int]daggo.DagNode
+	children    map[int][]daggo.DagNode
+	descendants map[int][]daggo.DagNode
+}
+
+func (g *graphCache) reset() {
+	g.generation++
+	g.nodes = make(map[int]daggo.DagNode)
+	g.children = make(map[int][]daggo.DagNode)
+	g.descendants = make(map[int][]daggo.DagNode)
+}
+
+type lookupResult struct {
+	node *daggo.DagNode
+	err  error
+}
+
+// New creates a client of the server at baseURL, e.g. http://localhost:8080
+func New(baseURL string, opts ...Option) *Client {
+	c := &Client{
+		baseURL:  strings.TrimSuffix(baseURL, "/"),
+		http:     http.DefaultClient,
+		retries:  3,
+		backoff:  100 * time.Millisecond,
+		window:   2 * time.Millisecond,
+		maxBatch: 100,
+		pending:  make(map[int][]chan lookupResult),
+		graphs:   make(map[int]*graphCache),
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	if c.maxBatch <= 0 {
+		c.maxBatch = 1
+	}
+
+	return c
+}
+
+// GetNode returns the node with the given ID, or ErrNotFound
+func (c *Client) GetNode(ctx context.Context, nodeID int) (*daggo.DagNode, error) {
+	c.mu.Lock()
+	for _, graph := range c.graphs {
+		if node, ok := graph.nodes[nodeID]; ok {
+			c.mu.Unlock()
+			return &node, nil
+		}
+	}
+
+	// Join the batch of the next request
+	result := make(chan lookupResult, 1)
+	c.pending[nodeID] = append(c.pending[nodeID], result)
+	if len(c.pending) >= c.maxBatch || c.window <= 0 {
+		c.flushLocked()
+	} else if c.timer == nil {
+		c.timer = time.AfterFunc(c.window, func() {
+			c.mu.Lock()
+			c.flushLocked()
+			c.mu.Unlock()
+		})
+	}
+	c.mu.Unlock()
+
+	select {
+	case r := <-result:
+		return r.node, r.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// flushLocked sends the pending lookups in one request; c.mu must be held
+func (c *Client) flushLocked() {
+	if c.timer != nil {
+		c.timer.Stop()
+		c.timer = nil
+	}
+	if len(c.pending) == 0 {
+		return
+	}
+	batch := c.pending
+	c.pending = make(map[int][]chan lookupResult)
+	generations := c.generationsLocked()
+
+	go func() {
+		ids := make([]string, 0, len(batch))
+		for id := range batch {
+			ids = append(ids, strconv.Itoa(id))
+		}
+
+		// The batch outlives the context of any single caller, so it gets its own
+		ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+		defer cancel()
+
+		nodes := make([]daggo.DagNode, 0)
+		err := c.get(ctx, "/nodes", url.Values{"id": {strings.Join(ids, ",")}}, &nodes)
+
+		found := make(map[int]daggo.DagNode, len(nodes))
+		for _, node := range nodes {
+			found[node.ID] = node
+		}
+		c.mu.Lock()
+		for _, node := range nodes {
+			if graph, ok := c.graphs[node.RootID]; ok && graph.generation == generations[node.RootID] {
+				graph.nodes[node.ID] = node
+			}
+		}
+		c.mu.Unlock()
+
+		for id, waiters := range batch {
+			r := lookupResult{err: err}
+			if err == nil {
+				if node, ok := found[id]; ok {
+					r.node = &node
+				} else {
+					r.err = fmt.Errorf("%w: %d", ErrNotFound, id)
+				}
+			}
+			for _, waiter := range waiters {
+				waiter <- r
+			}
+		}
+	}()
+}
+
+// GetChildren returns the children of the node with the given ID
+func (c *Client) GetChildren(ctx context.Context, nodeID int) ([]daggo.DagNode, error) {
+	return c.subtree(ctx, nodeID, "children", func(g *graphCache) map[int][]daggo.DagNode { return g.children })
+}
+
+// GetDescendants returns the descendants of the node with the given ID
+func (c *Client) GetDescendants(ctx context.Context, nodeID int) ([]daggo.DagNode, error) {
+	return c.subtree(ctx, nodeID, "descendants", func(g *graphCache) map[int][]daggo.DagNode { return g.descendants })
+}
+
+// subtree reads the given relatives of a node, through the cache when its graph is followed
+func (c *Client) subtree(ctx context.Context, nodeID int, relation string, cached func(*graphCache) map[int][]daggo.DagNode) ([]daggo.DagNode, error) {
+	node, err := c.GetNode(ctx, nodeID)
+	if err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	graph, followed := c.graphs[node.RootID]
+	var generation uint64
+	if followed {
+		if nodes, ok := cached(graph)[nodeID]; ok {
+			c.mu.Unlock()
+			return append([]daggo.DagNode(nil), nodes...), nil
+		}
+		generation = graph.generation
+	}
+	c.mu.Unlock()
+
+	nodes := make([]daggo.DagNode, 0)
+	err = c.get(ctx, fmt.Sprintf("/nodes/%d/%s", nodeID, relation), nil, &nodes)
+	if err != nil {
+		return nil, err
+	}
+
+	if followed {
+		c.mu.Lock()
+		if graph.generation == generation && c.graphs[node.RootID] == graph {
+			cached(graph)[nodeID] = nodes
+		}
+		c.mu.Unlock()
+	}
+
+	return append([]daggo.DagNode(nil), nodes...), nil
+}
+
+// generationsLocked returns the generation of every followed graph; c.mu must be held
+func (c *Client) generationsLocked() map[int]uint64 {
+	generations := make(map[int]uint64, len(c.graphs))
+	for rootID, graph := range c.graphs {
+		generations[rootID] = graph.generation
+	}
+	return generations
+}
+
+// Follow caches the reads of the graph rooted at rootID until ctx is done, polling the change feed of the
+// server every interval and dropping the cached reads of the graph whenever it changed. It needs the sync table
+// on the server (CreateSyncTable) and blocks, so run it in its own goroutine. Reads are cached once the feed
+// has been caught up with.
+func (c *Client) Follow(ctx context.Context, rootID int, interval time.Duration) error {
+	defer func() {
+		c.mu.Lock()
+		delete(c.graphs, rootID)
+		c.mu.Unlock()
+	}()
+
+	var cursor int64
+	for {
+		var response daggo.PullResponse
+		query := url.Values{
+			"root_id": {strconv.Itoa(rootID)},
+			"cursor":  {strconv.FormatInt(cursor, 10)},
+			"limit":   {"500"},
+		}
+		err := c.get(ctx, "/sync/pull", query, &response)
+		if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			return fmt.Errorf("failed to follow graph %d: %v", rootID, err)
+		}
+		cursor = response.Cursor
+
+		c.mu.Lock()
+		graph, ok := c.graphs[rootID]
+		if !ok && len(response.Changes) < 500 {
+			graph = &graphCache{}
+			graph.reset()
+			c.graphs[rootID] = graph
+		} else if ok && len(response.Changes) > 0 {
+			graph.reset()
+		}
+		c.mu.Unlock()
+
+		// Keep paging while the feed returns full pages
+		if len(response.Changes) == 500 {
+			continue
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(interval):
+		}
+	}
+}
+
+// get fetches path and decodes its JSON body into out, retrying transient failures
+func (c *Client) get(ctx context.Context, path string, query url.Values, out interface{}) error {
+	target := c.baseURL + path
+	if c.rootID != "" && query.Get("root_id") == "" {
+		if query == nil {
+			query = url.Values{}
+		}
+		query.Set("root_id", c.rootID)
+	}
+	if len(query) > 0 {
+		target += "?" + query.Encode()
+	}
+
+	backoff := c.backoff
+	var err error
+	for attempt := 0; ; attempt++ {
+		var retry bool
+		retry, err = c.do(ctx, target, out)
+		if err == nil || !retry || attempt >= c.retries {
+			return err
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+	}
+}
+
+// do sends one GET request and tells whether a failure is worth retrying
+func (c *Client) do(ctx context.Context, target string, out interface{}) (bool, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, target, nil)
+	if err != nil {
+		return false, err
+	}
+	if c.apiKey != "" {
+		req.Header.Set("Authorization", "Bearer "+c.apiKey)
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return ctx.Err() == nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		retry := resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500
+		return retry, &StatusError{StatusCode: resp.StatusCode, Message: strings.TrimSpace(string(body))}
+	}
+
+	err = json.NewDecoder(resp.Body).Decode(out)
+	if err != nil {
+		return false, fmt.Errorf("failed to decode response: %v", err)
+	}
+
+	return false, nil
+}
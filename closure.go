@@ -0,0 +1,213 @@
+package daggo
+
+import (
+	"context"
+	"fmt"
+)
+
+// closureBackfillQuery fills the closure table from the edge table, keeping the shortest depth of every pair
+const closureBackfillQuery = `
+	INSERT INTO dag_closure (ancestor_id, descendant_id, depth)
+	SELECT id, id, 0 FROM dag
+	ON CONFLICT DO NOTHING;
+
+	WITH RECURSIVE paths(ancestor_id, descendant_id, depth) AS (
+		SELECT parent_id, child_id, 1 FROM dag_edge
+		UNION
+		SELECT paths.ancestor_id, dag_edge.child_id, paths.depth + 1
+		FROM paths
+		JOIN dag_edge ON dag_edge.parent_id = paths.descendant_id
+	)
+	INSERT INTO dag_closure (ancestor_id, descendant_id, depth)
+	SELECT ancestor_id, descendant_id, min(depth) FROM paths GROUP BY ancestor_id, descendant_id
+	ON CONFLICT (ancestor_id, descendant_id) DO UPDATE SET depth = LEAST(dag_closure.depth, EXCLUDED.depth);
+`
+
+// createClosureTableQuery creates the closure table and the triggers maintaining it in the transactions writing
+// the edge table. Adding an edge joins the ancestors of the parent with the descendants of the child; removing
+// one recomputes the ancestors of the subtree of the child from the edge table, which stays exact with several
+// parents. Writes are blocked while the table is backfilled.
+const createClosureTableQuery = `
+	CREATE TABLE IF NOT EXISTS dag_closure (
+		ancestor_id INTEGER NOT NULL,
+		descendant_id INTEGER NOT NULL,
+		depth INTEGER NOT NULL,
+		PRIMARY KEY (ancestor_id, descendant_id)
+	);
+	CREATE INDEX IF NOT EXISTS dag_closure_descendant_id_idx ON dag_closure (descendant_id, depth);
+
+	LOCK TABLE dag_edge IN SHARE ROW EXCLUSIVE MODE;
+
+	CREATE OR REPLACE FUNCTION dag_closure_add_edge() RETURNS trigger AS $$
+	BEGIN
+		INSERT INTO dag_closure (ancestor_id, descendant_id, depth)
+		VALUES (NEW.parent_id, NEW.parent_id, 0), (NEW.child_id, NEW.child_id, 0)
+		ON CONFLICT DO NOTHING;
+
+		INSERT INTO dag_closure (ancestor_id, descendant_id, depth)
+		SELECT a.ancestor_id, x.descendant_id, a.depth + 1 + x.depth
+		FROM dag_closure a, dag_closure x
+		WHERE a.descendant_id = NEW.parent_id AND x.ancestor_id = NEW.child_id
+		ON CONFLICT (ancestor_id, descendant_id) DO UPDATE SET depth = LEAST(dag_closure.depth, EXCLUDED.depth);
+		RETURN NULL;
+	END;
+	$$ LANGUAGE plpgsql;
+
+	CREATE OR REPLACE FUNCTION dag_closure_remove_edge() RETURNS trigger AS $$
+	BEGIN
+		-- The rows of a deleted child go with it
+		IF NOT EXISTS (SELECT 1 FROM dag WHERE id = OLD.child_id) THEN
+			RETURN NULL;
+		END IF;
+
+		WITH RECURSIVE subtree AS (
+			SELECT OLD.child_id AS id
+			UNION
+			SELECT dag_edge.child_id FROM dag_edge JOIN subtree ON dag_edge.parent_id = subtree.id
+		)
+		DELETE FROM dag_closure
+		WHERE descendant_id IN (SELECT id FROM subtree) AND depth > 0;
+
+		WITH RECURSIVE subtree AS (
+			SELECT OLD.child_id AS id
+			UNION
+			SELECT dag_edge.child_id FROM dag_edge JOIN subtree ON dag_edge.parent_id = subtree.id
+		),
+		paths(ancestor_id, descendant_id, depth) AS (
+			SELECT dag_edge.parent_id, dag_edge.child_id, 1
+			FROM dag_edge
+			WHERE dag_edge.child_id IN (SELECT id FROM subtree)
+			UNION
+			SELECT dag_edge.parent_id, paths.descendant_id, paths.depth + 1
+			FROM paths
+			JOIN dag_edge ON dag_edge.child_id = paths.ancestor_id
+		)
+		INSERT INTO dag_closure (ancestor_id, descendant_id, depth)
+		SELECT ancestor_id, descendant_id, min(depth) FROM paths GROUP BY ancestor_id, descendant_id;
+		RETURN NULL;
+	END;
+	$$ LANGUAGE plpgsql;
+
+	CREATE OR REPLACE FUNCTION dag_closure_remove_node() RETURNS trigger AS $$
+	BEGIN
+		DELETE FROM dag_closure WHERE ancestor_id = OLD.id OR descendant_id = OLD.id;
+		RETURN NULL;
+	END;
+	$$ LANGUAGE plpgsql;
+
+	DROP TRIGGER IF EXISTS dag_closure_add_edge_trigger ON dag_edge;
+	CREATE TRIGGER dag_closure_add_edge_trigger
+		AFTER INSERT ON dag_edge
+		FOR EACH ROW EXECUTE FUNCTION dag_closure_add_edge();
+	DROP TRIGGER IF EXISTS dag_closure_remove_edge_trigger ON dag_edge;
+	CREATE TRIGGER dag_closure_remove_edge_trigger
+		AFTER DELETE ON dag_edge
+		FOR EACH ROW EXECUTE FUNCTION dag_closure_remove_edge();
+	DROP TRIGGER IF EXISTS dag_closure_remove_node_trigger ON dag;
+	CREATE TRIGGER dag_closure_remove_node_trigger
+		AFTER DELETE ON dag
+		FOR EACH ROW EXECUTE FUNCTION dag_closure_remove_node();
+` + closureBackfillQuery
+
+// LayoutClosure reads the dag_closure table, which holds every ancestor-descendant pair with the length of the
+// shortest path between them, so that ancestor and descendant reads are a single index lookup instead of a
+// recursive query. It is maintained by triggers on the edge table, which makes edge writes slower, in
+// particular removals and moves of large subtrees. Recursive queries other than GetAncestors, GetDescendants
+// and Traverse follow the edge table.
+var LayoutClosure = StorageLayout{
+	name:    "closure",
+	install: createClosureTableQuery,
+	// Every pair must derive from the pairs of the parents of its descendant, which holds for the whole table
+	// when it holds for every node since the graph is acyclic
+	verify: `
+		SELECT DISTINCT id FROM (
+			SELECT COALESCE(expected.descendant_id, c.descendant_id) AS id
+			FROM (
+				SELECT a.ancestor_id, dag_edge.child_id AS descendant_id, min(a.depth) + 1 AS depth
+				FROM dag_edge
+				JOIN dag_closure a ON a.descendant_id = dag_edge.parent_id
+				GROUP BY a.ancestor_id, dag_edge.child_id
+			) expected
+			FULL JOIN (SELECT * FROM dag_closure WHERE depth > 0) c
+				ON c.ancestor_id = expected.ancestor_id AND c.descendant_id = expected.descendant_id
+			WHERE expected.depth IS DISTINCT FROM c.depth
+			UNION
+			SELECT c.descendant_id
+			FROM dag_closure c
+			WHERE NOT EXISTS (SELECT 1 FROM dag WHERE dag.id = c.descendant_id)
+				OR NOT EXISTS (SELECT 1 FROM dag WHERE dag.id = c.ancestor_id)
+		) mismatched
+		ORDER BY id
+		LIMIT $1
+	`,
+	down:    LayoutEdgeTable.down,
+	up:      LayoutEdgeTable.up,
+	closure: true,
+}
+
+// WithClosureTable makes GetAncestors, GetDescendants and Traverse read the closure table, whatever the layout
+// recorded in the database, until LoadStorageLayout or Cutover switches layouts. The table must have been
+// installed with CreateClosureTable, by this or any other instance.
+func WithClosureTable() Option {
+	return func(d *Daggo) {
+		layout := LayoutClosure
+		d.readLayout = &layout
+	}
+}
+
+// CreateClosureTable installs the closure table, backfills it from the edge table and keeps it maintained in the
+// transactions of every later edge write. It is BeginDualWrite of LayoutClosure: reads switch to the table with
+// WithClosureTable or, for every instance, with VerifyLayout and Cutover.
+func (d *Daggo) CreateClosureTable() error {
+	return d.BeginDualWrite(context.Background(), LayoutClosure)
+}
+
+// RebuildClosureTable recomputes the closure table from the edge table, repairing it after edges were written
+// with its triggers disabled. Edge writes wait for the rebuild.
+func (d *Daggo) RebuildClosureTable(ctx context.Context) error {
+	// Start a transaction
+	tx, err := d.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %v", err)
+	}
+	defer func() {
+		// Rollback the transaction if it failed to commit
+		if p := recover(); p != nil {
+			tx.Rollback()
+			panic(p)
+		} else if err != nil {
+			tx.Rollback()
+		}
+	}()
+
+	_, err = tx.ExecContext(ctx, "LOCK TABLE dag_edge IN SHARE ROW EXCLUSIVE MODE")
+	if err != nil {
+		return fmt.Errorf("failed to lock edge table: %v", err)
+	}
+	_, err = tx.ExecContext(ctx, "DELETE FROM dag_closure")
+	if err != nil {
+		return fmt.Errorf("failed to clear closure table: %v", err)
+	}
+	_, err = tx.ExecContext(ctx, closureBackfillQuery)
+	if err != nil {
+		return fmt.Errorf("failed to rebuild closure table: %v", err)
+	}
+
+	// Commit the transaction
+	err = tx.Commit()
+	if err != nil {
+		return fmt.Errorf("failed to commit transaction: %v", err)
+	}
+
+	return nil
+}
+
+// closureQuery returns the paginated query of a Down or Up traversal from nodeID read from the closure table,
+// with its arguments. The depth of a pair is its shortest path, so the depth limit is exact.
+func (o traversalOptions) closureQuery(dir Direction, nodeID int) (string, []interface{}) {
+	cursor, limit := o.args()
+	if o.maxDepth > 0 {
+		return paginate(closureTraversalQuery(dir, true)), []interface{}{nodeID, cursor, limit, o.maxDepth}
+	}
+	return paginate(closureTraversalQuery(dir, false)), []interface{}{nodeID, cursor, limit}
+}
@@ -0,0 +1,182 @@
+// Command daggo is an operator tool for graphs stored by the daggo library
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"daggo"
+)
+
+const usage = `usage: daggo [-dsn DSN] <command>
+
+commands:
+  bootstrap [demo]
+                 migrate the schema, create the feature tables and check the database, seeding a demo graph
+                 into an empty database with demo
+  shell          explore graphs interactively
+  jobs [STATUS]  list the last jobs, optionally only those with the given status
+  job ID         show a job
+  cancel-job ID  cancel a job
+  serve ADDR     serve the node, sync, job and API key endpoints over HTTP, authenticated with API keys
+  api-keys       list the API keys
+  create-api-key NAME SCOPE [ROOT_ID...]
+                 mint an API key with scope read, write or admin, on the given graphs or all of them
+  revoke-api-key ID
+                 revoke an API key
+
+The DSN defaults to the DAGGO_DSN environment variable.
+`
+
+func main() {
+	dsn := flag.String("dsn", os.Getenv("DAGGO_DSN"), "Postgres connection string")
+	flag.Usage = func() { fmt.Fprint(flag.CommandLine.Output(), usage) }
+	flag.Parse()
+
+	if flag.NArg() == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+	if err := run(*dsn, flag.Arg(0), flag.Args()[1:]); err != nil {
+		fmt.Fprintf(os.Stderr, "daggo: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+func run(dsn string, command string, args []string) error {
+	d, err := daggo.NewDaggo(dsn, daggo.WithApplicationName("daggo-cli"))
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+
+	switch command {
+	case "bootstrap":
+		opts := daggo.BootstrapOptions{Features: true}
+		if len(args) == 1 && args[0] == "demo" {
+			opts.SeedDemo = true
+		} else if len(args) > 0 {
+			return fmt.Errorf("usage: daggo bootstrap [demo]")
+		}
+		report, err := d.Bootstrap(context.Background(), opts)
+		if report != nil {
+			fmt.Print(report)
+		}
+		if err != nil {
+			return err
+		}
+		if !report.Ready() {
+			return fmt.Errorf("database is not ready")
+		}
+		return nil
+	case "shell":
+		return newShell(d, os.Stdin, os.Stdout).run()
+	case "jobs":
+		status := ""
+		if len(args) > 0 {
+			status = args[0]
+		}
+		jobs, err := d.ListJobs(context.Background(), status, 50)
+		if err != nil {
+			return err
+		}
+		for _, job := range jobs {
+			fmt.Printf("%d\t%s\t%s\t%s\n", job.ID, job.Kind, job.Status, job.CreatedAt.Format("2006-01-02 15:04:05"))
+		}
+		return nil
+	case "job", "cancel-job":
+		if len(args) != 1 {
+			return fmt.Errorf("usage: daggo %s ID", command)
+		}
+		jobID, err := strconv.ParseInt(args[0], 10, 64)
+		if err != nil {
+			return fmt.Errorf("invalid job ID %q", args[0])
+		}
+		var job *daggo.Job
+		if command == "job" {
+			job, err = d.GetJobStatus(context.Background(), jobID)
+		} else {
+			job, err = d.CancelJob(context.Background(), jobID)
+		}
+		if err != nil {
+			return err
+		}
+		if job == nil {
+			return fmt.Errorf("job %d not found", jobID)
+		}
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(job)
+	case "serve":
+		if len(args) != 1 {
+			return fmt.Errorf("usage: daggo serve ADDR")
+		}
+		return http.ListenAndServe(args[0], newServer(d))
+	case "api-keys":
+		keys, err := d.ListAPIKeys(context.Background())
+		if err != nil {
+			return err
+		}
+		for _, key := range keys {
+			state := "active"
+			if key.RevokedAt != nil {
+				state = "revoked"
+			} else if key.ExpiresAt != nil && key.ExpiresAt.Before(time.Now()) {
+				state = "expired"
+			}
+			fmt.Printf("%d\t%s\t%s...\t%s\t%v\t%s\n", key.ID, key.Name, key.Prefix, key.Scope, []int64(key.RootIDs), state)
+		}
+		return nil
+	case "create-api-key":
+		if len(args) < 2 {
+			return fmt.Errorf("usage: daggo create-api-key NAME SCOPE [ROOT_ID...]")
+		}
+		rootIDs := make([]int, 0)
+		for _, arg := range args[2:] {
+			rootID, err := strconv.Atoi(arg)
+			if err != nil {
+				return fmt.Errorf("invalid root ID %q", arg)
+			}
+			rootIDs = append(rootIDs, rootID)
+		}
+		key, _, err := d.CreateAPIKey(context.Background(), args[0], daggo.APIScope(args[1]), rootIDs, 0)
+		if err != nil {
+			return err
+		}
+		fmt.Println(key)
+		return nil
+	case "revoke-api-key":
+		if len(args) != 1 {
+			return fmt.Errorf("usage: daggo revoke-api-key ID")
+		}
+		keyID, err := strconv.ParseInt(args[0], 10, 64)
+		if err != nil {
+			return fmt.Errorf("invalid API key ID %q", args[0])
+		}
+		return d.RevokeAPIKey(context.Background(), keyID)
+	default:
+		return fmt.Errorf("unknown command %q", command)
+	}
+}
+
+// newServer routes the HTTP endpoints of the library, each behind an API key
+func newServer(d *daggo.Daggo) http.Handler {
+	mux := http.NewServeMux()
+	nodes := daggo.RequireAPIKey(d, daggo.ScopeRead, daggo.NodesHandler(d))
+	mux.Handle("/nodes", nodes)
+	mux.Handle("/nodes/", nodes)
+	mux.Handle("/sync/", daggo.RequireAPIKey(d, daggo.ScopeRead, http.StripPrefix("/sync", daggo.SyncHandler(d))))
+	jobs := daggo.RequireAPIKey(d, daggo.ScopeAdmin, daggo.JobsHandler(d))
+	mux.Handle("/jobs", jobs)
+	mux.Handle("/jobs/", jobs)
+	apiKeys := daggo.RequireAPIKey(d, daggo.ScopeAdmin, daggo.APIKeysHandler(d))
+	mux.Handle("/api-keys", apiKeys)
+	mux.Handle("/api-keys/", apiKeys)
+	return mux
+}
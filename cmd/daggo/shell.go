@@ -0,0 +1,244 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"daggo"
+)
+
+const shellHelp = `Nodes are addressed by paths of IDs from a root, like /1/5/9. Relative paths, . and .. work as usual.
+
+  cd [PATH]        change the current node; / when omitted
+  ls [PATH]        list the children of a node, or the roots at /
+  tree [PATH] [N]  print the subtree of a node, N levels deep (3 by default)
+  find ID          print the path of a node through its primary parents
+  pwd              print the current path
+  help             print this help
+  exit             leave the shell
+`
+
+// shell is an interactive explorer over the graphs of a database
+type shell struct {
+	d   *daggo.Daggo
+	in  *bufio.Scanner
+	out io.Writer
+	// cwd is the path of the current node, empty at /
+	cwd []int
+}
+
+func newShell(d *daggo.Daggo, in io.Reader, out io.Writer) *shell {
+	return &shell{d: d, in: bufio.NewScanner(in), out: out}
+}
+
+// run reads and executes commands until exit or end of input
+func (s *shell) run() error {
+	for {
+		fmt.Fprintf(s.out, "daggo:%s> ", formatPath(s.cwd))
+		if !s.in.Scan() {
+			fmt.Fprintln(s.out)
+			return s.in.Err()
+		}
+
+		args := strings.Fields(s.in.Text())
+		if len(args) == 0 {
+			continue
+		}
+		if args[0] == "exit" || args[0] == "quit" {
+			return nil
+		}
+		if err := s.exec(args[0], args[1:]); err != nil {
+			fmt.Fprintf(s.out, "%s: %v\n", args[0], err)
+		}
+	}
+}
+
+func (s *shell) exec(command string, args []string) error {
+	switch command {
+	case "cd":
+		path, err := s.resolve(optionalArg(args, 0, "/"))
+		if err != nil {
+			return err
+		}
+		s.cwd = path
+	case "ls":
+		path, err := s.resolve(optionalArg(args, 0, "."))
+		if err != nil {
+			return err
+		}
+		nodes, err := s.children(path)
+		if err != nil {
+			return err
+		}
+		for _, node := range nodes {
+			fmt.Fprintln(s.out, node.ID)
+		}
+	case "tree":
+		path, err := s.resolve(optionalArg(args, 0, "."))
+		if err != nil {
+			return err
+		}
+		depth, err := strconv.Atoi(optionalArg(args, 1, "3"))
+		if err != nil {
+			return fmt.Errorf("invalid depth %q", args[1])
+		}
+		fmt.Fprintln(s.out, formatPath(path))
+		return s.tree(path, depth, "")
+	case "find":
+		if len(args) != 1 {
+			return fmt.Errorf("usage: find ID")
+		}
+		id, err := strconv.Atoi(args[0])
+		if err != nil {
+			return fmt.Errorf("invalid node ID %q", args[0])
+		}
+		path, err := s.pathOf(id)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintln(s.out, formatPath(path))
+	case "pwd":
+		fmt.Fprintln(s.out, formatPath(s.cwd))
+	case "help":
+		fmt.Fprint(s.out, shellHelp)
+	default:
+		return fmt.Errorf("unknown command, try help")
+	}
+	return nil
+}
+
+// resolve turns a path argument into the IDs from a root to the addressed node, checking every step
+func (s *shell) resolve(arg string) ([]int, error) {
+	path := append([]int(nil), s.cwd...)
+	if strings.HasPrefix(arg, "/") {
+		path = path[:0]
+	}
+
+	for _, segment := range strings.Split(arg, "/") {
+		switch segment {
+		case "", ".":
+			continue
+		case "..":
+			if len(path) > 0 {
+				path = path[:len(path)-1]
+			}
+			continue
+		}
+
+		id, err := strconv.Atoi(segment)
+		if err != nil {
+			return nil, fmt.Errorf("invalid node ID %q", segment)
+		}
+		node, err := s.d.GetNodeByID(id)
+		if err != nil {
+			return nil, err
+		}
+		if node == nil {
+			return nil, fmt.Errorf("%s: no such node", formatPath(append(path, id)))
+		}
+		ok, err := s.isChildOf(node, path)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			return nil, fmt.Errorf("%s: no such node", formatPath(append(path, id)))
+		}
+		path = append(path, id)
+	}
+
+	return path, nil
+}
+
+// isChildOf reports whether node is a root when path is empty, or one of the children of the last node of path
+func (s *shell) isChildOf(node *daggo.DagNode, path []int) (bool, error) {
+	if len(path) == 0 {
+		return !node.ParentID.Valid, nil
+	}
+
+	parents, err := s.d.GetParentNodes(node.ID)
+	if err != nil {
+		return false, err
+	}
+	for _, parent := range parents {
+		if parent.ID == path[len(path)-1] {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// children lists the children of the node at path, or the roots at /
+func (s *shell) children(path []int) ([]daggo.DagNode, error) {
+	if len(path) == 0 {
+		return s.d.GetRootNodes()
+	}
+	return s.d.GetNextChildrenNodes(path[len(path)-1])
+}
+
+func (s *shell) tree(path []int, depth int, indent string) error {
+	if depth <= 0 {
+		return nil
+	}
+
+	nodes, err := s.children(path)
+	if err != nil {
+		return err
+	}
+	for i, node := range nodes {
+		branch, next := "├── ", "│   "
+		if i == len(nodes)-1 {
+			branch, next = "└── ", "    "
+		}
+		fmt.Fprintf(s.out, "%s%s%d\n", indent, branch, node.ID)
+		if err := s.tree(append(path, node.ID), depth-1, indent+next); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// pathOf follows the primary parents of a node up to its root
+func (s *shell) pathOf(id int) ([]int, error) {
+	path := make([]int, 0)
+	seen := make(map[int]bool)
+	for {
+		node, err := s.d.GetNodeByID(id)
+		if err != nil {
+			return nil, err
+		}
+		if node == nil {
+			return nil, fmt.Errorf("node %d does not exist", id)
+		}
+		if seen[id] {
+			return nil, fmt.Errorf("node %d is on a cycle", id)
+		}
+		seen[id] = true
+
+		path = append([]int{id}, path...)
+		if !node.ParentID.Valid {
+			return path, nil
+		}
+		id = node.GetParentID()
+	}
+}
+
+func formatPath(path []int) string {
+	if len(path) == 0 {
+		return "/"
+	}
+	var b strings.Builder
+	for _, id := range path {
+		fmt.Fprintf(&b, "/%d", id)
+	}
+	return b.String()
+}
+
+func optionalArg(args []string, i int, def string) string {
+	if i < len(args) {
+		return args[i]
+	}
+	return def
+}
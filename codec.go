@@ -0,0 +1,144 @@
+package daggo
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+)
+
+// Codec serializes node payloads, e.g. with msgpack or protobuf, for payloads whose JSONB encoding costs too much
+type Codec interface {
+	// Name identifies the codec in the database and in graph settings; it must be stable
+	Name() string
+	Marshal(v interface{}) ([]byte, error)
+	Unmarshal(data []byte, v interface{}) error
+}
+
+// JSONCodec stores payloads as JSONB in the payload column. It is the default codec.
+var JSONCodec Codec = jsonCodec{}
+
+type jsonCodec struct{}
+
+func (jsonCodec) Name() string {
+	return "json"
+}
+
+func (jsonCodec) Marshal(v interface{}) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+func (jsonCodec) Unmarshal(data []byte, v interface{}) error {
+	return json.Unmarshal(data, v)
+}
+
+var (
+	codecsMu sync.RWMutex
+	codecs   = map[string]Codec{"json": JSONCodec}
+)
+
+// RegisterCodec makes a codec available by name to every Daggo of the process, for the Codec graph setting and
+// to decode the payloads it encoded. Registering a name again replaces its codec.
+func RegisterCodec(codec Codec) {
+	codecsMu.Lock()
+	defer codecsMu.Unlock()
+	codecs[codec.Name()] = codec
+}
+
+// lookupCodec returns the codec registered under name
+func lookupCodec(name string) (Codec, error) {
+	codecsMu.RLock()
+	defer codecsMu.RUnlock()
+	codec, ok := codecs[name]
+	if !ok {
+		return nil, fmt.Errorf("codec %q is not registered", name)
+	}
+	return codec, nil
+}
+
+// Payloads of other codecs are kept apart from the JSONB column, which stays {} for their nodes
+const createEncodedPayloadColumnsQuery = `
+	ALTER TABLE dag ADD COLUMN IF NOT EXISTS payload_bin BYTEA;
+	ALTER TABLE dag ADD COLUMN IF NOT EXISTS payload_codec TEXT;
+`
+
+// CreateEncodedPayloadColumns adds the payload_bin and payload_codec columns storing the payloads encoded by
+// codecs other than JSONCodec
+func (d *Daggo) CreateEncodedPayloadColumns() error {
+	_, err := d.db.Exec(createEncodedPayloadColumnsQuery)
+	if err != nil {
+		return fmt.Errorf("failed to create encoded payload columns: %v", err)
+	}
+
+	return nil
+}
+
+// WithPayloadCodecs encodes the payloads written by SetNodePayload and SetTypedNodePayload with the codec of
+// their node type, set with SetNodeTypeCodec, or else with the Codec setting of their graph, and decodes them
+// accordingly in GetNodePayload and DecodeNode. It needs CreateEncodedPayloadColumns. Payloads of codecs other
+// than JSONCodec are opaque to the database, so GetNodesByPayload and UpdateSubtree do not see them.
+func WithPayloadCodecs() Option {
+	return func(d *Daggo) {
+		d.payloadCodecs = true
+	}
+}
+
+// SetNodeTypeCodec encodes the payloads of nodeType with codec, which is registered with RegisterCodec, in
+// preference to the codec of their graph. Payloads are still validated against the schema of the type as JSON.
+func (d *Daggo) SetNodeTypeCodec(nodeType string, codec Codec) {
+	RegisterCodec(codec)
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.typeCodecs == nil {
+		d.typeCodecs = make(map[string]string)
+	}
+	d.typeCodecs[nodeType] = codec.Name()
+}
+
+// payloadCodec returns the codec encoding the payload of nodeID, of type nodeType when not empty, or nil for
+// JSONCodec. It must run before the transaction of the write starts, as it reads the graph settings.
+func (d *Daggo) payloadCodec(ctx context.Context, nodeID int, nodeType string) (Codec, error) {
+	if !d.payloadCodecs {
+		return nil, nil
+	}
+
+	d.mu.RLock()
+	name := d.typeCodecs[nodeType]
+	d.mu.RUnlock()
+
+	if name == "" {
+		var rootIDs []int
+		err := d.db.SelectContext(ctx, &rootIDs, "SELECT root_id FROM dag WHERE id = $1", nodeID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get node: %v", err)
+		}
+		if len(rootIDs) == 0 {
+			return nil, nil // The update reports the missing node
+		}
+		settings, err := d.graphSettings(ctx, rootIDs[0])
+		if err != nil {
+			return nil, err
+		}
+		name = settings.Codec
+	}
+	if name == "" || name == JSONCodec.Name() {
+		return nil, nil
+	}
+
+	return lookupCodec(name)
+}
+
+// decodePayload decodes the payload of a node encoded by the codec named codecName, or the JSONB payload when
+// codecName is empty
+func decodePayload(payload []byte, encoded []byte, codecName string, out interface{}) error {
+	if codecName == "" {
+		return json.Unmarshal(payload, out)
+	}
+
+	codec, err := lookupCodec(codecName)
+	if err != nil {
+		return err
+	}
+	return codec.Unmarshal(encoded, out)
+}
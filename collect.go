@@ -0,0 +1,158 @@
+package daggo
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// collectQuery returns the nodes of the subtree of $1 that no node outside of it still reaches, in ID order,
+// locking them. Every node outside of the subtree is reachable from a root, so a node of the subtree stays alive
+// exactly when it is reached from one of them.
+const collectQuery = `
+	WITH RECURSIVE subtree AS (
+		SELECT $1::int AS id
+		UNION
+		SELECT dag_edge.child_id FROM dag_edge JOIN subtree ON dag_edge.parent_id = subtree.id
+	),
+	alive AS (
+		SELECT dag_edge.child_id AS id
+		FROM dag_edge
+		JOIN subtree ON subtree.id = dag_edge.child_id
+		WHERE dag_edge.parent_id NOT IN (SELECT id FROM subtree)
+		UNION
+		SELECT dag_edge.child_id FROM dag_edge JOIN alive ON dag_edge.parent_id = alive.id
+	)
+	SELECT dag.id
+	FROM dag
+	WHERE dag.id IN (SELECT id FROM subtree) AND dag.id NOT IN (SELECT id FROM alive)
+	ORDER BY dag.id
+	FOR UPDATE
+`
+
+// GetReferenceCount returns the number of parents referencing the node with the given ID, which
+// DeleteEdgeAndCollect deletes once it drops to zero. Counts are read from the edge table, indexed by child.
+func (d *Daggo) GetReferenceCount(nodeID int) (int, error) {
+	return d.GetReferenceCountContext(context.Background(), nodeID)
+}
+
+// GetReferenceCountContext is GetReferenceCount with a context bounding its queries
+func (d *Daggo) GetReferenceCountContext(ctx context.Context, nodeID int) (int, error) {
+	var count int
+	err := d.db.GetContext(ctx, &count, "SELECT count(*) FROM dag_edge WHERE child_id = $1", nodeID)
+	if err != nil {
+		return 0, fmt.Errorf("failed to count references: %v", err)
+	}
+
+	return count, nil
+}
+
+// DeleteEdgeAndCollect removes the edge from parentID to childID and deletes the nodes left unreachable: the
+// child when the edge was its last reference, and the descendants of the child that are only referenced by
+// deleted nodes, like a garbage collection of shared sub-DAGs in content-addressed stores. Descendants still
+// referenced from elsewhere are kept, with another parent promoted when their primary parent is deleted. The
+// result counts the deleted nodes.
+func (d *Daggo) DeleteEdgeAndCollect(parentID int, childID int) (*MutationResult, error) {
+	return d.DeleteEdgeAndCollectContext(context.Background(), parentID, childID)
+}
+
+// DeleteEdgeAndCollectContext is DeleteEdgeAndCollect with a context bounding its queries
+func (d *Daggo) DeleteEdgeAndCollectContext(ctx context.Context, parentID int, childID int) (*MutationResult, error) {
+	start := time.Now()
+
+	// Start a transaction
+	tx, err := d.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %v", err)
+	}
+	defer func() {
+		// Rollback the transaction if it failed to commit
+		if p := recover(); p != nil {
+			tx.Rollback()
+			panic(p)
+		} else if err != nil {
+			tx.Rollback()
+		}
+	}()
+
+	err = d.setTxActor(ctx, tx)
+	if err != nil {
+		return nil, err
+	}
+
+	child := &DagNode{}
+	err = tx.GetContext(ctx, child, "SELECT * FROM dag WHERE id = $1 FOR UPDATE", childID)
+	if err == sql.ErrNoRows {
+		err = fmt.Errorf("%w: %d", ErrNodeNotFound, childID)
+		return nil, err
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to lock node: %v", err)
+	}
+
+	res, err := tx.ExecContext(ctx, "DELETE FROM dag_edge WHERE parent_id = $1 AND child_id = $2", parentID, childID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to remove edge: %v", err)
+	}
+	removed, err := res.RowsAffected()
+	if err != nil {
+		return nil, fmt.Errorf("failed to remove edge: %v", err)
+	}
+	if removed == 0 {
+		err = fmt.Errorf("edge from %d to %d does not exist", parentID, childID)
+		return nil, err
+	}
+
+	collected := make([]int, 0)
+	err = tx.SelectContext(ctx, &collected, collectQuery, childID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find unreachable nodes: %v", err)
+	}
+
+	// Promote another parent of the surviving nodes whose primary parent goes away, the child included
+	query := `
+		UPDATE dag SET parent_id = (
+			SELECT min(dag_edge.parent_id) FROM dag_edge
+			WHERE dag_edge.child_id = dag.id AND dag_edge.parent_id <> ALL($2::int[])
+		)
+		WHERE (parent_id = ANY($2::int[]) OR (id = $1 AND parent_id = $3)) AND id <> ALL($2::int[])
+	`
+	_, err = tx.ExecContext(ctx, query, childID, pq.Array(collected), parentID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to update primary parents: %v", err)
+	}
+
+	_, err = tx.ExecContext(ctx, "DELETE FROM dag WHERE id = ANY($1::int[])", pq.Array(collected))
+	if err != nil {
+		return nil, fmt.Errorf("failed to delete unreachable nodes: %v", err)
+	}
+
+	events := []DagEvent{{Kind: DagEventEdgeRemoved, NodeID: childID, RootID: child.RootID, ParentIDs: []int{parentID}}}
+	for _, id := range collected {
+		events = append(events, DagEvent{Kind: DagEventNodeDeleted, NodeID: id, RootID: child.RootID})
+	}
+	err = d.notify(ctx, tx, events...)
+	if err != nil {
+		return nil, err
+	}
+
+	// Commit the transaction
+	err = tx.Commit()
+	if err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %v", err)
+	}
+
+	d.InvalidatePlanCache()
+
+	result := newMutationResult()
+	if len(collected) > 0 {
+		result.Counts[MutationDeleted] = int64(len(collected))
+	}
+	result.addRoot(child.RootID)
+	result.addNode(childID)
+	result.Duration = time.Since(start)
+
+	return result, nil
+}
@@ -0,0 +1,321 @@
+package daggo
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+)
+
+// nodeReferences lists the side table columns holding node IDs that must follow a renumbering, by table
+var nodeReferences = []struct {
+	table   string
+	columns []string
+}{
+	{"dag_annotation", []string{"node_id"}},
+	{"dag_acl", []string{"node_id"}},
+	{"dag_pin", []string{"node_id"}},
+	{"dag_visual", []string{"node_id"}},
+	{"dag_claim", []string{"node_id"}},
+	{"dag_attr", []string{"node_id"}},
+	{"dag_rollup", []string{"node_id"}},
+	{"dag_edge", []string{"parent_id", "child_id"}},
+	{"dag_edge_payload", []string{"parent_id", "child_id"}},
+	{"dag_cross_edge", []string{"parent_id", "child_id"}},
+	{"dag_closure", []string{"ancestor_id", "descendant_id"}},
+	{"dag_path", []string{"node_id"}},
+	{"dag_document_node", []string{"node_id"}},
+	{"dag_graph", []string{"root_id"}},
+	{"dag_graph_lease", []string{"root_id"}},
+	{"dag_view", []string{"root_id"}},
+	{"dag_view_graph", []string{"root_id"}},
+	{"dag_view_graph_node", []string{"node_id"}},
+	{"dag_view_graph_edge", []string{"parent_id", "child_id"}},
+}
+
+// compactGraphQuery selects the nodes of graph $1 in breadth-first order over every edge, each at its shortest
+// distance from the root, followed by the nodes of the graph no edge reaches
+const compactGraphQuery = `
+	WITH RECURSIVE bfs AS (
+		SELECT id, 0 AS depth FROM dag WHERE id = $1
+		UNION
+		SELECT dag_edge.child_id, bfs.depth + 1 FROM dag_edge JOIN bfs ON dag_edge.parent_id = bfs.id
+	),
+	reached AS (
+		SELECT id, min(depth) AS depth FROM bfs GROUP BY id
+	)
+	SELECT dag.id
+	FROM dag
+	LEFT JOIN reached ON reached.id = dag.id
+	WHERE dag.root_id = $1
+	ORDER BY reached.depth ASC NULLS LAST, dag.id ASC
+`
+
+// Compact renumbers the nodes of the graph rooted at rootID with dense sequential IDs, in breadth-first order,
+// and returns the mapping from old to new IDs. The root keeps its ID and the rest of the graph is packed right
+// after it when that range is free; otherwise the graph is moved to a fresh block after the highest ID in use.
+// Side tables referencing the nodes are rewritten in the same transaction, graph quotas and API key scopes
+// included. Replicas and the event log address nodes by their IDs for good, so graphs tracked by sync or with
+// events in the log cannot be compacted, nor can partitioned dag tables, whose nodes cannot move between graphs.
+func (d *Daggo) Compact(ctx context.Context, rootID int) (map[int]int, error) {
+	// Start a transaction
+	tx, err := d.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %v", err)
+	}
+	defer func() {
+		// Rollback the transaction if it failed to commit
+		if p := recover(); p != nil {
+			tx.Rollback()
+			panic(p)
+		} else if err != nil {
+			tx.Rollback()
+		}
+	}()
+
+	err = d.setTxActor(ctx, tx)
+	if err != nil {
+		return nil, err
+	}
+
+	// Renumbering moves the nodes through a temporary graph, which the partitioned ID trigger refuses
+	var partitioned bool
+	err = tx.GetContext(ctx, &partitioned, "SELECT EXISTS (SELECT 1 FROM pg_partitioned_table WHERE partrelid = 'dag'::regclass)")
+	if err != nil {
+		return nil, fmt.Errorf("failed to check partitioning: %v", err)
+	}
+	if partitioned {
+		err = fmt.Errorf("graph %d cannot be compacted in a partitioned dag table", rootID)
+		return nil, err
+	}
+
+	// Keep concurrent writers from taking IDs in the target range
+	_, err = tx.ExecContext(ctx, "LOCK TABLE dag IN SHARE ROW EXCLUSIVE MODE")
+	if err != nil {
+		return nil, fmt.Errorf("failed to lock dag table: %v", err)
+	}
+
+	var ids []int
+	err = tx.SelectContext(ctx, &ids, compactGraphQuery, rootID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get graph nodes: %v", err)
+	}
+	if len(ids) == 0 || ids[0] != rootID {
+		err = fmt.Errorf("%w: %d", ErrNodeNotFound, rootID)
+		return nil, err
+	}
+
+	err = checkCompactable(ctx, tx, rootID, ids)
+	if err != nil {
+		return nil, err
+	}
+
+	// Pack after the root when no other graph uses that range
+	start := rootID
+	var foreign int
+	err = tx.GetContext(ctx, &foreign,
+		"SELECT count(*) FROM dag WHERE id BETWEEN $1 AND $2 AND root_id <> $1", rootID, rootID+len(ids)-1)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check ID range: %v", err)
+	}
+	if foreign > 0 {
+		err = tx.GetContext(ctx, &start, "SELECT COALESCE(max(id), 0) + 1 FROM dag")
+		if err != nil {
+			return nil, fmt.Errorf("failed to find free ID range: %v", err)
+		}
+	}
+
+	mapping := make(map[int]int, len(ids))
+	oldIDs := make([]int64, len(ids))
+	newIDs := make([]int64, len(ids))
+	for i, id := range ids {
+		mapping[id] = start + i
+		oldIDs[i] = int64(id)
+		newIDs[i] = int64(start + i)
+	}
+
+	_, err = tx.ExecContext(ctx, `
+		CREATE TEMP TABLE dag_compact_map ON COMMIT DROP AS
+		SELECT * FROM unnest($1::bigint[], $2::bigint[]) AS m(old_id, new_id)
+	`, pq.Int64Array(oldIDs), pq.Int64Array(newIDs))
+	if err != nil {
+		return nil, fmt.Errorf("failed to build ID mapping: %v", err)
+	}
+
+	// Move to negative IDs first so the old and new ranges may overlap without unique violations
+	_, err = tx.ExecContext(ctx, `
+		UPDATE dag
+		SET id = -m.new_id,
+			parent_id = -(SELECT p.new_id FROM dag_compact_map p WHERE p.old_id = dag.parent_id),
+			root_id = -$1::bigint
+		FROM dag_compact_map m
+		WHERE dag.id = m.old_id
+	`, start)
+	if err != nil {
+		return nil, fmt.Errorf("failed to renumber nodes: %v", err)
+	}
+	_, err = tx.ExecContext(ctx, "UPDATE dag SET id = -id, parent_id = -parent_id, root_id = -root_id WHERE id < 0")
+	if err != nil {
+		return nil, fmt.Errorf("failed to renumber nodes: %v", err)
+	}
+
+	for _, ref := range nodeReferences {
+		var exists bool
+		err = tx.GetContext(ctx, &exists, "SELECT to_regclass($1) IS NOT NULL", ref.table)
+		if err != nil {
+			return nil, fmt.Errorf("failed to check table %s: %v", ref.table, err)
+		}
+		if !exists {
+			continue
+		}
+
+		// Keys are checked row by row, so the new IDs go through negative ones as for the dag table, every key
+		// column of a row at once
+		var negate, mapped, restore, negative []string
+		for _, column := range ref.columns {
+			negate = append(negate, fmt.Sprintf(
+				"%[2]s = COALESCE((SELECT -m.new_id FROM dag_compact_map m WHERE m.old_id = %[1]s.%[2]s), %[2]s)", ref.table, column))
+			mapped = append(mapped, fmt.Sprintf("%s IN (SELECT old_id FROM dag_compact_map)", column))
+			restore = append(restore, fmt.Sprintf("%[1]s = abs(%[1]s)", column))
+			negative = append(negative, fmt.Sprintf("%s < 0", column))
+		}
+		query := fmt.Sprintf("UPDATE %s SET %s WHERE %s", ref.table, strings.Join(negate, ", "), strings.Join(mapped, " OR "))
+		_, err = tx.ExecContext(ctx, query)
+		if err != nil {
+			return nil, fmt.Errorf("failed to rewrite %s: %v", ref.table, err)
+		}
+		query = fmt.Sprintf("UPDATE %s SET %s WHERE %s", ref.table, strings.Join(restore, ", "), strings.Join(negative, " OR "))
+		_, err = tx.ExecContext(ctx, query)
+		if err != nil {
+			return nil, fmt.Errorf("failed to rewrite %s: %v", ref.table, err)
+		}
+	}
+
+	err = remapPathIndex(ctx, tx)
+	if err != nil {
+		return nil, err
+	}
+
+	if start != rootID {
+		err = moveGraphScopes(ctx, tx, rootID, start)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// View graphs were refreshed while the IDs were in flux
+	err = refreshViewGraphsOf(ctx, tx, start)
+	if err != nil {
+		return nil, err
+	}
+
+	// Commit the transaction
+	err = tx.Commit()
+	if err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %v", err)
+	}
+
+	d.InvalidatePlanCache()
+
+	return mapping, nil
+}
+
+// checkCompactable fails when replicas or the event log address the node IDs of the graph rooted at rootID
+func checkCompactable(ctx context.Context, tx *sqlx.Tx, rootID int, ids []int) error {
+	var exists bool
+	err := tx.GetContext(ctx, &exists, "SELECT to_regclass('dag_sync') IS NOT NULL")
+	if err != nil {
+		return fmt.Errorf("failed to check sync table: %v", err)
+	}
+	if exists {
+		var tracked bool
+		err = tx.GetContext(ctx, &tracked, "SELECT EXISTS (SELECT 1 FROM dag_sync WHERE root_id = $1)", rootID)
+		if err != nil {
+			return fmt.Errorf("failed to check sync versions: %v", err)
+		}
+		if tracked {
+			return fmt.Errorf("graph %d is tracked by sync and cannot be compacted", rootID)
+		}
+	}
+
+	err = tx.GetContext(ctx, &exists, "SELECT to_regclass('dag_event') IS NOT NULL")
+	if err != nil {
+		return fmt.Errorf("failed to check event table: %v", err)
+	}
+	if exists {
+		var logged bool
+		query := "SELECT EXISTS (SELECT 1 FROM dag_event WHERE node_id = ANY($1::int[]) OR parent_id = ANY($1::int[]))"
+		err = tx.GetContext(ctx, &logged, query, pq.Array(ids))
+		if err != nil {
+			return fmt.Errorf("failed to check event log: %v", err)
+		}
+		if logged {
+			return fmt.Errorf("graph %d has events in the event log and cannot be compacted", rootID)
+		}
+	}
+
+	return nil
+}
+
+// remapPathIndex renumbers the ancestors held by the path index after the nodes of dag_compact_map moved, if the
+// index is installed
+func remapPathIndex(ctx context.Context, tx *sqlx.Tx) error {
+	var exists bool
+	err := tx.GetContext(ctx, &exists, "SELECT to_regclass('dag_path') IS NOT NULL")
+	if err != nil {
+		return fmt.Errorf("failed to check path index: %v", err)
+	}
+	if !exists {
+		return nil
+	}
+
+	query := `
+		UPDATE dag_path
+		SET ancestors = ARRAY(
+			SELECT COALESCE(m.new_id::int, a)
+			FROM unnest(ancestors) a
+			LEFT JOIN dag_compact_map m ON m.old_id = a
+			ORDER BY 1
+		)
+		WHERE ancestors && (SELECT array_agg(old_id::int) FROM dag_compact_map)
+	`
+	_, err = tx.ExecContext(ctx, query)
+	if err != nil {
+		return fmt.Errorf("failed to rewrite path index: %v", err)
+	}
+
+	return nil
+}
+
+// moveGraphScopes points the graph quota and the API keys scoped to the graph rooted at rootID to its new root
+func moveGraphScopes(ctx context.Context, tx *sqlx.Tx, rootID int, newRootID int) error {
+	var exists bool
+	err := tx.GetContext(ctx, &exists, "SELECT to_regclass('dag_quota') IS NOT NULL")
+	if err != nil {
+		return fmt.Errorf("failed to check quota table: %v", err)
+	}
+	if exists {
+		query := "UPDATE dag_quota SET scope_id = $3 WHERE scope = $1 AND scope_id = $2"
+		_, err = tx.ExecContext(ctx, query, QuotaScopeGraph, strconv.Itoa(rootID), strconv.Itoa(newRootID))
+		if err != nil {
+			return fmt.Errorf("failed to move graph quota: %v", err)
+		}
+	}
+
+	err = tx.GetContext(ctx, &exists, "SELECT to_regclass('dag_api_key') IS NOT NULL")
+	if err != nil {
+		return fmt.Errorf("failed to check API key table: %v", err)
+	}
+	if exists {
+		query := "UPDATE dag_api_key SET root_ids = array_replace(root_ids, $1, $2) WHERE $1 = ANY(root_ids)"
+		_, err = tx.ExecContext(ctx, query, rootID, newRootID)
+		if err != nil {
+			return fmt.Errorf("failed to move API key scopes: %v", err)
+		}
+	}
+
+	return nil
+}
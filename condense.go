@@ -0,0 +1,128 @@
+package daggo
+
+import (
+	"fmt"
+	"sort"
+)
+
+// GroupFunc returns the group a node collapses into when a graph is condensed
+type GroupFunc func(node DagNode) string
+
+// SuperNode is a group of nodes collapsed into one by Condense
+type SuperNode struct {
+	Key     string
+	NodeIDs []int
+	Count   int
+}
+
+// SuperEdge connects two super-nodes; Count is the number of original edges it summarizes
+type SuperEdge struct {
+	From  string
+	To    string
+	Count int
+}
+
+// CondensedGraph is a summary of a graph where nodes sharing a group collapse into one super-node
+type CondensedGraph struct {
+	RootID int
+	Nodes  []SuperNode
+	Edges  []SuperEdge
+}
+
+// Condense builds a summary of the graph rooted at rootID in which the nodes sharing the same groupBy value
+// collapse into one super-node. Every edge is summarized, those to secondary parents included; edges between
+// nodes of the same group are dropped.
+func (d *Daggo) Condense(rootID int, groupBy GroupFunc) (*CondensedGraph, error) {
+	if groupBy == nil {
+		return nil, fmt.Errorf("group function cannot be nil")
+	}
+
+	nodes := make([]DagNode, 0)
+	err := d.db.Select(&nodes, "SELECT * FROM dag WHERE root_id = $1 ORDER BY id ASC", rootID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get graph nodes: %v", err)
+	}
+
+	members := make([]groupMember, 0, len(nodes))
+	for _, node := range nodes {
+		members = append(members, groupMember{ID: node.ID, Key: groupBy(node)})
+	}
+
+	return d.condense(rootID, members)
+}
+
+// CondenseByPayload is Condense grouping the nodes by the value of the top-level payload field, as text, read in
+// SQL. Nodes without the field share the group with the empty key.
+func (d *Daggo) CondenseByPayload(rootID int, field string) (*CondensedGraph, error) {
+	if field == "" {
+		return nil, fmt.Errorf("payload field cannot be empty")
+	}
+
+	members := make([]groupMember, 0)
+	query := "SELECT id, COALESCE(payload->>$2, '') AS key FROM dag WHERE root_id = $1 ORDER BY id ASC"
+	err := d.db.Select(&members, query, rootID, field)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get graph nodes: %v", err)
+	}
+
+	return d.condense(rootID, members)
+}
+
+// groupMember is a node of a graph being condensed with the key of its group
+type groupMember struct {
+	ID  int    `db:"id"`
+	Key string `db:"key"`
+}
+
+// condense collapses the members, in ID order, into their groups and summarizes the edges of the graph rooted at
+// rootID between the groups
+func (d *Daggo) condense(rootID int, members []groupMember) (*CondensedGraph, error) {
+	groupOf := make(map[int]string, len(members))
+	groups := make(map[string]*SuperNode)
+	keys := make([]string, 0)
+	for _, member := range members {
+		groupOf[member.ID] = member.Key
+		group, ok := groups[member.Key]
+		if !ok {
+			group = &SuperNode{Key: member.Key}
+			groups[member.Key] = group
+			keys = append(keys, member.Key)
+		}
+		group.NodeIDs = append(group.NodeIDs, member.ID)
+		group.Count++
+	}
+
+	edges, err := d.loadGraphEdges(rootID)
+	if err != nil {
+		return nil, err
+	}
+	edgeCounts := make(map[[2]string]int)
+	for _, edge := range edges {
+		parentKey, ok := groupOf[edge.ParentID]
+		if !ok {
+			continue
+		}
+		childKey, ok := groupOf[edge.ChildID]
+		if !ok || parentKey == childKey {
+			continue
+		}
+		edgeCounts[[2]string{parentKey, childKey}]++
+	}
+
+	condensed := &CondensedGraph{RootID: rootID, Nodes: make([]SuperNode, 0, len(keys)), Edges: make([]SuperEdge, 0, len(edgeCounts))}
+	sort.Strings(keys)
+	for _, key := range keys {
+		condensed.Nodes = append(condensed.Nodes, *groups[key])
+	}
+	for pair, count := range edgeCounts {
+		condensed.Edges = append(condensed.Edges, SuperEdge{From: pair[0], To: pair[1], Count: count})
+	}
+	sort.Slice(condensed.Edges, func(i, j int) bool {
+		if condensed.Edges[i].From != condensed.Edges[j].From {
+			return condensed.Edges[i].From < condensed.Edges[j].From
+		}
+		return condensed.Edges[i].To < condensed.Edges[j].To
+	})
+
+	return condensed, nil
+}
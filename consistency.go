@@ -0,0 +1,96 @@
+package daggo
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+type consistencyLevel int
+
+const (
+	consistencyStrong consistencyLevel = iota
+	consistencyBounded
+	consistencyStale
+)
+
+// ReadConsistency trades freshness for load on a read query
+type ReadConsistency struct {
+	level        consistencyLevel
+	maxStaleness time.Duration
+}
+
+var (
+	// Strong reads from the primary and always observes the latest committed writes
+	Strong = ReadConsistency{level: consistencyStrong}
+	// Stale reads from any replica regardless of how far behind it is
+	Stale = ReadConsistency{level: consistencyStale}
+)
+
+// Bounded reads from a replica lagging the primary by at most maxStaleness, falling back to the primary
+// when no replica is fresh enough
+func Bounded(maxStaleness time.Duration) ReadConsistency {
+	return ReadConsistency{level: consistencyBounded, maxStaleness: maxStaleness}
+}
+
+// String returns the name of the consistency level
+func (c ReadConsistency) String() string {
+	switch c.level {
+	case consistencyBounded:
+		return fmt.Sprintf("bounded(%v)", c.maxStaleness)
+	case consistencyStale:
+		return "stale"
+	default:
+		return "strong"
+	}
+}
+
+// WithReadReplicas connects to read replicas that serve queries run with a Bounded or Stale consistency
+func WithReadReplicas(dsns ...string) Option {
+	return func(d *Daggo) {
+		d.replicaDSNs = append(d.replicaDSNs, dsns...)
+	}
+}
+
+// WithConsistency selects where a read query is served from. Reads are Strong by default.
+func WithConsistency(c ReadConsistency) TraversalOption {
+	return func(o *traversalOptions) {
+		o.consistency = c
+	}
+}
+
+// The replay lag is zero when the replica has applied everything it received, so an idle primary does not
+// make its replicas look stale
+const replicaLagQuery = `
+	SELECT CASE
+		WHEN NOT pg_is_in_recovery() OR pg_last_wal_receive_lsn() = pg_last_wal_replay_lsn() THEN 0
+		ELSE COALESCE(EXTRACT(EPOCH FROM now() - pg_last_xact_replay_timestamp()), 0)
+	END
+`
+
+// reader returns the connection pool serving reads at the given consistency
+func (d *Daggo) reader(ctx context.Context, c ReadConsistency) *sqlx.DB {
+	if c.level == consistencyStrong || len(d.replicas) == 0 {
+		return d.db
+	}
+
+	// Rotate through the replicas to spread the load
+	start := int(atomic.AddUint32(&d.nextReplica, 1))
+	for i := range d.replicas {
+		replica := d.replicas[(start+i)%len(d.replicas)]
+		if c.level == consistencyStale {
+			return replica
+		}
+
+		var lag float64
+		err := replica.GetContext(ctx, &lag, replicaLagQuery)
+		if err == nil && time.Duration(lag*float64(time.Second)) <= c.maxStaleness {
+			return replica
+		}
+	}
+
+	return d.db
+}
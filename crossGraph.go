@@ -0,0 +1,292 @@
+package daggo
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+const createCrossEdgeTableQuery = `
+	CREATE TABLE IF NOT EXISTS dag_cross_edge (
+		parent_id INTEGER NOT NULL,
+		child_id INTEGER NOT NULL,
+		created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+		PRIMARY KEY (parent_id, child_id),
+		CONSTRAINT dag_cross_edge_no_self_edge CHECK (parent_id <> child_id)
+	);
+	CREATE INDEX IF NOT EXISTS dag_cross_edge_child_id_idx ON dag_cross_edge (child_id);
+
+	CREATE OR REPLACE FUNCTION dag_drop_cross_edges() RETURNS trigger AS $$
+	BEGIN
+		DELETE FROM dag_cross_edge WHERE parent_id = OLD.id OR child_id = OLD.id;
+		RETURN NULL;
+	END;
+	$$ LANGUAGE plpgsql;
+
+	DROP TRIGGER IF EXISTS dag_drop_cross_edges_trigger ON dag;
+	CREATE TRIGGER dag_drop_cross_edges_trigger
+		AFTER DELETE ON dag
+		FOR EACH ROW EXECUTE FUNCTION dag_drop_cross_edges();
+`
+
+// crossGraphEdges lists every edge, within a graph or across graphs, for traversals crossing graph boundaries
+const crossGraphEdges = "(SELECT parent_id, child_id FROM dag_edge UNION ALL SELECT parent_id, child_id FROM dag_cross_edge) AS edge"
+
+// NodeRef qualifies a node with the graph it belongs to
+type NodeRef struct {
+	GraphID int `json:"graph_id"`
+	NodeID  int `json:"node_id"`
+}
+
+// String returns the reference as graph/node
+func (r NodeRef) String() string {
+	return fmt.Sprintf("%d/%d", r.GraphID, r.NodeID)
+}
+
+// CrossEdge is an edge between nodes of different graphs
+type CrossEdge struct {
+	Parent    NodeRef   `json:"parent"`
+	Child     NodeRef   `json:"child"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// GraphBoundary tells whether a traversal follows the edges between graphs
+type GraphBoundary int
+
+const (
+	// StopAtGraphBoundary only follows the edges of the graph of the start node. It is the default.
+	StopAtGraphBoundary GraphBoundary = iota
+	// CrossGraphBoundaries also follows the edges added with AddCrossGraphEdge, into the graphs they lead to
+	CrossGraphBoundaries
+)
+
+// WithGraphBoundary sets whether a traversal crosses into other graphs through cross-graph edges. Crossing
+// traversals read the dag_edge table whatever the active storage layout and need CreateCrossEdgeTable.
+func WithGraphBoundary(boundary GraphBoundary) TraversalOption {
+	return func(o *traversalOptions) {
+		o.boundary = boundary
+	}
+}
+
+// crossGraphStep returns the recursive step following the edges within and across graphs in a Down or Up
+// direction
+func crossGraphStep(dir Direction) (recursiveStep, error) {
+	switch dir {
+	case Down:
+		return recursiveStep{column: "edge.child_id", from: crossGraphEdges + " JOIN reachable ON edge.parent_id = reachable.id"}, nil
+	case Up:
+		return recursiveStep{column: "edge.parent_id", from: crossGraphEdges + " JOIN reachable ON edge.child_id = reachable.id"}, nil
+	default:
+		return recursiveStep{}, fmt.Errorf("unknown direction %v", dir)
+	}
+}
+
+// traversalStepFor returns the recursive step of a traversal in a Down or Up direction honoring the graph
+// boundary of options
+func (d *Daggo) traversalStepFor(dir Direction, options traversalOptions) (recursiveStep, error) {
+	if options.boundary == CrossGraphBoundaries {
+		return crossGraphStep(dir)
+	}
+	return d.traversalStep(dir)
+}
+
+// CreateCrossEdgeTable creates the side table holding the edges between graphs, together with the trigger
+// dropping the edges of deleted nodes
+func (d *Daggo) CreateCrossEdgeTable() error {
+	_, err := d.db.Exec(createCrossEdgeTableQuery)
+	if err != nil {
+		return fmt.Errorf("failed to create cross edge table: %v", err)
+	}
+
+	return nil
+}
+
+// AddCrossGraphEdge adds an edge from parent to child, which belong to different graphs, e.g. to record lineage
+// spanning graphs owned by different teams. Each reference must name the graph its node belongs to. The edge
+// is not followed by traversals unless they cross graph boundaries, and it fails with ErrCycleDetected when
+// it would close a cycle across the graphs.
+func (d *Daggo) AddCrossGraphEdge(parent NodeRef, child NodeRef) error {
+	return d.AddCrossGraphEdgeContext(context.Background(), parent, child)
+}
+
+// AddCrossGraphEdgeContext is AddCrossGraphEdge with a context bounding its queries
+func (d *Daggo) AddCrossGraphEdgeContext(ctx context.Context, parent NodeRef, child NodeRef) error {
+	if parent.GraphID == child.GraphID {
+		return fmt.Errorf("nodes %v and %v belong to the same graph: use AddEdge", parent, child)
+	}
+
+	// Start a transaction
+	tx, err := d.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %v", err)
+	}
+	defer func() {
+		// Rollback the transaction if it failed to commit
+		if p := recover(); p != nil {
+			tx.Rollback()
+			panic(p)
+		} else if err != nil {
+			tx.Rollback()
+		}
+	}()
+
+	err = d.setTxActor(ctx, tx)
+	if err != nil {
+		return err
+	}
+
+	// Lock both ends so that they cannot be deleted or moved to another graph before the edge is inserted
+	nodes := make([]DagNode, 0, 2)
+	err = tx.SelectContext(ctx, &nodes, "SELECT * FROM dag WHERE id IN ($1, $2) ORDER BY id FOR SHARE", parent.NodeID, child.NodeID)
+	if err != nil {
+		return fmt.Errorf("failed to lock nodes: %v", err)
+	}
+	rootOf := make(map[int]int, len(nodes))
+	for _, node := range nodes {
+		rootOf[node.ID] = node.RootID
+	}
+	for _, ref := range []NodeRef{parent, child} {
+		rootID, ok := rootOf[ref.NodeID]
+		if !ok {
+			err = fmt.Errorf("%w: %d", ErrNodeNotFound, ref.NodeID)
+			return err
+		}
+		if rootID != ref.GraphID {
+			err = fmt.Errorf("node %d belongs to graph %d, not %d", ref.NodeID, rootID, ref.GraphID)
+			return err
+		}
+	}
+
+	// The edge closes a cycle when the parent is reachable from the child, within or across graphs
+	var cycle bool
+	err = tx.GetContext(ctx, &cycle, `
+		WITH RECURSIVE reachable AS (
+			SELECT $1::int AS id
+			UNION
+			SELECT edge.child_id FROM `+crossGraphEdges+` JOIN reachable ON edge.parent_id = reachable.id
+		)
+		SELECT EXISTS (SELECT 1 FROM reachable WHERE id = $2)
+	`, child.NodeID, parent.NodeID)
+	if err != nil {
+		return fmt.Errorf("failed to check for cycles: %v", err)
+	}
+	if cycle {
+		err = fmt.Errorf("%w: edge from %v to %v", ErrCycleDetected, parent, child)
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, "INSERT INTO dag_cross_edge (parent_id, child_id) VALUES ($1, $2)", parent.NodeID, child.NodeID)
+	if err != nil {
+		if isConstraintViolation(err, "dag_cross_edge_pkey") {
+			err = fmt.Errorf("%w: from %v to %v", ErrDuplicateEdge, parent, child)
+			return err
+		}
+		return fmt.Errorf("failed to add cross-graph edge: %v", err)
+	}
+
+	err = d.notify(ctx, tx, DagEvent{Kind: DagEventEdgeAdded, NodeID: child.NodeID, RootID: child.GraphID, ParentIDs: []int{parent.NodeID}})
+	if err != nil {
+		return err
+	}
+
+	// Commit the transaction
+	err = tx.Commit()
+	if err != nil {
+		return fmt.Errorf("failed to commit transaction: %v", err)
+	}
+
+	d.InvalidatePlanCache()
+
+	return nil
+}
+
+// RemoveCrossGraphEdge removes the edge between parentID and childID added with AddCrossGraphEdge
+func (d *Daggo) RemoveCrossGraphEdge(parentID int, childID int) error {
+	return d.RemoveCrossGraphEdgeContext(context.Background(), parentID, childID)
+}
+
+// RemoveCrossGraphEdgeContext is RemoveCrossGraphEdge with a context bounding its queries
+func (d *Daggo) RemoveCrossGraphEdgeContext(ctx context.Context, parentID int, childID int) error {
+	var rootID int
+	query := "DELETE FROM dag_cross_edge e USING dag WHERE e.parent_id = $1 AND e.child_id = $2 AND dag.id = e.child_id RETURNING dag.root_id"
+	err := d.db.GetContext(ctx, &rootID, query, parentID, childID)
+	if err == sql.ErrNoRows {
+		return fmt.Errorf("cross-graph edge from %d to %d does not exist", parentID, childID)
+	} else if err != nil {
+		return fmt.Errorf("failed to remove cross-graph edge: %v", err)
+	}
+
+	err = d.notify(ctx, d.db, DagEvent{Kind: DagEventEdgeRemoved, NodeID: childID, RootID: rootID, ParentIDs: []int{parentID}})
+	if err != nil {
+		return err
+	}
+
+	d.InvalidatePlanCache()
+
+	return nil
+}
+
+// GetCrossGraphEdges returns the edges leading into or out of the graph rooted at graphID from other graphs,
+// ordered by parent and child ID, i.e. the references between the graph and the rest of the database
+func (d *Daggo) GetCrossGraphEdges(graphID int) ([]CrossEdge, error) {
+	return d.GetCrossGraphEdgesContext(context.Background(), graphID)
+}
+
+// GetCrossGraphEdgesContext is GetCrossGraphEdges with a context bounding its queries
+func (d *Daggo) GetCrossGraphEdgesContext(ctx context.Context, graphID int) ([]CrossEdge, error) {
+	query := `
+		SELECT p.root_id AS parent_root_id, e.parent_id, c.root_id AS child_root_id, e.child_id, e.created_at
+		FROM dag_cross_edge e
+		JOIN dag p ON p.id = e.parent_id
+		JOIN dag c ON c.id = e.child_id
+		WHERE p.root_id = $1 OR c.root_id = $1
+		ORDER BY e.parent_id, e.child_id
+	`
+	return d.selectCrossEdges(ctx, query, graphID)
+}
+
+// GetNodeReferences returns the edges between the node with the given ID and nodes of other graphs, in both
+// directions, ordered by parent and child ID
+func (d *Daggo) GetNodeReferences(nodeID int) ([]CrossEdge, error) {
+	return d.GetNodeReferencesContext(context.Background(), nodeID)
+}
+
+// GetNodeReferencesContext is GetNodeReferences with a context bounding its queries
+func (d *Daggo) GetNodeReferencesContext(ctx context.Context, nodeID int) ([]CrossEdge, error) {
+	query := `
+		SELECT p.root_id AS parent_root_id, e.parent_id, c.root_id AS child_root_id, e.child_id, e.created_at
+		FROM dag_cross_edge e
+		JOIN dag p ON p.id = e.parent_id
+		JOIN dag c ON c.id = e.child_id
+		WHERE e.parent_id = $1 OR e.child_id = $1
+		ORDER BY e.parent_id, e.child_id
+	`
+	return d.selectCrossEdges(ctx, query, nodeID)
+}
+
+// selectCrossEdges runs a query returning cross-graph edges with the graphs of their ends
+func (d *Daggo) selectCrossEdges(ctx context.Context, query string, args ...interface{}) ([]CrossEdge, error) {
+	rows := make([]struct {
+		ParentRootID int       `db:"parent_root_id"`
+		ParentID     int       `db:"parent_id"`
+		ChildRootID  int       `db:"child_root_id"`
+		ChildID      int       `db:"child_id"`
+		CreatedAt    time.Time `db:"created_at"`
+	}, 0)
+	err := d.db.SelectContext(ctx, &rows, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get cross-graph edges: %v", err)
+	}
+
+	edges := make([]CrossEdge, 0, len(rows))
+	for _, row := range rows {
+		edges = append(edges, CrossEdge{
+			Parent:    NodeRef{GraphID: row.ParentRootID, NodeID: row.ParentID},
+			Child:     NodeRef{GraphID: row.ChildRootID, NodeID: row.ChildID},
+			CreatedAt: row.CreatedAt,
+		})
+	}
+
+	return edges, nil
+}
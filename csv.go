@@ -0,0 +1,188 @@
+package daggo
+
+import (
+	"context"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+)
+
+// CSV columns
+const (
+	CSVColumnID        = "id"
+	CSVColumnParentID  = "parent_id"
+	CSVColumnRootID    = "root_id"
+	CSVColumnCreatedAt = "created_at"
+	CSVColumnUpdatedAt = "updated_at"
+	CSVColumnCreatedBy = "created_by"
+	CSVColumnUpdatedBy = "updated_by"
+)
+
+// defaultCSVColumns are the structural columns, which every dag table has
+var defaultCSVColumns = []string{CSVColumnID, CSVColumnParentID, CSVColumnRootID}
+
+// CSVOption configures CSV output
+type CSVOption func(*csvOptions)
+
+type csvOptions struct {
+	columns  []string
+	noHeader bool
+}
+
+// WithCSVColumns selects the columns written and their order; id, parent_id and root_id by default
+func WithCSVColumns(columns ...string) CSVOption {
+	return func(o *csvOptions) {
+		o.columns = columns
+	}
+}
+
+// WithoutCSVHeader omits the header row
+func WithoutCSVHeader() CSVOption {
+	return func(o *csvOptions) {
+		o.noHeader = true
+	}
+}
+
+// CSVWriter streams nodes as CSV rows. Its WriteNodes method can be passed directly as the batch callback of
+// WalkPartitioned.
+type CSVWriter struct {
+	w             *csv.Writer
+	options       csvOptions
+	headerWritten bool
+}
+
+// NewCSVWriter creates a CSVWriter writing to w
+func NewCSVWriter(w io.Writer, opts ...CSVOption) (*CSVWriter, error) {
+	options := csvOptions{columns: defaultCSVColumns}
+	for _, opt := range opts {
+		opt(&options)
+	}
+	for _, column := range options.columns {
+		if _, err := csvField(DagNode{}, column); err != nil {
+			return nil, err
+		}
+	}
+
+	return &CSVWriter{w: csv.NewWriter(w), options: options}, nil
+}
+
+// WriteNodes writes one row per node, preceded by the header on the first call, and flushes them
+func (cw *CSVWriter) WriteNodes(nodes []DagNode) error {
+	if !cw.headerWritten && !cw.options.noHeader {
+		if err := cw.w.Write(cw.options.columns); err != nil {
+			return fmt.Errorf("failed to write CSV header: %v", err)
+		}
+	}
+	cw.headerWritten = true
+
+	record := make([]string, len(cw.options.columns))
+	for _, node := range nodes {
+		for i, column := range cw.options.columns {
+			record[i], _ = csvField(node, column)
+		}
+		if err := cw.w.Write(record); err != nil {
+			return fmt.Errorf("failed to write CSV row: %v", err)
+		}
+	}
+
+	cw.w.Flush()
+	return cw.w.Error()
+}
+
+// WriteCSV writes nodes to w as CSV
+func WriteCSV(w io.Writer, nodes []DagNode, opts ...CSVOption) error {
+	cw, err := NewCSVWriter(w, opts...)
+	if err != nil {
+		return err
+	}
+	return cw.WriteNodes(nodes)
+}
+
+// csvField formats a column of node; NULL values are written as empty fields
+func csvField(node DagNode, column string) (string, error) {
+	formatTime := func(t time.Time) string {
+		if t.IsZero() {
+			return ""
+		}
+		return t.Format(time.RFC3339Nano)
+	}
+
+	switch column {
+	case CSVColumnID:
+		return strconv.Itoa(node.ID), nil
+	case CSVColumnParentID:
+		if !node.ParentID.Valid {
+			return "", nil
+		}
+		return strconv.FormatInt(node.ParentID.Int64, 10), nil
+	case CSVColumnRootID:
+		return strconv.Itoa(node.RootID), nil
+	case CSVColumnCreatedAt:
+		return formatTime(node.CreatedAt), nil
+	case CSVColumnUpdatedAt:
+		return formatTime(node.UpdatedAt), nil
+	case CSVColumnCreatedBy:
+		return node.CreatedBy.String, nil
+	case CSVColumnUpdatedBy:
+		return node.UpdatedBy.String, nil
+	default:
+		return "", fmt.Errorf("unknown CSV column %q", column)
+	}
+}
+
+// ImportCSV imports nodes from CSV rows with a header naming at least the id and parent_id columns, as written
+// by CSVWriter; other columns are ignored. An empty parent_id makes the node a root, and the parent of a node
+// must exist or be imported along with it. The report lists the issues found by validation, which fail the
+// import with ErrInvalidImport.
+func (d *Daggo) ImportCSV(r io.Reader, opts ...ImportOption) (*ImportReport, error) {
+	return d.ImportCSVContext(context.Background(), r, opts...)
+}
+
+// ImportCSVContext is ImportCSV with a context bounding its queries
+func (d *Daggo) ImportCSVContext(ctx context.Context, r io.Reader, opts ...ImportOption) (*ImportReport, error) {
+	cr := csv.NewReader(r)
+	header, err := cr.Read()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read CSV header: %v", err)
+	}
+	idColumn, parentColumn := -1, -1
+	for i, column := range header {
+		switch column {
+		case CSVColumnID:
+			idColumn = i
+		case CSVColumnParentID:
+			parentColumn = i
+		}
+	}
+	if idColumn < 0 || parentColumn < 0 {
+		return nil, fmt.Errorf("CSV header must name the %s and %s columns", CSVColumnID, CSVColumnParentID)
+	}
+
+	nodes := make([]NewNode, 0)
+	for line := 2; ; line++ {
+		record, err := cr.Read()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, fmt.Errorf("failed to read CSV row: %v", err)
+		}
+
+		id, err := strconv.Atoi(record[idColumn])
+		if err != nil {
+			return nil, fmt.Errorf("invalid node ID %q on line %d", record[idColumn], line)
+		}
+		node := NewNode{ID: id}
+		if record[parentColumn] != "" {
+			parentID, err := strconv.Atoi(record[parentColumn])
+			if err != nil {
+				return nil, fmt.Errorf("invalid parent ID %q on line %d", record[parentColumn], line)
+			}
+			node.ParentIDs = []int{parentID}
+		}
+		nodes = append(nodes, node)
+	}
+
+	return d.importNodes(ctx, nodes, newImportOptions(opts))
+}
@@ -0,0 +1,54 @@
+package daggo
+
+import (
+	"bytes"
+	"encoding/gob"
+	"fmt"
+)
+
+// dagSnapshotVersion is bumped whenever the binary layout of a Dag changes
+const dagSnapshotVersion = 1
+
+// dagSnapshot is the gob-encoded form of a Dag
+type dagSnapshot struct {
+	Version int
+	Root    DagNode
+	Nodes   []DagNode
+}
+
+// MarshalBinary encodes the Dag with gob so warm caches of large graphs can be persisted to disk
+func (g *Dag) MarshalBinary() ([]byte, error) {
+	if g.Root == nil {
+		return nil, fmt.Errorf("cannot encode a dag without root")
+	}
+
+	snapshot := dagSnapshot{Version: dagSnapshotVersion, Root: *g.Root}
+	for _, children := range g.Nodes {
+		for _, node := range children {
+			snapshot.Nodes = append(snapshot.Nodes, *node)
+		}
+	}
+
+	var buf bytes.Buffer
+	err := gob.NewEncoder(&buf).Encode(snapshot)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode dag: %v", err)
+	}
+
+	return buf.Bytes(), nil
+}
+
+// UnmarshalBinary decodes a Dag encoded by MarshalBinary, replacing the content of g
+func (g *Dag) UnmarshalBinary(data []byte) error {
+	var snapshot dagSnapshot
+	err := gob.NewDecoder(bytes.NewReader(data)).Decode(&snapshot)
+	if err != nil {
+		return fmt.Errorf("failed to decode dag: %v", err)
+	}
+	if snapshot.Version != dagSnapshotVersion {
+		return fmt.Errorf("unsupported dag snapshot version %d", snapshot.Version)
+	}
+
+	*g = *newDag(&snapshot.Root, snapshot.Nodes)
+	return nil
+}
@@ -0,0 +1,171 @@
+package daggo
+
+import (
+	"context"
+	"fmt"
+	"sync"
+)
+
+// subtreeQuery selects the nodes of the subtree rooted at $1, the root included
+const subtreeQuery = `
+	WITH RECURSIVE subtree AS (
+		SELECT id FROM dag WHERE id = $1
+		UNION
+		SELECT dag.id FROM dag JOIN subtree ON dag.parent_id = subtree.id
+	)
+	SELECT dag.*
+	FROM dag
+	JOIN subtree ON dag.id = subtree.id
+	ORDER BY dag.id ASC
+`
+
+// LoadDag hydrates the graph rooted at rootID into an in-memory Dag with a single query, so that repeated
+// traversals can run without going back to the database. Nodes are attached to their primary parent.
+func (d *Daggo) LoadDag(rootID int, opts ...TraversalOption) (*Dag, error) {
+	return d.LoadDagContext(context.Background(), rootID, opts...)
+}
+
+// LoadDagContext is LoadDag with a context bounding its queries
+func (d *Daggo) LoadDagContext(ctx context.Context, rootID int, opts ...TraversalOption) (*Dag, error) {
+	ctx = WithOperation(ctx, OpLoadDag)
+
+	nodes := make([]DagNode, 0)
+	err := d.reader(ctx, newTraversalOptions(opts).consistency).SelectContext(ctx, &nodes, "SELECT * FROM dag WHERE root_id = $1 ORDER BY id ASC", rootID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load graph: %v", err)
+	}
+
+	for i := range nodes {
+		if nodes[i].ID == rootID {
+			return newDag(&nodes[i], nodes), nil
+		}
+	}
+
+	return nil, fmt.Errorf("node with ID %d is not the root of a graph", rootID)
+}
+
+// LoadDagParallel hydrates the graph rooted at rootID into an in-memory Dag by splitting the IDs of its nodes
+// into ranges fetched concurrently with at most workers queries in flight. It is meant for wide graphs, where a
+// single query leaves the database mostly idle, and loads the same nodes as LoadDag.
+func (d *Daggo) LoadDagParallel(ctx context.Context, rootID int, workers int) (*Dag, error) {
+	if workers <= 0 {
+		workers = 1
+	}
+	ctx = WithOperation(ctx, OpLoadDag)
+
+	var root DagNode
+	err := d.db.GetContext(ctx, &root, "SELECT * FROM dag WHERE id = $1", rootID)
+	if err != nil {
+		if isNoRows(err) {
+			return nil, fmt.Errorf("%w: %d", ErrNodeNotFound, rootID)
+		}
+		return nil, fmt.Errorf("failed to get root node: %v", err)
+	}
+	if root.RootID != rootID {
+		return nil, fmt.Errorf("node with ID %d is not the root of a graph", rootID)
+	}
+
+	var bounds struct {
+		Min int `db:"min"`
+		Max int `db:"max"`
+	}
+	err = d.db.GetContext(ctx, &bounds, "SELECT min(id) AS min, max(id) AS max FROM dag WHERE root_id = $1", rootID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get ID range of graph: %v", err)
+	}
+
+	// Ranges of equal width, the last one taking the remainder
+	width := (bounds.Max-bounds.Min)/workers + 1
+	ranges := make([][2]int, 0, workers)
+	for low := bounds.Min; low <= bounds.Max; low += width {
+		ranges = append(ranges, [2]int{low, min(low+width-1, bounds.Max)})
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	jobs := make(chan int)
+	results := make([][]DagNode, len(ranges))
+	errs := make(chan error, 1)
+	var wg sync.WaitGroup
+	for w := 0; w < workers && w < len(ranges); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				nodes := make([]DagNode, 0)
+				query := "SELECT * FROM dag WHERE root_id = $1 AND id BETWEEN $2 AND $3 ORDER BY id ASC"
+				err := d.db.SelectContext(ctx, &nodes, query, rootID, ranges[i][0], ranges[i][1])
+				if err != nil {
+					select {
+					case errs <- fmt.Errorf("failed to load nodes %d to %d: %v", ranges[i][0], ranges[i][1], err):
+					default:
+					}
+					cancel()
+					return
+				}
+				results[i] = nodes
+			}
+		}()
+	}
+
+feed:
+	for i := range ranges {
+		select {
+		case jobs <- i:
+		case <-ctx.Done():
+			break feed
+		}
+	}
+	close(jobs)
+	wg.Wait()
+
+	select {
+	case err := <-errs:
+		return nil, err
+	default:
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	nodes := make([]DagNode, 0)
+	for _, chunk := range results {
+		nodes = append(nodes, chunk...)
+	}
+
+	return newDag(&root, nodes), nil
+}
+
+// newDag assembles a Dag from its root and the rest of its nodes. Nodes are indexed by parent ID and their
+// ChildIDs are filled from the loaded structure.
+func newDag(root *DagNode, nodes []DagNode) *Dag {
+	dag := &Dag{Root: root, Nodes: make(map[int][]*DagNode)}
+
+	byID := map[int]*DagNode{root.ID: root}
+	all := make([]*DagNode, 0, len(nodes))
+	for i := range nodes {
+		if nodes[i].ID == root.ID {
+			continue
+		}
+		byID[nodes[i].ID] = &nodes[i]
+		all = append(all, &nodes[i])
+	}
+
+	root.ChildIDs = nil
+	for _, node := range all {
+		node.ChildIDs = nil
+	}
+	for _, node := range all {
+		if !node.ParentID.Valid {
+			continue
+		}
+		parentID := int(node.ParentID.Int64)
+		dag.Nodes[parentID] = append(dag.Nodes[parentID], node)
+		if parent, ok := byID[parentID]; ok {
+			parent.ChildIDs = append(parent.ChildIDs, node.ID)
+		}
+	}
+
+	return dag
+}
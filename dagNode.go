@@ -1,15 +1,37 @@
 package daggo
 
 import (
+	"context"
 	"database/sql"
+	"errors"
 	"fmt"
+	"time"
 )
 
-func (d *Daggo) GetNodeByID(nodeID int) (*DagNode, error) {
+// ErrNodeNotFound is returned when an operation targets a node that does not exist
+var ErrNodeNotFound = errors.New("node not found")
+
+// ErrNodeExists is returned when a node is added with an ID that is already taken
+var ErrNodeExists = errors.New("node already exists")
+
+// ErrParentNotFound is returned when a node is given a parent that does not exist
+var ErrParentNotFound = errors.New("parent node not found")
+
+// ErrHasChildren is returned when a node that still has children is deleted on its own
+var ErrHasChildren = errors.New("node has children")
+
+// GetNodeByID returns the node with the given ID, or nil if it does not exist
+func (d *Daggo) GetNodeByID(nodeID int, opts ...TraversalOption) (*DagNode, error) {
+	return d.GetNodeByIDContext(context.Background(), nodeID, opts...)
+}
+
+// GetNodeByIDContext is GetNodeByID with a context bounding its queries
+func (d *Daggo) GetNodeByIDContext(ctx context.Context, nodeID int, opts ...TraversalOption) (*DagNode, error) {
 	var node DagNode
+	options := newTraversalOptions(opts)
 
 	query := "SELECT * FROM dag WHERE id = $1"
-	err := d.db.Get(&node, query, nodeID)
+	err := d.reader(ctx, options.consistency).GetContext(ctx, &node, query, nodeID)
 	if err == sql.ErrNoRows {
 		return nil, nil // No node found
 	} else if err != nil {
@@ -19,30 +41,54 @@ func (d *Daggo) GetNodeByID(nodeID int) (*DagNode, error) {
 	return &node, nil
 }
 
-// GetNextChildrenNodes GetNode returns the immediate children nodes of the given node ID
-func (d *Daggo) GetNextChildrenNodes(nodeID int) ([]DagNode, error) {
+// GetNextChildrenNodes GetNode returns the immediate children nodes of the given node ID, ordered by ID unless
+// WithOrder is given or the graph has an Order setting
+func (d *Daggo) GetNextChildrenNodes(nodeID int, opts ...TraversalOption) ([]DagNode, error) {
+	return d.GetNextChildrenNodesContext(context.Background(), nodeID, opts...)
+}
+
+// GetNextChildrenNodesContext is GetNextChildrenNodes with a context bounding its queries
+func (d *Daggo) GetNextChildrenNodesContext(ctx context.Context, nodeID int, opts ...TraversalOption) ([]DagNode, error) {
 	dagNodes := make([]DagNode, 0)
+	options := newTraversalOptions(opts)
 
-	query := "SELECT * FROM dag WHERE parent_id = $1 ORDER BY id ASC"
-	err := d.db.Select(&dagNodes, query, nodeID)
+	query := "SELECT dag.* FROM dag JOIN dag_edge ON dag_edge.child_id = dag.id WHERE dag_edge.parent_id = $1 ORDER BY " +
+		options.order.orderBy()
+	err := d.reader(ctx, options.consistency).SelectContext(ctx, &dagNodes, query, nodeID)
 	if err != nil {
 		return nil, err
 	}
 
 	if dagNodes == nil {
 		return []DagNode{}, nil
-	} else {
-		return dagNodes, nil
 	}
+
+	// Children share the graph of their parent, whose settings give the default order
+	if !options.orderSet && len(dagNodes) > 1 {
+		settings, err := d.graphSettings(ctx, dagNodes[0].RootID)
+		if err != nil {
+			return nil, err
+		}
+		if settings.Order != OrderByID {
+			sortNodes(dagNodes, settings.Order)
+		}
+	}
+
+	return dagNodes, nil
 }
 
-// GetParentNode returns the immediate parent node of the given node
+// GetParentNode returns the primary parent of the given node; use GetParentNodes for all of its parents
 func (d *Daggo) GetParentNode(nodeID int) (*DagNode, error) {
+	return d.GetParentNodeContext(context.Background(), nodeID)
+}
+
+// GetParentNodeContext is GetParentNode with a context bounding its queries
+func (d *Daggo) GetParentNodeContext(ctx context.Context, nodeID int) (*DagNode, error) {
 	var node DagNode
 
 	// Query the database for the parent of the node with the given nodeID
-	query := "SELECT * FROM dag WHERE child_id = $1"
-	err := d.db.Get(&node, query, nodeID)
+	query := "SELECT parent.* FROM dag parent JOIN dag child ON child.parent_id = parent.id WHERE child.id = $1"
+	err := d.db.GetContext(ctx, &node, query, nodeID)
 	if err == sql.ErrNoRows {
 		return nil, nil // No parent node found when it's the root node
 	} else if err != nil {
@@ -52,137 +98,292 @@ func (d *Daggo) GetParentNode(nodeID int) (*DagNode, error) {
 	return &node, nil
 }
 
-// GetRootNode returns the root node of the given node
+// GetRootNode returns the root node of the given node, or an error wrapping ErrNodeNotFound when the node or its
+// root does not exist
 func (d *Daggo) GetRootNode(nodeID int) (*DagNode, error) {
+	return d.GetRootNodeContext(context.Background(), nodeID)
+}
+
+// GetRootNodeContext is GetRootNode with a context bounding its queries
+func (d *Daggo) GetRootNodeContext(ctx context.Context, nodeID int) (*DagNode, error) {
 	var node DagNode
 
-	query := "SELECT * FROM dag WHERE root_id = $1"
-	err := d.db.Get(&node, query, nodeID)
+	query := "SELECT root.* FROM dag root JOIN dag node ON node.root_id = root.id WHERE node.id = $1"
+	err := d.db.GetContext(ctx, &node, query, nodeID)
 	if err == sql.ErrNoRows {
-		return nil, fmt.Errorf("no root node found for node %d", nodeID)
+		return nil, fmt.Errorf("%w: no root node found for node %d", ErrNodeNotFound, nodeID)
 	} else if err != nil {
-		return nil, err
+		return nil, fmt.Errorf("failed to get root node: %v", err)
 	}
 	return &node, nil
 }
 
-// GetDescendants returns all descendants of the given node ID
-func (d *Daggo) GetDescendants(nodeID int) ([]DagNode, error) {
+// GetRootNodes returns every root node, ordered by ID
+func (d *Daggo) GetRootNodes() ([]DagNode, error) {
+	return d.GetRootNodesContext(context.Background())
+}
+
+// GetRootNodesContext is GetRootNodes with a context bounding its queries
+func (d *Daggo) GetRootNodesContext(ctx context.Context) ([]DagNode, error) {
+	roots := make([]DagNode, 0)
+
+	err := d.db.SelectContext(ctx, &roots, "SELECT * FROM dag WHERE parent_id IS NULL ORDER BY id ASC")
+	if err != nil {
+		return nil, fmt.Errorf("failed to get root nodes: %v", err)
+	}
+
+	return roots, nil
+}
+
+// GetDescendants returns all descendants of the given node ID, ordered by ID. Nodes with several parents are
+// followed through all of them, unless the adjacency layout is active. WithMaxDepth, WithLimit and WithCursor
+// bound and page the result; DescendantsIter streams it instead.
+func (d *Daggo) GetDescendants(nodeID int, opts ...TraversalOption) ([]DagNode, error) {
+	return d.GetDescendantsContext(context.Background(), nodeID, opts...)
+}
+
+// GetDescendantsContext is GetDescendants with a context bounding its queries
+func (d *Daggo) GetDescendantsContext(ctx context.Context, nodeID int, opts ...TraversalOption) ([]DagNode, error) {
 	descendants := make([]DagNode, 0)
 
-	query := `
-		WITH RECURSIVE cte AS (
-			SELECT *
-			FROM dag
-			WHERE parent_id = $1
-			UNION ALL
-			SELECT dag.*
-			FROM dag
-			JOIN cte ON dag.parent_id = cte.child_id
-		)
-		SELECT DISTINCT d.*
-		FROM cte
-		JOIN unnest(cte.child_id) AS c ON d.id = c
-	`
+	// The query reads the active storage layout, or the edges across graphs when crossing them
+	options := newTraversalOptions(opts)
+	ctx, cancel := options.withTimeout(ctx)
+	defer cancel()
+	if options.partial {
+		return d.traversePartial(WithOperation(ctx, OpDescendants), Down, nodeID, options)
+	}
+	query, args, err := d.traversalQueryFor(ctx, Down, nodeID, options)
+	if err != nil {
+		return nil, err
+	}
 
 	// Execute the query and retrieve the descendants
-	err := d.db.Select(&descendants, query, nodeID)
+	ctx = WithOperation(ctx, OpDescendants)
+	err = d.reader(ctx, options.consistency).SelectContext(ctx, &descendants, query, args...)
 	if err != nil {
 		return nil, err
 	}
 
-	if descendants == nil {
-		return []DagNode{}, nil
-	} else {
-		return descendants, nil
-	}
+	return options.truncate(descendants)
 }
 
-// GetAncestors returns all ancestors of the given node ID
-func (d *Daggo) GetAncestors(nodeID int) ([]DagNode, error) {
+// GetAncestors returns all ancestors of the given node ID, ordered by ID. Nodes with several parents are
+// followed through all of them, unless the adjacency layout is active. WithMaxDepth, WithLimit and WithCursor
+// bound and page the result.
+func (d *Daggo) GetAncestors(nodeID int, opts ...TraversalOption) ([]DagNode, error) {
+	return d.GetAncestorsContext(context.Background(), nodeID, opts...)
+}
+
+// GetAncestorsContext is GetAncestors with a context bounding its queries
+func (d *Daggo) GetAncestorsContext(ctx context.Context, nodeID int, opts ...TraversalOption) ([]DagNode, error) {
 	ancestors := make([]DagNode, 0)
 
-	query := `
-		WITH RECURSIVE cte AS (
-			SELECT *
-			FROM dag
-			WHERE child_id = $1
-			UNION ALL
-			SELECT dag.*
-			FROM dag
-			JOIN cte ON dag.child_id = cte.parent_id
-		)
-		SELECT DISTINCT d.*
-		FROM cte
-		JOIN unnest(cte.parent_id) AS p ON d.id = p
-	`
+	// The query reads the active storage layout, or the edges across graphs when crossing them
+	options := newTraversalOptions(opts)
+	ctx, cancel := options.withTimeout(ctx)
+	defer cancel()
+	if options.partial {
+		return d.traversePartial(WithOperation(ctx, OpAncestors), Up, nodeID, options)
+	}
+	query, args, err := d.traversalQueryFor(ctx, Up, nodeID, options)
+	if err != nil {
+		return nil, err
+	}
 
 	// Execute the query and retrieve the ancestors
-	err := d.db.Select(&ancestors, query, nodeID)
+	ctx = WithOperation(ctx, OpAncestors)
+	err = d.reader(ctx, options.consistency).SelectContext(ctx, &ancestors, query, args...)
 	if err != nil {
 		return nil, err
 	}
 
-	if ancestors == nil {
-		return []DagNode{}, nil
-	} else {
-		return ancestors, nil
-	}
+	return options.truncate(ancestors)
 }
 
-// AddChildNode creates a new node with the given ID and parent ID
+// AddChildNode creates a new node with the given ID and parent ID. It fails with ErrCycleDetected if the edge to
+// the parent would close a cycle
 func (d *Daggo) AddChildNode(id int, parentID int) error {
+	return d.AddChildNodeContext(context.Background(), id, parentID)
+}
+
+// AddChildNodeContext is AddChildNode with a context bounding its queries
+func (d *Daggo) AddChildNodeContext(ctx context.Context, id int, parentID int) error {
+	if id == parentID {
+		return fmt.Errorf("%w: node %d", ErrSelfEdge, id)
+	}
+
 	// Check if node with given ID already exists in the database
-	existingNode, err := d.GetNodeByID(id)
+	existingNode, err := d.GetNodeByIDContext(ctx, id)
 	if err != nil {
 		return err
 	}
 	if existingNode != nil {
-		return fmt.Errorf("node with ID %d already exists", id)
+		if existingNode.ParentID.Valid && int(existingNode.ParentID.Int64) == parentID {
+			return fmt.Errorf("%w: from %d to %d", ErrDuplicateEdge, parentID, id)
+		}
+		return fmt.Errorf("%w: %d", ErrNodeExists, id)
 	}
 
-	// Get root ID for new node
-	parentNode, err := d.GetParentNode(parentID)
+	// The settings are read before the transaction starts, as the only connection of a Daggo from WithTx is held
+	// by the transaction until it ends
+	parent, err := d.GetNodeByIDContext(ctx, parentID)
+	if err != nil {
+		return err
+	}
+	if parent == nil {
+		return fmt.Errorf("%w: %d", ErrParentNotFound, parentID)
+	}
+	settings, err := d.graphSettings(ctx, parent.RootID)
 	if err != nil {
 		return err
 	}
+
+	// Start a transaction
+	tx, err := d.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %v", err)
+	}
+	defer func() {
+		// Rollback the transaction if it failed to commit
+		if p := recover(); p != nil {
+			tx.Rollback()
+			panic(p)
+		} else if err != nil {
+			tx.Rollback()
+		}
+	}()
+
+	// Lock the parent so that it cannot be deleted or moved before the child is inserted, and get its root ID
+	var parentNode DagNode
+	err = tx.GetContext(ctx, &parentNode, "SELECT * FROM dag WHERE id = $1 FOR SHARE", parentID)
+	if err == sql.ErrNoRows {
+		err = fmt.Errorf("%w: %d", ErrParentNotFound, parentID)
+		return err
+	} else if err != nil {
+		return fmt.Errorf("failed to get parent node: %v", err)
+	}
 	rootID := parentNode.RootID
+	if rootID != parent.RootID {
+		err = fmt.Errorf("parent %d moved to graph %d while adding node %d", parentID, rootID, id)
+		return err
+	}
+
+	if settings.MaxDepth > 0 {
+		err = checkDepth(ctx, tx, parentID, id, settings.MaxDepth)
+		if err != nil {
+			return err
+		}
+	}
+
+	// Edges left behind by rows written outside of daggo can already lead from the new ID to the parent
+	err = checkCycle(ctx, tx, parentID, id)
+	if err != nil {
+		return err
+	}
+
+	// Refuse the insert if it would exceed the graph or tenant quota
+	if d.enforceQuotas {
+		err = checkQuota(ctx, tx, rootID, 1)
+		if err != nil {
+			return err
+		}
+	}
 
 	// Insert new node into database
 	query := "INSERT INTO dag (id, parent_id, root_id) VALUES ($1, $2, $3)"
-	_, err = d.db.Exec(query, id, parentID, rootID)
+	args := []interface{}{id, parentID, rootID}
+	if actor := d.actor(ctx); actor != "" {
+		query = "INSERT INTO dag (id, parent_id, root_id, created_by) VALUES ($1, $2, $3, $4)"
+		args = append(args, actor)
+	}
+	_, err = tx.ExecContext(ctx, query, args...)
+	if isConstraintViolation(err, "dag_pkey") {
+		err = fmt.Errorf("%w: %d", ErrNodeExists, id)
+		return err
+	} else if err != nil {
+		err = fmt.Errorf("failed to add child node: %w", edgeError(err, parentID, id))
+		return err
+	}
+	if settings.DefaultEdgeLabel != "" {
+		err = labelEdge(ctx, tx, parentID, id, settings.DefaultEdgeLabel)
+		if err != nil {
+			return err
+		}
+	}
+
+	err = d.notify(ctx, tx, DagEvent{Kind: DagEventNodeAdded, NodeID: id, RootID: rootID, ParentIDs: []int{parentID}})
+	if err != nil {
+		return err
+	}
+
+	// Commit the transaction
+	err = tx.Commit()
 	if err != nil {
-		return fmt.Errorf("failed to add child node: %v", err)
+		return fmt.Errorf("failed to commit transaction: %v", err)
 	}
 
+	d.InvalidatePlanCache()
+
 	return nil
 }
 
 // AddRootNode creates a new root node with the given ID
 func (d *Daggo) AddRootNode(id int) error {
+	return d.AddRootNodeContext(context.Background(), id)
+}
+
+// AddRootNodeContext is AddRootNode with a context bounding its queries
+func (d *Daggo) AddRootNodeContext(ctx context.Context, id int) error {
 	// Check if node with given ID already exists in the database
-	existingNode, err := d.GetNodeByID(id)
+	existingNode, err := d.GetNodeByIDContext(ctx, id)
 	if err != nil {
 		return err
 	}
 	if existingNode != nil {
-		return fmt.Errorf("node with ID %d already exists", id)
+		return fmt.Errorf("%w: %d", ErrNodeExists, id)
+	}
+
+	// Refuse the insert if it would exceed the quota set for the graph ahead of its creation
+	if d.enforceQuotas {
+		err = checkQuota(ctx, d.db, id, 1)
+		if err != nil {
+			return err
+		}
 	}
 
 	// Insert new root node into database
 	query := "INSERT INTO dag (id, parent_id, root_id) VALUES ($1, NULL, $1)"
-	_, err = d.db.Exec(query, id)
-	if err != nil {
+	args := []interface{}{id}
+	if actor := d.actor(ctx); actor != "" {
+		query = "INSERT INTO dag (id, parent_id, root_id, created_by) VALUES ($1, NULL, $1, $2)"
+		args = append(args, actor)
+	}
+	_, err = d.db.ExecContext(ctx, query, args...)
+	if isConstraintViolation(err, "dag_pkey") {
+		return fmt.Errorf("%w: %d", ErrNodeExists, id)
+	} else if err != nil {
 		return fmt.Errorf("failed to add root node: %v", err)
 	}
+	err = d.notify(ctx, d.db, DagEvent{Kind: DagEventNodeAdded, NodeID: id, RootID: id})
+	if err != nil {
+		return err
+	}
+
+	d.InvalidatePlanCache()
 
 	return nil
 }
 
-// DeleteChildNode deletes the node with the given ID and removes it from its parent's ChildIDs list
+// DeleteChildNode deletes the node with the given ID, which must not have children, together with its edges
 func (d *Daggo) DeleteChildNode(nodeId int) error {
+	return d.DeleteChildNodeContext(context.Background(), nodeId)
+}
+
+// DeleteChildNodeContext is DeleteChildNode with a context bounding its queries
+func (d *Daggo) DeleteChildNodeContext(ctx context.Context, nodeId int) error {
 	// Start a transaction
-	tx, err := d.db.Beginx()
+	tx, err := d.db.BeginTxx(ctx, nil)
 	if err != nil {
 		return fmt.Errorf("failed to begin transaction: %v", err)
 	}
@@ -196,43 +397,35 @@ func (d *Daggo) DeleteChildNode(nodeId int) error {
 		}
 	}()
 
-	// Get the node with the given ID
+	// Lock the node with the given ID
 	node := &DagNode{}
-	err = tx.Get(node, "SELECT * FROM DagNode WHERE ID = $1", nodeId)
-	if err != nil {
+	err = tx.GetContext(ctx, node, "SELECT * FROM dag WHERE id = $1 FOR UPDATE", nodeId)
+	if err == sql.ErrNoRows {
+		err = fmt.Errorf("%w: %d", ErrNodeNotFound, nodeId)
+		return err
+	} else if err != nil {
 		return fmt.Errorf("failed to get node: %v", err)
 	}
 
-	if node.GetChildIDs() != nil || len(node.GetChildIDs()) > 0 {
-		return fmt.Errorf("cannot delete node with children")
+	var hasChildren bool
+	err = tx.GetContext(ctx, &hasChildren, "SELECT EXISTS (SELECT 1 FROM dag_edge WHERE parent_id = $1)", nodeId)
+	if err != nil {
+		return fmt.Errorf("failed to get children: %v", err)
+	}
+	if hasChildren {
+		err = fmt.Errorf("%w: node %d", ErrHasChildren, nodeId)
+		return err
 	}
 
-	// Delete the node
-	_, err = tx.Exec("DELETE FROM DagNode WHERE ID = $1", nodeId)
+	// Delete the node; the edges to its parents go with it
+	_, err = tx.ExecContext(ctx, "DELETE FROM dag WHERE id = $1", nodeId)
 	if err != nil {
 		return fmt.Errorf("failed to delete node: %v", err)
 	}
 
-	// If the node had a parent, update its ChildIDs list
-	if node.ParentID.Valid {
-		// Get the parent node
-		parent := &DagNode{}
-		err = tx.Get(parent, "SELECT * FROM DagNode WHERE ID = $1", node.ParentID.Int64)
-		if err != nil {
-			return fmt.Errorf("failed to get parent node: %v", err)
-		}
-
-		// Remove the deleted node's ID from the parent's ChildIDs list
-		newChildIDs := make([]int, 0, len(parent.ChildIDs)-1)
-		for _, childID := range parent.ChildIDs {
-			if childID != nodeId {
-				newChildIDs = append(newChildIDs, childID)
-			}
-		}
-		_, err = tx.Exec("UPDATE DagNode SET ChildIDs = $1 WHERE ID = $2", newChildIDs, parent.ID)
-		if err != nil {
-			return fmt.Errorf("failed to update parent node: %v", err)
-		}
+	err = d.notify(ctx, tx, DagEvent{Kind: DagEventNodeDeleted, NodeID: nodeId, RootID: node.RootID})
+	if err != nil {
+		return err
 	}
 
 	// Commit the transaction
@@ -241,15 +434,26 @@ func (d *Daggo) DeleteChildNode(nodeId int) error {
 		return fmt.Errorf("failed to commit transaction: %v", err)
 	}
 
+	d.InvalidatePlanCache()
+
 	return nil
 }
 
-// DeleteNodeAndDescendants deletes the node with the given ID and all of its descendants
-func (d *Daggo) DeleteNodeAndDescendants(nodeID int) error {
+// DeleteNodeAndDescendants deletes the node with the given ID and all of its descendants, including descendants
+// that also have parents outside of the subtree, and returns the number of deleted nodes in the result. Deleting
+// a node that does not exist deletes nothing.
+func (d *Daggo) DeleteNodeAndDescendants(nodeID int) (*MutationResult, error) {
+	return d.DeleteNodeAndDescendantsContext(context.Background(), nodeID)
+}
+
+// DeleteNodeAndDescendantsContext is DeleteNodeAndDescendants with a context bounding its queries
+func (d *Daggo) DeleteNodeAndDescendantsContext(ctx context.Context, nodeID int) (*MutationResult, error) {
+	start := time.Now()
+
 	// Start a transaction
-	tx, err := d.db.Beginx()
+	tx, err := d.db.BeginTxx(ctx, nil)
 	if err != nil {
-		return fmt.Errorf("failed to begin transaction: %v", err)
+		return nil, fmt.Errorf("failed to begin transaction: %v", err)
 	}
 	defer func() {
 		// Rollback the transaction if it failed to commit
@@ -264,29 +468,51 @@ func (d *Daggo) DeleteNodeAndDescendants(nodeID int) error {
 	// Recursive query to delete the node and its descendants
 	query := `
 		WITH RECURSIVE cte AS (
-			SELECT child_id
-			FROM dag
-			WHERE parent_id = $1
-			UNION ALL
-			SELECT dag.child_id
-			FROM dag
-			JOIN cte ON dag.parent_id = any(cte.child_id)
+			SELECT $1::int AS id
+			UNION
+			SELECT dag_edge.child_id FROM dag_edge JOIN cte ON dag_edge.parent_id = cte.id
 		)
 		DELETE FROM dag
-		WHERE child_id @> (SELECT array_agg(child_id) FROM cte)
+		WHERE id IN (SELECT id FROM cte)
 	`
 
+	// The graph of the subtree is only known before it is gone
+	var rootID int
+	err = tx.GetContext(ctx, &rootID, "SELECT root_id FROM dag WHERE id = $1", nodeID)
+	if err != nil && err != sql.ErrNoRows {
+		return nil, fmt.Errorf("failed to get node: %v", err)
+	}
+
 	// Execute the recursive delete query
-	_, err = tx.Exec(query, nodeID)
+	res, err := tx.ExecContext(ctx, query, nodeID)
 	if err != nil {
-		return fmt.Errorf("failed to delete node and descendants: %v", err)
+		return nil, fmt.Errorf("failed to delete node and descendants: %v", err)
+	}
+
+	var count int64
+	count, err = res.RowsAffected()
+	if err != nil {
+		return nil, fmt.Errorf("failed to count deleted nodes: %v", err)
+	}
+	result := newMutationResult()
+	if count > 0 {
+		err = d.notify(ctx, tx, DagEvent{Kind: DagEventSubtreeDeleted, NodeID: nodeID, RootID: rootID, Count: count})
+		if err != nil {
+			return nil, err
+		}
+		result.Counts[MutationDeleted] = count
+		result.addRoot(rootID)
+		result.addNode(nodeID)
 	}
 
 	// Commit the transaction
 	err = tx.Commit()
 	if err != nil {
-		return fmt.Errorf("failed to commit transaction: %v", err)
+		return nil, fmt.Errorf("failed to commit transaction: %v", err)
 	}
 
-	return nil
+	d.InvalidatePlanCache()
+	result.Duration = time.Since(start)
+
+	return result, nil
 }
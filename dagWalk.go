@@ -0,0 +1,96 @@
+package daggo
+
+import (
+	"errors"
+)
+
+// SkipChildren is returned by a Visitor to skip the children of the node it was given
+var SkipChildren = errors.New("skip children")
+
+// Visitor is called by Walk for every node with its depth below the root. Returning SkipChildren skips the
+// children of the node; any other error stops the walk.
+type Visitor func(node *DagNode, depth int) error
+
+// Walk visits the nodes of the Dag depth-first, parents before children and children in ID order
+func (g *Dag) Walk(visitor Visitor) error {
+	if g.Root == nil {
+		return nil
+	}
+	return g.walk(g.Root, 0, visitor)
+}
+
+func (g *Dag) walk(node *DagNode, depth int, visitor Visitor) error {
+	err := visitor(node, depth)
+	if err == SkipChildren {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	for _, child := range g.Nodes[node.ID] {
+		if err := g.walk(child, depth+1, visitor); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// DFS returns the nodes of the Dag in depth-first order, parents before children
+func (g *Dag) DFS() []*DagNode {
+	nodes := make([]*DagNode, 0)
+	g.Walk(func(node *DagNode, _ int) error {
+		nodes = append(nodes, node)
+		return nil
+	})
+	return nodes
+}
+
+// BFS returns the nodes of the Dag in breadth-first order, level by level from the root
+func (g *Dag) BFS() []*DagNode {
+	nodes := make([]*DagNode, 0)
+	if g.Root == nil {
+		return nodes
+	}
+
+	nodes = append(nodes, g.Root)
+	for i := 0; i < len(nodes); i++ {
+		nodes = append(nodes, g.Nodes[nodes[i].ID]...)
+	}
+	return nodes
+}
+
+// Leaves returns the nodes of the Dag without children, in depth-first order
+func (g *Dag) Leaves() []*DagNode {
+	return g.Find(func(node *DagNode) bool {
+		return len(g.Nodes[node.ID]) == 0
+	})
+}
+
+// Depth returns the number of edges between the root and the node with the given ID, or -1 if the node is not
+// reachable from the root of the Dag
+func (g *Dag) Depth(nodeID int) int {
+	found := -1
+	g.Walk(func(node *DagNode, depth int) error {
+		if node.ID == nodeID {
+			found = depth
+			return errStopWalk
+		}
+		return nil
+	})
+	return found
+}
+
+// errStopWalk ends a walk early once its visitor found what it was looking for
+var errStopWalk = errors.New("stop walk")
+
+// Find returns the nodes of the Dag matching predicate, in depth-first order
+func (g *Dag) Find(predicate func(node *DagNode) bool) []*DagNode {
+	nodes := make([]*DagNode, 0)
+	g.Walk(func(node *DagNode, _ int) error {
+		if predicate(node) {
+			nodes = append(nodes, node)
+		}
+		return nil
+	})
+	return nodes
+}
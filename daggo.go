@@ -1,30 +1,129 @@
 package daggo
 
 import (
+	"database/sql"
+	"database/sql/driver"
 	"errors"
+	"sync"
+	"sync/atomic"
+
 	"github.com/jmoiron/sqlx"
 )
 
 // Daggo is a wrapper around sqlx.DB object
 type Daggo struct {
 	db *sqlx.DB
+
+	// driverName and dialect are only set by NewDaggoWithDriver; a nil dialect is Postgres
+	driverName string
+	dialect    *Dialect
+	// dsn is kept for the connections of Watch
+	dsn string
+
+	enforceQuotas     bool
+	adaptiveThreshold int64
+	sqlComments       bool
+	staticQueryTags   map[string]string
+	applicationName   string
+	attribution       bool
+	defaultActor      string
+	replicaDSNs       []string
+	faults            *faultInjector
+	notifications     bool
+	payloadCodecs     bool
+
+	replicas    []*sqlx.DB
+	nextReplica uint32
+	// snapshotTx is the transaction a snapshot of BeginSnapshot reads in, ended by Close
+	snapshotTx *sqlx.Tx
+
+	mu             sync.RWMutex
+	nodeTypes      map[string]*JSONSchema
+	typeCodecs     map[string]string
+	plans          map[string]*preparedPlan
+	readLayout     *StorageLayout
+	strategies     *strategyState
+	settings       map[int]cachedGraphSettings
+	planGeneration atomic.Uint64
 }
 
-// NewDaggo creates a new Daggo object given a DSN
-func NewDaggo(dsn string) (*Daggo, error) {
+// NewDaggo creates a new Daggo object given a DSN and optional behaviour options
+func NewDaggo(dsn string, opts ...Option) (*Daggo, error) {
 	if dsn == "" {
 		return nil, errors.New("DSN cannot be empty")
 	}
 
-	db, err := sqlx.Connect("postgres", dsn)
+	d := &Daggo{dsn: dsn}
+	for _, opt := range opts {
+		opt(d)
+	}
+
+	db, err := d.connect(dsn)
+	if err != nil {
+		return nil, err
+	}
+	d.db = db
+
+	for _, replicaDSN := range d.replicaDSNs {
+		replica, err := d.connect(replicaDSN)
+		if err != nil {
+			d.Close()
+			return nil, err
+		}
+		d.replicas = append(d.replicas, replica)
+	}
+
+	return d, nil
+}
+
+// connect opens a connection pool to dsn
+func (d *Daggo) connect(dsn string) (*sqlx.DB, error) {
+	if !d.sqlComments && d.faults == nil && d.dialect == nil {
+		return sqlx.Connect("postgres", dsn)
+	}
+
+	// Translate, tag every statement and inject faults by wrapping the driver connections
+	var connector driver.Connector
+	connector, err := openConnector(d.driverName, dsn)
 	if err != nil {
 		return nil, err
 	}
+	if d.Dialect() != DialectPostgres {
+		connector = &dialectConnector{Connector: connector, dialect: d.dialect}
+	}
+	if d.sqlComments {
+		connector = &commentConnector{Connector: connector, static: d.staticQueryTags, applicationName: d.applicationName}
+	}
+	if d.faults != nil {
+		connector = &faultConnector{Connector: connector, faults: d.faults}
+	}
+	db := sqlx.NewDb(sql.OpenDB(connector), "postgres")
+	if err = db.Ping(); err != nil {
+		db.Close()
+		return nil, err
+	}
 
-	return &Daggo{db: db}, nil
+	return db, nil
 }
 
-// Close closes the underlying database connection
+// Close closes the underlying database connections, and ends the transaction of a snapshot
 func (d *Daggo) Close() error {
-	return d.db.Close()
+	d.mu.Lock()
+	for _, plan := range d.plans {
+		plan.stmt.Close()
+	}
+	d.plans = nil
+	d.mu.Unlock()
+
+	for _, replica := range d.replicas {
+		replica.Close()
+	}
+	err := d.db.Close()
+	if d.snapshotTx != nil {
+		// The transaction only read, and is already gone when the context of the snapshot is done
+		if rollbackErr := d.snapshotTx.Rollback(); rollbackErr != nil && !errors.Is(rollbackErr, sql.ErrTxDone) && err == nil {
+			err = rollbackErr
+		}
+	}
+	return err
 }
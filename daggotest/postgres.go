@@ -0,0 +1,54 @@
+package daggotest
+
+import (
+	"context"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/testcontainers/testcontainers-go/modules/postgres"
+)
+
+// postgresImage is the image of the database started for the tests
+const postgresImage = "postgres:16-alpine"
+
+var (
+	postgresOnce sync.Once
+	postgresDSN  string
+	postgresErr  error
+)
+
+// PostgresDSN returns the connection string of a Postgres database for tests: the one given by the
+// DAGGO_TEST_DSN environment variable, or else a container started with testcontainers on first use and shared
+// by the tests of the process, which removes it when the process exits. The test is skipped when no container
+// runtime is available. Tests share the database, so they should empty the tables they use first.
+func PostgresDSN(tb testing.TB) string {
+	tb.Helper()
+
+	if dsn := os.Getenv("DAGGO_TEST_DSN"); dsn != "" {
+		return dsn
+	}
+
+	postgresOnce.Do(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 2*time.Minute)
+		defer cancel()
+
+		container, err := postgres.Run(ctx, postgresImage,
+			postgres.WithDatabase("daggo_test"),
+			postgres.WithUsername("postgres"),
+			postgres.WithPassword("postgres"),
+			postgres.BasicWaitStrategies(),
+		)
+		if err != nil {
+			postgresErr = err
+			return
+		}
+		postgresDSN, postgresErr = container.ConnectionString(ctx, "sslmode=disable")
+	})
+	if postgresErr != nil {
+		tb.Skipf("no Postgres for tests, set DAGGO_TEST_DSN or run a container runtime: %v", postgresErr)
+	}
+
+	return postgresDSN
+}
@@ -0,0 +1,150 @@
+// Package daggotest holds helpers for testing code that mutates daggo graphs. Run the tests with -update to
+// rewrite the golden files from the current state of the database:
+//
+//	go test ./... -run TestMoveSubtree -update
+package daggotest
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+
+	"daggo"
+)
+
+var update = flag.Bool("update", false, "rewrite daggotest golden files instead of comparing against them")
+
+// AssertGraphSnapshot serializes the subtree below rootID and compares it against goldenFile, failing the test
+// with a line diff when they differ. With -update the golden file is written instead
+func AssertGraphSnapshot(t testing.TB, d *daggo.Daggo, rootID int, goldenFile string) {
+	t.Helper()
+
+	actual, err := SnapshotGraph(d, rootID)
+	if err != nil {
+		t.Fatalf("failed to snapshot graph %d: %v", rootID, err)
+	}
+
+	if *update {
+		if err := os.MkdirAll(filepath.Dir(goldenFile), 0o755); err != nil {
+			t.Fatalf("failed to create golden file directory: %v", err)
+		}
+		if err := os.WriteFile(goldenFile, []byte(actual), 0o644); err != nil {
+			t.Fatalf("failed to write golden file: %v", err)
+		}
+		return
+	}
+
+	expected, err := os.ReadFile(goldenFile)
+	if errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("golden file %s does not exist, run the test with -update to create it", goldenFile)
+	}
+	if err != nil {
+		t.Fatalf("failed to read golden file: %v", err)
+	}
+
+	if string(expected) != actual {
+		t.Errorf("graph %d does not match %s (-golden +actual):\n%s", rootID, goldenFile, lineDiff(string(expected), actual))
+	}
+}
+
+// SnapshotGraph serializes the subtree below rootID deterministically. Node IDs are replaced by their rank in
+// ID order, so that snapshots do not depend on the state of the id sequence: the root is n0 and the other nodes
+// are numbered in creation order. Timestamps and attribution are left out
+func SnapshotGraph(d *daggo.Daggo, rootID int) (string, error) {
+	root, err := d.GetNodeByID(rootID)
+	if err != nil {
+		return "", err
+	}
+	if root == nil {
+		return "", fmt.Errorf("node %d does not exist", rootID)
+	}
+
+	descendants, err := d.GetDescendants(rootID)
+	if err != nil {
+		return "", err
+	}
+
+	labels := map[int]string{rootID: "n0"}
+	for i, node := range descendants {
+		labels[node.ID] = fmt.Sprintf("n%d", i+1)
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "nodes %d\n", len(descendants)+1)
+
+	// Edges are listed per child in ID order, parents sorted by ID
+	for _, node := range descendants {
+		parents, err := d.GetParentNodes(node.ID)
+		if err != nil {
+			return "", err
+		}
+
+		parentIDs := make([]int, 0)
+		for _, parent := range parents {
+			parentIDs = append(parentIDs, parent.ID)
+		}
+		sort.Ints(parentIDs)
+
+		for _, parentID := range parentIDs {
+			// Parents outside the subtree have no label and are kept by ID
+			label, ok := labels[parentID]
+			if !ok {
+				label = fmt.Sprintf("external(%d)", parentID)
+			}
+			primary := ""
+			if node.ParentID.Valid && int(node.ParentID.Int64) == parentID {
+				primary = " primary"
+			}
+			fmt.Fprintf(&b, "%s -> %s%s\n", label, labels[node.ID], primary)
+		}
+	}
+
+	return b.String(), nil
+}
+
+// lineDiff returns a minimal line diff of a and b, based on their longest common subsequence
+func lineDiff(a, b string) string {
+	x := strings.Split(strings.TrimSuffix(a, "\n"), "\n")
+	y := strings.Split(strings.TrimSuffix(b, "\n"), "\n")
+
+	// lcs[i][j] is the length of the longest common subsequence of x[i:] and y[j:]
+	lcs := make([][]int, len(x)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(y)+1)
+	}
+	for i := len(x) - 1; i >= 0; i-- {
+		for j := len(y) - 1; j >= 0; j-- {
+			if x[i] == y[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else if lcs[i+1][j] >= lcs[i][j+1] {
+				lcs[i][j] = lcs[i+1][j]
+			} else {
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+
+	var out strings.Builder
+	i, j := 0, 0
+	for i < len(x) || j < len(y) {
+		switch {
+		case i < len(x) && j < len(y) && x[i] == y[j]:
+			fmt.Fprintf(&out, "  %s\n", x[i])
+			i++
+			j++
+		case j < len(y) && (i == len(x) || lcs[i][j+1] >= lcs[i+1][j]):
+			fmt.Fprintf(&out, "+ %s\n", y[j])
+			j++
+		default:
+			fmt.Fprintf(&out, "- %s\n", x[i])
+			i++
+		}
+	}
+
+	return out.String()
+}
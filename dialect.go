@@ -0,0 +1,463 @@
+package daggo
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/lib/pq"
+)
+
+// ErrUnsupportedDialect is returned by the operations that need Postgres when daggo runs against another database
+var ErrUnsupportedDialect = errors.New("operation not supported by the SQL dialect")
+
+// Dialect is the SQL flavor of the database daggo runs against. Queries are written for Postgres and rewritten
+// on the fly for the other dialects, which support the core node API: adding, getting, moving and deleting
+// nodes and edges, and the traversals. Payloads, side tables and the other features need Postgres.
+type Dialect struct {
+	name string
+	// positional dialects take ? placeholders bound in order of appearance instead of $n ones
+	positional bool
+	// intType is the type integer parameters are cast to
+	intType string
+	// noRowLocks dialects have no FOR UPDATE and FOR SHARE clauses
+	noRowLocks bool
+	// schema creates the core tables and keeps the edge table in sync with the parent_id column, one
+	// statement at a time
+	schema []string
+}
+
+// Name returns the name of the dialect
+func (dl *Dialect) Name() string {
+	return dl.name
+}
+
+// DialectPostgres is the native dialect of daggo
+var DialectPostgres = &Dialect{name: "postgres"}
+
+// DialectSQLite runs daggo against SQLite 3.35+, for tests and embedded use. Writes are serialized by SQLite
+// itself, which stands in for the row locks.
+var DialectSQLite = &Dialect{
+	name:       "sqlite",
+	positional: true,
+	intType:    "INTEGER",
+	noRowLocks: true,
+	schema: []string{
+		`CREATE TABLE IF NOT EXISTS dag (
+			id INTEGER PRIMARY KEY,
+			parent_id INTEGER,
+			root_id INTEGER NOT NULL
+		)`,
+		"CREATE INDEX IF NOT EXISTS dag_parent_id_idx ON dag (parent_id)",
+		"CREATE INDEX IF NOT EXISTS dag_root_id_idx ON dag (root_id)",
+		`CREATE TABLE IF NOT EXISTS dag_edge (
+			parent_id INTEGER NOT NULL,
+			child_id INTEGER NOT NULL,
+			PRIMARY KEY (parent_id, child_id),
+			CONSTRAINT dag_edge_no_self_edge CHECK (parent_id <> child_id)
+		)`,
+		"CREATE INDEX IF NOT EXISTS dag_edge_child_id_idx ON dag_edge (child_id)",
+		`CREATE TRIGGER IF NOT EXISTS dag_sync_edge_insert_trigger AFTER INSERT ON dag
+		WHEN NEW.parent_id IS NOT NULL
+		BEGIN
+			INSERT OR IGNORE INTO dag_edge (parent_id, child_id) VALUES (NEW.parent_id, NEW.id);
+		END`,
+		`CREATE TRIGGER IF NOT EXISTS dag_sync_edge_delete_trigger AFTER DELETE ON dag
+		BEGIN
+			DELETE FROM dag_edge WHERE parent_id = OLD.id OR child_id = OLD.id;
+		END`,
+		`CREATE TRIGGER IF NOT EXISTS dag_sync_edge_move_trigger AFTER UPDATE OF parent_id ON dag
+		WHEN OLD.id = NEW.id AND OLD.parent_id IS NOT NEW.parent_id
+		BEGIN
+			DELETE FROM dag_edge WHERE parent_id = OLD.parent_id AND child_id = NEW.id;
+			INSERT OR IGNORE INTO dag_edge (parent_id, child_id) SELECT NEW.parent_id, NEW.id WHERE NEW.parent_id IS NOT NULL;
+		END`,
+	},
+}
+
+// DialectMySQL runs daggo against MySQL 8.0.16+, which has recursive CTEs and check constraints. MySQL
+// triggers cannot write a table the triggering statement reads, so deleted nodes drop their edges through
+// cascading foreign keys instead.
+var DialectMySQL = &Dialect{
+	name:       "mysql",
+	positional: true,
+	intType:    "SIGNED",
+	schema: []string{
+		`CREATE TABLE IF NOT EXISTS dag (
+			id INT PRIMARY KEY,
+			parent_id INT NULL,
+			root_id INT NOT NULL,
+			INDEX dag_parent_id_idx (parent_id),
+			INDEX dag_root_id_idx (root_id)
+		)`,
+		`CREATE TABLE IF NOT EXISTS dag_edge (
+			parent_id INT NOT NULL,
+			child_id INT NOT NULL,
+			PRIMARY KEY (parent_id, child_id),
+			INDEX dag_edge_child_id_idx (child_id),
+			CONSTRAINT dag_edge_no_self_edge CHECK (parent_id <> child_id),
+			CONSTRAINT dag_edge_parent_fk FOREIGN KEY (parent_id) REFERENCES dag (id) ON DELETE CASCADE,
+			CONSTRAINT dag_edge_child_fk FOREIGN KEY (child_id) REFERENCES dag (id) ON DELETE CASCADE
+		)`,
+		"DROP TRIGGER IF EXISTS dag_sync_edge_insert_trigger",
+		`CREATE TRIGGER dag_sync_edge_insert_trigger AFTER INSERT ON dag FOR EACH ROW
+			INSERT IGNORE INTO dag_edge (parent_id, child_id)
+			SELECT NEW.parent_id, NEW.id FROM DUAL WHERE NEW.parent_id IS NOT NULL`,
+		"DROP TRIGGER IF EXISTS dag_sync_edge_move_trigger",
+		`CREATE TRIGGER dag_sync_edge_move_trigger AFTER UPDATE ON dag FOR EACH ROW
+		BEGIN
+			IF OLD.id = NEW.id AND NOT (OLD.parent_id <=> NEW.parent_id) THEN
+				DELETE FROM dag_edge WHERE parent_id = OLD.parent_id AND child_id = NEW.id;
+				INSERT IGNORE INTO dag_edge (parent_id, child_id)
+				SELECT NEW.parent_id, NEW.id FROM DUAL WHERE NEW.parent_id IS NOT NULL;
+			END IF;
+		END`,
+	},
+}
+
+// dialectsByDriver maps the usual database/sql driver names to their dialect
+var dialectsByDriver = map[string]*Dialect{
+	"postgres": DialectPostgres,
+	"pgx":      DialectPostgres,
+	"sqlite3":  DialectSQLite,
+	"sqlite":   DialectSQLite,
+	"mysql":    DialectMySQL,
+}
+
+// NewDaggoWithDriver creates a Daggo on a database opened with the named database/sql driver, which the caller
+// registers by importing it (e.g. github.com/mattn/go-sqlite3 as "sqlite3" or github.com/go-sql-driver/mysql
+// as "mysql"). The dialect follows from the driver name. Migrate creates the core schema of every dialect.
+func NewDaggoWithDriver(driverName string, dsn string, opts ...Option) (*Daggo, error) {
+	dialect, ok := dialectsByDriver[driverName]
+	if !ok {
+		return nil, fmt.Errorf("no SQL dialect known for driver %q", driverName)
+	}
+	if dialect == DialectPostgres && driverName == "postgres" {
+		return NewDaggo(dsn, opts...)
+	}
+	if dsn == "" {
+		return nil, errors.New("DSN cannot be empty")
+	}
+
+	d := &Daggo{driverName: driverName, dialect: dialect, dsn: dsn}
+	for _, opt := range opts {
+		opt(d)
+	}
+
+	db, err := d.connect(dsn)
+	if err != nil {
+		return nil, err
+	}
+	d.db = db
+
+	for _, replicaDSN := range d.replicaDSNs {
+		replica, err := d.connect(replicaDSN)
+		if err != nil {
+			d.Close()
+			return nil, err
+		}
+		d.replicas = append(d.replicas, replica)
+	}
+
+	return d, nil
+}
+
+// Dialect returns the SQL dialect of the database
+func (d *Daggo) Dialect() *Dialect {
+	if d.dialect == nil {
+		return DialectPostgres
+	}
+	return d.dialect
+}
+
+// requirePostgres returns ErrUnsupportedDialect for operations that only run on Postgres
+func (d *Daggo) requirePostgres(operation string) error {
+	if d.Dialect() != DialectPostgres {
+		return fmt.Errorf("%w: %s needs Postgres, not %s", ErrUnsupportedDialect, operation, d.Dialect().name)
+	}
+	return nil
+}
+
+// migrateDialect creates the core schema of a dialect other than Postgres
+func (d *Daggo) migrateDialect(ctx context.Context) error {
+	for _, statement := range d.Dialect().schema {
+		_, err := d.db.ExecContext(ctx, statement)
+		if err != nil {
+			return fmt.Errorf("failed to create %s schema: %v", d.Dialect().name, err)
+		}
+	}
+	return nil
+}
+
+// openConnector returns a connector of the named driver for dsn
+func openConnector(driverName string, dsn string) (driver.Connector, error) {
+	if driverName == "" || driverName == "postgres" {
+		return pq.NewConnector(dsn)
+	}
+
+	db, err := sql.Open(driverName, dsn)
+	if err != nil {
+		return nil, err
+	}
+	drv := db.Driver()
+	db.Close()
+
+	if dc, ok := drv.(driver.DriverContext); ok {
+		return dc.OpenConnector(dsn)
+	}
+	return &dsnConnector{dsn: dsn, driver: drv}, nil
+}
+
+// dsnConnector is the connector of drivers that only open connections from a DSN
+type dsnConnector struct {
+	dsn    string
+	driver driver.Driver
+}
+
+func (c *dsnConnector) Connect(context.Context) (driver.Conn, error) {
+	return c.driver.Open(c.dsn)
+}
+
+func (c *dsnConnector) Driver() driver.Driver {
+	return c.driver
+}
+
+// translatedQuery is a query rewritten for a dialect, with the $n parameter bound by each placeholder
+type translatedQuery struct {
+	query string
+	order []int
+}
+
+var rowLockPattern = regexp.MustCompile(`(?i)\s+FOR\s+(UPDATE|SHARE)(\s+OF\s+\w+(\s*,\s*\w+)*)?(\s+SKIP\s+LOCKED|\s+NOWAIT)?`)
+
+var intTypes = map[string]bool{"int": true, "integer": true, "bigint": true, "int4": true, "int8": true}
+
+// translate rewrites a Postgres query for the dialect: $n placeholders become ? placeholders, casts of
+// parameters to integers become CAST expressions, other casts are dropped and, without row locks, so are
+// FOR UPDATE and FOR SHARE clauses. String literals and quoted identifiers are left alone.
+func (dl *Dialect) translate(query string) translatedQuery {
+	out := make([]byte, 0, len(query))
+	order := make([]int, 0)
+	placeholderStart, placeholderEnd := -1, -1
+
+	for i := 0; i < len(query); {
+		c := query[i]
+		switch {
+		case c == '\'' || c == '"':
+			end := strings.IndexByte(query[i+1:], c)
+			if end < 0 {
+				end = len(query) - i - 1
+			}
+			out = append(out, query[i:i+end+2]...)
+			i += end + 2
+		case c == '$' && i+1 < len(query) && query[i+1] >= '0' && query[i+1] <= '9':
+			j := i + 1
+			n := 0
+			for j < len(query) && query[j] >= '0' && query[j] <= '9' {
+				n = n*10 + int(query[j]-'0')
+				j++
+			}
+			placeholderStart = len(out)
+			out = append(out, '?')
+			placeholderEnd = len(out)
+			order = append(order, n)
+			i = j
+		case c == ':' && i+1 < len(query) && query[i+1] == ':':
+			j := i + 2
+			for j < len(query) && (isIdentByte(query[j]) || query[j] == '[' || query[j] == ']') {
+				j++
+			}
+			typ := strings.ToLower(query[i+2 : j])
+			if placeholderEnd == len(out) && intTypes[typ] {
+				cast := "CAST(? AS " + dl.intType + ")"
+				out = append(out[:placeholderStart], cast...)
+			}
+			i = j
+		default:
+			out = append(out, c)
+			i++
+		}
+	}
+
+	translated := string(out)
+	if dl.noRowLocks {
+		translated = rowLockPattern.ReplaceAllString(translated, "")
+	}
+	return translatedQuery{query: translated, order: order}
+}
+
+func isIdentByte(c byte) bool {
+	return c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9')
+}
+
+// bind returns the arguments in the order of the placeholders of the translated query
+func (q translatedQuery) bind(args []driver.NamedValue) ([]driver.NamedValue, error) {
+	bound := make([]driver.NamedValue, 0, len(q.order))
+	for i, n := range q.order {
+		if n < 1 || n > len(args) {
+			return nil, fmt.Errorf("query references parameter $%d but got %d arguments", n, len(args))
+		}
+		bound = append(bound, driver.NamedValue{Ordinal: i + 1, Value: args[n-1].Value})
+	}
+	return bound, nil
+}
+
+// numInput returns the number of arguments the original query takes
+func (q translatedQuery) numInput() int {
+	max := 0
+	for _, n := range q.order {
+		if n > max {
+			max = n
+		}
+	}
+	return max
+}
+
+// dialectConnector wraps a driver connector so every statement sent on its connections is translated
+type dialectConnector struct {
+	driver.Connector
+	dialect *Dialect
+	cache   sync.Map
+}
+
+func (c *dialectConnector) Connect(ctx context.Context) (driver.Conn, error) {
+	conn, err := c.Connector.Connect(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &dialectConn{Conn: conn, connector: c}, nil
+}
+
+// translate translates query, caching the result since daggo sends the same queries over and over
+func (c *dialectConnector) translate(query string) translatedQuery {
+	if cached, ok := c.cache.Load(query); ok {
+		return cached.(translatedQuery)
+	}
+	translated := c.dialect.translate(query)
+	c.cache.Store(query, translated)
+	return translated
+}
+
+// dialectConn forwards translated statements to the wrapped connection
+type dialectConn struct {
+	driver.Conn
+	connector *dialectConnector
+}
+
+func (c *dialectConn) PrepareContext(ctx context.Context, query string) (driver.Stmt, error) {
+	q := c.connector.translate(query)
+	var stmt driver.Stmt
+	var err error
+	if p, ok := c.Conn.(driver.ConnPrepareContext); ok {
+		stmt, err = p.PrepareContext(ctx, q.query)
+	} else {
+		stmt, err = c.Conn.Prepare(q.query)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &dialectStmt{Stmt: stmt, query: q}, nil
+}
+
+func (c *dialectConn) Prepare(query string) (driver.Stmt, error) {
+	return c.PrepareContext(context.Background(), query)
+}
+
+func (c *dialectConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	q, ok := c.Conn.(driver.QueryerContext)
+	if !ok {
+		return nil, driver.ErrSkip
+	}
+	translated := c.connector.translate(query)
+	bound, err := translated.bind(args)
+	if err != nil {
+		return nil, err
+	}
+	return q.QueryContext(ctx, translated.query, bound)
+}
+
+func (c *dialectConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	e, ok := c.Conn.(driver.ExecerContext)
+	if !ok {
+		return nil, driver.ErrSkip
+	}
+	translated := c.connector.translate(query)
+	bound, err := translated.bind(args)
+	if err != nil {
+		return nil, err
+	}
+	return e.ExecContext(ctx, translated.query, bound)
+}
+
+func (c *dialectConn) BeginTx(ctx context.Context, opts driver.TxOptions) (driver.Tx, error) {
+	if b, ok := c.Conn.(driver.ConnBeginTx); ok {
+		return b.BeginTx(ctx, opts)
+	}
+	return c.Conn.Begin()
+}
+
+func (c *dialectConn) Ping(ctx context.Context) error {
+	if p, ok := c.Conn.(driver.Pinger); ok {
+		return p.Ping(ctx)
+	}
+	return nil
+}
+
+func (c *dialectConn) ResetSession(ctx context.Context) error {
+	if r, ok := c.Conn.(driver.SessionResetter); ok {
+		return r.ResetSession(ctx)
+	}
+	return nil
+}
+
+func (c *dialectConn) IsValid() bool {
+	if v, ok := c.Conn.(driver.Validator); ok {
+		return v.IsValid()
+	}
+	return true
+}
+
+// dialectStmt binds the arguments of a prepared statement in the order of its translated placeholders
+type dialectStmt struct {
+	driver.Stmt
+	query translatedQuery
+}
+
+func (s *dialectStmt) NumInput() int {
+	return s.query.numInput()
+}
+
+func (s *dialectStmt) ExecContext(ctx context.Context, args []driver.NamedValue) (driver.Result, error) {
+	bound, err := s.query.bind(args)
+	if err != nil {
+		return nil, err
+	}
+	if e, ok := s.Stmt.(driver.StmtExecContext); ok {
+		return e.ExecContext(ctx, bound)
+	}
+	return s.Stmt.Exec(namedValuesToValues(bound))
+}
+
+func (s *dialectStmt) QueryContext(ctx context.Context, args []driver.NamedValue) (driver.Rows, error) {
+	bound, err := s.query.bind(args)
+	if err != nil {
+		return nil, err
+	}
+	if q, ok := s.Stmt.(driver.StmtQueryContext); ok {
+		return q.QueryContext(ctx, bound)
+	}
+	return s.Stmt.Query(namedValuesToValues(bound))
+}
+
+func namedValuesToValues(named []driver.NamedValue) []driver.Value {
+	values := make([]driver.Value, 0, len(named))
+	for _, v := range named {
+		values = append(values, v.Value)
+	}
+	return values
+}
@@ -0,0 +1,130 @@
+package daggo
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+)
+
+// Diff statuses of nodes and edges
+const (
+	DiffUnchanged = "unchanged"
+	DiffAdded     = "added"
+	DiffRemoved   = "removed"
+)
+
+// DiffNode is a node of either version of a graph with its diff status
+type DiffNode struct {
+	ID     int
+	Status string
+}
+
+// DiffEdge is a parent-child edge of either version of a graph with its diff status
+type DiffEdge struct {
+	ParentID int
+	ChildID  int
+	Status   string
+}
+
+// GraphDiff is the structural difference between two versions of a graph, sorted by ID
+type GraphDiff struct {
+	Nodes []DiffNode
+	Edges []DiffEdge
+}
+
+// DiffGraphs compares two versions of a graph keyed by node ID, such as those returned by GraphAt or
+// ProjectEventsAt. A moved node shows up as a removed edge and an added edge.
+func DiffGraphs(before, after map[int]*DagNode) *GraphDiff {
+	diff := &GraphDiff{Nodes: make([]DiffNode, 0), Edges: make([]DiffEdge, 0)}
+
+	status := func(inBefore, inAfter bool) string {
+		switch {
+		case inBefore && inAfter:
+			return DiffUnchanged
+		case inAfter:
+			return DiffAdded
+		default:
+			return DiffRemoved
+		}
+	}
+
+	type edge struct{ parentID, childID int }
+	nodes := make(map[int]bool)
+	edges := make(map[edge]bool)
+	for _, graph := range []map[int]*DagNode{before, after} {
+		for id, node := range graph {
+			nodes[id] = true
+			if node.ParentID.Valid {
+				edges[edge{int(node.ParentID.Int64), id}] = true
+			}
+		}
+	}
+	hasEdge := func(graph map[int]*DagNode, e edge) bool {
+		node, ok := graph[e.childID]
+		return ok && node.ParentID.Valid && int(node.ParentID.Int64) == e.parentID
+	}
+
+	for id := range nodes {
+		_, inBefore := before[id]
+		_, inAfter := after[id]
+		diff.Nodes = append(diff.Nodes, DiffNode{ID: id, Status: status(inBefore, inAfter)})
+	}
+	for e := range edges {
+		diff.Edges = append(diff.Edges, DiffEdge{ParentID: e.parentID, ChildID: e.childID, Status: status(hasEdge(before, e), hasEdge(after, e))})
+	}
+
+	sort.Slice(diff.Nodes, func(i, j int) bool { return diff.Nodes[i].ID < diff.Nodes[j].ID })
+	sort.Slice(diff.Edges, func(i, j int) bool {
+		if diff.Edges[i].ParentID != diff.Edges[j].ParentID {
+			return diff.Edges[i].ParentID < diff.Edges[j].ParentID
+		}
+		return diff.Edges[i].ChildID < diff.Edges[j].ChildID
+	})
+
+	return diff
+}
+
+// HasChanges reports whether anything was added or removed
+func (diff *GraphDiff) HasChanges() bool {
+	for _, node := range diff.Nodes {
+		if node.Status != DiffUnchanged {
+			return true
+		}
+	}
+	for _, edge := range diff.Edges {
+		if edge.Status != DiffUnchanged {
+			return true
+		}
+	}
+	return false
+}
+
+// GraphAt returns the nodes of the graph rooted at rootID as they were at the given time, keyed by node ID.
+// It relies on the history table.
+func (d *Daggo) GraphAt(rootID int, at time.Time) (map[int]*DagNode, error) {
+	images := make([]json.RawMessage, 0)
+	err := d.db.Select(&images, graphStateAtQuery, rootID, at)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get graph state: %v", err)
+	}
+
+	graph := make(map[int]*DagNode, len(images))
+	for _, image := range images {
+		var row struct {
+			ID       int    `json:"id"`
+			ParentID *int64 `json:"parent_id"`
+			RootID   int    `json:"root_id"`
+		}
+		if err := json.Unmarshal(image, &row); err != nil {
+			return nil, fmt.Errorf("failed to decode history row: %v", err)
+		}
+		node := &DagNode{ID: row.ID, RootID: row.RootID}
+		if row.ParentID != nil {
+			node.ParentID.Int64, node.ParentID.Valid = *row.ParentID, true
+		}
+		graph[node.ID] = node
+	}
+
+	return graph, nil
+}
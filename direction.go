@@ -0,0 +1,262 @@
+package daggo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+)
+
+// Direction selects which way a traversal follows edges
+type Direction int
+
+const (
+	// Down follows edges from parents to children
+	Down Direction = iota
+	// Up follows edges from children to parents
+	Up
+	// Both returns the union of the Down and Up traversals
+	Both
+)
+
+// String returns the name of the direction
+func (dir Direction) String() string {
+	switch dir {
+	case Down:
+		return "down"
+	case Up:
+		return "up"
+	case Both:
+		return "both"
+	default:
+		return fmt.Sprintf("Direction(%d)", int(dir))
+	}
+}
+
+// Traverse returns the nodes reachable from the given node ID in the given direction, excluding the node itself,
+// ordered by ID
+func (d *Daggo) Traverse(nodeID int, dir Direction, opts ...TraversalOption) ([]DagNode, error) {
+	return d.TraverseContext(context.Background(), nodeID, dir, opts...)
+}
+
+// TraverseContext is Traverse with a context bounding its queries
+func (d *Daggo) TraverseContext(ctx context.Context, nodeID int, dir Direction, opts ...TraversalOption) ([]DagNode, error) {
+	nodes := make([]DagNode, 0)
+	options := newTraversalOptions(opts)
+	ctx, cancel := options.withTimeout(ctx)
+	defer cancel()
+
+	if dir == Both {
+		return d.traverseBoth(ctx, nodeID, options)
+	}
+
+	if options.partial {
+		return d.traversePartial(WithOperation(ctx, OpTraverse), dir, nodeID, options)
+	}
+
+	query, args, err := d.traversalQueryFor(ctx, dir, nodeID, options)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx = WithOperation(ctx, OpTraverse)
+	err = d.reader(ctx, options.consistency).SelectContext(ctx, &nodes, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to traverse %v from node %d: %v", dir, nodeID, err)
+	}
+
+	return options.truncate(nodes)
+}
+
+// traverseBoth returns the union of the Down and Up traversals from nodeID. Descendants and ancestors are
+// collected separately so that siblings are not reached through a parent. Each side only fetches the nodes the
+// page or the guard of options can return, and a partial side makes the union partial.
+func (d *Daggo) traverseBoth(ctx context.Context, nodeID int, options traversalOptions) ([]DagNode, error) {
+	bounds := []TraversalOption{
+		WithConsistency(options.consistency),
+		WithMaxDepth(options.maxDepth),
+		WithGraphBoundary(options.boundary),
+	}
+	if options.partial {
+		bounds = append(bounds, WithPartialResults(), WithResumeDepth(options.resumeDepth))
+	} else {
+		if options.cursor.Valid {
+			bounds = append(bounds, WithCursor(int(options.cursor.Int64)))
+		}
+		if limit := options.fetchLimit(); limit > 0 {
+			bounds = append(bounds, WithLimit(limit))
+		}
+	}
+
+	var partial *PartialResultError
+	nodes := make([]DagNode, 0)
+	for _, dir := range []Direction{Down, Up} {
+		reached, err := d.TraverseContext(ctx, nodeID, dir, bounds...)
+		var sidePartial *PartialResultError
+		if errors.As(err, &sidePartial) {
+			if partial == nil || sidePartial.ResumeDepth < partial.ResumeDepth {
+				partial = sidePartial
+			}
+		} else if err != nil {
+			return nil, err
+		}
+		nodes = append(nodes, reached...)
+	}
+	sort.Slice(nodes, func(i, j int) bool { return nodes[i].ID < nodes[j].ID })
+
+	if partial != nil {
+		return nodes, partial
+	}
+	return options.truncate(nodes)
+}
+
+// traversalStep returns the recursive step following edges in a Down or Up direction in the active layout
+func (d *Daggo) traversalStep(dir Direction) (recursiveStep, error) {
+	layout := d.layout()
+	switch dir {
+	case Down:
+		return layout.down, nil
+	case Up:
+		return layout.up, nil
+	default:
+		return recursiveStep{}, fmt.Errorf("unknown direction %v", dir)
+	}
+}
+
+// recursiveStep is the recursive term of a traversal: it selects column, the ID of the next node, from a join of
+// from on the reachable CTE, keeping the rows matching where when set
+type recursiveStep struct {
+	column string
+	from   string
+	where  string
+}
+
+// query returns the recursive term collecting the next nodes
+func (s recursiveStep) query() string {
+	query := "SELECT " + s.column + " FROM " + s.from
+	if s.where != "" {
+		query += " WHERE " + s.where
+	}
+	return query
+}
+
+// depthQuery returns the recursive term collecting the next nodes with their depth, one more than the depth of
+// the node they are reached from, through at most the number of edges bound to the maxDepth placeholder
+func (s recursiveStep) depthQuery(maxDepth string) string {
+	where := "reachable.depth < " + maxDepth
+	if s.where != "" {
+		where = s.where + " AND " + where
+	}
+	return "SELECT " + s.column + ", reachable.depth + 1 FROM " + s.from + " WHERE " + where
+}
+
+// traversalQueryFor returns the paginated query of a Down or Up traversal from nodeID with its arguments, in the
+// strategy chosen for it
+func (d *Daggo) traversalQueryFor(ctx context.Context, dir Direction, nodeID int, options traversalOptions) (string, []interface{}, error) {
+	strategy, err := d.chooseTraversalStrategy(ctx, dir, options)
+	if err != nil {
+		return "", nil, err
+	}
+	switch strategy {
+	case StrategyClosureTable:
+		query, args := options.closureQuery(dir, nodeID)
+		return query, args, nil
+	case StrategyPathIndex:
+		query, args := options.pathIndexQuery(dir, nodeID)
+		return query, args, nil
+	}
+
+	step, err := d.traversalStepFor(dir, options)
+	if err != nil {
+		return "", nil, err
+	}
+	query, args := options.traversalQuery(step, nodeID)
+	return query, args, nil
+}
+
+// recursiveTraversalQuery returns the recursive query collecting the nodes reached by step from $1
+func recursiveTraversalQuery(step recursiveStep) string {
+	return `
+		WITH RECURSIVE reachable AS (
+			SELECT $1::int AS id
+			UNION
+			` + step.query() + `
+		)
+		SELECT dag.*
+		FROM dag
+		JOIN reachable ON dag.id = reachable.id
+		WHERE dag.id <> $1
+		ORDER BY dag.id ASC
+	`
+}
+
+// depthLimitedTraversalQuery returns the query collecting the nodes reached by step from $1 through at most $4
+// edges. Nodes are tracked with their depth, so one reached at several depths is expanded from each of them.
+func depthLimitedTraversalQuery(step recursiveStep) string {
+	return `
+		WITH RECURSIVE reachable(id, depth) AS (
+			SELECT $1::int, 0
+			UNION
+			` + step.depthQuery("$4") + `
+		)
+		SELECT dag.*
+		FROM dag
+		WHERE dag.id IN (SELECT id FROM reachable) AND dag.id <> $1
+		ORDER BY dag.id ASC
+	`
+}
+
+// GetConnectedNodes returns every node connected to the given node ID when edge direction is ignored,
+// excluding the node itself
+func (d *Daggo) GetConnectedNodes(nodeID int) ([]DagNode, error) {
+	return d.GetConnectedNodesContext(context.Background(), nodeID)
+}
+
+// GetConnectedNodesContext is GetConnectedNodes with a context bounding its queries
+func (d *Daggo) GetConnectedNodesContext(ctx context.Context, nodeID int) ([]DagNode, error) {
+	nodes := make([]DagNode, 0)
+
+	query := `
+		WITH RECURSIVE connected AS (
+			SELECT $1::int AS id
+			UNION
+			SELECT CASE WHEN dag_edge.parent_id = connected.id THEN dag_edge.child_id ELSE dag_edge.parent_id END
+			FROM dag_edge
+			JOIN connected ON dag_edge.parent_id = connected.id OR dag_edge.child_id = connected.id
+		)
+		SELECT dag.*
+		FROM dag
+		JOIN connected ON dag.id = connected.id
+		WHERE dag.id <> $1
+		ORDER BY dag.id ASC
+	`
+	err := d.db.SelectContext(ctx, &nodes, query, nodeID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get connected nodes: %v", err)
+	}
+
+	return nodes, nil
+}
+
+// IsConnected reports whether two nodes are connected when edge direction is ignored
+func (d *Daggo) IsConnected(a int, b int) (bool, error) {
+	return d.IsConnectedContext(context.Background(), a, b)
+}
+
+// IsConnectedContext is IsConnected with a context bounding its queries
+func (d *Daggo) IsConnectedContext(ctx context.Context, a int, b int) (bool, error) {
+	if a == b {
+		return true, nil
+	}
+
+	nodes, err := d.GetConnectedNodesContext(ctx, a)
+	if err != nil {
+		return false, err
+	}
+	for _, node := range nodes {
+		if node.ID == b {
+			return true, nil
+		}
+	}
+	return false, nil
+}
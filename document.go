@@ -0,0 +1,588 @@
+package daggo
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/lib/pq"
+)
+
+// ErrNotInDocument is returned when a document operation targets a node that is not part of a document
+var ErrNotInDocument = errors.New("node is not part of a document")
+
+// ErrDuplicateSlug is returned when a document node is given the slug of one of its siblings
+var ErrDuplicateSlug = errors.New("slug already used by a sibling")
+
+// The position is compared byte-wise so that the order of the keys does not depend on the database locale
+const createDocumentTableQuery = `
+	CREATE TABLE IF NOT EXISTS dag_document_node (
+		node_id INTEGER PRIMARY KEY,
+		slug TEXT NOT NULL,
+		position TEXT COLLATE "C" NOT NULL,
+		CONSTRAINT dag_document_node_slug_check CHECK (slug <> '' AND strpos(slug, '/') = 0)
+	);
+
+	CREATE OR REPLACE FUNCTION dag_drop_document_node() RETURNS trigger AS $$
+	BEGIN
+		DELETE FROM dag_document_node WHERE node_id = OLD.id;
+		RETURN NULL;
+	END;
+	$$ LANGUAGE plpgsql;
+
+	DROP TRIGGER IF EXISTS dag_drop_document_node_trigger ON dag;
+	CREATE TRIGGER dag_drop_document_node_trigger
+		AFTER DELETE ON dag
+		FOR EACH ROW EXECUTE FUNCTION dag_drop_document_node();
+`
+
+// positionDigits are the digits of position keys, in byte order
+const positionDigits = "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz"
+
+// maxPositionLength is the length past which the positions of a sibling list are spread out again
+const maxPositionLength = 48
+
+// DocumentNode is a node of a document with its place in the outline
+type DocumentNode struct {
+	DagNode
+	// Slug names the node among its siblings
+	Slug string `db:"slug"`
+	// Position orders the node among its siblings; positions compare byte-wise
+	Position string `db:"position"`
+	// Path is the slugs from the document root, excluded, to the node, joined by slashes; empty for the root
+	Path  string `db:"path"`
+	Depth int    `db:"depth"`
+}
+
+// Placement tells where a node goes among the children of its parent in a document
+type Placement struct {
+	siblingID int
+	relative  bool
+	before    bool
+}
+
+// PlaceFirst places a node before all of its siblings
+func PlaceFirst() Placement {
+	return Placement{before: true}
+}
+
+// PlaceLast places a node after all of its siblings
+func PlaceLast() Placement {
+	return Placement{}
+}
+
+// PlaceBefore places a node right before the sibling with the given ID
+func PlaceBefore(siblingID int) Placement {
+	return Placement{siblingID: siblingID, relative: true, before: true}
+}
+
+// PlaceAfter places a node right after the sibling with the given ID
+func PlaceAfter(siblingID int) Placement {
+	return Placement{siblingID: siblingID, relative: true}
+}
+
+// documentSibling is a child of a document node with its position
+type documentSibling struct {
+	NodeID   int    `db:"node_id"`
+	Position string `db:"position"`
+}
+
+// CreateDocumentTable creates the side table placing nodes in documents, together with the trigger dropping the
+// rows of deleted nodes. Documents are ordered forests: every node has one parent, a slug unique among its
+// siblings addressing it by path, and a fractional position, so that a node is inserted or moved between two
+// siblings by writing its own row only.
+func (d *Daggo) CreateDocumentTable() error {
+	_, err := d.db.Exec(createDocumentTableQuery)
+	if err != nil {
+		return fmt.Errorf("failed to create document table: %v", err)
+	}
+
+	return nil
+}
+
+// CreateDocument creates a new root node, with an ID drawn from the dag_id_seq sequence, as the root of a
+// document titled by slug, and returns its ID
+func (d *Daggo) CreateDocument(slug string) (int, error) {
+	return d.CreateDocumentContext(context.Background(), slug)
+}
+
+// CreateDocumentContext is CreateDocument with a context bounding its queries
+func (d *Daggo) CreateDocumentContext(ctx context.Context, slug string) (int, error) {
+	if err := validateSlug(slug); err != nil {
+		return 0, err
+	}
+
+	var rootID int
+	err := d.Tx(ctx, func(txDaggo *Daggo) error {
+		var err error
+		rootID, err = txDaggo.CreateRootNodeContext(ctx)
+		if err != nil {
+			return err
+		}
+
+		_, err = txDaggo.db.ExecContext(ctx, "INSERT INTO dag_document_node (node_id, slug, position) VALUES ($1, $2, $3)", rootID, slug, positionBetween("", ""))
+		if err != nil {
+			return fmt.Errorf("failed to add document node: %v", err)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return rootID, nil
+}
+
+// InsertDocumentNode creates a new child of parentID, with an ID drawn from the dag_id_seq sequence, at placement
+// among the children of the parent and returns its ID. It fails with ErrNotInDocument when the parent is not
+// part of a document and with ErrDuplicateSlug when a sibling already has the slug.
+func (d *Daggo) InsertDocumentNode(parentID int, slug string, placement Placement) (int, error) {
+	return d.InsertDocumentNodeContext(context.Background(), parentID, slug, placement)
+}
+
+// InsertDocumentNodeContext is InsertDocumentNode with a context bounding its queries
+func (d *Daggo) InsertDocumentNodeContext(ctx context.Context, parentID int, slug string, placement Placement) (int, error) {
+	if err := validateSlug(slug); err != nil {
+		return 0, err
+	}
+
+	var nodeID int
+	err := d.Tx(ctx, func(txDaggo *Daggo) error {
+		err := txDaggo.lockDocumentNode(ctx, parentID)
+		if err != nil {
+			return err
+		}
+		err = txDaggo.checkSlug(ctx, parentID, slug, 0)
+		if err != nil {
+			return err
+		}
+
+		position, err := txDaggo.documentPosition(ctx, parentID, placement, 0)
+		if err != nil {
+			return err
+		}
+
+		nodeID, err = txDaggo.CreateChildNodeContext(ctx, parentID)
+		if err != nil {
+			return err
+		}
+
+		_, err = txDaggo.db.ExecContext(ctx, "INSERT INTO dag_document_node (node_id, slug, position) VALUES ($1, $2, $3)", nodeID, slug, position)
+		if err != nil {
+			return fmt.Errorf("failed to add document node: %v", err)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return nodeID, nil
+}
+
+// MoveDocumentNode moves a document node and its descendants at placement among the children of newParentID,
+// which is its current parent to reorder it among its siblings. Only the row of the node is written, unless the
+// positions of the new siblings have grown too long and are spread out again.
+func (d *Daggo) MoveDocumentNode(nodeID int, newParentID int, placement Placement) error {
+	return d.MoveDocumentNodeContext(context.Background(), nodeID, newParentID, placement)
+}
+
+// MoveDocumentNodeContext is MoveDocumentNode with a context bounding its queries
+func (d *Daggo) MoveDocumentNodeContext(ctx context.Context, nodeID int, newParentID int, placement Placement) error {
+	if placement.relative && placement.siblingID == nodeID {
+		return fmt.Errorf("cannot place node %d relative to itself", nodeID)
+	}
+
+	return d.Tx(ctx, func(txDaggo *Daggo) error {
+		err := txDaggo.lockDocumentNode(ctx, newParentID)
+		if err != nil {
+			return err
+		}
+
+		var node struct {
+			ParentID sql.NullInt64 `db:"parent_id"`
+			RootID   int           `db:"root_id"`
+			Slug     string        `db:"slug"`
+		}
+		query := "SELECT dag.parent_id, dag.root_id, doc.slug FROM dag JOIN dag_document_node doc ON doc.node_id = dag.id WHERE dag.id = $1"
+		err = txDaggo.db.GetContext(ctx, &node, query, nodeID)
+		if err == sql.ErrNoRows {
+			return fmt.Errorf("%w: %d", ErrNotInDocument, nodeID)
+		} else if err != nil {
+			return fmt.Errorf("failed to get document node: %v", err)
+		}
+
+		reparent := !node.ParentID.Valid || int(node.ParentID.Int64) != newParentID
+		if reparent {
+			err = txDaggo.checkSlug(ctx, newParentID, node.Slug, nodeID)
+			if err != nil {
+				return err
+			}
+		}
+
+		position, err := txDaggo.documentPosition(ctx, newParentID, placement, nodeID)
+		if err != nil {
+			return err
+		}
+
+		if reparent {
+			_, err = txDaggo.MoveSubtreeContext(ctx, nodeID, newParentID)
+			if err != nil {
+				return err
+			}
+		}
+
+		_, err = txDaggo.db.ExecContext(ctx, "UPDATE dag_document_node SET position = $2 WHERE node_id = $1", nodeID, position)
+		if err != nil {
+			return fmt.Errorf("failed to move document node: %v", err)
+		}
+
+		// MoveSubtree reports the new parent; a reorder is a move within the same parent
+		if !reparent {
+			return txDaggo.notify(ctx, txDaggo.db, DagEvent{Kind: DagEventNodeMoved, NodeID: nodeID, RootID: node.RootID, ParentIDs: []int{newParentID}})
+		}
+
+		return nil
+	})
+}
+
+// RenameDocumentNode changes the slug of a document node, and so the paths of its descendants. It fails with
+// ErrDuplicateSlug when a sibling already has the slug.
+func (d *Daggo) RenameDocumentNode(nodeID int, slug string) error {
+	return d.RenameDocumentNodeContext(context.Background(), nodeID, slug)
+}
+
+// RenameDocumentNodeContext is RenameDocumentNode with a context bounding its queries
+func (d *Daggo) RenameDocumentNodeContext(ctx context.Context, nodeID int, slug string) error {
+	if err := validateSlug(slug); err != nil {
+		return err
+	}
+
+	return d.Tx(ctx, func(txDaggo *Daggo) error {
+		var parentID sql.NullInt64
+		err := txDaggo.db.GetContext(ctx, &parentID, "SELECT parent_id FROM dag WHERE id = $1", nodeID)
+		if err == sql.ErrNoRows {
+			return fmt.Errorf("%w: %d", ErrNodeNotFound, nodeID)
+		} else if err != nil {
+			return fmt.Errorf("failed to get node: %v", err)
+		}
+
+		// Document roots have no siblings to collide with
+		if parentID.Valid {
+			err = txDaggo.lockDocumentNode(ctx, int(parentID.Int64))
+			if err != nil {
+				return err
+			}
+			err = txDaggo.checkSlug(ctx, int(parentID.Int64), slug, nodeID)
+			if err != nil {
+				return err
+			}
+		}
+
+		result, err := txDaggo.db.ExecContext(ctx, "UPDATE dag_document_node SET slug = $2 WHERE node_id = $1", nodeID, slug)
+		if err != nil {
+			return fmt.Errorf("failed to rename document node: %v", err)
+		}
+		renamed, err := result.RowsAffected()
+		if err != nil {
+			return fmt.Errorf("failed to rename document node: %v", err)
+		}
+		if renamed == 0 {
+			return fmt.Errorf("%w: %d", ErrNotInDocument, nodeID)
+		}
+
+		return nil
+	})
+}
+
+// GetDocument returns the nodes of the document rooted at rootID in outline order: every node is followed by its
+// children, ordered by position, and their descendants. Children of document nodes that are not part of the
+// document are left out with their descendants.
+func (d *Daggo) GetDocument(rootID int, opts ...TraversalOption) ([]DocumentNode, error) {
+	return d.GetDocumentContext(context.Background(), rootID, opts...)
+}
+
+// GetDocumentContext is GetDocument with a context bounding its queries
+func (d *Daggo) GetDocumentContext(ctx context.Context, rootID int, opts ...TraversalOption) ([]DocumentNode, error) {
+	options := newTraversalOptions(opts)
+
+	// The sort key is the positions from the root, compared byte-wise element after element
+	query := `
+		WITH RECURSIVE outline AS (
+			SELECT dag.id, 0 AS depth, ''::text AS path, '{}'::text[] COLLATE "C" AS sort_key
+			FROM dag
+			JOIN dag_document_node doc ON doc.node_id = dag.id
+			WHERE dag.id = $1
+			UNION ALL
+			SELECT child.id, outline.depth + 1,
+				CASE WHEN outline.depth = 0 THEN doc.slug ELSE outline.path || '/' || doc.slug END,
+				outline.sort_key || doc.position
+			FROM outline
+			JOIN dag child ON child.parent_id = outline.id
+			JOIN dag_document_node doc ON doc.node_id = child.id
+		)
+		SELECT dag.*, doc.slug, doc.position, outline.path, outline.depth
+		FROM outline
+		JOIN dag ON dag.id = outline.id
+		JOIN dag_document_node doc ON doc.node_id = dag.id
+		ORDER BY outline.sort_key, dag.id
+	`
+	nodes := make([]DocumentNode, 0)
+	err := d.reader(ctx, options.consistency).SelectContext(ctx, &nodes, query, rootID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get document: %v", err)
+	}
+	if len(nodes) == 0 {
+		return nil, fmt.Errorf("%w: %d", ErrNotInDocument, rootID)
+	}
+
+	return nodes, nil
+}
+
+// GetDocumentNodeByPath returns the node of the document rooted at rootID addressed by path, slugs separated by
+// slashes, or nil if no node has that path. The empty path addresses the root.
+func (d *Daggo) GetDocumentNodeByPath(rootID int, path string, opts ...TraversalOption) (*DocumentNode, error) {
+	return d.GetDocumentNodeByPathContext(context.Background(), rootID, path, opts...)
+}
+
+// GetDocumentNodeByPathContext is GetDocumentNodeByPath with a context bounding its queries
+func (d *Daggo) GetDocumentNodeByPathContext(ctx context.Context, rootID int, path string, opts ...TraversalOption) (*DocumentNode, error) {
+	options := newTraversalOptions(opts)
+
+	slugs := make([]string, 0)
+	for _, slug := range strings.Split(path, "/") {
+		if slug != "" {
+			slugs = append(slugs, slug)
+		}
+	}
+
+	// Each step follows the child carrying the next slug, which is unique among its siblings
+	query := `
+		WITH RECURSIVE walk AS (
+			SELECT dag.id, 0 AS depth
+			FROM dag
+			JOIN dag_document_node doc ON doc.node_id = dag.id
+			WHERE dag.id = $1
+			UNION ALL
+			SELECT child.id, walk.depth + 1
+			FROM walk
+			JOIN dag child ON child.parent_id = walk.id
+			JOIN dag_document_node doc ON doc.node_id = child.id
+			WHERE doc.slug = ($2::text[])[walk.depth + 1]
+		)
+		SELECT dag.*, doc.slug, doc.position, $3::text AS path, walk.depth
+		FROM walk
+		JOIN dag ON dag.id = walk.id
+		JOIN dag_document_node doc ON doc.node_id = dag.id
+		WHERE walk.depth = cardinality($2::text[])
+	`
+	var node DocumentNode
+	err := d.reader(ctx, options.consistency).GetContext(ctx, &node, query, rootID, pq.Array(slugs), strings.Join(slugs, "/"))
+	if err == sql.ErrNoRows {
+		return nil, nil // No node has the path
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to get document node: %v", err)
+	}
+
+	return &node, nil
+}
+
+// lockDocumentNode locks the row of a document node, serializing the writes to the list of its children
+func (d *Daggo) lockDocumentNode(ctx context.Context, nodeID int) error {
+	var locked int
+	err := d.db.GetContext(ctx, &locked, "SELECT node_id FROM dag_document_node WHERE node_id = $1 FOR UPDATE", nodeID)
+	if err == sql.ErrNoRows {
+		return fmt.Errorf("%w: %d", ErrNotInDocument, nodeID)
+	} else if err != nil {
+		return fmt.Errorf("failed to lock document node: %v", err)
+	}
+
+	return nil
+}
+
+// checkSlug fails with ErrDuplicateSlug when a child of parentID other than nodeID has the slug
+func (d *Daggo) checkSlug(ctx context.Context, parentID int, slug string, nodeID int) error {
+	var taken bool
+	query := `
+		SELECT EXISTS (
+			SELECT 1 FROM dag JOIN dag_document_node doc ON doc.node_id = dag.id
+			WHERE dag.parent_id = $1 AND doc.slug = $2 AND dag.id <> $3
+		)
+	`
+	err := d.db.GetContext(ctx, &taken, query, parentID, slug, nodeID)
+	if err != nil {
+		return fmt.Errorf("failed to check slug: %v", err)
+	}
+	if taken {
+		return fmt.Errorf("%w: %q under node %d", ErrDuplicateSlug, slug, parentID)
+	}
+
+	return nil
+}
+
+// documentPosition returns the position of a node placed among the children of parentID, other than nodeID. The
+// positions of the children are spread out again when the new one would grow past maxPositionLength. The lock
+// on the parent must be held.
+func (d *Daggo) documentPosition(ctx context.Context, parentID int, placement Placement, nodeID int) (string, error) {
+	siblings := make([]documentSibling, 0)
+	query := `
+		SELECT doc.node_id, doc.position
+		FROM dag
+		JOIN dag_document_node doc ON doc.node_id = dag.id
+		WHERE dag.parent_id = $1 AND dag.id <> $2
+		ORDER BY doc.position, dag.id
+	`
+	err := d.db.SelectContext(ctx, &siblings, query, parentID, nodeID)
+	if err != nil {
+		return "", fmt.Errorf("failed to get siblings: %v", err)
+	}
+
+	// index is where the node goes in the list of its siblings
+	index := len(siblings)
+	if placement.relative {
+		index = -1
+		for i, sibling := range siblings {
+			if sibling.NodeID == placement.siblingID {
+				index = i
+				break
+			}
+		}
+		if index < 0 {
+			return "", fmt.Errorf("node %d is not a child of %d in the document", placement.siblingID, parentID)
+		}
+		if !placement.before {
+			index++
+		}
+	} else if placement.before {
+		index = 0
+	}
+
+	var lo, hi string
+	if index > 0 {
+		lo = siblings[index-1].Position
+	}
+	if index < len(siblings) {
+		hi = siblings[index].Position
+	}
+	if hi == "" || lo < hi {
+		position := positionBetween(lo, hi)
+		if len(position) <= maxPositionLength {
+			return position, nil
+		}
+	}
+
+	// The positions are too long, or equal after concurrent writes without the lock: renumber the siblings
+	positions := spreadPositions(len(siblings) + 1)
+	nodeIDs := make([]int, 0, len(siblings))
+	siblingPositions := make([]string, 0, len(siblings))
+	for i, sibling := range siblings {
+		nodeIDs = append(nodeIDs, sibling.NodeID)
+		if i < index {
+			siblingPositions = append(siblingPositions, positions[i])
+		} else {
+			siblingPositions = append(siblingPositions, positions[i+1])
+		}
+	}
+	query = `
+		UPDATE dag_document_node doc SET position = p.position
+		FROM unnest($1::int[], $2::text[]) AS p(node_id, position)
+		WHERE doc.node_id = p.node_id
+	`
+	_, err = d.db.ExecContext(ctx, query, pq.Array(nodeIDs), pq.Array(siblingPositions))
+	if err != nil {
+		return "", fmt.Errorf("failed to renumber siblings: %v", err)
+	}
+
+	return positions[index], nil
+}
+
+// validateSlug checks that slug can be a segment of a document path
+func validateSlug(slug string) error {
+	if slug == "" {
+		return fmt.Errorf("slug cannot be empty")
+	}
+	if strings.Contains(slug, "/") {
+		return fmt.Errorf("slug %q cannot contain a slash", slug)
+	}
+
+	return nil
+}
+
+// positionBetween returns a position sorting strictly between lo and hi, where an empty lo is before every
+// position and an empty hi after every position. Positions are base 62 fractions that never end with a zero
+// digit, so that there is always room before any of them.
+func positionBetween(lo string, hi string) string {
+	// Keep the prefix the bounds share, lo being padded with zeros
+	if hi != "" {
+		n := 0
+		for n < len(hi) && positionDigit(lo, n) == hi[n] {
+			n++
+		}
+		if n > 0 {
+			rest := ""
+			if n < len(lo) {
+				rest = lo[n:]
+			}
+			return hi[:n] + positionBetween(rest, hi[n:])
+		}
+	}
+
+	low := 0
+	if lo != "" {
+		low = strings.IndexByte(positionDigits, lo[0])
+	}
+	high := len(positionDigits)
+	if hi != "" {
+		high = strings.IndexByte(positionDigits, hi[0])
+	}
+	if high-low > 1 {
+		return string(positionDigits[(low+high)/2])
+	}
+
+	// The first digits are consecutive: the first digit of hi alone sorts between them when hi goes on
+	if len(hi) > 1 {
+		return hi[:1]
+	}
+	rest := ""
+	if len(lo) > 1 {
+		rest = lo[1:]
+	}
+	return string(positionDigits[low]) + positionBetween(rest, "")
+}
+
+// positionDigit returns the digit of position at index, zero past its end
+func positionDigit(position string, index int) byte {
+	if index < len(position) {
+		return position[index]
+	}
+	return positionDigits[0]
+}
+
+// spreadPositions returns count ascending positions evenly spaced between the bounds, with room for 61 more
+// positions in every gap before they grow longer
+func spreadPositions(count int) []string {
+	base := len(positionDigits)
+	width, capacity := 1, base
+	for capacity < (count+1)*base {
+		width++
+		capacity *= base
+	}
+	step := capacity / (count + 1)
+
+	positions := make([]string, 0, count)
+	digits := make([]byte, width)
+	for i := 1; i <= count; i++ {
+		value := i * step
+		for j := width - 1; j >= 0; j-- {
+			digits[j] = positionDigits[value%base]
+			value /= base
+		}
+		positions = append(positions, strings.TrimRight(string(digits), positionDigits[:1]))
+	}
+
+	return positions
+}
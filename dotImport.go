@@ -0,0 +1,252 @@
+package daggo
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// dotToken is a lexical token of the DOT language; quoted strings never act as keywords or punctuation
+type dotToken struct {
+	text   string
+	quoted bool
+}
+
+// is reports whether the token is the unquoted text s, ignoring case as DOT keywords do
+func (t dotToken) is(s string) bool {
+	return !t.quoted && strings.EqualFold(t.text, s)
+}
+
+// isID reports whether the token can be a node ID
+func (t dotToken) isID() bool {
+	if t.quoted {
+		return true
+	}
+	switch t.text {
+	case "{", "}", "[", "]", ";", ",", "=", "->", "--":
+		return false
+	}
+	return true
+}
+
+// tokenizeDOT splits DOT source into tokens, dropping comments
+func tokenizeDOT(src string) ([]dotToken, error) {
+	tokens := make([]dotToken, 0)
+	for i := 0; i < len(src); {
+		c := src[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			i++
+		case strings.HasPrefix(src[i:], "//") || (c == '#' && (i == 0 || src[i-1] == '\n')):
+			for i < len(src) && src[i] != '\n' {
+				i++
+			}
+		case strings.HasPrefix(src[i:], "/*"):
+			end := strings.Index(src[i+2:], "*/")
+			if end < 0 {
+				return nil, fmt.Errorf("unterminated comment")
+			}
+			i += end + 4
+		case c == '"':
+			var sb strings.Builder
+			i++
+			for ; i < len(src) && src[i] != '"'; i++ {
+				if src[i] == '\\' && i+1 < len(src) {
+					i++
+					if src[i] == 'n' {
+						sb.WriteByte('\n')
+						continue
+					}
+				}
+				sb.WriteByte(src[i])
+			}
+			if i == len(src) {
+				return nil, fmt.Errorf("unterminated string")
+			}
+			i++
+			tokens = append(tokens, dotToken{text: sb.String(), quoted: true})
+		case strings.HasPrefix(src[i:], "->") || strings.HasPrefix(src[i:], "--"):
+			tokens = append(tokens, dotToken{text: src[i : i+2]})
+			i += 2
+		case strings.ContainsRune("{}[];,=", rune(c)):
+			tokens = append(tokens, dotToken{text: string(c)})
+			i++
+		default:
+			start := i
+			for i < len(src) && !strings.ContainsRune(" \t\r\n{}[];,=\"", rune(src[i])) &&
+				!strings.HasPrefix(src[i:], "->") && !strings.HasPrefix(src[i:], "--") {
+				i++
+			}
+			if i == start {
+				return nil, fmt.Errorf("unexpected character %q", c)
+			}
+			tokens = append(tokens, dotToken{text: src[start:i]})
+		}
+	}
+	return tokens, nil
+}
+
+// parseDOT reads the nodes and edges of a directed DOT graph whose node IDs are integers, as written by
+// ExportDOT. Attributes and subgraph boundaries are skipped; subgraphs used as edge ends are not supported.
+func parseDOT(src string) ([]int, [][2]int, error) {
+	tokens, err := tokenizeDOT(src)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read DOT: %v", err)
+	}
+
+	pos := 0
+	peek := func() dotToken {
+		if pos < len(tokens) {
+			return tokens[pos]
+		}
+		return dotToken{}
+	}
+	next := func() (dotToken, error) {
+		if pos >= len(tokens) {
+			return dotToken{}, fmt.Errorf("unexpected end of DOT graph")
+		}
+		pos++
+		return tokens[pos-1], nil
+	}
+	skipAttributes := func() error {
+		for peek().is("[") {
+			for {
+				tok, err := next()
+				if err != nil {
+					return err
+				}
+				if tok.is("]") {
+					break
+				}
+			}
+		}
+		return nil
+	}
+	nodeID := func(tok dotToken) (int, error) {
+		id, err := strconv.Atoi(tok.text)
+		if err != nil {
+			return 0, fmt.Errorf("node %q does not have an integer ID", tok.text)
+		}
+		return id, nil
+	}
+
+	// Header: [strict] digraph [ID] {
+	if peek().is("strict") {
+		pos++
+	}
+	tok, err := next()
+	if err != nil {
+		return nil, nil, err
+	}
+	if !tok.is("digraph") {
+		return nil, nil, fmt.Errorf("expected a digraph, found %q", tok.text)
+	}
+	if !peek().is("{") {
+		pos++
+	}
+	if tok, err = next(); err != nil || !tok.is("{") {
+		return nil, nil, fmt.Errorf("expected { after the graph name")
+	}
+
+	ids := make([]int, 0)
+	edges := make([][2]int, 0)
+	seen := make(map[int]bool)
+	addNode := func(id int) {
+		if !seen[id] {
+			seen[id] = true
+			ids = append(ids, id)
+		}
+	}
+
+	for depth := 1; depth > 0; {
+		tok, err := next()
+		if err != nil {
+			return nil, nil, err
+		}
+		switch {
+		case tok.is("}"):
+			depth--
+		case tok.is(";") || tok.is(","):
+		case tok.is("{"):
+			depth++
+		case tok.is("subgraph"):
+			if !peek().is("{") {
+				pos++
+			}
+			if tok, err = next(); err != nil || !tok.is("{") {
+				return nil, nil, fmt.Errorf("expected { after subgraph")
+			}
+			depth++
+		case tok.is("graph") || tok.is("node") || tok.is("edge"):
+			if err = skipAttributes(); err != nil {
+				return nil, nil, err
+			}
+		case tok.isID():
+			if peek().is("=") {
+				pos++
+				if _, err = next(); err != nil {
+					return nil, nil, err
+				}
+				continue
+			}
+
+			from, err := nodeID(tok)
+			if err != nil {
+				return nil, nil, err
+			}
+			addNode(from)
+			for peek().is("->") || peek().is("--") {
+				if peek().is("--") {
+					return nil, nil, fmt.Errorf("undirected edges are not supported")
+				}
+				pos++
+				tok, err := next()
+				if err != nil {
+					return nil, nil, err
+				}
+				if !tok.isID() {
+					return nil, nil, fmt.Errorf("subgraphs as edge ends are not supported")
+				}
+				to, err := nodeID(tok)
+				if err != nil {
+					return nil, nil, err
+				}
+				addNode(to)
+				edges = append(edges, [2]int{from, to})
+				from = to
+			}
+			if err = skipAttributes(); err != nil {
+				return nil, nil, err
+			}
+		default:
+			return nil, nil, fmt.Errorf("unexpected %q in DOT graph", tok.text)
+		}
+	}
+
+	return ids, edges, nil
+}
+
+// ImportDOT imports a directed graph in the Graphviz DOT format, as written by ExportDOT. Node IDs must be
+// integers and every node named in the graph is created; the smallest parent of a node becomes its primary
+// parent. Attributes are not imported. The report lists the issues found by validation, which fail the import
+// with ErrInvalidImport.
+func (d *Daggo) ImportDOT(r io.Reader, opts ...ImportOption) (*ImportReport, error) {
+	return d.ImportDOTContext(context.Background(), r, opts...)
+}
+
+// ImportDOTContext is ImportDOT with a context bounding its queries
+func (d *Daggo) ImportDOTContext(ctx context.Context, r io.Reader, opts ...ImportOption) (*ImportReport, error) {
+	src, err := io.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read DOT: %v", err)
+	}
+
+	ids, edges, err := parseDOT(string(src))
+	if err != nil {
+		return nil, err
+	}
+
+	return d.importNodes(ctx, newNodesFromEdges(ids, edges), newImportOptions(opts))
+}
@@ -0,0 +1,71 @@
+package daggo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// ErrDuplicateEdge is returned when a parent-child pair that already exists is added again
+var ErrDuplicateEdge = errors.New("duplicate edge")
+
+// ErrSelfEdge is returned when a node is made its own parent
+var ErrSelfEdge = errors.New("self edge")
+
+// ErrCycleDetected is returned when an edge would make a node its own ancestor
+var ErrCycleDetected = errors.New("cycle detected")
+
+// The constraints are added idempotently since ALTER TABLE has no IF NOT EXISTS for them
+const createEdgeConstraintsQuery = `
+	DO $$
+	BEGIN
+		ALTER TABLE dag ADD CONSTRAINT dag_no_self_edge CHECK (parent_id IS NULL OR parent_id <> id);
+	EXCEPTION WHEN duplicate_object THEN NULL;
+	END $$;
+`
+
+// CreateEdgeConstraints adds the database constraints rejecting self edges, so rows written outside of the
+// library cannot corrupt traversals either. Duplicate pairs are already prevented by the primary keys.
+func (d *Daggo) CreateEdgeConstraints() error {
+	_, err := d.db.Exec(createEdgeConstraintsQuery)
+	if err != nil {
+		return fmt.Errorf("failed to create edge constraints: %v", err)
+	}
+
+	return nil
+}
+
+// edgeError translates constraint violations raised while writing an edge into typed errors
+func edgeError(err error, parentID int, childID int) error {
+	switch {
+	case isConstraintViolation(err, "dag_no_self_edge"), isConstraintViolation(err, "dag_edge_no_self_edge"):
+		return fmt.Errorf("%w: node %d", ErrSelfEdge, childID)
+	case isConstraintViolation(err, "dag_edge_pkey"):
+		return fmt.Errorf("%w: from %d to %d", ErrDuplicateEdge, parentID, childID)
+	}
+	return err
+}
+
+// checkCycle returns ErrCycleDetected when an edge from parentID to childID would close a cycle, that is when
+// parentID is reachable from childID. It runs in the transaction adding the edge so that it sees its writes
+func checkCycle(ctx context.Context, tx *sqlx.Tx, parentID int, childID int) error {
+	var cycle bool
+	err := tx.GetContext(ctx, &cycle, `
+		WITH RECURSIVE reachable AS (
+			SELECT $1::int AS id
+			UNION
+			SELECT dag_edge.child_id FROM dag_edge JOIN reachable ON dag_edge.parent_id = reachable.id
+		)
+		SELECT EXISTS (SELECT 1 FROM reachable WHERE id = $2)
+	`, childID, parentID)
+	if err != nil {
+		return fmt.Errorf("failed to check for cycles: %v", err)
+	}
+	if cycle {
+		return fmt.Errorf("%w: edge from %d to %d", ErrCycleDetected, parentID, childID)
+	}
+
+	return nil
+}
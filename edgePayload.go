@@ -0,0 +1,124 @@
+package daggo
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+)
+
+const createEdgePayloadTableQuery = `
+	CREATE TABLE IF NOT EXISTS dag_edge_payload (
+		parent_id INTEGER NOT NULL,
+		child_id INTEGER NOT NULL,
+		payload JSONB NOT NULL DEFAULT '{}',
+		PRIMARY KEY (parent_id, child_id)
+	);
+	CREATE INDEX IF NOT EXISTS dag_edge_payload_payload_idx ON dag_edge_payload USING GIN (payload);
+`
+
+// CreateEdgePayloadTable creates the side table used to store edge payloads
+func (d *Daggo) CreateEdgePayloadTable() error {
+	_, err := d.db.Exec(createEdgePayloadTableQuery)
+	if err != nil {
+		return fmt.Errorf("failed to create edge payload table: %v", err)
+	}
+
+	return nil
+}
+
+// SetEdgePayload stores value, encoded as JSON, on the edge between parentID and childID
+func (d *Daggo) SetEdgePayload(parentID int, childID int, value interface{}) error {
+	payload, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Errorf("failed to encode edge payload: %v", err)
+	}
+
+	// The edge must exist before it can carry a payload
+	var exists bool
+	err = d.db.Get(&exists, "SELECT EXISTS (SELECT 1 FROM dag_edge WHERE child_id = $1 AND parent_id = $2)", childID, parentID)
+	if err != nil {
+		return fmt.Errorf("failed to get edge: %v", err)
+	}
+	if !exists {
+		return fmt.Errorf("edge from %d to %d does not exist", parentID, childID)
+	}
+
+	query := `
+		INSERT INTO dag_edge_payload (parent_id, child_id, payload)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (parent_id, child_id) DO UPDATE SET payload = EXCLUDED.payload
+	`
+	_, err = d.db.Exec(query, parentID, childID, payload)
+	if err != nil {
+		return fmt.Errorf("failed to set edge payload: %v", err)
+	}
+
+	return nil
+}
+
+// GetEdgePayload decodes the payload of the edge between parentID and childID into out.
+// It returns false if the edge carries no payload.
+func (d *Daggo) GetEdgePayload(parentID int, childID int, out interface{}) (bool, error) {
+	var payload []byte
+
+	query := "SELECT payload FROM dag_edge_payload WHERE parent_id = $1 AND child_id = $2"
+	err := d.db.Get(&payload, query, parentID, childID)
+	if err == sql.ErrNoRows {
+		return false, nil // No payload on this edge
+	} else if err != nil {
+		return false, fmt.Errorf("failed to get edge payload: %v", err)
+	}
+
+	err = json.Unmarshal(payload, out)
+	if err != nil {
+		return false, fmt.Errorf("failed to decode edge payload: %v", err)
+	}
+
+	return true, nil
+}
+
+// DeleteEdgePayload removes the payload of the edge between parentID and childID
+func (d *Daggo) DeleteEdgePayload(parentID int, childID int) error {
+	_, err := d.db.Exec("DELETE FROM dag_edge_payload WHERE parent_id = $1 AND child_id = $2", parentID, childID)
+	if err != nil {
+		return fmt.Errorf("failed to delete edge payload: %v", err)
+	}
+
+	return nil
+}
+
+// GetDescendantsByEdgePayload returns the descendants of the given node ID reachable only through edges whose
+// payload contains filter (JSONB containment), e.g. map[string]interface{}{"kind": "transform"}
+func (d *Daggo) GetDescendantsByEdgePayload(nodeID int, filter interface{}) ([]DagNode, error) {
+	descendants := make([]DagNode, 0)
+
+	payloadFilter, err := json.Marshal(filter)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode edge filter: %v", err)
+	}
+
+	query := `
+		WITH RECURSIVE reachable AS (
+			SELECT e.child_id AS id
+			FROM dag_edge_payload e
+			JOIN dag_edge ON dag_edge.parent_id = e.parent_id AND dag_edge.child_id = e.child_id
+			WHERE e.parent_id = $1 AND e.payload @> $2
+			UNION
+			SELECT e.child_id
+			FROM dag_edge_payload e
+			JOIN dag_edge ON dag_edge.parent_id = e.parent_id AND dag_edge.child_id = e.child_id
+			JOIN reachable ON e.parent_id = reachable.id
+			WHERE e.payload @> $2
+		)
+		SELECT dag.*
+		FROM dag
+		JOIN reachable ON dag.id = reachable.id
+		ORDER BY dag.id ASC
+	`
+	err = d.db.Select(&descendants, query, nodeID, payloadFilter)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get descendants by edge payload: %v", err)
+	}
+
+	return descendants, nil
+}
@@ -0,0 +1,276 @@
+package daggo
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+)
+
+// dag_edge holds every parent-child edge, so a node can have several parents. The parent_id column of the dag
+// table keeps the primary parent of each node for the readers that only follow one parent; the trigger mirrors
+// it into dag_edge so inserts and moves made through the dag table stay visible to traversals.
+const createEdgeTableQuery = `
+	CREATE TABLE IF NOT EXISTS dag_edge (
+		parent_id INTEGER NOT NULL,
+		child_id INTEGER NOT NULL,
+		PRIMARY KEY (parent_id, child_id),
+		CONSTRAINT dag_edge_no_self_edge CHECK (parent_id <> child_id)
+	);
+	CREATE INDEX IF NOT EXISTS dag_edge_child_id_idx ON dag_edge (child_id);
+
+	INSERT INTO dag_edge (parent_id, child_id)
+	SELECT parent_id, id FROM dag WHERE parent_id IS NOT NULL
+	ON CONFLICT DO NOTHING;
+
+	CREATE OR REPLACE FUNCTION dag_sync_edge() RETURNS trigger AS $$
+	BEGIN
+		IF TG_OP = 'DELETE' THEN
+			DELETE FROM dag_edge WHERE parent_id = OLD.id OR child_id = OLD.id;
+			RETURN NULL;
+		END IF;
+		IF TG_OP = 'UPDATE' AND OLD.parent_id IS NOT NULL THEN
+			DELETE FROM dag_edge WHERE parent_id = OLD.parent_id AND child_id = NEW.id;
+		END IF;
+		IF NEW.parent_id IS NOT NULL THEN
+			INSERT INTO dag_edge (parent_id, child_id) VALUES (NEW.parent_id, NEW.id) ON CONFLICT DO NOTHING;
+		END IF;
+		RETURN NULL;
+	END;
+	$$ LANGUAGE plpgsql;
+
+	DROP TRIGGER IF EXISTS dag_sync_edge_trigger ON dag;
+	CREATE TRIGGER dag_sync_edge_trigger
+		AFTER INSERT OR DELETE ON dag
+		FOR EACH ROW EXECUTE FUNCTION dag_sync_edge();
+	-- Renumbering changes id together with parent_id and is not a move
+	DROP TRIGGER IF EXISTS dag_sync_edge_move_trigger ON dag;
+	CREATE TRIGGER dag_sync_edge_move_trigger
+		AFTER UPDATE OF parent_id ON dag
+		FOR EACH ROW WHEN (OLD.id = NEW.id AND OLD.parent_id IS DISTINCT FROM NEW.parent_id)
+		EXECUTE FUNCTION dag_sync_edge();
+`
+
+// CreateEdgeTable creates the edge table that traversals follow, filling it from the parent_id column, and
+// installs the trigger keeping it in sync with the dag table. It must be run once before nodes are given
+// additional parents with AddEdge.
+func (d *Daggo) CreateEdgeTable() error {
+	_, err := d.db.Exec(createEdgeTableQuery)
+	if err != nil {
+		return fmt.Errorf("failed to create edge table: %v", err)
+	}
+
+	return nil
+}
+
+// AddEdge adds parentID as an additional parent of childID. Both nodes must belong to the same graph; an edge
+// that would create a cycle fails with ErrCycleDetected.
+func (d *Daggo) AddEdge(parentID int, childID int) error {
+	return d.AddEdgeContext(context.Background(), parentID, childID)
+}
+
+// AddEdgeContext is AddEdge with a context bounding its queries
+func (d *Daggo) AddEdgeContext(ctx context.Context, parentID int, childID int) error {
+	if parentID == childID {
+		return fmt.Errorf("%w: node %d", ErrSelfEdge, childID)
+	}
+
+	// The settings are read before the transaction starts, as the only connection of a Daggo from WithTx is held
+	// by the transaction until it ends
+	parent, err := d.GetNodeByIDContext(ctx, parentID)
+	if err != nil {
+		return err
+	}
+	if parent == nil {
+		return fmt.Errorf("%w: %d", ErrNodeNotFound, parentID)
+	}
+	settings, err := d.graphSettings(ctx, parent.RootID)
+	if err != nil {
+		return err
+	}
+
+	tx, err := d.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %v", err)
+	}
+	defer func() {
+		// Rollback the transaction if it failed to commit
+		if p := recover(); p != nil {
+			tx.Rollback()
+			panic(p)
+		} else if err != nil {
+			tx.Rollback()
+		}
+	}()
+
+	err = d.setTxActor(ctx, tx)
+	if err != nil {
+		return err
+	}
+
+	// Lock both ends so that concurrent edge changes cannot create a cycle together
+	nodes := make([]DagNode, 0, 2)
+	err = tx.SelectContext(ctx, &nodes, "SELECT * FROM dag WHERE id IN ($1, $2) ORDER BY id FOR UPDATE", parentID, childID)
+	if err != nil {
+		return fmt.Errorf("failed to lock nodes: %v", err)
+	}
+	if len(nodes) != 2 {
+		err = fmt.Errorf("%w: %d or %d", ErrNodeNotFound, parentID, childID)
+		return err
+	}
+	if nodes[0].RootID != nodes[1].RootID {
+		err = fmt.Errorf("nodes %d and %d belong to different graphs", parentID, childID)
+		return err
+	}
+	if nodes[0].RootID != parent.RootID {
+		err = fmt.Errorf("node %d moved to graph %d while adding an edge", parentID, nodes[0].RootID)
+		return err
+	}
+
+	err = checkCycle(ctx, tx, parentID, childID)
+	if err != nil {
+		return err
+	}
+
+	if settings.MaxDepth > 0 {
+		err = checkDepth(ctx, tx, parentID, childID, settings.MaxDepth)
+		if err != nil {
+			return err
+		}
+	}
+
+	_, err = tx.ExecContext(ctx, "INSERT INTO dag_edge (parent_id, child_id) VALUES ($1, $2)", parentID, childID)
+	if err != nil {
+		return fmt.Errorf("failed to add edge: %w", edgeError(err, parentID, childID))
+	}
+
+	if settings.DefaultEdgeLabel != "" {
+		err = labelEdge(ctx, tx, parentID, childID, settings.DefaultEdgeLabel)
+		if err != nil {
+			return err
+		}
+	}
+
+	err = d.notify(ctx, tx, DagEvent{Kind: DagEventEdgeAdded, NodeID: childID, RootID: nodes[0].RootID, ParentIDs: []int{parentID}})
+	if err != nil {
+		return err
+	}
+
+	// Commit the transaction
+	err = tx.Commit()
+	if err != nil {
+		return fmt.Errorf("failed to commit transaction: %v", err)
+	}
+
+	d.InvalidatePlanCache()
+
+	return nil
+}
+
+// RemoveEdge removes the edge between parentID and childID. The last parent of a node cannot be removed; use
+// ReplaceParents to turn the node into a root instead.
+func (d *Daggo) RemoveEdge(parentID int, childID int) error {
+	return d.RemoveEdgeContext(context.Background(), parentID, childID)
+}
+
+// RemoveEdgeContext is RemoveEdge with a context bounding its queries
+func (d *Daggo) RemoveEdgeContext(ctx context.Context, parentID int, childID int) error {
+	tx, err := d.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %v", err)
+	}
+	defer func() {
+		// Rollback the transaction if it failed to commit
+		if p := recover(); p != nil {
+			tx.Rollback()
+			panic(p)
+		} else if err != nil {
+			tx.Rollback()
+		}
+	}()
+
+	err = d.setTxActor(ctx, tx)
+	if err != nil {
+		return err
+	}
+
+	child := &DagNode{}
+	err = tx.GetContext(ctx, child, "SELECT * FROM dag WHERE id = $1 FOR UPDATE", childID)
+	if err == sql.ErrNoRows {
+		err = fmt.Errorf("%w: %d", ErrNodeNotFound, childID)
+		return err
+	} else if err != nil {
+		return fmt.Errorf("failed to lock node: %v", err)
+	}
+
+	parentIDs := make([]int, 0)
+	err = tx.SelectContext(ctx, &parentIDs, "SELECT parent_id FROM dag_edge WHERE child_id = $1 ORDER BY parent_id", childID)
+	if err != nil {
+		return fmt.Errorf("failed to get parents: %v", err)
+	}
+	remaining := make([]int, 0, len(parentIDs))
+	for _, id := range parentIDs {
+		if id != parentID {
+			remaining = append(remaining, id)
+		}
+	}
+	if len(remaining) == len(parentIDs) {
+		err = fmt.Errorf("edge from %d to %d does not exist", parentID, childID)
+		return err
+	}
+	if len(remaining) == 0 {
+		err = fmt.Errorf("cannot remove the last parent of node %d", childID)
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, "DELETE FROM dag_edge WHERE parent_id = $1 AND child_id = $2", parentID, childID)
+	if err != nil {
+		return fmt.Errorf("failed to remove edge: %v", err)
+	}
+
+	// Promote another parent when the primary one goes away
+	if child.GetParentID() == parentID {
+		_, err = tx.ExecContext(ctx, "UPDATE dag SET parent_id = $2 WHERE id = $1", childID, remaining[0])
+		if err != nil {
+			return fmt.Errorf("failed to update primary parent: %v", err)
+		}
+	}
+
+	err = d.notify(ctx, tx, DagEvent{Kind: DagEventEdgeRemoved, NodeID: childID, RootID: child.RootID, ParentIDs: []int{parentID}})
+	if err != nil {
+		return err
+	}
+
+	// Commit the transaction
+	err = tx.Commit()
+	if err != nil {
+		return fmt.Errorf("failed to commit transaction: %v", err)
+	}
+
+	d.InvalidatePlanCache()
+
+	return nil
+}
+
+// GetParentNodes returns every parent of the given node, ordered by ID
+func (d *Daggo) GetParentNodes(nodeID int) ([]DagNode, error) {
+	return d.GetParentNodesContext(context.Background(), nodeID)
+}
+
+// GetParentNodesContext is GetParentNodes with a context bounding its queries
+func (d *Daggo) GetParentNodesContext(ctx context.Context, nodeID int) ([]DagNode, error) {
+	parents := make([]DagNode, 0)
+
+	query := `
+		SELECT dag.*
+		FROM dag
+		JOIN dag_edge ON dag_edge.parent_id = dag.id
+		WHERE dag_edge.child_id = $1
+		ORDER BY dag.id ASC
+	`
+	err := d.db.SelectContext(ctx, &parents, query, nodeID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get parent nodes: %v", err)
+	}
+
+	return parents, nil
+}
@@ -0,0 +1,431 @@
+package daggo
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+)
+
+// Event kinds stored in the event log
+const (
+	EventNodeAdded   = "node_added"
+	EventNodeMoved   = "node_moved"
+	EventNodeDeleted = "node_deleted"
+	// EventEdgeAdded adds an edge from ParentID to NodeID, a further parent of a node of the same graph
+	EventEdgeAdded = "edge_added"
+)
+
+// Event is an entry of the append-only event log. When a graph is managed in event sourcing mode the log is
+// the source of truth and the dag table is a projection of it: writes go through AppendEvents and the table
+// can be rebuilt at any time with ReplayEvents.
+type Event struct {
+	Seq    int64  `db:"seq"`
+	Kind   string `db:"kind"`
+	NodeID int    `db:"node_id"`
+	// ParentID is the parent of an added node, the new parent of a moved node or the parent end of an added
+	// edge; NULL for roots
+	ParentID  sql.NullInt64 `db:"parent_id"`
+	CreatedAt time.Time     `db:"created_at"`
+}
+
+const createEventTableQuery = `
+	CREATE TABLE IF NOT EXISTS dag_event (
+		seq BIGSERIAL PRIMARY KEY,
+		kind TEXT NOT NULL,
+		node_id INTEGER NOT NULL,
+		parent_id INTEGER,
+		created_at TIMESTAMPTZ NOT NULL DEFAULT clock_timestamp()
+	);
+	CREATE INDEX IF NOT EXISTS dag_event_created_at_idx ON dag_event (created_at);
+`
+
+// CreateEventTable creates the append-only event log table
+func (d *Daggo) CreateEventTable() error {
+	_, err := d.db.Exec(createEventTableQuery)
+	if err != nil {
+		return fmt.Errorf("failed to create event table: %v", err)
+	}
+
+	return nil
+}
+
+// mutationKinds maps the event kinds that change nodes to the kind of change they count as in a MutationResult
+var mutationKinds = map[string]string{
+	EventNodeAdded:   MutationAdded,
+	EventNodeMoved:   MutationMoved,
+	EventNodeDeleted: MutationDeleted,
+}
+
+// AppendEvents appends the given events to the log and applies them to the dag table in a single transaction.
+// The result counts the nodes each kind of event affected, the descendants of moved nodes included.
+func (d *Daggo) AppendEvents(events ...Event) (*MutationResult, error) {
+	start := time.Now()
+
+	// Start a transaction
+	tx, err := d.db.Beginx()
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %v", err)
+	}
+	defer func() {
+		// Rollback the transaction if it failed to commit
+		if p := recover(); p != nil {
+			tx.Rollback()
+			panic(p)
+		} else if err != nil {
+			tx.Rollback()
+		}
+	}()
+
+	err = d.setTxActor(context.Background(), tx)
+	if err != nil {
+		return nil, err
+	}
+
+	result := newMutationResult()
+	for _, event := range events {
+		_, err = tx.Exec("INSERT INTO dag_event (kind, node_id, parent_id) VALUES ($1, $2, $3)",
+			event.Kind, event.NodeID, event.ParentID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to append event: %v", err)
+		}
+
+		// The graph of the node is looked up on both sides of the change, which covers moves between graphs
+		err = addEventRoot(tx, result, event.NodeID)
+		if err != nil {
+			return nil, err
+		}
+		var affected int64
+		affected, err = projectEvent(context.Background(), tx, event)
+		if err != nil {
+			return nil, err
+		}
+		err = addEventRoot(tx, result, event.NodeID)
+		if err != nil {
+			return nil, err
+		}
+		if kind, ok := mutationKinds[event.Kind]; ok {
+			result.Counts[kind] += affected
+		}
+		result.addNode(event.NodeID)
+	}
+
+	// Refuse the events if the nodes they added exceed the graph or tenant quotas; the usage already counts them
+	if d.enforceQuotas && result.Counts[MutationAdded] > 0 {
+		for _, rootID := range result.RootIDs {
+			err = checkQuota(context.Background(), tx, rootID, 0)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	// Commit the transaction
+	err = tx.Commit()
+	if err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %v", err)
+	}
+
+	d.InvalidatePlanCache()
+	result.Duration = time.Since(start)
+
+	return result, nil
+}
+
+// addEventRoot adds the graph of the given node, if it exists, to result
+func addEventRoot(tx *sqlx.Tx, result *MutationResult, nodeID int) error {
+	var rootID int
+	err := tx.Get(&rootID, "SELECT root_id FROM dag WHERE id = $1", nodeID)
+	if err == sql.ErrNoRows {
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("failed to get graph of node %d: %v", nodeID, err)
+	}
+	result.addRoot(rootID)
+
+	return nil
+}
+
+// ListEvents returns up to limit events with a sequence number greater than afterSeq
+func (d *Daggo) ListEvents(afterSeq int64, limit int) ([]Event, error) {
+	events := make([]Event, 0)
+
+	query := "SELECT * FROM dag_event WHERE seq > $1 ORDER BY seq ASC LIMIT $2"
+	err := d.db.Select(&events, query, afterSeq, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list events: %v", err)
+	}
+
+	return events, nil
+}
+
+// ReplayEvents rebuilds the graphs of the event log from scratch by applying the whole log in order. The graphs
+// of the log are the ones rooted at the nodes it adds without parent; the other graphs of the dag table are kept.
+func (d *Daggo) ReplayEvents() error {
+	// Start a transaction
+	tx, err := d.db.Beginx()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %v", err)
+	}
+	defer func() {
+		// Rollback the transaction if it failed to commit
+		if p := recover(); p != nil {
+			tx.Rollback()
+			panic(p)
+		} else if err != nil {
+			tx.Rollback()
+		}
+	}()
+
+	err = d.setTxActor(context.Background(), tx)
+	if err != nil {
+		return err
+	}
+
+	rows, err := tx.Queryx("SELECT * FROM dag_event ORDER BY seq ASC")
+	if err != nil {
+		return fmt.Errorf("failed to read events: %v", err)
+	}
+	events := make([]Event, 0)
+	for rows.Next() {
+		var event Event
+		err = rows.StructScan(&event)
+		if err != nil {
+			rows.Close()
+			return fmt.Errorf("failed to read event: %v", err)
+		}
+		events = append(events, event)
+	}
+	rows.Close()
+
+	rootIDs := make([]int, 0)
+	for _, event := range events {
+		if event.Kind == EventNodeAdded && !event.ParentID.Valid {
+			rootIDs = append(rootIDs, event.NodeID)
+		}
+	}
+	_, err = tx.Exec("DELETE FROM dag WHERE root_id = ANY($1)", pq.Array(rootIDs))
+	if err != nil {
+		return fmt.Errorf("failed to clear graphs of the event log: %v", err)
+	}
+
+	for _, event := range events {
+		_, err = projectEvent(context.Background(), tx, event)
+		if err != nil {
+			return err
+		}
+	}
+
+	// Commit the transaction
+	err = tx.Commit()
+	if err != nil {
+		return fmt.Errorf("failed to commit transaction: %v", err)
+	}
+
+	d.InvalidatePlanCache()
+
+	return nil
+}
+
+// ProjectEventsAt folds the events recorded up to the given time into an in-memory set of nodes keyed by ID,
+// without touching the dag table. The children of a node include those of the edges added by EventEdgeAdded.
+func (d *Daggo) ProjectEventsAt(at time.Time) (map[int]*DagNode, error) {
+	events := make([]Event, 0)
+
+	err := d.db.Select(&events, "SELECT * FROM dag_event WHERE created_at <= $1 ORDER BY seq ASC", at)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read events: %v", err)
+	}
+
+	nodes := make(map[int]*DagNode)
+	// extraParents holds the parents of the edges added by EventEdgeAdded, by child
+	extraParents := make(map[int][]int)
+	// reaches reports whether nodeID is an ancestor of fromID, or fromID itself
+	reaches := func(fromID int, nodeID int) bool {
+		seen := make(map[int]bool)
+		stack := []int{fromID}
+		for len(stack) > 0 {
+			id := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+			if id == nodeID {
+				return true
+			}
+			if seen[id] {
+				continue
+			}
+			seen[id] = true
+			if node, ok := nodes[id]; ok && node.ParentID.Valid {
+				stack = append(stack, int(node.ParentID.Int64))
+			}
+			stack = append(stack, extraParents[id]...)
+		}
+		return false
+	}
+
+	for _, event := range events {
+		switch event.Kind {
+		case EventNodeAdded:
+			nodes[event.NodeID] = &DagNode{ID: event.NodeID, ParentID: event.ParentID}
+		case EventNodeMoved:
+			node, ok := nodes[event.NodeID]
+			if !ok {
+				continue
+			}
+			if event.ParentID.Valid && reaches(int(event.ParentID.Int64), event.NodeID) {
+				return nil, fmt.Errorf("%w: event %d moves node %d below %d", ErrCycleDetected, event.Seq, event.NodeID,
+					event.ParentID.Int64)
+			}
+			node.ParentID = event.ParentID
+		case EventEdgeAdded:
+			if _, ok := nodes[event.NodeID]; !ok || !event.ParentID.Valid {
+				continue
+			}
+			if reaches(int(event.ParentID.Int64), event.NodeID) {
+				return nil, fmt.Errorf("%w: event %d adds an edge from %d to %d", ErrCycleDetected, event.Seq,
+					event.ParentID.Int64, event.NodeID)
+			}
+			extraParents[event.NodeID] = append(extraParents[event.NodeID], int(event.ParentID.Int64))
+		case EventNodeDeleted:
+			delete(nodes, event.NodeID)
+			delete(extraParents, event.NodeID)
+		}
+	}
+
+	// Resolve root and child IDs once the structure is final
+	for _, node := range nodes {
+		root := node
+		for root.ParentID.Valid {
+			parent, ok := nodes[int(root.ParentID.Int64)]
+			if !ok {
+				break
+			}
+			root = parent
+		}
+		node.RootID = root.ID
+
+		if node.ParentID.Valid {
+			if parent, ok := nodes[int(node.ParentID.Int64)]; ok {
+				parent.ChildIDs = append(parent.ChildIDs, node.ID)
+			}
+		}
+		for _, parentID := range extraParents[node.ID] {
+			if parent, ok := nodes[parentID]; ok && !(node.ParentID.Valid && int(node.ParentID.Int64) == parentID) {
+				parent.ChildIDs = append(parent.ChildIDs, node.ID)
+			}
+		}
+	}
+
+	return nodes, nil
+}
+
+// projectEvent applies a single event to the dag table and returns the number of nodes it changed. It fails with
+// ErrParentNotFound for nodes added or moved below a missing parent, with ErrNodeNotFound for moves of a missing
+// node and with ErrCycleDetected for moves and edges that would close a cycle.
+func projectEvent(ctx context.Context, tx *sqlx.Tx, event Event) (int64, error) {
+	var res sql.Result
+	var err error
+	switch event.Kind {
+	case EventNodeAdded:
+		if event.ParentID.Valid {
+			res, err = tx.ExecContext(ctx, `
+				INSERT INTO dag (id, parent_id, root_id)
+				SELECT $1, id, root_id FROM dag WHERE id = $2
+			`, event.NodeID, event.ParentID.Int64)
+		} else {
+			res, err = tx.ExecContext(ctx, "INSERT INTO dag (id, parent_id, root_id) VALUES ($1, NULL, $1)", event.NodeID)
+		}
+	case EventNodeMoved:
+		if event.ParentID.Valid {
+			var parentExists bool
+			err = tx.GetContext(ctx, &parentExists, "SELECT EXISTS (SELECT 1 FROM dag WHERE id = $1)", event.ParentID.Int64)
+			if err != nil {
+				return 0, fmt.Errorf("failed to project %s event for node %d: %v", event.Kind, event.NodeID, err)
+			}
+			if !parentExists {
+				return 0, fmt.Errorf("failed to project %s event for node %d: %w: %d", event.Kind, event.NodeID,
+					ErrParentNotFound, event.ParentID.Int64)
+			}
+			err = checkCycle(ctx, tx, int(event.ParentID.Int64), event.NodeID)
+			if err != nil {
+				return 0, fmt.Errorf("failed to project %s event for node %d: %w", event.Kind, event.NodeID, err)
+			}
+		}
+		res, err = tx.ExecContext(ctx, "UPDATE dag SET parent_id = $2 WHERE id = $1", event.NodeID, event.ParentID)
+		if err != nil {
+			return 0, fmt.Errorf("failed to project %s event for node %d: %v", event.Kind, event.NodeID, err)
+		}
+		var moved int64
+		moved, err = res.RowsAffected()
+		if err != nil {
+			return 0, fmt.Errorf("failed to count nodes changed by %s event for node %d: %v", event.Kind, event.NodeID, err)
+		}
+		if moved == 0 {
+			return 0, fmt.Errorf("failed to project %s event for node %d: %w: %d", event.Kind, event.NodeID,
+				ErrNodeNotFound, event.NodeID)
+		}
+
+		// Propagate the new root to the moved node and its descendants
+		res, err = tx.ExecContext(ctx, `
+			WITH RECURSIVE subtree AS (
+				SELECT $1::int AS id
+				UNION
+				SELECT dag_edge.child_id FROM dag_edge JOIN subtree ON dag_edge.parent_id = subtree.id
+			)
+			UPDATE dag
+			SET root_id = COALESCE((SELECT root_id FROM dag WHERE id = $2), $1)
+			WHERE id IN (SELECT id FROM subtree)
+		`, event.NodeID, event.ParentID)
+	case EventEdgeAdded:
+		if !event.ParentID.Valid {
+			return 0, fmt.Errorf("%s event for node %d has no parent", event.Kind, event.NodeID)
+		}
+		parentID := int(event.ParentID.Int64)
+		err = checkCycle(ctx, tx, parentID, event.NodeID)
+		if err != nil {
+			return 0, fmt.Errorf("failed to project %s event for node %d: %w", event.Kind, event.NodeID, err)
+		}
+		res, err = tx.ExecContext(ctx, `
+			INSERT INTO dag_edge (parent_id, child_id)
+			SELECT parent.id, child.id
+			FROM dag parent
+			JOIN dag child ON child.root_id = parent.root_id
+			WHERE parent.id = $1 AND child.id = $2
+		`, parentID, event.NodeID)
+		if err != nil {
+			return 0, fmt.Errorf("failed to project %s event for node %d: %w", event.Kind, event.NodeID,
+				edgeError(err, parentID, event.NodeID))
+		}
+	case EventNodeDeleted:
+		res, err = tx.ExecContext(ctx, "DELETE FROM dag WHERE id = $1", event.NodeID)
+	default:
+		return 0, fmt.Errorf("unknown event kind %q", event.Kind)
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to project %s event for node %d: %v", event.Kind, event.NodeID, err)
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("failed to count nodes changed by %s event for node %d: %v", event.Kind, event.NodeID, err)
+	}
+
+	// The inserts select their parent, so a missing one adds nothing rather than failing
+	if affected == 0 {
+		switch {
+		case event.Kind == EventNodeAdded && event.ParentID.Valid:
+			return 0, fmt.Errorf("failed to project %s event for node %d: %w: %d", event.Kind, event.NodeID,
+				ErrParentNotFound, event.ParentID.Int64)
+		case event.Kind == EventEdgeAdded:
+			return 0, fmt.Errorf("failed to project %s event for node %d: %w: %d or %d in one graph", event.Kind,
+				event.NodeID, ErrNodeNotFound, event.ParentID.Int64, event.NodeID)
+		}
+	}
+	if event.Kind == EventEdgeAdded {
+		return 0, nil // No node changed
+	}
+
+	return affected, nil
+}
@@ -0,0 +1,246 @@
+package daggo
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// exportGraph is a graph loaded for export with its visual hints
+type exportGraph struct {
+	rootID int
+	nodes  []DagNode
+	edges  []graphEdge
+	hints  map[int]VisualHints
+}
+
+func (d *Daggo) loadExportGraph(rootID int) (*exportGraph, error) {
+	nodes := make([]DagNode, 0)
+	err := d.db.Select(&nodes, "SELECT * FROM dag WHERE root_id = $1 ORDER BY id ASC", rootID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get graph nodes: %v", err)
+	}
+	if len(nodes) == 0 {
+		return nil, fmt.Errorf("%w: graph root %d", ErrNodeNotFound, rootID)
+	}
+
+	edges, err := d.loadGraphEdges(rootID)
+	if err != nil {
+		return nil, err
+	}
+
+	hints, err := d.loadVisualHints(rootID)
+	if err != nil {
+		return nil, err
+	}
+
+	return &exportGraph{rootID: rootID, nodes: nodes, edges: edges, hints: hints}, nil
+}
+
+// groups returns the nodes of each visual group, in group name order, and the ungrouped nodes
+func (g *exportGraph) groups() ([]string, map[string][]DagNode, []DagNode) {
+	grouped := make(map[string][]DagNode)
+	ungrouped := make([]DagNode, 0)
+	for _, node := range g.nodes {
+		if group := g.hints[node.ID].Group; group != "" {
+			grouped[group] = append(grouped[group], node)
+		} else {
+			ungrouped = append(ungrouped, node)
+		}
+	}
+
+	names := make([]string, 0, len(grouped))
+	for name := range grouped {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names, grouped, ungrouped
+}
+
+// ExportDOT writes the graph rooted at rootID in the Graphviz DOT format, applying the visual hints
+func (d *Daggo) ExportDOT(rootID int, w io.Writer) error {
+	graph, err := d.loadExportGraph(rootID)
+	if err != nil {
+		return err
+	}
+
+	bw := bufio.NewWriter(w)
+	fmt.Fprintf(bw, "digraph %s {\n", dotQuote(fmt.Sprintf("dag_%d", rootID)))
+
+	writeNode := func(indent string, node DagNode) {
+		attrs := []string{"label=" + dotQuote(strconv.Itoa(node.ID))}
+		hints := graph.hints[node.ID]
+		if hints.Color != "" {
+			attrs = append(attrs, "color="+dotQuote(hints.Color))
+		}
+		if hints.Shape != "" {
+			attrs = append(attrs, "shape="+dotQuote(hints.Shape))
+		}
+		fmt.Fprintf(bw, "%s%s [%s];\n", indent, dotQuote(strconv.Itoa(node.ID)), strings.Join(attrs, ", "))
+	}
+
+	names, grouped, ungrouped := graph.groups()
+	for i, name := range names {
+		fmt.Fprintf(bw, "\tsubgraph %s {\n\t\tlabel=%s;\n", dotQuote(fmt.Sprintf("cluster_%d", i)), dotQuote(name))
+		for _, node := range grouped[name] {
+			writeNode("\t\t", node)
+		}
+		fmt.Fprint(bw, "\t}\n")
+	}
+	for _, node := range ungrouped {
+		writeNode("\t", node)
+	}
+
+	for _, edge := range graph.edges {
+		fmt.Fprintf(bw, "\t%s -> %s;\n", dotQuote(strconv.Itoa(edge.ParentID)), dotQuote(strconv.Itoa(edge.ChildID)))
+	}
+	fmt.Fprint(bw, "}\n")
+
+	return bw.Flush()
+}
+
+// Colors of the statuses in a diff export
+var diffColors = map[string]string{
+	DiffAdded:   "green",
+	DiffRemoved: "red",
+}
+
+// ExportDiffDOT writes a graph diff in the Graphviz DOT format, drawing added nodes and edges in green and
+// removed ones in red
+func ExportDiffDOT(diff *GraphDiff, w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	fmt.Fprint(bw, "digraph \"diff\" {\n")
+
+	for _, node := range diff.Nodes {
+		attrs := []string{"label=" + dotQuote(strconv.Itoa(node.ID))}
+		if color, ok := diffColors[node.Status]; ok {
+			attrs = append(attrs, "color="+dotQuote(color), "fontcolor="+dotQuote(color))
+		}
+		if node.Status == DiffRemoved {
+			attrs = append(attrs, "style=\"dashed\"")
+		}
+		fmt.Fprintf(bw, "\t%s [%s];\n", dotQuote(strconv.Itoa(node.ID)), strings.Join(attrs, ", "))
+	}
+	for _, edge := range diff.Edges {
+		attrs := make([]string, 0)
+		if color, ok := diffColors[edge.Status]; ok {
+			attrs = append(attrs, "color="+dotQuote(color))
+		}
+		if edge.Status == DiffRemoved {
+			attrs = append(attrs, "style=\"dashed\"")
+		}
+		fmt.Fprintf(bw, "\t%s -> %s", dotQuote(strconv.Itoa(edge.ParentID)), dotQuote(strconv.Itoa(edge.ChildID)))
+		if len(attrs) > 0 {
+			fmt.Fprintf(bw, " [%s]", strings.Join(attrs, ", "))
+		}
+		fmt.Fprint(bw, ";\n")
+	}
+	fmt.Fprint(bw, "}\n")
+
+	return bw.Flush()
+}
+
+// ExportMermaid writes the graph rooted at rootID as a Mermaid flowchart, applying the visual hints
+func (d *Daggo) ExportMermaid(rootID int, w io.Writer) error {
+	graph, err := d.loadExportGraph(rootID)
+	if err != nil {
+		return err
+	}
+
+	bw := bufio.NewWriter(w)
+	fmt.Fprint(bw, "flowchart TD\n")
+
+	writeNode := func(indent string, node DagNode) {
+		open, close := "[", "]"
+		switch graph.hints[node.ID].Shape {
+		case "ellipse", "round":
+			open, close = "(", ")"
+		case "circle":
+			open, close = "((", "))"
+		case "diamond":
+			open, close = "{", "}"
+		}
+		fmt.Fprintf(bw, "%sn%d%s\"%d\"%s\n", indent, node.ID, open, node.ID, close)
+	}
+
+	names, grouped, ungrouped := graph.groups()
+	for i, name := range names {
+		fmt.Fprintf(bw, "\tsubgraph g%d [\"%s\"]\n", i, strings.ReplaceAll(name, "\"", "#quot;"))
+		for _, node := range grouped[name] {
+			writeNode("\t\t", node)
+		}
+		fmt.Fprint(bw, "\tend\n")
+	}
+	for _, node := range ungrouped {
+		writeNode("\t", node)
+	}
+
+	for _, edge := range graph.edges {
+		fmt.Fprintf(bw, "\tn%d --> n%d\n", edge.ParentID, edge.ChildID)
+	}
+	for _, node := range graph.nodes {
+		if color := graph.hints[node.ID].Color; isSafeColor(color) {
+			fmt.Fprintf(bw, "\tstyle n%d fill:%s\n", node.ID, color)
+		}
+	}
+
+	return bw.Flush()
+}
+
+// d3Graph is the node-link layout expected by d3-force
+type d3Graph struct {
+	Nodes []d3Node `json:"nodes"`
+	Links []d3Link `json:"links"`
+}
+
+type d3Node struct {
+	ID int `json:"id"`
+	VisualHints
+}
+
+type d3Link struct {
+	Source int `json:"source"`
+	Target int `json:"target"`
+}
+
+// ExportD3JSON writes the graph rooted at rootID in the node-link JSON layout used by d3-force, with the
+// visual hints as node attributes
+func (d *Daggo) ExportD3JSON(rootID int, w io.Writer) error {
+	graph, err := d.loadExportGraph(rootID)
+	if err != nil {
+		return err
+	}
+
+	out := d3Graph{Nodes: make([]d3Node, 0, len(graph.nodes)), Links: make([]d3Link, 0, len(graph.edges))}
+	for _, node := range graph.nodes {
+		out.Nodes = append(out.Nodes, d3Node{ID: node.ID, VisualHints: graph.hints[node.ID]})
+	}
+	for _, edge := range graph.edges {
+		out.Links = append(out.Links, d3Link{Source: edge.ParentID, Target: edge.ChildID})
+	}
+
+	return json.NewEncoder(w).Encode(out)
+}
+
+// dotQuote quotes s as a DOT identifier
+func dotQuote(s string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(s) + `"`
+}
+
+// isSafeColor accepts color names and hex values, which is all Mermaid style statements can safely embed
+func isSafeColor(color string) bool {
+	if color == "" {
+		return false
+	}
+	for _, r := range color {
+		if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '#') {
+			return false
+		}
+	}
+	return true
+}
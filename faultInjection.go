@@ -0,0 +1,209 @@
+package daggo
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"math/rand"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrInjectedFault is wrapped by the errors returned by queries failed on purpose by WithFaultInjection
+var ErrInjectedFault = errors.New("injected fault")
+
+// FaultRule describes the faults injected into one kind of operation. Probabilities are between 0 and 1 and
+// are drawn independently for every statement
+type FaultRule struct {
+	// LatencyProbability is the probability of delaying a statement by Latency plus up to LatencyJitter
+	LatencyProbability float64
+	Latency            time.Duration
+	LatencyJitter      time.Duration
+	// ErrorProbability is the probability of failing a statement, after any latency, without sending it
+	ErrorProbability float64
+}
+
+// FaultInjection configures WithFaultInjection. Rules are looked up by the operation kind of the query context
+// (see WithOperation), then by the leading keyword of the statement in lower case ("select", "insert",
+// "update", "delete", "with", "begin"...), falling back to Default
+type FaultInjection struct {
+	Default    FaultRule
+	Operations map[string]FaultRule
+	// Seed makes the injected faults reproducible, a zero Seed uses the current time
+	Seed int64
+}
+
+// WithFaultInjection injects artificial latency and transient errors into the statements sent to the
+// database, so applications can test their retry and timeout handling around daggo. Latency honours the
+// context deadline of the query. Injected errors wrap ErrInjectedFault and report themselves as temporary.
+// Not meant for production use
+func WithFaultInjection(cfg FaultInjection) Option {
+	return func(d *Daggo) {
+		seed := cfg.Seed
+		if seed == 0 {
+			seed = time.Now().UnixNano()
+		}
+		d.faults = &faultInjector{cfg: cfg, rnd: rand.New(rand.NewSource(seed))}
+	}
+}
+
+// InjectedFaultError is the error of a statement failed by WithFaultInjection
+type InjectedFaultError struct {
+	Operation string
+}
+
+func (e *InjectedFaultError) Error() string {
+	return fmt.Sprintf("%v in %s", ErrInjectedFault, e.Operation)
+}
+
+func (e *InjectedFaultError) Unwrap() error {
+	return ErrInjectedFault
+}
+
+// Temporary reports the error as transient, for callers classifying errors like net.Error
+func (e *InjectedFaultError) Temporary() bool {
+	return true
+}
+
+// faultInjector draws the faults of the statements of a Daggo
+type faultInjector struct {
+	cfg FaultInjection
+
+	mu  sync.Mutex
+	rnd *rand.Rand
+}
+
+// rule returns the rule applying to query run with ctx, and the operation it was chosen for
+func (f *faultInjector) rule(ctx context.Context, query string) (FaultRule, string) {
+	if tags, ok := ctx.Value(queryTagsKey{}).(map[string]string); ok {
+		if rule, ok := f.cfg.Operations[tags["op"]]; ok {
+			return rule, tags["op"]
+		}
+	}
+
+	keyword := ""
+	if fields := strings.Fields(query); len(fields) > 0 {
+		keyword = strings.ToLower(strings.TrimRight(fields[0], "(;"))
+	}
+	if rule, ok := f.cfg.Operations[keyword]; ok {
+		return rule, keyword
+	}
+
+	return f.cfg.Default, keyword
+}
+
+// inject applies the faults drawn for query, returning the error to fail it with or nil to run it
+func (f *faultInjector) inject(ctx context.Context, query string) error {
+	rule, op := f.rule(ctx, query)
+
+	f.mu.Lock()
+	delay := time.Duration(0)
+	if rule.LatencyProbability > 0 && f.rnd.Float64() < rule.LatencyProbability {
+		delay = rule.Latency
+		if rule.LatencyJitter > 0 {
+			delay += time.Duration(f.rnd.Int63n(int64(rule.LatencyJitter)))
+		}
+	}
+	fail := rule.ErrorProbability > 0 && f.rnd.Float64() < rule.ErrorProbability
+	f.mu.Unlock()
+
+	if delay > 0 {
+		timer := time.NewTimer(delay)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		}
+	}
+
+	if fail {
+		return &InjectedFaultError{Operation: op}
+	}
+	return nil
+}
+
+// faultConnector wraps a driver connector so every statement sent on its connections goes through the injector
+type faultConnector struct {
+	driver.Connector
+	faults *faultInjector
+}
+
+func (c *faultConnector) Connect(ctx context.Context) (driver.Conn, error) {
+	conn, err := c.Connector.Connect(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &faultConn{Conn: conn, faults: c.faults}, nil
+}
+
+// faultConn forwards to the wrapped connection once the injector let the statement through
+type faultConn struct {
+	driver.Conn
+	faults *faultInjector
+}
+
+func (c *faultConn) PrepareContext(ctx context.Context, query string) (driver.Stmt, error) {
+	if err := c.faults.inject(ctx, query); err != nil {
+		return nil, err
+	}
+	if p, ok := c.Conn.(driver.ConnPrepareContext); ok {
+		return p.PrepareContext(ctx, query)
+	}
+	return c.Conn.Prepare(query)
+}
+
+func (c *faultConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	q, ok := c.Conn.(driver.QueryerContext)
+	if !ok {
+		return nil, driver.ErrSkip
+	}
+	if err := c.faults.inject(ctx, query); err != nil {
+		return nil, err
+	}
+	return q.QueryContext(ctx, query, args)
+}
+
+func (c *faultConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	e, ok := c.Conn.(driver.ExecerContext)
+	if !ok {
+		return nil, driver.ErrSkip
+	}
+	if err := c.faults.inject(ctx, query); err != nil {
+		return nil, err
+	}
+	return e.ExecContext(ctx, query, args)
+}
+
+func (c *faultConn) BeginTx(ctx context.Context, opts driver.TxOptions) (driver.Tx, error) {
+	if err := c.faults.inject(ctx, "begin"); err != nil {
+		return nil, err
+	}
+	if b, ok := c.Conn.(driver.ConnBeginTx); ok {
+		return b.BeginTx(ctx, opts)
+	}
+	return c.Conn.Begin()
+}
+
+func (c *faultConn) Ping(ctx context.Context) error {
+	if p, ok := c.Conn.(driver.Pinger); ok {
+		return p.Ping(ctx)
+	}
+	return nil
+}
+
+func (c *faultConn) ResetSession(ctx context.Context) error {
+	if r, ok := c.Conn.(driver.SessionResetter); ok {
+		return r.ResetSession(ctx)
+	}
+	return nil
+}
+
+func (c *faultConn) IsValid() bool {
+	if v, ok := c.Conn.(driver.Validator); ok {
+		return v.IsValid()
+	}
+	return true
+}
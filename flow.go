@@ -0,0 +1,176 @@
+package daggo
+
+import (
+	"fmt"
+	"math"
+	"sort"
+)
+
+// CapacityEdge is an edge of a flow analysis with its capacity and the flow routed through it
+type CapacityEdge struct {
+	ParentID int
+	ChildID  int
+	Capacity float64
+	Flow     float64
+}
+
+// FlowAnalysis is the result of Bottlenecks: the maximum throughput from source to sink and the minimum
+// cut, i.e. the saturated edges limiting it
+type FlowAnalysis struct {
+	SourceID int
+	// SinkID is 0 when the flow was computed towards all leaves
+	SinkID  int
+	MaxFlow float64
+	MinCut  []CapacityEdge
+	Edges   []CapacityEdge
+}
+
+// Bottlenecks interprets the numeric edge payload field capacityField as edge capacity (edges without it are
+// unbounded) and computes the maximum flow from the root of the graph to sinkID, or to all leaves when sinkID
+// is 0. The edges of the minimum cut are the bottlenecks of the pipeline.
+func (d *Daggo) Bottlenecks(rootID int, sinkID int, capacityField string) (*FlowAnalysis, error) {
+	edges, err := d.loadGraphEdges(rootID)
+	if err != nil {
+		return nil, err
+	}
+
+	// Leaves are connected to a virtual sink when no sink is given
+	const virtualSink = math.MinInt32
+	sink := sinkID
+	if sinkID == 0 {
+		sink = virtualSink
+		hasChildren := make(map[int]bool)
+		for _, edge := range edges {
+			hasChildren[edge.ParentID] = true
+		}
+		for _, edge := range edges {
+			if !hasChildren[edge.ChildID] {
+				edges = append(edges, graphEdge{ParentID: edge.ChildID, ChildID: virtualSink})
+				hasChildren[edge.ChildID] = true
+			}
+		}
+	}
+
+	network := newFlowNetwork()
+	for _, edge := range edges {
+		capacity := math.Inf(1)
+		if edge.ChildID != virtualSink {
+			capacity = edge.numericField(capacityField, math.Inf(1))
+		}
+		if capacity < 0 {
+			return nil, fmt.Errorf("negative capacity on edge from %d to %d", edge.ParentID, edge.ChildID)
+		}
+		network.addEdge(edge.ParentID, edge.ChildID, capacity)
+	}
+
+	maxFlow := network.maxFlow(rootID, sink)
+	if math.IsInf(maxFlow, 1) {
+		return nil, fmt.Errorf("flow from %d is unbounded: some path has no capacity", rootID)
+	}
+
+	analysis := &FlowAnalysis{SourceID: rootID, SinkID: sinkID, MaxFlow: maxFlow}
+	reachable := network.residualReachable(rootID)
+	for _, e := range network.edges {
+		if e.to == virtualSink || e.reverse {
+			continue
+		}
+		edge := CapacityEdge{ParentID: e.from, ChildID: e.to, Capacity: e.capacity, Flow: e.flow}
+		analysis.Edges = append(analysis.Edges, edge)
+		if reachable[e.from] && !reachable[e.to] {
+			analysis.MinCut = append(analysis.MinCut, edge)
+		}
+	}
+	sort.Slice(analysis.MinCut, func(i, j int) bool { return analysis.MinCut[i].Capacity < analysis.MinCut[j].Capacity })
+
+	return analysis, nil
+}
+
+type flowEdge struct {
+	from, to int
+	capacity float64
+	flow     float64
+	reverse  bool
+	pair     int
+}
+
+// flowNetwork is a residual network solved with Edmonds-Karp
+type flowNetwork struct {
+	edges []*flowEdge
+	adj   map[int][]int
+}
+
+func newFlowNetwork() *flowNetwork {
+	return &flowNetwork{adj: make(map[int][]int)}
+}
+
+func (n *flowNetwork) addEdge(from, to int, capacity float64) {
+	forward := &flowEdge{from: from, to: to, capacity: capacity, pair: len(n.edges) + 1}
+	backward := &flowEdge{from: to, to: from, capacity: 0, reverse: true, pair: len(n.edges)}
+	n.adj[from] = append(n.adj[from], len(n.edges))
+	n.adj[to] = append(n.adj[to], len(n.edges)+1)
+	n.edges = append(n.edges, forward, backward)
+}
+
+func (n *flowNetwork) residual(e *flowEdge) float64 {
+	return e.capacity - e.flow
+}
+
+func (n *flowNetwork) maxFlow(source, sink int) float64 {
+	total := 0.0
+	for {
+		// Breadth-first search for the shortest augmenting path
+		via := map[int]int{source: -1}
+		queue := []int{source}
+		for len(queue) > 0 && !containsKey(via, sink) {
+			current := queue[0]
+			queue = queue[1:]
+			for _, i := range n.adj[current] {
+				e := n.edges[i]
+				if _, seen := via[e.to]; !seen && n.residual(e) > 0 {
+					via[e.to] = i
+					queue = append(queue, e.to)
+				}
+			}
+		}
+		if !containsKey(via, sink) {
+			return total
+		}
+
+		bottleneck := math.Inf(1)
+		for node := sink; node != source; node = n.edges[via[node]].from {
+			bottleneck = math.Min(bottleneck, n.residual(n.edges[via[node]]))
+		}
+		if math.IsInf(bottleneck, 1) {
+			return bottleneck
+		}
+		for node := sink; node != source; node = n.edges[via[node]].from {
+			e := n.edges[via[node]]
+			e.flow += bottleneck
+			n.edges[e.pair].flow -= bottleneck
+		}
+		total += bottleneck
+	}
+}
+
+// residualReachable returns the nodes reachable from source in the residual network
+func (n *flowNetwork) residualReachable(source int) map[int]bool {
+	reachable := map[int]bool{source: true}
+	queue := []int{source}
+	for len(queue) > 0 {
+		current := queue[0]
+		queue = queue[1:]
+		for _, i := range n.adj[current] {
+			e := n.edges[i]
+			if !reachable[e.to] && n.residual(e) > 0 {
+				reachable[e.to] = true
+				queue = append(queue, e.to)
+			}
+		}
+	}
+	return reachable
+}
+
+func containsKey(m map[int]int, key int) bool {
+	_, ok := m[key]
+	return ok
+}
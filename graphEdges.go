@@ -0,0 +1,73 @@
+package daggo
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+)
+
+// graphEdge is a parent-child edge of a graph together with its payload, if any. Payload is a []byte since
+// json.RawMessage cannot be scanned from NULL.
+type graphEdge struct {
+	ParentID int    `db:"parent_id"`
+	ChildID  int    `db:"child_id"`
+	Payload  []byte `db:"payload"`
+}
+
+// numericField returns the numeric value of field in the edge payload, or def when it is missing
+func (e graphEdge) numericField(field string, def float64) float64 {
+	if len(e.Payload) == 0 || field == "" {
+		return def
+	}
+
+	var fields map[string]interface{}
+	if err := json.Unmarshal(e.Payload, &fields); err != nil {
+		return def
+	}
+	return numericValue(fields[field], def)
+}
+
+// numericValue returns the number held by a decoded JSON value, given as a number or a numeric string, or def
+// when it holds none
+func numericValue(value interface{}, def float64) float64 {
+	switch v := value.(type) {
+	case float64:
+		return v
+	case string:
+		if f, err := strconv.ParseFloat(v, 64); err == nil {
+			return f
+		}
+	}
+	return def
+}
+
+// loadGraphEdges returns every edge of the graph rooted at rootID with its payload. Payloads are left
+// empty when the edge payload table was never created.
+func (d *Daggo) loadGraphEdges(rootID int) ([]graphEdge, error) {
+	edges := make([]graphEdge, 0)
+
+	query := `
+		SELECT dag_edge.parent_id, dag_edge.child_id, e.payload
+		FROM dag_edge
+		JOIN dag ON dag.id = dag_edge.child_id
+		LEFT JOIN dag_edge_payload e ON e.parent_id = dag_edge.parent_id AND e.child_id = dag_edge.child_id
+		WHERE dag.root_id = $1
+		ORDER BY dag_edge.parent_id, dag_edge.child_id
+	`
+	err := d.db.Select(&edges, query, rootID)
+	if err != nil && isUndefinedTable(err) {
+		query = `
+			SELECT dag_edge.parent_id, dag_edge.child_id, NULL::jsonb AS payload
+			FROM dag_edge
+			JOIN dag ON dag.id = dag_edge.child_id
+			WHERE dag.root_id = $1
+			ORDER BY dag_edge.parent_id, dag_edge.child_id
+		`
+		err = d.db.Select(&edges, query, rootID)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load graph edges: %v", err)
+	}
+
+	return edges, nil
+}
@@ -0,0 +1,58 @@
+package daggo
+
+import (
+	"context"
+	"fmt"
+)
+
+// graphHashQuery hashes the nodes of a graph with their primary parent and payload, then its edges, both in a
+// fixed order so that equal graphs hash the same on every database. Node and edge lists are prefixed with their
+// sizes so that no two graphs serialize to the same string.
+const graphHashQuery = `
+	SELECT md5(
+		(SELECT count(*) FROM dag WHERE root_id = $1) || ';' ||
+		COALESCE((
+			SELECT string_agg(dag.id || ':' || COALESCE(dag.parent_id::text, '') || ':' || %s, ',' ORDER BY dag.id)
+			FROM dag
+			WHERE dag.root_id = $1
+		), '') || ';' ||
+		COALESCE((
+			SELECT string_agg(dag_edge.parent_id || '>' || dag_edge.child_id, ',' ORDER BY dag_edge.parent_id, dag_edge.child_id)
+			FROM dag_edge
+			JOIN dag ON dag.id = dag_edge.child_id
+			WHERE dag.root_id = $1
+		), '')
+	)
+`
+
+// GraphHash returns a hash of the graph rooted at rootID computed in the database: its nodes, their parents and
+// their payloads. It changes whenever a node is added, moved, deleted or has its payload updated, and is equal
+// for graphs with the same content, so it can serve as the cache key or ETag of whole-graph responses. It is not
+// meant to resist deliberate collisions. It fails with ErrNodeNotFound when the graph does not exist.
+func (d *Daggo) GraphHash(rootID int) (string, error) {
+	return d.GraphHashContext(context.Background(), rootID)
+}
+
+// GraphHashContext is GraphHash with a context bounding its queries
+func (d *Daggo) GraphHashContext(ctx context.Context, rootID int) (string, error) {
+	var exists bool
+	err := d.db.GetContext(ctx, &exists, "SELECT EXISTS (SELECT 1 FROM dag WHERE id = $1 AND root_id = $1)", rootID)
+	if err != nil {
+		return "", fmt.Errorf("failed to get graph root: %v", err)
+	}
+	if !exists {
+		return "", fmt.Errorf("%w: graph root %d", ErrNodeNotFound, rootID)
+	}
+
+	// Payloads are only hashed when the column exists, so that it is not required otherwise
+	var hash string
+	err = d.db.GetContext(ctx, &hash, fmt.Sprintf(graphHashQuery, "md5(dag.payload::text)"), rootID)
+	if err != nil && isUndefinedColumn(err) {
+		err = d.db.GetContext(ctx, &hash, fmt.Sprintf(graphHashQuery, "''"), rootID)
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to hash graph: %v", err)
+	}
+
+	return hash, nil
+}
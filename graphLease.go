@@ -0,0 +1,125 @@
+package daggo
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ErrGraphOwned is returned when another owner holds an unexpired lease on a graph
+var ErrGraphOwned = errors.New("graph is owned by another owner")
+
+// GraphLease records which owner currently operates the graph rooted at RootID
+type GraphLease struct {
+	RootID     int       `db:"root_id"`
+	OwnerID    string    `db:"owner_id"`
+	AcquiredAt time.Time `db:"acquired_at"`
+	ExpiresAt  time.Time `db:"expires_at"`
+}
+
+const createGraphLeaseTableQuery = `
+	CREATE TABLE IF NOT EXISTS dag_graph_lease (
+		root_id INTEGER PRIMARY KEY,
+		owner_id TEXT NOT NULL,
+		acquired_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+		expires_at TIMESTAMPTZ NOT NULL
+	);
+`
+
+// CreateGraphLeaseTable creates the side table used to store graph ownership leases
+func (d *Daggo) CreateGraphLeaseTable() error {
+	_, err := d.db.Exec(createGraphLeaseTableQuery)
+	if err != nil {
+		return fmt.Errorf("failed to create graph lease table: %v", err)
+	}
+
+	return nil
+}
+
+// AcquireGraphOwnership makes ownerID the owner of the graph rooted at rootID for the given lease duration.
+// Acquiring a graph already owned by ownerID renews the lease; a lease held by another owner can only be
+// taken over once it has expired, otherwise ErrGraphOwned is returned.
+func (d *Daggo) AcquireGraphOwnership(rootID int, ownerID string, lease time.Duration) (*GraphLease, error) {
+	if ownerID == "" {
+		return nil, fmt.Errorf("owner ID cannot be empty")
+	}
+	if lease <= 0 {
+		return nil, fmt.Errorf("lease duration must be positive")
+	}
+
+	var graphLease GraphLease
+
+	// Expiry is computed with the database clock so that competing instances agree on it
+	query := `
+		INSERT INTO dag_graph_lease (root_id, owner_id, expires_at)
+		VALUES ($1, $2, now() + $3 * interval '1 millisecond')
+		ON CONFLICT (root_id) DO UPDATE
+		SET owner_id = EXCLUDED.owner_id,
+			acquired_at = CASE
+				WHEN dag_graph_lease.owner_id = EXCLUDED.owner_id THEN dag_graph_lease.acquired_at
+				ELSE now()
+			END,
+			expires_at = EXCLUDED.expires_at
+		WHERE dag_graph_lease.owner_id = EXCLUDED.owner_id OR dag_graph_lease.expires_at < now()
+		RETURNING *
+	`
+	err := d.db.Get(&graphLease, query, rootID, ownerID, lease.Milliseconds())
+	if err == sql.ErrNoRows {
+		return nil, ErrGraphOwned
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to acquire graph ownership: %v", err)
+	}
+
+	return &graphLease, nil
+}
+
+// RenewGraphOwnership extends the lease ownerID holds on the graph rooted at rootID.
+// It returns ErrGraphOwned if the lease has expired or was taken over by another owner.
+func (d *Daggo) RenewGraphOwnership(rootID int, ownerID string, lease time.Duration) (*GraphLease, error) {
+	if lease <= 0 {
+		return nil, fmt.Errorf("lease duration must be positive")
+	}
+
+	var graphLease GraphLease
+
+	query := `
+		UPDATE dag_graph_lease
+		SET expires_at = now() + $3 * interval '1 millisecond'
+		WHERE root_id = $1 AND owner_id = $2 AND expires_at >= now()
+		RETURNING *
+	`
+	err := d.db.Get(&graphLease, query, rootID, ownerID, lease.Milliseconds())
+	if err == sql.ErrNoRows {
+		return nil, ErrGraphOwned
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to renew graph ownership: %v", err)
+	}
+
+	return &graphLease, nil
+}
+
+// ReleaseGraphOwnership gives up the lease ownerID holds on the graph rooted at rootID
+func (d *Daggo) ReleaseGraphOwnership(rootID int, ownerID string) error {
+	_, err := d.db.Exec("DELETE FROM dag_graph_lease WHERE root_id = $1 AND owner_id = $2", rootID, ownerID)
+	if err != nil {
+		return fmt.Errorf("failed to release graph ownership: %v", err)
+	}
+
+	return nil
+}
+
+// GetGraphOwner returns the current unexpired lease on the graph rooted at rootID, or nil if it has no owner
+func (d *Daggo) GetGraphOwner(rootID int) (*GraphLease, error) {
+	var graphLease GraphLease
+
+	query := "SELECT * FROM dag_graph_lease WHERE root_id = $1 AND expires_at >= now()"
+	err := d.db.Get(&graphLease, query, rootID)
+	if err == sql.ErrNoRows {
+		return nil, nil // Graph is not owned
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to get graph owner: %v", err)
+	}
+
+	return &graphLease, nil
+}
@@ -0,0 +1,177 @@
+package daggo
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// GraphMeta describes the graph rooted at RootID
+type GraphMeta struct {
+	RootID      int            `db:"root_id"`
+	Name        string         `db:"name"`
+	Description string         `db:"description"`
+	Owner       string         `db:"owner"`
+	Labels      pq.StringArray `db:"labels"`
+	Settings    GraphSettings  `db:"settings"`
+	CreatedAt   time.Time      `db:"created_at"`
+	UpdatedAt   time.Time      `db:"updated_at"`
+}
+
+// GraphFilter narrows the graphs returned by ListGraphs; zero-valued fields are ignored
+type GraphFilter struct {
+	Owner      string
+	NamePrefix string
+	// Labels keeps only graphs carrying all of the given labels
+	Labels []string
+}
+
+const createGraphTableQuery = `
+	CREATE TABLE IF NOT EXISTS dag_graph (
+		root_id INTEGER PRIMARY KEY,
+		name TEXT NOT NULL,
+		description TEXT NOT NULL DEFAULT '',
+		owner TEXT NOT NULL DEFAULT '',
+		labels TEXT[] NOT NULL DEFAULT '{}',
+		created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+		updated_at TIMESTAMPTZ NOT NULL DEFAULT now()
+	);
+	CREATE INDEX IF NOT EXISTS dag_graph_labels_idx ON dag_graph USING GIN (labels);
+	ALTER TABLE dag_graph ADD COLUMN IF NOT EXISTS settings JSONB NOT NULL DEFAULT '{}';
+`
+
+// CreateGraphTable creates the side table used to store graph metadata
+func (d *Daggo) CreateGraphTable() error {
+	_, err := d.db.Exec(createGraphTableQuery)
+	if err != nil {
+		return fmt.Errorf("failed to create graph table: %v", err)
+	}
+
+	return nil
+}
+
+// CreateGraph registers the graph rooted at meta.RootID, creating the root node if it does not exist yet. The
+// root and the metadata are created in one transaction, so a failed registration leaves no root behind.
+func (d *Daggo) CreateGraph(meta GraphMeta) (*GraphMeta, error) {
+	if meta.Name == "" {
+		return nil, fmt.Errorf("graph name cannot be empty")
+	}
+
+	labels := meta.Labels
+	if labels == nil {
+		labels = pq.StringArray{}
+	}
+
+	var graph GraphMeta
+	ctx := context.Background()
+	err := d.Tx(ctx, func(txDaggo *Daggo) error {
+		root, err := txDaggo.GetNodeByIDContext(ctx, meta.RootID)
+		if err != nil {
+			return err
+		}
+		if root == nil {
+			err = txDaggo.AddRootNodeContext(ctx, meta.RootID)
+			if err != nil {
+				return err
+			}
+		} else if root.ParentID.Valid {
+			return fmt.Errorf("node with ID %d is not a root node", meta.RootID)
+		}
+
+		query := `
+			INSERT INTO dag_graph (root_id, name, description, owner, labels)
+			VALUES ($1, $2, $3, $4, $5)
+			RETURNING *
+		`
+		err = txDaggo.db.GetContext(ctx, &graph, query, meta.RootID, meta.Name, meta.Description, meta.Owner, labels)
+		if err != nil {
+			return fmt.Errorf("failed to create graph: %v", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &graph, nil
+}
+
+// GetGraph returns the metadata of the graph rooted at rootID, or nil if it is not registered
+func (d *Daggo) GetGraph(rootID int) (*GraphMeta, error) {
+	var graph GraphMeta
+
+	err := d.db.Get(&graph, "SELECT * FROM dag_graph WHERE root_id = $1", rootID)
+	if err == sql.ErrNoRows {
+		return nil, nil // No graph registered for this root
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to get graph: %v", err)
+	}
+
+	return &graph, nil
+}
+
+// UpdateGraphMeta replaces the name, description, owner and labels of the graph rooted at rootID
+func (d *Daggo) UpdateGraphMeta(rootID int, meta GraphMeta) (*GraphMeta, error) {
+	if meta.Name == "" {
+		return nil, fmt.Errorf("graph name cannot be empty")
+	}
+
+	labels := meta.Labels
+	if labels == nil {
+		labels = pq.StringArray{}
+	}
+
+	var graph GraphMeta
+
+	query := `
+		UPDATE dag_graph
+		SET name = $2, description = $3, owner = $4, labels = $5, updated_at = now()
+		WHERE root_id = $1
+		RETURNING *
+	`
+	err := d.db.Get(&graph, query, rootID, meta.Name, meta.Description, meta.Owner, labels)
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("graph with root ID %d does not exist", rootID)
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to update graph: %v", err)
+	}
+
+	return &graph, nil
+}
+
+// ListGraphs returns the registered graphs matching the given filter ordered by name
+func (d *Daggo) ListGraphs(filter GraphFilter) ([]GraphMeta, error) {
+	graphs := make([]GraphMeta, 0)
+
+	conditions := make([]string, 0)
+	args := make([]interface{}, 0)
+	if filter.Owner != "" {
+		args = append(args, filter.Owner)
+		conditions = append(conditions, fmt.Sprintf("owner = $%d", len(args)))
+	}
+	if filter.NamePrefix != "" {
+		args = append(args, filter.NamePrefix+"%")
+		conditions = append(conditions, fmt.Sprintf("name LIKE $%d", len(args)))
+	}
+	if len(filter.Labels) > 0 {
+		args = append(args, pq.StringArray(filter.Labels))
+		conditions = append(conditions, fmt.Sprintf("labels @> $%d", len(args)))
+	}
+
+	query := "SELECT * FROM dag_graph"
+	if len(conditions) > 0 {
+		query += " WHERE " + strings.Join(conditions, " AND ")
+	}
+	query += " ORDER BY name ASC, root_id ASC"
+
+	err := d.db.Select(&graphs, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list graphs: %v", err)
+	}
+
+	return graphs, nil
+}
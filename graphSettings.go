@@ -0,0 +1,206 @@
+package daggo
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// ErrMaxDepthExceeded is returned when a node would lie deeper than the MaxDepth setting of its graph
+var ErrMaxDepthExceeded = errors.New("max depth exceeded")
+
+// graphSettingsTTL bounds how long a Daggo uses cached settings changed by another instance
+const graphSettingsTTL = 30 * time.Second
+
+// GraphSettings tune the behavior of the library for one graph; zero values keep the defaults. They are stored
+// with the graph metadata.
+type GraphSettings struct {
+	// MaxDepth is the largest number of edges on the longest path between the root and a node, checked when
+	// AddChildNode adds a node and when AddEdge adds an edge, 0 for no limit
+	MaxDepth int `json:"max_depth,omitempty"`
+	// Order sorts the children returned by GetNextChildrenNodes when no WithOrder is given
+	Order NodeOrder `json:"order,omitempty"`
+	// HistoryRetention overrides the retention of the history sweep maintenance task for the graph
+	HistoryRetention time.Duration `json:"history_retention,omitempty"`
+	// DefaultEdgeLabel is stored as the label of the edge payload of the edges created by AddChildNode and
+	// AddEdge, which then need the edge payload table
+	DefaultEdgeLabel string `json:"default_edge_label,omitempty"`
+	// Codec names the codec, registered with RegisterCodec, encoding the payloads of the graph with
+	// WithPayloadCodecs; JSONCodec when empty
+	Codec string `json:"codec,omitempty"`
+}
+
+// Scan decodes settings stored as JSON
+func (s *GraphSettings) Scan(src interface{}) error {
+	*s = GraphSettings{}
+	switch v := src.(type) {
+	case nil:
+		return nil
+	case []byte:
+		return json.Unmarshal(v, s)
+	case string:
+		return json.Unmarshal([]byte(v), s)
+	default:
+		return fmt.Errorf("cannot scan %T into graph settings", src)
+	}
+}
+
+// Value encodes the settings as JSON
+func (s GraphSettings) Value() (driver.Value, error) {
+	return json.Marshal(s)
+}
+
+type cachedGraphSettings struct {
+	settings GraphSettings
+	expires  time.Time
+}
+
+// GetGraphSettings returns the settings of the graph rooted at rootID; unregistered graphs have the defaults
+func (d *Daggo) GetGraphSettings(rootID int) (*GraphSettings, error) {
+	var settings GraphSettings
+
+	err := d.db.Get(&settings, "SELECT settings FROM dag_graph WHERE root_id = $1", rootID)
+	if err == sql.ErrNoRows || isUndefinedTable(err) || isUndefinedColumn(err) {
+		return &settings, nil // Defaults for unregistered graphs
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to get graph settings: %v", err)
+	}
+
+	return &settings, nil
+}
+
+// SetGraphSettings replaces the settings of the graph rooted at rootID, which must be registered with
+// CreateGraph. Other Daggo instances pick the change up within 30 seconds.
+func (d *Daggo) SetGraphSettings(rootID int, settings GraphSettings) error {
+	if settings.MaxDepth < 0 || settings.HistoryRetention < 0 {
+		return fmt.Errorf("graph settings cannot be negative")
+	}
+	if settings.Codec != "" {
+		if _, err := lookupCodec(settings.Codec); err != nil {
+			return err
+		}
+	}
+
+	result, err := d.db.Exec("UPDATE dag_graph SET settings = $2, updated_at = now() WHERE root_id = $1", rootID, settings)
+	if err != nil {
+		return fmt.Errorf("failed to set graph settings: %v", err)
+	}
+	updated, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to set graph settings: %v", err)
+	}
+	if updated == 0 {
+		return fmt.Errorf("graph with root ID %d does not exist", rootID)
+	}
+
+	d.mu.Lock()
+	delete(d.settings, rootID)
+	d.mu.Unlock()
+
+	return nil
+}
+
+// graphSettings returns the settings of the graph rooted at rootID, cached for graphSettingsTTL
+func (d *Daggo) graphSettings(ctx context.Context, rootID int) (GraphSettings, error) {
+	d.mu.RLock()
+	cached, ok := d.settings[rootID]
+	d.mu.RUnlock()
+	if ok && time.Now().Before(cached.expires) {
+		return cached.settings, nil
+	}
+
+	var settings GraphSettings
+	err := d.db.GetContext(ctx, &settings, "SELECT settings FROM dag_graph WHERE root_id = $1", rootID)
+	if err != nil && err != sql.ErrNoRows && !isUndefinedTable(err) && !isUndefinedColumn(err) {
+		return settings, fmt.Errorf("failed to get graph settings: %v", err)
+	}
+
+	d.mu.Lock()
+	if d.settings == nil {
+		d.settings = make(map[int]cachedGraphSettings)
+	}
+	d.settings[rootID] = cachedGraphSettings{settings: settings, expires: time.Now().Add(graphSettingsTTL)}
+	d.mu.Unlock()
+
+	return settings, nil
+}
+
+// checkDepth returns ErrMaxDepthExceeded if an edge from parentID to childID would put a node deeper than
+// maxDepth below its root. Depths follow every edge, so a node lies at the length of its longest path from the
+// root.
+func checkDepth(ctx context.Context, tx *sqlx.Tx, parentID int, childID int, maxDepth int) error {
+	var depth int
+
+	// The longest path from the root to the parent, plus the longest path from the child down to a leaf
+	query := `
+		WITH RECURSIVE up AS (
+			SELECT $1::int AS id, 0 AS depth
+			UNION
+			SELECT dag_edge.parent_id, up.depth + 1 FROM dag_edge JOIN up ON dag_edge.child_id = up.id
+		),
+		down AS (
+			SELECT $2::int AS id, 0 AS depth
+			UNION
+			SELECT dag_edge.child_id, down.depth + 1 FROM dag_edge JOIN down ON dag_edge.parent_id = down.id
+		)
+		SELECT (SELECT MAX(depth) FROM up) + (SELECT MAX(depth) FROM down)
+	`
+	err := tx.GetContext(ctx, &depth, query, parentID, childID)
+	if err != nil {
+		return fmt.Errorf("failed to get depth of node %d: %v", parentID, err)
+	}
+	if depth+1 > maxDepth {
+		return fmt.Errorf("%w: an edge from %d to %d would put nodes at depth %d, the graph allows %d", ErrMaxDepthExceeded, parentID, childID, depth+1, maxDepth)
+	}
+
+	return nil
+}
+
+// labelEdge stores label as the label of the payload of the edge between parentID and childID, unless the
+// edge already has a payload
+func labelEdge(ctx context.Context, tx *sqlx.Tx, parentID int, childID int, label string) error {
+	query := `
+		INSERT INTO dag_edge_payload (parent_id, child_id, payload)
+		VALUES ($1, $2, jsonb_build_object('label', $3::text))
+		ON CONFLICT (parent_id, child_id) DO NOTHING
+	`
+	_, err := tx.ExecContext(ctx, query, parentID, childID, label)
+	if err != nil {
+		return fmt.Errorf("failed to label edge from %d to %d: %v", parentID, childID, err)
+	}
+
+	return nil
+}
+
+// sortNodes sorts nodes in place as the ORDER BY clause of order would
+func sortNodes(nodes []DagNode, order NodeOrder) {
+	sort.SliceStable(nodes, func(i, j int) bool {
+		a, b := nodes[i], nodes[j]
+		switch order {
+		case NewestFirst:
+			if !a.CreatedAt.Equal(b.CreatedAt) {
+				return a.CreatedAt.After(b.CreatedAt)
+			}
+			return a.ID > b.ID
+		case OldestFirst:
+			if !a.CreatedAt.Equal(b.CreatedAt) {
+				return a.CreatedAt.Before(b.CreatedAt)
+			}
+			return a.ID < b.ID
+		case RecentlyUpdatedFirst:
+			if !a.UpdatedAt.Equal(b.UpdatedAt) {
+				return a.UpdatedAt.After(b.UpdatedAt)
+			}
+			return a.ID > b.ID
+		default:
+			return a.ID < b.ID
+		}
+	})
+}
@@ -0,0 +1,285 @@
+package daggo
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// History operations recorded for every change to the dag table
+const (
+	HistoryInsert = "I"
+	HistoryUpdate = "U"
+	HistoryDelete = "D"
+)
+
+// HistoryEntry is a snapshot of a dag row taken when it was inserted, updated or deleted
+type HistoryEntry struct {
+	ID        int64           `db:"id"`
+	NodeID    int             `db:"node_id"`
+	RootID    int             `db:"root_id"`
+	Op        string          `db:"op"`
+	RowImage  json.RawMessage `db:"row_image"`
+	ChangedAt time.Time       `db:"changed_at"`
+	// Actor is the user or service credited with the change when attribution is enabled
+	Actor sql.NullString `db:"actor"`
+}
+
+// The history table is filled by a trigger so that writes made outside of daggo are recorded too
+const createHistoryTableQuery = `
+	CREATE TABLE IF NOT EXISTS dag_history (
+		id BIGSERIAL PRIMARY KEY,
+		node_id INTEGER NOT NULL,
+		root_id INTEGER,
+		op CHAR(1) NOT NULL,
+		row_image JSONB NOT NULL,
+		changed_at TIMESTAMPTZ NOT NULL DEFAULT clock_timestamp()
+	);
+	ALTER TABLE dag_history ADD COLUMN IF NOT EXISTS actor TEXT;
+	CREATE INDEX IF NOT EXISTS dag_history_node_id_idx ON dag_history (node_id, id);
+	CREATE INDEX IF NOT EXISTS dag_history_root_id_idx ON dag_history (root_id, changed_at);
+
+	CREATE OR REPLACE FUNCTION dag_history_record() RETURNS trigger AS $$
+	BEGIN
+		IF TG_OP = 'DELETE' THEN
+			INSERT INTO dag_history (node_id, root_id, op, row_image, actor)
+			VALUES (OLD.id, OLD.root_id, 'D', to_jsonb(OLD), nullif(current_setting('daggo.actor', true), ''));
+			RETURN OLD;
+		END IF;
+		INSERT INTO dag_history (node_id, root_id, op, row_image, actor)
+		VALUES (NEW.id, NEW.root_id, left(TG_OP, 1), to_jsonb(NEW), to_jsonb(NEW)->>'updated_by');
+		RETURN NEW;
+	END;
+	$$ LANGUAGE plpgsql;
+
+	DROP TRIGGER IF EXISTS dag_history_trigger ON dag;
+	CREATE TRIGGER dag_history_trigger
+		AFTER INSERT OR UPDATE OR DELETE ON dag
+		FOR EACH ROW EXECUTE FUNCTION dag_history_record();
+
+	-- Edges are only inserted and deleted, so the history of each edge is a sequence of I and D entries
+	CREATE TABLE IF NOT EXISTS dag_edge_history (
+		id BIGSERIAL PRIMARY KEY,
+		parent_id INTEGER NOT NULL,
+		child_id INTEGER NOT NULL,
+		op CHAR(1) NOT NULL,
+		changed_at TIMESTAMPTZ NOT NULL DEFAULT clock_timestamp(),
+		actor TEXT
+	);
+	CREATE INDEX IF NOT EXISTS dag_edge_history_child_id_idx ON dag_edge_history (child_id, changed_at);
+
+	CREATE OR REPLACE FUNCTION dag_edge_history_record() RETURNS trigger AS $$
+	BEGIN
+		IF TG_OP = 'DELETE' THEN
+			INSERT INTO dag_edge_history (parent_id, child_id, op, actor)
+			VALUES (OLD.parent_id, OLD.child_id, 'D', nullif(current_setting('daggo.actor', true), ''));
+			RETURN OLD;
+		END IF;
+		INSERT INTO dag_edge_history (parent_id, child_id, op, actor)
+		VALUES (NEW.parent_id, NEW.child_id, 'I', nullif(current_setting('daggo.actor', true), ''));
+		RETURN NEW;
+	END;
+	$$ LANGUAGE plpgsql;
+
+	DROP TRIGGER IF EXISTS dag_edge_history_trigger ON dag_edge;
+	CREATE TRIGGER dag_edge_history_trigger
+		AFTER INSERT OR DELETE ON dag_edge
+		FOR EACH ROW EXECUTE FUNCTION dag_edge_history_record();
+`
+
+// CreateHistoryTable creates the history tables and installs the triggers recording every change to the dag and
+// dag_edge tables
+func (d *Daggo) CreateHistoryTable() error {
+	_, err := d.db.Exec(createHistoryTableQuery)
+	if err != nil {
+		return fmt.Errorf("failed to create history table: %v", err)
+	}
+
+	return nil
+}
+
+// GetNodeHistory returns the recorded changes of the given node ID, oldest first
+func (d *Daggo) GetNodeHistory(nodeID int) ([]HistoryEntry, error) {
+	entries := make([]HistoryEntry, 0)
+
+	err := d.db.Select(&entries, "SELECT * FROM dag_history WHERE node_id = $1 ORDER BY id ASC", nodeID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get node history: %v", err)
+	}
+
+	return entries, nil
+}
+
+// graphStateAtQuery selects the row images of the nodes that belonged to graph $1 at time $2
+const graphStateAtQuery = `
+	WITH latest AS (
+		SELECT DISTINCT ON (node_id) node_id, op, row_image
+		FROM dag_history
+		WHERE changed_at <= $2
+			AND node_id IN (SELECT node_id FROM dag_history WHERE root_id = $1)
+		ORDER BY node_id, id DESC
+	)
+	SELECT row_image
+	FROM latest
+	WHERE op <> 'D' AND (row_image->>'root_id')::int = $1
+`
+
+// edgeStateAtQuery selects the edges between the nodes $1 that existed at time $2
+const edgeStateAtQuery = `
+	SELECT parent_id, child_id
+	FROM (
+		SELECT DISTINCT ON (parent_id, child_id) parent_id, child_id, op
+		FROM dag_edge_history
+		WHERE changed_at <= $2 AND child_id = ANY($1::int[])
+		ORDER BY parent_id, child_id, id DESC
+	) AS latest
+	WHERE op <> 'D' AND parent_id = ANY($1::int[])
+`
+
+// movedNodesQuery selects the nodes of graph $1 at time $2 that belong to another graph now
+const movedNodesQuery = `
+	SELECT id FROM dag
+	WHERE root_id <> $1 AND id IN (SELECT (state.row_image->>'id')::int FROM (` + graphStateAtQuery + `) AS state)
+	ORDER BY id
+`
+
+// RestoreGraphTo rewinds the graph rooted at rootID to the state it had at the given time.
+// The current nodes of the graph are replaced in a single transaction; the restore itself is recorded in the history.
+// The edges between the restored nodes are restored too, those recorded since CreateHistoryTable installed the edge
+// history. Nodes of the graph at that time that belong to another graph now cannot be taken back without breaking
+// it, so the restore fails with ErrNodeExists listing them; RestoreGraphCopy restores such graphs next to the live
+// ones.
+func (d *Daggo) RestoreGraphTo(rootID int, at time.Time) error {
+	// Start a transaction
+	tx, err := d.db.Beginx()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %v", err)
+	}
+	defer func() {
+		// Rollback the transaction if it failed to commit
+		if p := recover(); p != nil {
+			tx.Rollback()
+			panic(p)
+		} else if err != nil {
+			tx.Rollback()
+		}
+	}()
+
+	err = d.setTxActor(context.Background(), tx)
+	if err != nil {
+		return err
+	}
+
+	moved := make([]int, 0)
+	err = tx.Select(&moved, movedNodesQuery, rootID, at)
+	if err != nil {
+		return fmt.Errorf("failed to find moved nodes: %v", err)
+	}
+	if len(moved) > 0 {
+		err = fmt.Errorf("%w: nodes %v belong to another graph now", ErrNodeExists, moved)
+		return err
+	}
+
+	_, err = tx.Exec("DELETE FROM dag WHERE root_id = $1", rootID)
+	if err != nil {
+		return fmt.Errorf("failed to clear graph: %v", err)
+	}
+
+	query := `
+		INSERT INTO dag
+		SELECT (jsonb_populate_record(NULL::dag, state.row_image)).*
+		FROM (` + graphStateAtQuery + `) AS state
+		RETURNING id
+	`
+	restored := make([]int, 0)
+	err = tx.Select(&restored, query, rootID, at)
+	if err != nil {
+		return fmt.Errorf("failed to restore graph: %v", err)
+	}
+
+	// The trigger of the edge table already restored the edges of the primary parents
+	query = `
+		INSERT INTO dag_edge (parent_id, child_id)
+		SELECT parent_id, child_id FROM (` + edgeStateAtQuery + `) AS state
+		ON CONFLICT DO NOTHING
+	`
+	_, err = tx.Exec(query, pq.Array(restored), at)
+	if err != nil {
+		return fmt.Errorf("failed to restore edges: %v", err)
+	}
+
+	// Commit the transaction
+	err = tx.Commit()
+	if err != nil {
+		return fmt.Errorf("failed to commit transaction: %v", err)
+	}
+
+	d.InvalidatePlanCache()
+
+	return nil
+}
+
+// RestoreGraphCopy recreates the graph rooted at rootID as it was at the given time next to the live graph,
+// shifting every node ID (and parent/root reference) by idOffset so the copy can be inspected safely.
+// The edges between the nodes are copied too. It returns the root ID of the copy.
+func (d *Daggo) RestoreGraphCopy(rootID int, at time.Time, idOffset int) (int, error) {
+	if idOffset == 0 {
+		return 0, fmt.Errorf("ID offset cannot be zero")
+	}
+
+	// Start a transaction
+	tx, err := d.db.Beginx()
+	if err != nil {
+		return 0, fmt.Errorf("failed to begin transaction: %v", err)
+	}
+	defer func() {
+		// Rollback the transaction if it failed to commit
+		if p := recover(); p != nil {
+			tx.Rollback()
+			panic(p)
+		} else if err != nil {
+			tx.Rollback()
+		}
+	}()
+
+	query := `
+		INSERT INTO dag
+		SELECT (jsonb_populate_record(NULL::dag,
+			state.row_image || jsonb_build_object(
+				'id', (state.row_image->>'id')::int + $3,
+				'parent_id', (state.row_image->>'parent_id')::int + $3,
+				'root_id', (state.row_image->>'root_id')::int + $3
+			))).*
+		FROM (` + graphStateAtQuery + `) AS state
+		RETURNING id - $3
+	`
+	restored := make([]int, 0)
+	err = tx.Select(&restored, query, rootID, at, idOffset)
+	if err != nil {
+		return 0, fmt.Errorf("failed to restore graph copy: %v", err)
+	}
+
+	query = `
+		INSERT INTO dag_edge (parent_id, child_id)
+		SELECT parent_id + $3, child_id + $3 FROM (` + edgeStateAtQuery + `) AS state
+		ON CONFLICT DO NOTHING
+	`
+	_, err = tx.Exec(query, pq.Array(restored), at, idOffset)
+	if err != nil {
+		return 0, fmt.Errorf("failed to restore edges of graph copy: %v", err)
+	}
+
+	// Commit the transaction
+	err = tx.Commit()
+	if err != nil {
+		return 0, fmt.Errorf("failed to commit transaction: %v", err)
+	}
+
+	d.InvalidatePlanCache()
+
+	return rootID + idOffset, nil
+}
@@ -0,0 +1,195 @@
+package daggo
+
+import (
+	"fmt"
+	"sort"
+)
+
+// Impact describes the predicted effect of a mutation. Nothing is changed when it is computed.
+type Impact struct {
+	// AffectedDescendants is the number of nodes below the mutated node or edge
+	AffectedDescendants int
+	// OrphanedNodes are the nodes that would no longer be reachable from the root, in ID order
+	OrphanedNodes []int
+	// BrokenPaths is the number of root-to-leaf paths that would disappear
+	BrokenPaths int
+	// NewPaths is the number of root-to-leaf paths that would appear
+	NewPaths int
+	// Cycles are the cycles the mutation would create, each listed from the child back to itself
+	Cycles [][]int
+}
+
+// ImpactOfDelete predicts the effect of deleting the given node
+func (d *Daggo) ImpactOfDelete(nodeID int) (*Impact, error) {
+	node, err := d.GetNodeByID(nodeID)
+	if err != nil {
+		return nil, err
+	}
+	if node == nil {
+		return nil, fmt.Errorf("%w: %d", ErrNodeNotFound, nodeID)
+	}
+
+	graph, err := d.loadImpactGraph(node.RootID)
+	if err != nil {
+		return nil, err
+	}
+
+	impact := &Impact{OrphanedNodes: make([]int, 0), Cycles: make([][]int, 0)}
+	descendants := graph.reachable(nodeID, -1)
+	impact.AffectedDescendants = len(descendants) - 1
+
+	remaining := graph.reachable(node.RootID, nodeID)
+	for id := range descendants {
+		if id != nodeID && !remaining[id] {
+			impact.OrphanedNodes = append(impact.OrphanedNodes, id)
+		}
+	}
+	sort.Ints(impact.OrphanedNodes)
+
+	impact.BrokenPaths = graph.pathsTo(node.RootID, nodeID) * graph.pathsToLeaves(nodeID)
+
+	return impact, nil
+}
+
+// ImpactOfEdge predicts the effect of adding an edge from parentID to childID
+func (d *Daggo) ImpactOfEdge(parentID int, childID int) (*Impact, error) {
+	parent, err := d.GetNodeByID(parentID)
+	if err != nil {
+		return nil, err
+	}
+	if parent == nil {
+		return nil, fmt.Errorf("%w: %d", ErrNodeNotFound, parentID)
+	}
+	child, err := d.GetNodeByID(childID)
+	if err != nil {
+		return nil, err
+	}
+	if child == nil {
+		return nil, fmt.Errorf("%w: %d", ErrNodeNotFound, childID)
+	}
+
+	graph, err := d.loadImpactGraph(parent.RootID, child.RootID)
+	if err != nil {
+		return nil, err
+	}
+
+	impact := &Impact{OrphanedNodes: make([]int, 0), Cycles: make([][]int, 0)}
+	impact.AffectedDescendants = len(graph.reachable(childID, -1)) - 1
+
+	// Every path from the child back up to the parent closes a cycle with the new edge
+	for _, path := range graph.allPaths(childID, parentID) {
+		impact.Cycles = append(impact.Cycles, append(path, childID))
+	}
+	if parentID == childID {
+		impact.Cycles = append(impact.Cycles, []int{childID, childID})
+	}
+	if len(impact.Cycles) == 0 {
+		impact.NewPaths = graph.pathsTo(parent.RootID, parentID) * graph.pathsToLeaves(childID)
+	}
+
+	return impact, nil
+}
+
+// impactGraph is an in-memory adjacency list used for what-if analysis
+type impactGraph map[int][]int
+
+func (d *Daggo) loadImpactGraph(rootIDs ...int) (impactGraph, error) {
+	graph := make(impactGraph)
+	loaded := make(map[int]bool)
+	for _, rootID := range rootIDs {
+		if loaded[rootID] {
+			continue
+		}
+		loaded[rootID] = true
+
+		edges, err := d.loadGraphEdges(rootID)
+		if err != nil {
+			return nil, err
+		}
+		for _, edge := range edges {
+			graph[edge.ParentID] = append(graph[edge.ParentID], edge.ChildID)
+		}
+	}
+	return graph, nil
+}
+
+// reachable returns the nodes reachable from start without passing through skip
+func (g impactGraph) reachable(start int, skip int) map[int]bool {
+	seen := map[int]bool{start: true}
+	stack := []int{start}
+	for len(stack) > 0 {
+		id := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		for _, childID := range g[id] {
+			if childID != skip && !seen[childID] {
+				seen[childID] = true
+				stack = append(stack, childID)
+			}
+		}
+	}
+	return seen
+}
+
+// pathsTo counts the distinct paths from one node down to another
+func (g impactGraph) pathsTo(from int, to int) int {
+	memo := make(map[int]int)
+	var count func(id int) int
+	count = func(id int) int {
+		if id == to {
+			return 1
+		}
+		if n, ok := memo[id]; ok {
+			return n
+		}
+		total := 0
+		for _, childID := range g[id] {
+			total += count(childID)
+		}
+		memo[id] = total
+		return total
+	}
+	return count(from)
+}
+
+// pathsToLeaves counts the distinct paths from a node down to the leaves below it
+func (g impactGraph) pathsToLeaves(from int) int {
+	memo := make(map[int]int)
+	var count func(id int) int
+	count = func(id int) int {
+		if len(g[id]) == 0 {
+			return 1
+		}
+		if n, ok := memo[id]; ok {
+			return n
+		}
+		total := 0
+		for _, childID := range g[id] {
+			total += count(childID)
+		}
+		memo[id] = total
+		return total
+	}
+	return count(from)
+}
+
+// allPaths lists every path from one node down to another
+func (g impactGraph) allPaths(from int, to int) [][]int {
+	paths := make([][]int, 0)
+	path := []int{from}
+	var walk func(id int)
+	walk = func(id int) {
+		if id == to {
+			paths = append(paths, append([]int(nil), path...))
+			return
+		}
+		for _, childID := range g[id] {
+			path = append(path, childID)
+			walk(childID)
+			path = path[:len(path)-1]
+		}
+	}
+	if from != to {
+		walk(from)
+	}
+	return paths
+}
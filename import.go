@@ -0,0 +1,462 @@
+package daggo
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+
+	"github.com/lib/pq"
+)
+
+// ErrInvalidImport is returned by the importers when validation found issues; nothing is written then
+var ErrInvalidImport = errors.New("invalid import")
+
+// Kinds of import issues
+const (
+	ImportDuplicateID   = "duplicate_id"
+	ImportExistingID    = "existing_id"
+	ImportMissingParent = "missing_parent"
+	ImportSelfEdge      = "self_edge"
+	ImportDuplicateEdge = "duplicate_edge"
+	ImportCycle         = "cycle"
+	ImportCrossGraph    = "cross_graph"
+)
+
+// ImportIssue is a problem found while validating an import
+type ImportIssue struct {
+	Kind   string `json:"kind"`
+	NodeID int    `json:"node_id"`
+	// ParentID is the other end of the offending edge, for edge issues
+	ParentID int `json:"parent_id,omitempty"`
+	// Path lists the nodes along a cycle, starting and ending with the same node
+	Path       []int  `json:"path,omitempty"`
+	Message    string `json:"message"`
+	Suggestion string `json:"suggestion"`
+}
+
+// ImportReport is the outcome of validating an import
+type ImportReport struct {
+	Nodes  int           `json:"nodes"`
+	Edges  int           `json:"edges"`
+	Issues []ImportIssue `json:"issues"`
+	// Remapped maps the IDs of the input to the IDs they were imported under, when an ID remapping option
+	// changed them; issues refer to the remapped IDs
+	Remapped map[int]int `json:"remapped,omitempty"`
+}
+
+// Valid reports whether the validation found no issue
+func (r *ImportReport) Valid() bool {
+	return len(r.Issues) == 0
+}
+
+// Err returns nil for a valid report, or an ErrInvalidImport error describing the first issue
+func (r *ImportReport) Err() error {
+	if r.Valid() {
+		return nil
+	}
+	return fmt.Errorf("%w: %s (%d issues in total)", ErrInvalidImport, r.Issues[0].Message, len(r.Issues))
+}
+
+func (r *ImportReport) add(issue ImportIssue) {
+	r.Issues = append(r.Issues, issue)
+}
+
+// ImportOption configures an import
+type ImportOption func(*importOptions)
+
+type importOptions struct {
+	validateOnly bool
+	idOffset     int
+	idMapping    map[int]int
+	freshIDs     bool
+}
+
+// WithValidateOnly validates the input and returns the report without writing anything
+func WithValidateOnly() ImportOption {
+	return func(o *importOptions) {
+		o.validateOnly = true
+	}
+}
+
+// WithIDOffset adds offset to the ID of every imported node. Parents that are not part of the import keep
+// their IDs.
+func WithIDOffset(offset int) ImportOption {
+	return func(o *importOptions) {
+		o.idOffset = offset
+	}
+}
+
+// WithIDMapping imports the nodes whose IDs are keys of mapping under the mapped IDs; the others are subject
+// to the other remapping options
+func WithIDMapping(mapping map[int]int) ImportOption {
+	return func(o *importOptions) {
+		o.idMapping = mapping
+	}
+}
+
+// WithFreshIDs shifts the imported IDs above the largest ID in the database, so that a graph exported from one
+// database can be loaded into another that already holds graphs. It replaces WithIDOffset.
+func WithFreshIDs() ImportOption {
+	return func(o *importOptions) {
+		o.freshIDs = true
+	}
+}
+
+func newImportOptions(opts []ImportOption) importOptions {
+	var options importOptions
+	for _, opt := range opts {
+		opt(&options)
+	}
+	return options
+}
+
+// ValidateImport checks nodes as AddNodesBulk would, but collects every issue instead of stopping at the first
+// one: duplicate and existing IDs, self and duplicate edges, missing parents, cycles with the offending path
+// and nodes whose parents belong to different graphs. It only reads from the database.
+func (d *Daggo) ValidateImport(nodes []NewNode) (*ImportReport, error) {
+	return d.ValidateImportContext(context.Background(), nodes)
+}
+
+// ValidateImportContext is ValidateImport with a context bounding its queries
+func (d *Daggo) ValidateImportContext(ctx context.Context, nodes []NewNode) (*ImportReport, error) {
+	report := &ImportReport{Nodes: len(nodes), Issues: make([]ImportIssue, 0)}
+
+	batch := make(map[int]NewNode, len(nodes))
+	ids := make([]int, 0, len(nodes))
+	for _, node := range nodes {
+		if _, ok := batch[node.ID]; ok {
+			report.add(ImportIssue{
+				Kind:       ImportDuplicateID,
+				NodeID:     node.ID,
+				Message:    fmt.Sprintf("node %d appears more than once", node.ID),
+				Suggestion: fmt.Sprintf("keep one definition of node %d or give the others new IDs", node.ID),
+			})
+			continue
+		}
+		batch[node.ID] = node
+		ids = append(ids, node.ID)
+	}
+	sort.Ints(ids)
+
+	// parents holds the distinct parents of every node, in the order given
+	parents := make(map[int][]int, len(ids))
+	outside := make([]int, 0)
+	for _, id := range ids {
+		node := batch[id]
+		seen := make(map[int]bool, len(node.ParentIDs))
+		for _, parentID := range node.ParentIDs {
+			switch {
+			case parentID == id:
+				report.add(ImportIssue{
+					Kind:       ImportSelfEdge,
+					NodeID:     id,
+					ParentID:   id,
+					Message:    fmt.Sprintf("node %d is its own parent", id),
+					Suggestion: fmt.Sprintf("drop node %d from its own parents", id),
+				})
+			case seen[parentID]:
+				report.add(ImportIssue{
+					Kind:       ImportDuplicateEdge,
+					NodeID:     id,
+					ParentID:   parentID,
+					Message:    fmt.Sprintf("node %d lists parent %d more than once", id, parentID),
+					Suggestion: fmt.Sprintf("list parent %d of node %d once", parentID, id),
+				})
+			default:
+				seen[parentID] = true
+				parents[id] = append(parents[id], parentID)
+				report.Edges++
+				if _, ok := batch[parentID]; !ok {
+					outside = append(outside, parentID)
+				}
+			}
+		}
+	}
+
+	existing := make([]int, 0)
+	err := d.db.SelectContext(ctx, &existing, "SELECT id FROM dag WHERE id = ANY($1) ORDER BY id", pq.Array(ids))
+	if err != nil {
+		return nil, fmt.Errorf("failed to check for existing nodes: %v", err)
+	}
+	for _, id := range existing {
+		report.add(ImportIssue{
+			Kind:       ImportExistingID,
+			NodeID:     id,
+			Message:    fmt.Sprintf("node %d already exists", id),
+			Suggestion: fmt.Sprintf("remove node %d from the import or import with WithFreshIDs", id),
+		})
+	}
+
+	// rootOf maps the known nodes to the root of their graph, starting with the parents outside of the batch
+	rootOf := make(map[int]int)
+	if len(outside) > 0 {
+		rows := make([]DagNode, 0)
+		err = d.db.SelectContext(ctx, &rows, "SELECT * FROM dag WHERE id = ANY($1)", pq.Array(outside))
+		if err != nil {
+			return nil, fmt.Errorf("failed to get parent nodes: %v", err)
+		}
+		for _, row := range rows {
+			rootOf[row.ID] = row.RootID
+		}
+	}
+	for _, id := range ids {
+		for _, parentID := range parents[id] {
+			_, inBatch := batch[parentID]
+			_, exists := rootOf[parentID]
+			if !inBatch && !exists {
+				report.add(ImportIssue{
+					Kind:       ImportMissingParent,
+					NodeID:     id,
+					ParentID:   parentID,
+					Message:    fmt.Sprintf("parent %d of node %d does not exist", parentID, id),
+					Suggestion: fmt.Sprintf("add node %d to the import or drop it from the parents of node %d", parentID, id),
+				})
+			}
+		}
+	}
+
+	order, cycles := importOrder(ids, parents, batch)
+	for _, path := range cycles {
+		from, to := path[len(path)-2], path[len(path)-1]
+		report.add(ImportIssue{
+			Kind:       ImportCycle,
+			NodeID:     to,
+			ParentID:   from,
+			Path:       path,
+			Message:    fmt.Sprintf("cycle %v", path),
+			Suggestion: fmt.Sprintf("remove the edge from %d to %d", from, to),
+		})
+	}
+
+	// Graphs can only be told apart once the batch is known to be acyclic
+	if len(cycles) == 0 {
+		for _, id := range order {
+			nodeParents := parents[id]
+			if len(nodeParents) == 0 {
+				rootOf[id] = id
+				continue
+			}
+			rootID, ok := rootOf[nodeParents[0]]
+			if !ok {
+				continue
+			}
+			rootOf[id] = rootID
+			for _, parentID := range nodeParents[1:] {
+				if other, ok := rootOf[parentID]; ok && other != rootID {
+					report.add(ImportIssue{
+						Kind:       ImportCrossGraph,
+						NodeID:     id,
+						ParentID:   parentID,
+						Message:    fmt.Sprintf("parents %d and %d of node %d belong to different graphs", nodeParents[0], parentID, id),
+						Suggestion: fmt.Sprintf("drop parent %d of node %d or attach both parents to the same root", parentID, id),
+					})
+				}
+			}
+		}
+	}
+
+	return report, nil
+}
+
+// importOrder sorts the batch so that every node comes after its parents in the batch, and returns the cycles
+// it found instead when there are any, each as the path of a back edge of a depth-first search
+func importOrder(ids []int, parents map[int][]int, batch map[int]NewNode) ([]int, [][]int) {
+	children := make(map[int][]int)
+	for _, id := range ids {
+		for _, parentID := range parents[id] {
+			if _, ok := batch[parentID]; ok {
+				children[parentID] = append(children[parentID], id)
+			}
+		}
+	}
+
+	const (
+		unvisited = iota
+		visiting
+		done
+	)
+	state := make(map[int]int, len(ids))
+	order := make([]int, 0, len(ids))
+	cycles := make([][]int, 0)
+	stack := make([]int, 0)
+
+	var visit func(id int)
+	visit = func(id int) {
+		state[id] = visiting
+		stack = append(stack, id)
+		for _, childID := range children[id] {
+			switch state[childID] {
+			case unvisited:
+				visit(childID)
+			case visiting:
+				start := len(stack) - 1
+				for stack[start] != childID {
+					start--
+				}
+				path := append(append([]int{}, stack[start:]...), childID)
+				cycles = append(cycles, path)
+			}
+		}
+		stack = stack[:len(stack)-1]
+		state[id] = done
+		order = append(order, id)
+	}
+	for _, id := range ids {
+		if state[id] == unvisited {
+			visit(id)
+		}
+	}
+
+	// Nodes are finished after their descendants, so the reverse finishing order puts parents first
+	for i, j := 0, len(order)-1; i < j; i, j = i+1, j-1 {
+		order[i], order[j] = order[j], order[i]
+	}
+	return order, cycles
+}
+
+// importNodes validates nodes and, unless only validation was asked for, inserts them with AddNodesBulk when
+// they are valid
+func (d *Daggo) importNodes(ctx context.Context, nodes []NewNode, options importOptions) (*ImportReport, error) {
+	nodes, remapped, err := d.remapImport(ctx, nodes, options)
+	if err != nil {
+		return nil, err
+	}
+
+	report, err := d.ValidateImportContext(ctx, nodes)
+	if err != nil {
+		return nil, err
+	}
+	if len(remapped) > 0 {
+		report.Remapped = remapped
+	}
+	if options.validateOnly {
+		return report, nil
+	}
+	if !report.Valid() {
+		return report, report.Err()
+	}
+
+	err = d.AddNodesBulkContext(ctx, nodes)
+	if err != nil {
+		return report, err
+	}
+
+	return report, nil
+}
+
+// remapImport applies the ID remapping options to nodes and returns the remapped nodes with the IDs that changed
+func (d *Daggo) remapImport(ctx context.Context, nodes []NewNode, options importOptions) ([]NewNode, map[int]int, error) {
+	if len(nodes) == 0 || (options.idOffset == 0 && options.idMapping == nil && !options.freshIDs) {
+		return nodes, nil, nil
+	}
+
+	offset := options.idOffset
+	if options.freshIDs {
+		var maxID int
+		err := d.db.GetContext(ctx, &maxID, "SELECT COALESCE(MAX(id), 0) FROM dag")
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to get largest node ID: %v", err)
+		}
+		minID := nodes[0].ID
+		for _, node := range nodes[1:] {
+			if node.ID < minID {
+				minID = node.ID
+			}
+		}
+		offset = 0
+		if minID <= maxID {
+			offset = maxID - minID + 1
+		}
+	}
+
+	inBatch := make(map[int]bool, len(nodes))
+	for _, node := range nodes {
+		inBatch[node.ID] = true
+	}
+	remap := func(id int) int {
+		if !inBatch[id] {
+			return id
+		}
+		if mapped, ok := options.idMapping[id]; ok {
+			return mapped
+		}
+		return id + offset
+	}
+
+	remapped := make(map[int]int)
+	result := make([]NewNode, 0, len(nodes))
+	for _, node := range nodes {
+		newNode := NewNode{ID: remap(node.ID), ParentIDs: make([]int, 0, len(node.ParentIDs)), Payload: node.Payload}
+		for _, parentID := range node.ParentIDs {
+			newNode.ParentIDs = append(newNode.ParentIDs, remap(parentID))
+		}
+		if newNode.ID != node.ID {
+			remapped[node.ID] = newNode.ID
+		}
+		result = append(result, newNode)
+	}
+
+	return result, remapped, nil
+}
+
+// newNodesFromEdges builds the nodes of an edge list: every listed ID and edge end becomes a node whose parents
+// are the sources of the edges leading to it, in ascending order, so that the smallest is the primary parent.
+// IDs listed twice are kept twice for validation to report them.
+func newNodesFromEdges(ids []int, edges [][2]int) []NewNode {
+	parents := make(map[int][]int)
+	for _, edge := range edges {
+		parents[edge[1]] = append(parents[edge[1]], edge[0])
+	}
+
+	listed := make(map[int]bool, len(ids))
+	all := append([]int{}, ids...)
+	for _, id := range ids {
+		listed[id] = true
+	}
+	for _, edge := range edges {
+		for _, id := range edge {
+			if !listed[id] {
+				listed[id] = true
+				all = append(all, id)
+			}
+		}
+	}
+
+	nodes := make([]NewNode, 0, len(all))
+	for _, id := range all {
+		nodeParents := append([]int{}, parents[id]...)
+		sort.Ints(nodeParents)
+		nodes = append(nodes, NewNode{ID: id, ParentIDs: nodeParents})
+	}
+	return nodes
+}
+
+// ImportD3JSON imports a graph in the node-link JSON layout written by ExportD3JSON. Links ending at nodes
+// that are not listed create them; the smallest parent of a node becomes its primary parent. Visual hints are
+// not imported. The report lists the issues found by validation, which fail the import with ErrInvalidImport.
+func (d *Daggo) ImportD3JSON(r io.Reader, opts ...ImportOption) (*ImportReport, error) {
+	return d.ImportD3JSONContext(context.Background(), r, opts...)
+}
+
+// ImportD3JSONContext is ImportD3JSON with a context bounding its queries
+func (d *Daggo) ImportD3JSONContext(ctx context.Context, r io.Reader, opts ...ImportOption) (*ImportReport, error) {
+	var graph d3Graph
+	err := json.NewDecoder(r).Decode(&graph)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode graph: %v", err)
+	}
+
+	ids := make([]int, 0, len(graph.Nodes))
+	for _, node := range graph.Nodes {
+		ids = append(ids, node.ID)
+	}
+	edges := make([][2]int, 0, len(graph.Links))
+	for _, link := range graph.Links {
+		edges = append(edges, [2]int{link.Source, link.Target})
+	}
+
+	return d.importNodes(ctx, newNodesFromEdges(ids, edges), newImportOptions(opts))
+}
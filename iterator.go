@@ -0,0 +1,97 @@
+package daggo
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// NodeIterator yields the nodes of a traversal one at a time as they come off the database cursor, so that
+// large subgraphs are never held in memory at once. It holds a connection until closed.
+type NodeIterator struct {
+	rows       *sqlx.Rows
+	node       DagNode
+	err        error
+	count      int
+	maxResults int
+}
+
+// DescendantsIter streams the descendants of the given node ID in ID order, honoring WithMaxDepth, WithLimit,
+// WithCursor and WithMaxResults, which ends the iteration with a *ResultTruncatedError from Err:
+//
+//	it, err := d.DescendantsIter(ctx, rootID, WithMaxDepth(3))
+//	if err != nil {
+//		return err
+//	}
+//	defer it.Close()
+//	for it.Next() {
+//		node := it.Node()
+//		...
+//	}
+//	return it.Err()
+func (d *Daggo) DescendantsIter(ctx context.Context, nodeID int, opts ...TraversalOption) (*NodeIterator, error) {
+	options := newTraversalOptions(opts)
+	query, args, err := d.traversalQueryFor(ctx, Down, nodeID, options)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx = WithOperation(ctx, OpDescendants)
+	rows, err := d.reader(ctx, options.consistency).QueryxContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get descendants: %v", err)
+	}
+
+	it := &NodeIterator{rows: rows}
+	if options.maxResults > 0 && (options.limit <= 0 || options.limit > options.maxResults) {
+		it.maxResults = options.maxResults
+	}
+
+	return it, nil
+}
+
+// Next advances to the next node, returning false when there are no more nodes or an error occurred
+func (it *NodeIterator) Next() bool {
+	if it.err != nil || !it.rows.Next() {
+		return false
+	}
+
+	// The query fetches one row past the guard to tell whether the result was cut off
+	if it.maxResults > 0 && it.count == it.maxResults {
+		it.err = &ResultTruncatedError{NextCursor: it.node.ID}
+		return false
+	}
+
+	var node DagNode
+	err := it.rows.StructScan(&node)
+	if err != nil {
+		it.err = fmt.Errorf("failed to read node: %v", err)
+		return false
+	}
+	it.node = node
+	it.count++
+
+	return true
+}
+
+// Node returns the current node
+func (it *NodeIterator) Node() DagNode {
+	return it.node
+}
+
+// Err returns the error that ended the iteration, if any
+func (it *NodeIterator) Err() error {
+	if it.err != nil {
+		return it.err
+	}
+	if err := it.rows.Err(); err != nil {
+		return fmt.Errorf("failed to get descendants: %v", err)
+	}
+	return nil
+}
+
+// Close releases the database cursor; it is safe to call more than once
+func (it *NodeIterator) Close() error {
+	return it.rows.Close()
+}
@@ -0,0 +1,493 @@
+package daggo
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// Job statuses
+const (
+	JobPending   = "pending"
+	JobRunning   = "running"
+	JobSucceeded = "succeeded"
+	JobFailed    = "failed"
+	JobCancelled = "cancelled"
+)
+
+// Built-in job kinds
+const (
+	// JobKindDeleteSubtree runs DeleteNodeAndDescendants with DeleteSubtreeJob parameters
+	JobKindDeleteSubtree = "delete_subtree"
+	// JobKindRepair runs AdoptOrphans with RepairJob parameters
+	JobKindRepair = "repair"
+	// JobKindClone copies a graph under fresh IDs with CloneJob parameters
+	JobKindClone = "clone"
+	// JobKindCompact runs Compact with CompactJob parameters
+	JobKindCompact = "compact"
+)
+
+const (
+	defaultJobPollInterval = time.Second
+	jobHeartbeatInterval   = 10 * time.Second
+	// jobStaleAfter is how long a running job may go without heartbeat before another worker takes it over
+	jobStaleAfter = time.Minute
+)
+
+const createJobTableQuery = `
+	CREATE TABLE IF NOT EXISTS dag_job (
+		id BIGSERIAL PRIMARY KEY,
+		kind TEXT NOT NULL,
+		params JSONB NOT NULL DEFAULT '{}',
+		status TEXT NOT NULL DEFAULT 'pending',
+		result JSONB NOT NULL DEFAULT 'null',
+		error TEXT NOT NULL DEFAULT '',
+		cancel_requested BOOLEAN NOT NULL DEFAULT false,
+		worker_id TEXT NOT NULL DEFAULT '',
+		attempts INTEGER NOT NULL DEFAULT 0,
+		created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+		started_at TIMESTAMPTZ,
+		heartbeat_at TIMESTAMPTZ,
+		finished_at TIMESTAMPTZ
+	);
+	CREATE INDEX IF NOT EXISTS dag_job_status_idx ON dag_job (status, id);
+`
+
+// Job is a long-running operation persisted in the job table, run asynchronously by a JobWorker
+type Job struct {
+	ID              int64           `db:"id" json:"id"`
+	Kind            string          `db:"kind" json:"kind"`
+	Params          json.RawMessage `db:"params" json:"params"`
+	Status          string          `db:"status" json:"status"`
+	Result          json.RawMessage `db:"result" json:"result"`
+	Error           string          `db:"error" json:"error,omitempty"`
+	CancelRequested bool            `db:"cancel_requested" json:"cancel_requested"`
+	WorkerID        string          `db:"worker_id" json:"worker_id,omitempty"`
+	Attempts        int             `db:"attempts" json:"attempts"`
+	CreatedAt       time.Time       `db:"created_at" json:"created_at"`
+	StartedAt       *time.Time      `db:"started_at" json:"started_at,omitempty"`
+	HeartbeatAt     *time.Time      `db:"heartbeat_at" json:"heartbeat_at,omitempty"`
+	FinishedAt      *time.Time      `db:"finished_at" json:"finished_at,omitempty"`
+}
+
+// Done reports whether the job reached a final status
+func (j *Job) Done() bool {
+	return j.Status == JobSucceeded || j.Status == JobFailed || j.Status == JobCancelled
+}
+
+// DecodeParams decodes the parameters of the job into out
+func (j *Job) DecodeParams(out interface{}) error {
+	if err := json.Unmarshal(j.Params, out); err != nil {
+		return fmt.Errorf("failed to decode parameters of job %d: %v", j.ID, err)
+	}
+	return nil
+}
+
+// JobHandler performs a job and returns its result, which is stored encoded as JSON. It should return early
+// once ctx is done, which happens when the job is cancelled or its worker stops; a job interrupted by a stopping
+// worker runs again from the start, so handlers must be safe to retry.
+type JobHandler func(ctx context.Context, d *Daggo, job *Job) (interface{}, error)
+
+// DeleteSubtreeJob are the parameters of JobKindDeleteSubtree. The result is the MutationResult of the deletion.
+type DeleteSubtreeJob struct {
+	NodeID int `json:"node_id"`
+}
+
+// RepairJob are the parameters of JobKindRepair. The result is the MutationResult of the adoption.
+type RepairJob struct {
+	TargetParentID int `json:"target_parent_id"`
+	RootID         int `json:"root_id"`
+}
+
+// CloneJob are the parameters of JobKindClone. The result is the ID of the root of the copy.
+type CloneJob struct {
+	RootID int `json:"root_id"`
+}
+
+// CompactJob are the parameters of JobKindCompact. The result is the number of renumbered nodes.
+type CompactJob struct {
+	RootID int `json:"root_id"`
+}
+
+var (
+	jobHandlersMu sync.RWMutex
+	// jobHandlers indexes the job handlers by kind
+	jobHandlers = map[string]JobHandler{
+		JobKindDeleteSubtree: func(ctx context.Context, d *Daggo, job *Job) (interface{}, error) {
+			var params DeleteSubtreeJob
+			if err := job.DecodeParams(&params); err != nil {
+				return nil, err
+			}
+			return d.DeleteNodeAndDescendantsContext(ctx, params.NodeID)
+		},
+		JobKindRepair: func(ctx context.Context, d *Daggo, job *Job) (interface{}, error) {
+			var params RepairJob
+			if err := job.DecodeParams(&params); err != nil {
+				return nil, err
+			}
+			return d.AdoptOrphansContext(ctx, params.TargetParentID, OrphanFilter{RootID: params.RootID})
+		},
+		JobKindClone: func(ctx context.Context, d *Daggo, job *Job) (interface{}, error) {
+			var params CloneJob
+			if err := job.DecodeParams(&params); err != nil {
+				return nil, err
+			}
+			var buf bytes.Buffer
+			if err := d.ExportJSON(params.RootID, &buf); err != nil {
+				return nil, err
+			}
+			report, err := d.ImportJSONContext(ctx, &buf, WithFreshIDs())
+			if err != nil {
+				return nil, err
+			}
+			return report.Remapped[params.RootID], nil
+		},
+		JobKindCompact: func(ctx context.Context, d *Daggo, job *Job) (interface{}, error) {
+			var params CompactJob
+			if err := job.DecodeParams(&params); err != nil {
+				return nil, err
+			}
+			mapping, err := d.Compact(ctx, params.RootID)
+			if err != nil {
+				return nil, err
+			}
+			return len(mapping), nil
+		},
+	}
+)
+
+// RegisterJobKind makes handler perform the jobs of the given kind, replacing the handler registered for it
+func RegisterJobKind(kind string, handler JobHandler) {
+	jobHandlersMu.Lock()
+	defer jobHandlersMu.Unlock()
+	jobHandlers[kind] = handler
+}
+
+func jobHandler(kind string) (JobHandler, bool) {
+	jobHandlersMu.RLock()
+	defer jobHandlersMu.RUnlock()
+	handler, ok := jobHandlers[kind]
+	return handler, ok
+}
+
+// jobKinds returns the registered job kinds
+func jobKinds() []string {
+	jobHandlersMu.RLock()
+	defer jobHandlersMu.RUnlock()
+	kinds := make([]string, 0, len(jobHandlers))
+	for kind := range jobHandlers {
+		kinds = append(kinds, kind)
+	}
+	return kinds
+}
+
+// CreateJobTable creates the table persisting jobs
+func (d *Daggo) CreateJobTable() error {
+	_, err := d.db.Exec(createJobTableQuery)
+	if err != nil {
+		return fmt.Errorf("failed to create job table: %v", err)
+	}
+
+	return nil
+}
+
+// StartJob records a pending job of the given kind with params, encoded as JSON, and returns it. The job runs
+// once a JobWorker picks it up, possibly in another process.
+func (d *Daggo) StartJob(ctx context.Context, kind string, params interface{}) (*Job, error) {
+	if _, ok := jobHandler(kind); !ok {
+		return nil, fmt.Errorf("unknown job kind %q", kind)
+	}
+	encoded, err := json.Marshal(params)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode job parameters: %v", err)
+	}
+
+	var job Job
+	err = d.db.GetContext(ctx, &job, "INSERT INTO dag_job (kind, params) VALUES ($1, $2) RETURNING *", kind, encoded)
+	if err != nil {
+		return nil, fmt.Errorf("failed to start job: %v", err)
+	}
+
+	return &job, nil
+}
+
+// GetJobStatus returns the job with the given ID, or nil if it does not exist
+func (d *Daggo) GetJobStatus(ctx context.Context, jobID int64) (*Job, error) {
+	var job Job
+
+	err := d.db.GetContext(ctx, &job, "SELECT * FROM dag_job WHERE id = $1", jobID)
+	if err == sql.ErrNoRows {
+		return nil, nil // No job with this ID
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to get job: %v", err)
+	}
+
+	return &job, nil
+}
+
+// ListJobs returns the last limit jobs, newest first, optionally only those with the given status
+func (d *Daggo) ListJobs(ctx context.Context, status string, limit int) ([]Job, error) {
+	jobs := make([]Job, 0)
+
+	query := "SELECT * FROM dag_job WHERE $1 = '' OR status = $1 ORDER BY id DESC LIMIT $2"
+	err := d.db.SelectContext(ctx, &jobs, query, status, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list jobs: %v", err)
+	}
+
+	return jobs, nil
+}
+
+// CancelJob cancels a job: a pending job is cancelled right away, a running job is stopped by its worker within
+// the heartbeat interval. Cancelling a finished job has no effect. It returns the job as updated.
+func (d *Daggo) CancelJob(ctx context.Context, jobID int64) (*Job, error) {
+	var job Job
+
+	query := `
+		UPDATE dag_job
+		SET cancel_requested = cancel_requested OR status IN ('pending', 'running'),
+			status = CASE WHEN status = 'pending' THEN 'cancelled' ELSE status END,
+			finished_at = CASE WHEN status = 'pending' THEN now() ELSE finished_at END
+		WHERE id = $1
+		RETURNING *
+	`
+	err := d.db.GetContext(ctx, &job, query, jobID)
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("job with ID %d does not exist", jobID)
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to cancel job: %v", err)
+	}
+
+	return &job, nil
+}
+
+// JobWorker runs pending jobs one at a time. Several workers, in one or several processes, can share the job
+// table; a job whose worker stopped sending heartbeats is taken over by another worker.
+type JobWorker struct {
+	daggo        *Daggo
+	id           string
+	pollInterval time.Duration
+}
+
+// NewJobWorker creates a worker identified by workerID, which should be unique among the running workers
+func NewJobWorker(d *Daggo, workerID string) *JobWorker {
+	return &JobWorker{daggo: d, id: workerID, pollInterval: defaultJobPollInterval}
+}
+
+// Run runs jobs as they are started until ctx is done, and returns the error of ctx. A job interrupted by ctx
+// is handed back to the other workers.
+func (w *JobWorker) Run(ctx context.Context) error {
+	for {
+		ran, err := w.RunNext(ctx)
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if ran && err == nil {
+			continue
+		}
+
+		timer := time.NewTimer(w.pollInterval)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// RunNext claims the oldest runnable job and runs it to completion. It returns false when there was no job to
+// run. Job failures are recorded on the job rather than returned.
+func (w *JobWorker) RunNext(ctx context.Context) (bool, error) {
+	d := w.daggo
+
+	var job Job
+	query := `
+		UPDATE dag_job
+		SET status = 'running', worker_id = $1, attempts = attempts + 1, started_at = now(), heartbeat_at = now()
+		WHERE id = (
+			SELECT id FROM dag_job
+			WHERE (status = 'pending' OR (status = 'running' AND heartbeat_at < now() - $2 * interval '1 millisecond'))
+				AND kind = ANY($3)
+			ORDER BY id
+			LIMIT 1
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING *
+	`
+	err := d.db.GetContext(ctx, &job, query, w.id, jobStaleAfter.Milliseconds(), pq.Array(jobKinds()))
+	if err == sql.ErrNoRows {
+		return false, nil
+	} else if err != nil {
+		return false, fmt.Errorf("failed to claim job: %v", err)
+	}
+
+	// A job taken over from a dead worker may have been cancelled in the meantime
+	if job.CancelRequested {
+		return true, w.finish(ctx, &job, JobCancelled, nil, nil)
+	}
+
+	handler, _ := jobHandler(job.Kind)
+	jobCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var cancelled bool
+	heartbeatDone := make(chan struct{})
+	go func() {
+		defer close(heartbeatDone)
+		ticker := time.NewTicker(jobHeartbeatInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-jobCtx.Done():
+				return
+			case <-ticker.C:
+			}
+
+			// A job taken over by another worker has no row for this worker anymore
+			var requested bool
+			query := "UPDATE dag_job SET heartbeat_at = now() WHERE id = $1 AND worker_id = $2 RETURNING cancel_requested"
+			err := d.db.GetContext(jobCtx, &requested, query, job.ID, w.id)
+			if requested || err == sql.ErrNoRows {
+				cancelled = true
+				cancel()
+				return
+			}
+		}
+	}()
+
+	result, runErr := handler(jobCtx, d, &job)
+	cancel()
+	<-heartbeatDone
+
+	switch {
+	case cancelled:
+		return true, w.finish(ctx, &job, JobCancelled, nil, nil)
+	case ctx.Err() != nil:
+		// The worker is stopping: hand the job back with a fresh context since ctx is done
+		_, err = d.db.Exec("UPDATE dag_job SET status = 'pending', worker_id = '' WHERE id = $1 AND worker_id = $2", job.ID, w.id)
+		if err != nil {
+			return true, fmt.Errorf("failed to release job %d: %v", job.ID, err)
+		}
+		return true, nil
+	case runErr != nil:
+		return true, w.finish(ctx, &job, JobFailed, nil, runErr)
+	default:
+		return true, w.finish(ctx, &job, JobSucceeded, result, nil)
+	}
+}
+
+// finish records the final status of a job run by this worker
+func (w *JobWorker) finish(ctx context.Context, job *Job, status string, result interface{}, runErr error) error {
+	encoded, err := json.Marshal(result)
+	if err != nil {
+		status, encoded, runErr = JobFailed, []byte("null"), fmt.Errorf("failed to encode job result: %v", err)
+	}
+	message := ""
+	if runErr != nil {
+		message = runErr.Error()
+	}
+
+	query := `
+		UPDATE dag_job SET status = $3, result = $4, error = $5, finished_at = now()
+		WHERE id = $1 AND worker_id = $2
+	`
+	_, err = w.daggo.db.ExecContext(ctx, query, job.ID, w.id, status, encoded, message)
+	if err != nil {
+		return fmt.Errorf("failed to finish job %d: %v", job.ID, err)
+	}
+
+	return nil
+}
+
+// JobsHandler exposes the job API over HTTP:
+//
+//	POST /jobs with a JSON object holding kind and params starts a job
+//	GET  /jobs?status=running&limit=50 lists jobs
+//	GET  /jobs/42 returns a job
+//	POST /jobs/42/cancel cancels a job
+func JobsHandler(d *Daggo) http.Handler {
+	mux := http.NewServeMux()
+
+	mux.HandleFunc("/jobs", func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			limit, err := strconv.Atoi(r.URL.Query().Get("limit"))
+			if err != nil || limit <= 0 {
+				limit = 50
+			}
+			jobs, err := d.ListJobs(r.Context(), r.URL.Query().Get("status"), limit)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			writeJSON(w, jobs)
+		case http.MethodPost:
+			var request struct {
+				Kind   string          `json:"kind"`
+				Params json.RawMessage `json:"params"`
+			}
+			if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+				http.Error(w, "invalid request body", http.StatusBadRequest)
+				return
+			}
+			if _, ok := jobHandler(request.Kind); !ok {
+				http.Error(w, fmt.Sprintf("unknown job kind %q", request.Kind), http.StatusBadRequest)
+				return
+			}
+			if request.Params == nil {
+				request.Params = json.RawMessage("{}")
+			}
+			job, err := d.StartJob(r.Context(), request.Kind, request.Params)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			w.WriteHeader(http.StatusAccepted)
+			writeJSON(w, job)
+		default:
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		}
+	})
+
+	mux.HandleFunc("/jobs/", func(w http.ResponseWriter, r *http.Request) {
+		path := strings.TrimPrefix(r.URL.Path, "/jobs/")
+		cancel := strings.HasSuffix(path, "/cancel")
+		jobID, err := strconv.ParseInt(strings.TrimSuffix(path, "/cancel"), 10, 64)
+		if err != nil {
+			http.Error(w, "invalid job ID", http.StatusBadRequest)
+			return
+		}
+
+		var job *Job
+		switch {
+		case cancel && r.Method == http.MethodPost:
+			job, err = d.CancelJob(r.Context(), jobID)
+		case !cancel && r.Method == http.MethodGet:
+			job, err = d.GetJobStatus(r.Context(), jobID)
+		default:
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if job == nil {
+			http.Error(w, "job not found", http.StatusNotFound)
+			return
+		}
+		writeJSON(w, job)
+	})
+
+	return mux
+}
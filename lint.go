@@ -0,0 +1,162 @@
+package daggo
+
+import (
+	"fmt"
+	"sort"
+)
+
+// Lint finding kinds
+const (
+	LintDeepChain      = "deep_chain"
+	LintWideNode       = "wide_node"
+	LintRedundantEdge  = "redundant_edge"
+	LintIsolatedIsland = "isolated_island"
+)
+
+const (
+	defaultLintMaxDepth   = 100
+	defaultLintMaxFanOut  = 1000
+	defaultLintIslandSize = 1
+)
+
+// LintThresholds configures when Lint reports a structural smell; zero values use the defaults
+type LintThresholds struct {
+	// MaxDepth is the deepest chain tolerated below the root (default 100)
+	MaxDepth int
+	// MaxChildren is the largest number of children tolerated on a node (default 1000)
+	MaxChildren int
+	// MinIslandSize is the smallest disconnected group of nodes reported (default 1)
+	MinIslandSize int
+}
+
+// LintFinding is a structural smell found by Lint
+type LintFinding struct {
+	Kind    string
+	NodeIDs []int
+	Message string
+}
+
+// Lint reports structural smells in the graph rooted at rootID: extremely deep chains, nodes with too many
+// children, edges made redundant by a longer path, and groups of nodes disconnected from the root
+func (d *Daggo) Lint(rootID int, thresholds LintThresholds) ([]LintFinding, error) {
+	if thresholds.MaxDepth <= 0 {
+		thresholds.MaxDepth = defaultLintMaxDepth
+	}
+	if thresholds.MaxChildren <= 0 {
+		thresholds.MaxChildren = defaultLintMaxFanOut
+	}
+	if thresholds.MinIslandSize <= 0 {
+		thresholds.MinIslandSize = defaultLintIslandSize
+	}
+
+	nodeIDs := make([]int, 0)
+	err := d.db.Select(&nodeIDs, "SELECT id FROM dag WHERE root_id = $1 ORDER BY id ASC", rootID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get graph nodes: %v", err)
+	}
+	edges, err := d.loadGraphEdges(rootID)
+	if err != nil {
+		return nil, err
+	}
+	order, children, parents, err := topoOrder(rootID, edges)
+	if err != nil {
+		return nil, err
+	}
+
+	findings := make([]LintFinding, 0)
+
+	// Longest chain below the root, reported once at its deepest node
+	depth := map[int]int{rootID: 0}
+	via := make(map[int]int)
+	deepest := rootID
+	for _, id := range order {
+		for _, childID := range children[id] {
+			if _, reached := depth[id]; reached && depth[id]+1 > depth[childID] {
+				depth[childID] = depth[id] + 1
+				via[childID] = id
+			}
+		}
+		if depth[id] > depth[deepest] {
+			deepest = id
+		}
+	}
+	if depth[deepest] > thresholds.MaxDepth {
+		chain := []int{deepest}
+		for id := deepest; id != rootID; {
+			id = via[id]
+			chain = append([]int{id}, chain...)
+		}
+		findings = append(findings, LintFinding{
+			Kind:    LintDeepChain,
+			NodeIDs: chain,
+			Message: fmt.Sprintf("chain of depth %d exceeds %d", depth[deepest], thresholds.MaxDepth),
+		})
+	}
+
+	// Nodes with too many children
+	for _, id := range order {
+		if len(children[id]) > thresholds.MaxChildren {
+			findings = append(findings, LintFinding{
+				Kind:    LintWideNode,
+				NodeIDs: []int{id},
+				Message: fmt.Sprintf("node %d has %d children, more than %d", id, len(children[id]), thresholds.MaxChildren),
+			})
+		}
+	}
+
+	// Edges implied by another path between the same nodes
+	reach := make(map[int]map[int]bool, len(order))
+	for i := len(order) - 1; i >= 0; i-- {
+		id := order[i]
+		reach[id] = make(map[int]bool)
+		for _, childID := range children[id] {
+			for descendant := range reach[childID] {
+				reach[id][descendant] = true
+			}
+		}
+		for _, childID := range children[id] {
+			if reach[id][childID] {
+				findings = append(findings, LintFinding{
+					Kind:    LintRedundantEdge,
+					NodeIDs: []int{id, childID},
+					Message: fmt.Sprintf("edge from %d to %d is implied by a longer path", id, childID),
+				})
+			}
+		}
+		for _, childID := range children[id] {
+			reach[id][childID] = true
+		}
+	}
+
+	// Groups of nodes that cannot be reached from the root
+	island := make(map[int]int)
+	for _, id := range nodeIDs {
+		if _, reached := depth[id]; reached || island[id] != 0 {
+			continue
+		}
+		members := make([]int, 0)
+		stack := []int{id}
+		island[id] = id
+		for len(stack) > 0 {
+			current := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+			members = append(members, current)
+			for _, next := range append(append([]int{}, children[current]...), parents[current]...) {
+				if island[next] == 0 {
+					island[next] = id
+					stack = append(stack, next)
+				}
+			}
+		}
+		if len(members) >= thresholds.MinIslandSize {
+			sort.Ints(members)
+			findings = append(findings, LintFinding{
+				Kind:    LintIsolatedIsland,
+				NodeIDs: members,
+				Message: fmt.Sprintf("%d nodes are not reachable from root %d", len(members), rootID),
+			})
+		}
+	}
+
+	return findings, nil
+}
@@ -0,0 +1,73 @@
+package daggo
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// ErrNoTransaction is returned by operations that must run inside a transaction bound with WithTx
+var ErrNoTransaction = errors.New("no transaction in context")
+
+type txKey struct{}
+
+// WithTx returns a context binding tx, so that row locks taken with it are held until tx ends
+func WithTx(ctx context.Context, tx *sqlx.Tx) context.Context {
+	return context.WithValue(ctx, txKey{}, tx)
+}
+
+// TxFromContext returns the transaction bound with WithTx, or nil if there is none
+func TxFromContext(ctx context.Context) *sqlx.Tx {
+	tx, _ := ctx.Value(txKey{}).(*sqlx.Tx)
+	return tx
+}
+
+// LockMode selects the row-level lock taken by LockNode
+type LockMode int
+
+const (
+	// LockShare blocks writers of the node but not other readers taking LockShare (FOR SHARE)
+	LockShare LockMode = iota
+	// LockExclusive blocks every other lock on the node (FOR UPDATE)
+	LockExclusive
+	// LockShareNoWait is LockShare failing immediately instead of waiting for a conflicting lock
+	LockShareNoWait
+	// LockExclusiveNoWait is LockExclusive failing immediately instead of waiting for a conflicting lock
+	LockExclusiveNoWait
+)
+
+// clause returns the locking clause of the mode
+func (m LockMode) clause() string {
+	switch m {
+	case LockExclusive:
+		return "FOR UPDATE"
+	case LockShareNoWait:
+		return "FOR SHARE NOWAIT"
+	case LockExclusiveNoWait:
+		return "FOR UPDATE NOWAIT"
+	default:
+		return "FOR SHARE"
+	}
+}
+
+// LockNode locks the row of the given node in the transaction bound to ctx with WithTx, so that applications
+// can serialize their own operations around it. The lock is released when the transaction ends.
+func (d *Daggo) LockNode(ctx context.Context, nodeID int, mode LockMode) error {
+	tx := TxFromContext(ctx)
+	if tx == nil {
+		return ErrNoTransaction
+	}
+
+	var locked int
+	err := tx.GetContext(ctx, &locked, "SELECT id FROM dag WHERE id = $1 "+mode.clause(), nodeID)
+	if err == sql.ErrNoRows {
+		return fmt.Errorf("%w: %d", ErrNodeNotFound, nodeID)
+	} else if err != nil {
+		return fmt.Errorf("failed to lock node %d: %v", nodeID, err)
+	}
+
+	return nil
+}
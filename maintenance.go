@@ -0,0 +1,329 @@
+package daggo
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+const defaultMaintenanceBatchSize = 1000
+
+// MaintenanceTask is a housekeeping job run periodically by Maintenance
+type MaintenanceTask struct {
+	Name     string
+	Interval time.Duration
+	// Run performs one pass of the task and should return early once ctx is done
+	Run func(ctx context.Context) error
+}
+
+// MaintenanceRun records the outcome of one pass of a task
+type MaintenanceRun struct {
+	Task      string
+	StartedAt time.Time
+	Duration  time.Duration
+	Err       error
+}
+
+// Pacing limits the load maintenance puts on the database; zero values use the defaults
+type Pacing struct {
+	// BatchSize is the number of rows a built-in task deletes per statement (default 1000)
+	BatchSize int
+	// BatchPause is the pause between two statements of a built-in task
+	BatchPause time.Duration
+	// MinGap is the minimum pause between two task passes, so that overdue tasks never run back to back
+	MinGap time.Duration
+}
+
+// Maintenance runs housekeeping tasks on their schedules, one pass at a time, so that it does not need
+// external cron jobs. Passes of the built-in tasks are split into small batches paced by Pacing.
+type Maintenance struct {
+	daggo  *Daggo
+	pacing Pacing
+
+	mu    sync.Mutex
+	tasks []MaintenanceTask
+	next  map[string]time.Time
+	last  map[string]MaintenanceRun
+}
+
+// NewMaintenance creates a maintenance scheduler without tasks
+func NewMaintenance(d *Daggo, pacing Pacing) *Maintenance {
+	if pacing.BatchSize <= 0 {
+		pacing.BatchSize = defaultMaintenanceBatchSize
+	}
+	return &Maintenance{
+		daggo:  d,
+		pacing: pacing,
+		next:   make(map[string]time.Time),
+		last:   make(map[string]MaintenanceRun),
+	}
+}
+
+// Schedule adds task, replacing the task of the same name. Its first pass is due right away.
+func (m *Maintenance) Schedule(task MaintenanceTask) error {
+	if task.Name == "" || task.Run == nil {
+		return fmt.Errorf("maintenance task needs a name and a run function")
+	}
+	if task.Interval <= 0 {
+		return fmt.Errorf("interval of maintenance task %s must be positive", task.Name)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for i := range m.tasks {
+		if m.tasks[i].Name == task.Name {
+			m.tasks[i] = task
+			return nil
+		}
+	}
+	m.tasks = append(m.tasks, task)
+	m.next[task.Name] = time.Time{}
+
+	return nil
+}
+
+// Run runs the scheduled tasks as they fall due until ctx is done, and returns the error of ctx. Task errors
+// are recorded in LastRuns and do not stop the scheduler.
+func (m *Maintenance) Run(ctx context.Context) error {
+	for {
+		task, due := m.nextDue()
+
+		wait := time.Minute
+		if task != nil {
+			wait = time.Until(due)
+		}
+		if wait > 0 {
+			timer := time.NewTimer(wait)
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+				return ctx.Err()
+			case <-timer.C:
+			}
+			continue
+		}
+
+		m.run(ctx, *task)
+
+		if m.pacing.MinGap > 0 {
+			timer := time.NewTimer(m.pacing.MinGap)
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+				return ctx.Err()
+			case <-timer.C:
+			}
+		}
+	}
+}
+
+// RunTask runs one pass of the named task right away and returns its error
+func (m *Maintenance) RunTask(ctx context.Context, name string) error {
+	m.mu.Lock()
+	var task *MaintenanceTask
+	for i := range m.tasks {
+		if m.tasks[i].Name == name {
+			t := m.tasks[i]
+			task = &t
+		}
+	}
+	m.mu.Unlock()
+	if task == nil {
+		return fmt.Errorf("maintenance task %s is not scheduled", name)
+	}
+
+	return m.run(ctx, *task).Err
+}
+
+// LastRuns returns the last pass of every task that ran, ordered by task name
+func (m *Maintenance) LastRuns() []MaintenanceRun {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	runs := make([]MaintenanceRun, 0, len(m.last))
+	for _, run := range m.last {
+		runs = append(runs, run)
+	}
+	sort.Slice(runs, func(i, j int) bool {
+		return runs[i].Task < runs[j].Task
+	})
+	return runs
+}
+
+// nextDue returns the task due first and when, or nil when no task is scheduled
+func (m *Maintenance) nextDue() (*MaintenanceTask, time.Time) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var task *MaintenanceTask
+	var due time.Time
+	for i := range m.tasks {
+		next := m.next[m.tasks[i].Name]
+		if task == nil || next.Before(due) {
+			t := m.tasks[i]
+			task, due = &t, next
+		}
+	}
+	return task, due
+}
+
+// run performs a pass of task, records it and schedules the next one
+func (m *Maintenance) run(ctx context.Context, task MaintenanceTask) MaintenanceRun {
+	run := MaintenanceRun{Task: task.Name, StartedAt: time.Now()}
+	run.Err = task.Run(ctx)
+	run.Duration = time.Since(run.StartedAt)
+
+	m.mu.Lock()
+	m.last[task.Name] = run
+	m.next[task.Name] = time.Now().Add(task.Interval)
+	m.mu.Unlock()
+
+	return run
+}
+
+// deleteInBatches runs a DELETE statement taking the batch size as its first argument, followed by args, until
+// it deletes fewer rows than a batch, pausing between batches. It returns the number of deleted rows.
+func (m *Maintenance) deleteInBatches(ctx context.Context, query string, args ...interface{}) (int64, error) {
+	args = append([]interface{}{m.pacing.BatchSize}, args...)
+
+	var total int64
+	for {
+		result, err := m.daggo.db.ExecContext(ctx, query, args...)
+		if err != nil {
+			return total, err
+		}
+		deleted, err := result.RowsAffected()
+		if err != nil {
+			return total, err
+		}
+		total += deleted
+		if deleted < int64(m.pacing.BatchSize) {
+			return total, nil
+		}
+
+		if m.pacing.BatchPause > 0 {
+			timer := time.NewTimer(m.pacing.BatchPause)
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+				return total, ctx.Err()
+			case <-timer.C:
+			}
+		}
+	}
+}
+
+// GCTask returns the task deleting the side table rows left behind by deleted nodes, and the graph leases that
+// expired. Side tables that were never created are skipped.
+func (m *Maintenance) GCTask(interval time.Duration) MaintenanceTask {
+	return MaintenanceTask{
+		Name:     "gc",
+		Interval: interval,
+		Run: func(ctx context.Context) error {
+			for _, ref := range nodeReferences {
+				var exists bool
+				err := m.daggo.db.GetContext(ctx, &exists, "SELECT to_regclass($1) IS NOT NULL", ref.table)
+				if err != nil {
+					return fmt.Errorf("failed to check table %s: %v", ref.table, err)
+				}
+				if !exists {
+					continue
+				}
+
+				for _, column := range ref.columns {
+					query := fmt.Sprintf(`
+						DELETE FROM %[1]s
+						WHERE ctid IN (
+							SELECT ctid FROM %[1]s t
+							WHERE NOT EXISTS (SELECT 1 FROM dag WHERE dag.id = t.%[2]s)
+							LIMIT $1
+						)
+					`, ref.table, column)
+					_, err = m.deleteInBatches(ctx, query)
+					if err != nil {
+						return fmt.Errorf("failed to collect %s: %v", ref.table, err)
+					}
+				}
+			}
+
+			_, err := m.deleteInBatches(ctx, `
+				DELETE FROM dag_graph_lease
+				WHERE ctid IN (SELECT ctid FROM dag_graph_lease WHERE expires_at < now() LIMIT $1)
+			`)
+			if err != nil && !isUndefinedTable(err) {
+				return fmt.Errorf("failed to collect expired leases: %v", err)
+			}
+
+			return nil
+		},
+	}
+}
+
+// HistorySweepTask returns the task deleting the history entries older than retention, or than the
+// HistoryRetention setting of their graph when it has one. The history of a graph can then only be restored
+// within the retention window.
+func (m *Maintenance) HistorySweepTask(interval time.Duration, retention time.Duration) MaintenanceTask {
+	return MaintenanceTask{
+		Name:     "history_sweep",
+		Interval: interval,
+		Run: func(ctx context.Context) error {
+			// The retention setting is stored in nanoseconds
+			query := `
+				DELETE FROM dag_history
+				WHERE id IN (
+					SELECT h.id FROM dag_history h
+					LEFT JOIN dag_graph g ON g.root_id = h.root_id
+					WHERE h.changed_at < now() - COALESCE((g.settings->>'history_retention')::bigint / 1000000, $2) * interval '1 millisecond'
+					LIMIT $1
+				)
+			`
+			_, err := m.deleteInBatches(ctx, query, retention.Milliseconds())
+			if isUndefinedTable(err) || isUndefinedColumn(err) {
+				// Without graph settings every graph keeps the given retention
+				query = `
+					DELETE FROM dag_history
+					WHERE id IN (
+						SELECT id FROM dag_history
+						WHERE changed_at < now() - $2 * interval '1 millisecond'
+						LIMIT $1
+					)
+				`
+				_, err = m.deleteInBatches(ctx, query, retention.Milliseconds())
+			}
+			if err != nil && !isUndefinedTable(err) {
+				return fmt.Errorf("failed to sweep history: %v", err)
+			}
+
+			// Edges take the retention of the graph of their child
+			query = `
+				DELETE FROM dag_edge_history
+				WHERE id IN (
+					SELECT h.id FROM dag_edge_history h
+					LEFT JOIN dag ON dag.id = h.child_id
+					LEFT JOIN dag_graph g ON g.root_id = dag.root_id
+					WHERE h.changed_at < now() - COALESCE((g.settings->>'history_retention')::bigint / 1000000, $2) * interval '1 millisecond'
+					LIMIT $1
+				)
+			`
+			_, err = m.deleteInBatches(ctx, query, retention.Milliseconds())
+			if isUndefinedTable(err) || isUndefinedColumn(err) {
+				query = `
+					DELETE FROM dag_edge_history
+					WHERE id IN (
+						SELECT id FROM dag_edge_history
+						WHERE changed_at < now() - $2 * interval '1 millisecond'
+						LIMIT $1
+					)
+				`
+				_, err = m.deleteInBatches(ctx, query, retention.Milliseconds())
+			}
+			if err != nil && !isUndefinedTable(err) {
+				return fmt.Errorf("failed to sweep edge history: %v", err)
+			}
+
+			return nil
+		},
+	}
+}
@@ -0,0 +1,214 @@
+package daggo
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+)
+
+// MergeConflict describes a node changed differently on both sides of a merge. A nil side means the node
+// does not exist on that side.
+type MergeConflict struct {
+	NodeID int
+	Base   *DagNode
+	Ours   *DagNode
+	Theirs *DagNode
+	// Cycle is set when the merged moves of the node closed a cycle, e.g. each side moved one node below the other
+	Cycle bool
+}
+
+// ConflictResolver decides the merged version of a conflicting node; returning nil drops the node.
+// Returning an error leaves the conflict unresolved in the MergeReport.
+type ConflictResolver func(conflict MergeConflict) (*DagNode, error)
+
+// PreferOurs resolves every conflict with our version of the node
+func PreferOurs(conflict MergeConflict) (*DagNode, error) {
+	return conflict.Ours, nil
+}
+
+// PreferTheirs resolves every conflict with their version of the node
+func PreferTheirs(conflict MergeConflict) (*DagNode, error) {
+	return conflict.Theirs, nil
+}
+
+// FailOnConflict leaves every conflict unresolved
+func FailOnConflict(conflict MergeConflict) (*DagNode, error) {
+	return nil, fmt.Errorf("conflicting changes to node %d", conflict.NodeID)
+}
+
+// MergeReport summarizes the outcome of MergeGraphs
+type MergeReport struct {
+	// Resolved lists the conflicts the resolver settled
+	Resolved []MergeConflict
+	// Unresolved lists the conflicts the resolver refused and the moves closing cycles; the base version is kept
+	// for them
+	Unresolved []MergeConflict
+	// Orphaned lists node IDs whose parent does not exist in the merged graph
+	Orphaned []int
+}
+
+// HasConflicts reports whether the merge left anything for a human to look at
+func (r *MergeReport) HasConflicts() bool {
+	return len(r.Unresolved) > 0 || len(r.Orphaned) > 0
+}
+
+// MergeGraphs performs a three-way merge of two divergent copies of a graph given their common base.
+// Changes made on only one side are applied; nodes changed differently on both sides are handed to resolve.
+// Moves that are fine on each side can close a cycle once merged, so the moved nodes of every cycle go back to
+// their base version and are reported as unresolved conflicts. The graphs are keyed by node ID, as returned by
+// ProjectEventsAt.
+func MergeGraphs(base, ours, theirs map[int]*DagNode, resolve ConflictResolver) (map[int]*DagNode, *MergeReport) {
+	if resolve == nil {
+		resolve = FailOnConflict
+	}
+
+	ids := make(map[int]struct{})
+	for _, graph := range []map[int]*DagNode{base, ours, theirs} {
+		for id := range graph {
+			ids[id] = struct{}{}
+		}
+	}
+	sortedIDs := make([]int, 0, len(ids))
+	for id := range ids {
+		sortedIDs = append(sortedIDs, id)
+	}
+	sort.Ints(sortedIDs)
+
+	merged := make(map[int]*DagNode)
+	report := &MergeReport{}
+	for _, id := range sortedIDs {
+		b, o, t := base[id], ours[id], theirs[id]
+
+		var result *DagNode
+		switch {
+		case sameNode(o, t):
+			result = o
+		case sameNode(b, o):
+			result = t
+		case sameNode(b, t):
+			result = o
+		default:
+			conflict := MergeConflict{NodeID: id, Base: b, Ours: o, Theirs: t}
+			resolved, err := resolve(conflict)
+			if err != nil {
+				report.Unresolved = append(report.Unresolved, conflict)
+				result = b
+			} else {
+				report.Resolved = append(report.Resolved, conflict)
+				result = resolved
+			}
+		}
+
+		if result != nil {
+			node := *result
+			node.ChildIDs = nil
+			merged[id] = &node
+		}
+	}
+
+	for {
+		cycle := findParentCycle(merged)
+		if cycle == nil {
+			break
+		}
+		// The base graph has no cycle, so reverting the moves of the cycle breaks it
+		reverted := false
+		for _, id := range cycle {
+			b := base[id]
+			if b != nil && merged[id].ParentID == b.ParentID {
+				continue
+			}
+			reverted = true
+			report.Unresolved = append(report.Unresolved, MergeConflict{
+				NodeID: id, Base: b, Ours: ours[id], Theirs: theirs[id], Cycle: true,
+			})
+			if b == nil {
+				delete(merged, id)
+				continue
+			}
+			node := *b
+			node.ChildIDs = nil
+			merged[id] = &node
+		}
+		if !reverted {
+			break // The cycle was already in the base graph
+		}
+	}
+
+	// Rebuild child lists and root IDs for the merged structure
+	for _, id := range sortedIDs {
+		node, ok := merged[id]
+		if !ok || !node.ParentID.Valid {
+			continue
+		}
+		parent, ok := merged[int(node.ParentID.Int64)]
+		if !ok {
+			report.Orphaned = append(report.Orphaned, id)
+			continue
+		}
+		parent.ChildIDs = append(parent.ChildIDs, id)
+	}
+	for _, node := range merged {
+		root := node
+		seen := map[int]bool{root.ID: true}
+		for root.ParentID.Valid {
+			parent, ok := merged[int(root.ParentID.Int64)]
+			if !ok || seen[parent.ID] {
+				break
+			}
+			seen[parent.ID] = true
+			root = parent
+		}
+		node.RootID = root.ID
+	}
+
+	return merged, report
+}
+
+// findParentCycle returns the IDs of a cycle of parents in graph, in ID order, or nil when it has none
+func findParentCycle(graph map[int]*DagNode) []int {
+	ids := make([]int, 0, len(graph))
+	for id := range graph {
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
+
+	// Nodes are done once their chain of parents is known to end
+	done := make(map[int]bool)
+	for _, id := range ids {
+		onPath := make(map[int]bool)
+		path := make([]int, 0)
+		for node := graph[id]; node != nil && !done[node.ID]; {
+			if onPath[node.ID] {
+				cycle := path
+				for i, pathID := range path {
+					if pathID == node.ID {
+						cycle = path[i:]
+						break
+					}
+				}
+				sort.Ints(cycle)
+				return cycle
+			}
+			onPath[node.ID] = true
+			path = append(path, node.ID)
+			if !node.ParentID.Valid {
+				break
+			}
+			node = graph[int(node.ParentID.Int64)]
+		}
+		for _, pathID := range path {
+			done[pathID] = true
+		}
+	}
+
+	return nil
+}
+
+// sameNode reports whether two versions of a node are identical in structure and payload; nil means absent
+func sameNode(a, b *DagNode) bool {
+	if a == nil || b == nil {
+		return a == nil && b == nil
+	}
+	return a.ID == b.ID && a.ParentID == b.ParentID && bytes.Equal(a.Payload, b.Payload)
+}
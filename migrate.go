@@ -0,0 +1,204 @@
+package daggo
+
+import (
+	"context"
+	"fmt"
+)
+
+// migration is one versioned change of the core schema. Migrations are append-only: a released migration is
+// never edited, later changes get a new version
+type migration struct {
+	version int
+	name    string
+	query   string
+}
+
+// The dag table is created with IF NOT EXISTS so that databases whose table was written by hand are adopted
+const createDagTableQuery = `
+	CREATE TABLE IF NOT EXISTS dag (
+		id INTEGER PRIMARY KEY,
+		parent_id INTEGER,
+		root_id INTEGER NOT NULL
+	);
+	CREATE INDEX IF NOT EXISTS dag_parent_id_idx ON dag (parent_id);
+	CREATE INDEX IF NOT EXISTS dag_root_id_idx ON dag (root_id);
+`
+
+// migrations is the core schema, in version order
+var migrations = []migration{
+	{version: 1, name: "create dag table", query: createDagTableQuery},
+	{version: 2, name: "create edge table", query: createEdgeTableQuery},
+	{version: 3, name: "add edge constraints", query: createEdgeConstraintsQuery},
+	{version: 4, name: "add timestamp columns", query: createTimestampColumnsQuery},
+	{version: 5, name: "add payload column", query: createPayloadColumnQuery},
+	{version: 6, name: "index payload column", query: createPayloadIndexQuery},
+	{version: 7, name: "create node ID sequence", query: createNodeIDSequenceQuery},
+	{version: 8, name: "add node type column", query: createNodeTypeColumnQuery},
+}
+
+const createMigrationTableQuery = `
+	CREATE TABLE IF NOT EXISTS dag_schema_migration (
+		version INTEGER PRIMARY KEY,
+		name TEXT NOT NULL,
+		applied_at TIMESTAMPTZ NOT NULL DEFAULT now()
+	)
+`
+
+// migrationLockKey is the advisory lock serializing concurrent Migrate calls
+const migrationLockKey = 0x6461676f
+
+// Migrate brings the core schema (the dag table and its indexes, the edge table, the timestamp, payload and node
+// type columns, the node ID sequence) to the latest version, applying the missing migrations in order within one
+// transaction. Concurrent callers, e.g. several instances starting at once, wait for each other. On SQLite and
+// MySQL it creates the core tables of the dialect instead, without version tracking
+func (d *Daggo) Migrate(ctx context.Context) error {
+	if d.Dialect() != DialectPostgres {
+		return d.migrateDialect(ctx)
+	}
+
+	_, err := d.db.ExecContext(ctx, createMigrationTableQuery)
+	if err != nil {
+		return fmt.Errorf("failed to create migration table: %v", err)
+	}
+
+	// Start a transaction
+	tx, err := d.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %v", err)
+	}
+	defer func() {
+		// Rollback the transaction if it failed to commit
+		if p := recover(); p != nil {
+			tx.Rollback()
+			panic(p)
+		} else if err != nil {
+			tx.Rollback()
+		}
+	}()
+
+	_, err = tx.ExecContext(ctx, "SELECT pg_advisory_xact_lock($1)", migrationLockKey)
+	if err != nil {
+		return fmt.Errorf("failed to lock migrations: %v", err)
+	}
+
+	var current int
+	err = tx.GetContext(ctx, &current, "SELECT COALESCE(max(version), 0) FROM dag_schema_migration")
+	if err != nil {
+		return fmt.Errorf("failed to get schema version: %v", err)
+	}
+
+	for _, m := range migrations {
+		if m.version <= current {
+			continue
+		}
+
+		_, err = tx.ExecContext(ctx, m.query)
+		if err != nil {
+			err = fmt.Errorf("failed to apply migration %d (%s): %v", m.version, m.name, err)
+			return err
+		}
+		_, err = tx.ExecContext(ctx, "INSERT INTO dag_schema_migration (version, name) VALUES ($1, $2)", m.version, m.name)
+		if err != nil {
+			err = fmt.Errorf("failed to record migration %d: %v", m.version, err)
+			return err
+		}
+	}
+
+	// Commit the transaction
+	err = tx.Commit()
+	if err != nil {
+		return fmt.Errorf("failed to commit transaction: %v", err)
+	}
+
+	return nil
+}
+
+// SchemaVersion returns the version of the core schema, 0 when Migrate never ran
+func (d *Daggo) SchemaVersion(ctx context.Context) (int, error) {
+	if err := d.requirePostgres("schema versioning"); err != nil {
+		return 0, err
+	}
+
+	var exists bool
+	err := d.db.GetContext(ctx, &exists, "SELECT to_regclass('dag_schema_migration') IS NOT NULL")
+	if err != nil {
+		return 0, fmt.Errorf("failed to get schema version: %v", err)
+	}
+	if !exists {
+		return 0, nil
+	}
+
+	var version int
+	err = d.db.GetContext(ctx, &version, "SELECT COALESCE(max(version), 0) FROM dag_schema_migration")
+	if err != nil {
+		return 0, fmt.Errorf("failed to get schema version: %v", err)
+	}
+
+	return version, nil
+}
+
+// LatestSchemaVersion returns the version Migrate brings the core schema to
+func LatestSchemaVersion() int {
+	return migrations[len(migrations)-1].version
+}
+
+// InitSchema migrates the core schema and creates the tables of the optional features (annotations, ACLs,
+// pins, visuals, claims, attributes, rollups, edge payloads, cross-graph edges, events, graphs, leases, views,
+// view graphs, quotas, jobs, API keys and documents), so a new database is ready for the whole API. It is
+// idempotent.
+// History, attribution and sync record every write and stay opt-in with CreateHistoryTable,
+// CreateAttributionColumns and CreateSyncTable. The optional features need Postgres, so on other dialects it
+// only creates the core tables
+func (d *Daggo) InitSchema(ctx context.Context) error {
+	err := d.Migrate(ctx)
+	if err != nil {
+		return err
+	}
+	if d.Dialect() != DialectPostgres {
+		return nil
+	}
+
+	features := []func() error{
+		d.CreateAnnotationTable,
+		d.CreateACLTable,
+		d.CreatePinTable,
+		d.CreateVisualTable,
+		d.CreateClaimTable,
+		d.CreateRollupTables,
+		d.CreateEdgePayloadTable,
+		d.CreateCrossEdgeTable,
+		d.CreateEventTable,
+		d.CreateGraphTable,
+		d.CreateGraphLeaseTable,
+		d.CreateViewTable,
+		d.CreateViewGraphTables,
+		d.CreateQuotaTable,
+		d.CreateJobTable,
+		d.CreateAPIKeyTable,
+		d.CreateDocumentTable,
+	}
+	for _, create := range features {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if err := create(); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Migrate migrates the core schema of every shard
+func (s *ShardedDaggo) Migrate(ctx context.Context) error {
+	return s.ForEachShard(func(_ int, d *Daggo) error {
+		return d.Migrate(ctx)
+	})
+}
+
+// InitSchema initializes the schema of every shard
+func (s *ShardedDaggo) InitSchema(ctx context.Context) error {
+	return s.ForEachShard(func(_ int, d *Daggo) error {
+		return d.InitSchema(ctx)
+	})
+}
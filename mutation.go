@@ -0,0 +1,84 @@
+package daggo
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Kinds of change counted by a MutationResult
+const (
+	MutationAdded   = "added"
+	MutationMoved   = "moved"
+	MutationDeleted = "deleted"
+)
+
+// MutationResult summarizes a write: how many nodes each kind of change affected, the graphs it touched and how
+// long it took
+type MutationResult struct {
+	// Counts maps MutationAdded, MutationMoved and MutationDeleted to the number of nodes affected, descendants
+	// carried along included
+	Counts map[string]int64 `json:"counts"`
+	// RootIDs lists the graphs the write touched in ascending order, both the ones nodes left and the ones they
+	// joined
+	RootIDs []int `json:"root_ids"`
+	// NodeIDs lists the nodes the write targeted directly in ascending order, without the descendants that
+	// followed them
+	NodeIDs  []int         `json:"node_ids"`
+	Duration time.Duration `json:"duration"`
+}
+
+func newMutationResult() *MutationResult {
+	return &MutationResult{Counts: make(map[string]int64), RootIDs: make([]int, 0), NodeIDs: make([]int, 0)}
+}
+
+// Total returns the number of nodes affected by the write
+func (r *MutationResult) Total() int64 {
+	var total int64
+	for _, count := range r.Counts {
+		total += count
+	}
+	return total
+}
+
+// String summarizes the result for logs, e.g. "moved 12 nodes in graphs [1 7] in 3ms"
+func (r *MutationResult) String() string {
+	kinds := make([]string, 0, len(r.Counts))
+	for kind := range r.Counts {
+		kinds = append(kinds, kind)
+	}
+	sort.Strings(kinds)
+
+	changes := make([]string, 0, len(kinds))
+	for _, kind := range kinds {
+		changes = append(changes, fmt.Sprintf("%s %d nodes", kind, r.Counts[kind]))
+	}
+	if len(changes) == 0 {
+		changes = append(changes, "changed no nodes")
+	}
+
+	return fmt.Sprintf("%s in graphs %v in %v", strings.Join(changes, ", "), r.RootIDs, r.Duration)
+}
+
+// addRoot records that the write touched the graph rooted at rootID
+func (r *MutationResult) addRoot(rootID int) {
+	i := sort.SearchInts(r.RootIDs, rootID)
+	if i < len(r.RootIDs) && r.RootIDs[i] == rootID {
+		return
+	}
+	r.RootIDs = append(r.RootIDs, 0)
+	copy(r.RootIDs[i+1:], r.RootIDs[i:])
+	r.RootIDs[i] = rootID
+}
+
+// addNode records a node the write targeted directly
+func (r *MutationResult) addNode(nodeID int) {
+	i := sort.SearchInts(r.NodeIDs, nodeID)
+	if i < len(r.NodeIDs) && r.NodeIDs[i] == nodeID {
+		return
+	}
+	r.NodeIDs = append(r.NodeIDs, 0)
+	copy(r.NodeIDs[i+1:], r.NodeIDs[i:])
+	r.NodeIDs[i] = nodeID
+}
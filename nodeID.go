@@ -0,0 +1,159 @@
+package daggo
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sync"
+)
+
+// The sequence starts after the highest ID in use so that databases written with caller-chosen IDs are adopted
+const createNodeIDSequenceQuery = `
+	CREATE SEQUENCE IF NOT EXISTS dag_id_seq AS INTEGER;
+	SELECT setval('dag_id_seq', COALESCE((SELECT max(id) FROM dag), 0) + 1, false);
+`
+
+// maxNodeIDAttempts bounds how many sequence values nextNodeID skips because nodes added with caller-chosen IDs
+// already took them
+const maxNodeIDAttempts = 100
+
+// nextNodeID draws an ID no node uses from the node ID sequence
+func (d *Daggo) nextNodeID(ctx context.Context) (int, error) {
+	if err := d.requirePostgres("generated node IDs"); err != nil {
+		return 0, err
+	}
+
+	query := "SELECT n FROM nextval('dag_id_seq') AS n WHERE NOT EXISTS (SELECT 1 FROM dag WHERE id = n)"
+	for attempt := 0; attempt < maxNodeIDAttempts; attempt++ {
+		var id int
+		err := d.db.GetContext(ctx, &id, query)
+		if err == sql.ErrNoRows {
+			continue // Taken by a node added with a caller-chosen ID
+		} else if err != nil {
+			return 0, fmt.Errorf("failed to generate node ID: %v", err)
+		}
+		return id, nil
+	}
+
+	return 0, fmt.Errorf("failed to generate node ID: %d values of the sequence were taken", maxNodeIDAttempts)
+}
+
+// CreateRootNode creates a new root node with an ID drawn from the dag_id_seq sequence and returns the ID
+func (d *Daggo) CreateRootNode() (int, error) {
+	return d.CreateRootNodeContext(context.Background())
+}
+
+// CreateRootNodeContext is CreateRootNode with a context bounding its queries
+func (d *Daggo) CreateRootNodeContext(ctx context.Context) (int, error) {
+	id, err := d.nextNodeID(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	err = d.AddRootNodeContext(ctx, id)
+	if err != nil {
+		return 0, err
+	}
+
+	return id, nil
+}
+
+// CreateChildNode creates a new child of parentID with an ID drawn from the dag_id_seq sequence and returns the
+// ID. It fails with ErrParentNotFound when the parent does not exist.
+func (d *Daggo) CreateChildNode(parentID int) (int, error) {
+	return d.CreateChildNodeContext(context.Background(), parentID)
+}
+
+// CreateChildNodeContext is CreateChildNode with a context bounding its queries
+func (d *Daggo) CreateChildNodeContext(ctx context.Context, parentID int) (int, error) {
+	id, err := d.nextNodeID(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	err = d.AddChildNodeContext(ctx, id, parentID)
+	if err != nil {
+		return 0, err
+	}
+
+	return id, nil
+}
+
+// defaultIDBlockSize is the number of IDs an IDAllocator reserves at once unless told otherwise
+const defaultIDBlockSize = 1000
+
+// IDAllocator hands out node IDs reserved in blocks from the node ID sequence, so that insert pipelines assign
+// IDs on the client, e.g. to build the batches of AddNodesBulk, with one sequence round trip per block instead
+// of one per node. The IDs of a block are unique and ascending but not contiguous when other processes draw from
+// the sequence at the same time. IDs reserved but not handed out before the process exits are lost, leaving
+// gaps. An IDAllocator is safe for concurrent use.
+type IDAllocator struct {
+	d         *Daggo
+	blockSize int
+
+	mu  sync.Mutex
+	ids []int
+}
+
+// NewIDAllocator returns an allocator reserving blockSize IDs at a time, 1000 when blockSize is not positive.
+// Larger blocks mean fewer round trips and larger gaps when the process stops.
+func (d *Daggo) NewIDAllocator(blockSize int) *IDAllocator {
+	if blockSize <= 0 {
+		blockSize = defaultIDBlockSize
+	}
+	return &IDAllocator{d: d, blockSize: blockSize}
+}
+
+// Next returns an unused node ID, reserving a new block when the current one is exhausted
+func (a *IDAllocator) Next(ctx context.Context) (int, error) {
+	ids, err := a.NextN(ctx, 1)
+	if err != nil {
+		return 0, err
+	}
+	return ids[0], nil
+}
+
+// NextN returns n unused node IDs in ascending order, reserving as many blocks as needed
+func (a *IDAllocator) NextN(ctx context.Context, n int) ([]int, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	for len(a.ids) < n {
+		size := a.blockSize
+		if missing := n - len(a.ids); missing > size {
+			size = missing
+		}
+		err := a.reserve(ctx, size)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	ids := make([]int, n)
+	copy(ids, a.ids)
+	a.ids = a.ids[n:]
+
+	return ids, nil
+}
+
+// reserve draws size values from the sequence and keeps the ones no node uses; a.mu must be held
+func (a *IDAllocator) reserve(ctx context.Context, size int) error {
+	if err := a.d.requirePostgres("generated node IDs"); err != nil {
+		return err
+	}
+
+	block := make([]int, 0, size)
+	query := `
+		SELECT s.id
+		FROM (SELECT nextval('dag_id_seq')::int AS id FROM generate_series(1, $1)) s
+		WHERE NOT EXISTS (SELECT 1 FROM dag WHERE dag.id = s.id)
+		ORDER BY s.id
+	`
+	err := a.d.db.SelectContext(ctx, &block, query, size)
+	if err != nil {
+		return fmt.Errorf("failed to reserve node IDs: %v", err)
+	}
+	a.ids = append(a.ids, block...)
+
+	return nil
+}
@@ -0,0 +1,220 @@
+package daggo
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// ErrInvalidPayload is returned when a payload does not match the schema of its node type
+var ErrInvalidPayload = errors.New("invalid payload")
+
+// JSONSchema is the subset of JSON Schema supported for node type validation: type, properties, required,
+// additionalProperties (boolean), items, enum, minimum, maximum, minLength and maxLength
+type JSONSchema struct {
+	Type                 string                 `json:"type,omitempty"`
+	Properties           map[string]*JSONSchema `json:"properties,omitempty"`
+	Required             []string               `json:"required,omitempty"`
+	AdditionalProperties *bool                  `json:"additionalProperties,omitempty"`
+	Items                *JSONSchema            `json:"items,omitempty"`
+	Enum                 []interface{}          `json:"enum,omitempty"`
+	Minimum              *float64               `json:"minimum,omitempty"`
+	Maximum              *float64               `json:"maximum,omitempty"`
+	MinLength            *int                   `json:"minLength,omitempty"`
+	MaxLength            *int                   `json:"maxLength,omitempty"`
+}
+
+// The type of a node is recorded by SetTypedNodePayload and AddNodesBulk, so that every later write of its
+// payload is validated against the schema of the type
+const createNodeTypeColumnQuery = `
+	ALTER TABLE dag ADD COLUMN IF NOT EXISTS node_type TEXT;
+`
+
+// RegisterNodeType declares a node type whose payloads must match the given JSON schema document.
+// Registering an existing type replaces its schema.
+func (d *Daggo) RegisterNodeType(name string, schema []byte) error {
+	if name == "" {
+		return fmt.Errorf("node type name cannot be empty")
+	}
+
+	var parsed JSONSchema
+	if err := json.Unmarshal(schema, &parsed); err != nil {
+		return fmt.Errorf("failed to parse schema for node type %s: %v", name, err)
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.nodeTypes == nil {
+		d.nodeTypes = make(map[string]*JSONSchema)
+	}
+	d.nodeTypes[name] = &parsed
+
+	return nil
+}
+
+// NodeTypes returns the names of the registered node types
+func (d *Daggo) NodeTypes() []string {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	names := make([]string, 0, len(d.nodeTypes))
+	for name := range d.nodeTypes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// ValidatePayload checks a JSON payload against the schema registered for the given node type
+func (d *Daggo) ValidatePayload(nodeType string, payload []byte) error {
+	d.mu.RLock()
+	schema, ok := d.nodeTypes[nodeType]
+	d.mu.RUnlock()
+	if !ok {
+		return fmt.Errorf("node type %s is not registered", nodeType)
+	}
+
+	var value interface{}
+	if err := json.Unmarshal(payload, &value); err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidPayload, err)
+	}
+
+	if err := schema.validate(value, "$"); err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidPayload, err)
+	}
+
+	return nil
+}
+
+// validateData checks data, encoded as JSON, against the schema of nodeType; nil data stands for an empty payload
+func (d *Daggo) validateData(nodeType string, data interface{}) error {
+	payload := []byte("{}")
+	if data != nil {
+		var err error
+		payload, err = json.Marshal(data)
+		if err != nil {
+			return fmt.Errorf("failed to encode node payload: %v", err)
+		}
+	}
+
+	return d.ValidatePayload(nodeType, payload)
+}
+
+// storedNodeType returns the type recorded for nodeID, or an empty string for untyped nodes. Nodes only have a
+// type once one is registered, so it does not query the database before.
+func (d *Daggo) storedNodeType(ctx context.Context, nodeID int) (string, error) {
+	d.mu.RLock()
+	typed := len(d.nodeTypes) > 0
+	d.mu.RUnlock()
+	if !typed {
+		return "", nil
+	}
+
+	types := make([]sql.NullString, 0, 1)
+	err := d.db.SelectContext(ctx, &types, "SELECT node_type FROM dag WHERE id = $1", nodeID)
+	if err != nil {
+		return "", fmt.Errorf("failed to get node type: %v", err)
+	}
+	if len(types) == 0 {
+		return "", nil // The update reports the missing node
+	}
+
+	return types[0].String, nil
+}
+
+// validate checks a decoded JSON value against the schema; path locates the value in error messages
+func (s *JSONSchema) validate(value interface{}, path string) error {
+	if s.Type != "" && !matchesType(s.Type, value) {
+		return fmt.Errorf("%s: expected %s", path, s.Type)
+	}
+
+	if len(s.Enum) > 0 {
+		found := false
+		for _, allowed := range s.Enum {
+			if fmt.Sprint(allowed) == fmt.Sprint(value) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return fmt.Errorf("%s: value is not one of the allowed values", path)
+		}
+	}
+
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for _, key := range s.Required {
+			if _, ok := v[key]; !ok {
+				return fmt.Errorf("%s: missing required property %q", path, key)
+			}
+		}
+		for key, child := range v {
+			propSchema, ok := s.Properties[key]
+			if !ok {
+				if s.AdditionalProperties != nil && !*s.AdditionalProperties {
+					return fmt.Errorf("%s: unexpected property %q", path, key)
+				}
+				continue
+			}
+			if err := propSchema.validate(child, path+"."+key); err != nil {
+				return err
+			}
+		}
+	case []interface{}:
+		if s.Items != nil {
+			for i, item := range v {
+				if err := s.Items.validate(item, fmt.Sprintf("%s[%d]", path, i)); err != nil {
+					return err
+				}
+			}
+		}
+	case float64:
+		if s.Minimum != nil && v < *s.Minimum {
+			return fmt.Errorf("%s: must be >= %v", path, *s.Minimum)
+		}
+		if s.Maximum != nil && v > *s.Maximum {
+			return fmt.Errorf("%s: must be <= %v", path, *s.Maximum)
+		}
+	case string:
+		length := len([]rune(v))
+		if s.MinLength != nil && length < *s.MinLength {
+			return fmt.Errorf("%s: must be at least %d characters", path, *s.MinLength)
+		}
+		if s.MaxLength != nil && length > *s.MaxLength {
+			return fmt.Errorf("%s: must be at most %d characters", path, *s.MaxLength)
+		}
+	}
+
+	return nil
+}
+
+func matchesType(schemaType string, value interface{}) bool {
+	switch strings.ToLower(schemaType) {
+	case "object":
+		_, ok := value.(map[string]interface{})
+		return ok
+	case "array":
+		_, ok := value.([]interface{})
+		return ok
+	case "string":
+		_, ok := value.(string)
+		return ok
+	case "number":
+		_, ok := value.(float64)
+		return ok
+	case "integer":
+		f, ok := value.(float64)
+		return ok && f == float64(int64(f))
+	case "boolean":
+		_, ok := value.(bool)
+		return ok
+	case "null":
+		return value == nil
+	default:
+		return false
+	}
+}
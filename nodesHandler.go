@@ -0,0 +1,102 @@
+package daggo
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// NodesHandler serves node reads over HTTP:
+//
+//	GET /nodes?id=1&id=2           the nodes with the given IDs, in that order, skipping unknown ones
+//	GET /nodes/{id}/children       the children of a node
+//	GET /nodes/{id}/descendants    the descendants of a node
+//
+// With a root_id query parameter, or behind RequireAPIKey with a key limited to some graphs, nodes of other
+// graphs are left out.
+func NodesHandler(d *Daggo) http.Handler {
+	mux := http.NewServeMux()
+
+	mux.HandleFunc("/nodes", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		params := r.URL.Query()["id"]
+		ids := make([]int64, 0, len(params))
+		for _, param := range params {
+			for _, field := range strings.Split(param, ",") {
+				id, err := strconv.ParseInt(field, 10, 64)
+				if err != nil {
+					http.Error(w, "invalid id", http.StatusBadRequest)
+					return
+				}
+				ids = append(ids, id)
+			}
+		}
+
+		nodes, err := d.getNodesInOrderContext(r.Context(), ids)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		writeJSON(w, visibleNodes(r, nodes))
+	})
+
+	mux.HandleFunc("/nodes/", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/nodes/"), "/")
+		if len(parts) != 2 {
+			http.Error(w, "not found", http.StatusNotFound)
+			return
+		}
+		nodeID, err := strconv.Atoi(parts[0])
+		if err != nil {
+			http.Error(w, "invalid node ID", http.StatusBadRequest)
+			return
+		}
+
+		var nodes []DagNode
+		switch parts[1] {
+		case "children":
+			nodes, err = d.GetNextChildrenNodesContext(r.Context(), nodeID)
+		case "descendants":
+			nodes, err = d.GetDescendantsContext(r.Context(), nodeID)
+		default:
+			http.Error(w, "not found", http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		writeJSON(w, visibleNodes(r, nodes))
+	})
+
+	return mux
+}
+
+// visibleNodes drops the nodes outside the graph named by the root_id query parameter of r or the graphs of its
+// API key
+func visibleNodes(r *http.Request, nodes []DagNode) []DagNode {
+	rootID, err := strconv.Atoi(r.URL.Query().Get("root_id"))
+	hasRoot := err == nil
+	key := APIKeyFromContext(r.Context())
+
+	visible := make([]DagNode, 0, len(nodes))
+	for _, node := range nodes {
+		if hasRoot && node.RootID != rootID {
+			continue
+		}
+		if key != nil && !key.AllowsGraph(node.RootID) {
+			continue
+		}
+		visible = append(visible, node)
+	}
+	return visible
+}
@@ -0,0 +1,130 @@
+package daggo
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+)
+
+// notifyChannel is the Postgres channel daggo publishes its events on
+const notifyChannel = "daggo_events"
+
+// Kinds of the events published by WithNotifications
+const (
+	DagEventNodeAdded      = "node_added"
+	DagEventNodeDeleted    = "node_deleted"
+	DagEventSubtreeDeleted = "subtree_deleted"
+	DagEventNodeMoved      = "node_moved"
+	DagEventEdgeAdded      = "edge_added"
+	DagEventEdgeRemoved    = "edge_removed"
+)
+
+// DagEvent describes a change made by a write of the library
+type DagEvent struct {
+	Kind   string `json:"kind"`
+	NodeID int    `json:"node_id"`
+	// RootID is the graph of the node after the change, or before it for deletions
+	RootID int `json:"root_id"`
+	// ParentIDs are the parents of an added or moved node, empty for roots, or the parent of an added or removed
+	// edge
+	ParentIDs []int `json:"parent_ids,omitempty"`
+	// Count is the number of nodes removed with a subtree
+	Count int64 `json:"count,omitempty"`
+	// Actor is the actor of the write when attribution is enabled
+	Actor string `json:"actor,omitempty"`
+}
+
+// WithNotifications publishes a DagEvent with NOTIFY for every node added, deleted or moved and every edge added
+// or removed by the library, received with Watch. Events are delivered when the write commits. NOTIFY serializes
+// the commits of the whole database, so it stays opt-in.
+func WithNotifications() Option {
+	return func(d *Daggo) {
+		d.notifications = true
+	}
+}
+
+// notify publishes events with exec, inside the transaction of the write when exec is one
+func (d *Daggo) notify(ctx context.Context, exec sqlx.ExecerContext, events ...DagEvent) error {
+	if !d.notifications || len(events) == 0 {
+		return nil
+	}
+
+	actor := d.actor(ctx)
+	payloads := make([]string, 0, len(events))
+	for _, event := range events {
+		event.Actor = actor
+		payload, err := json.Marshal(event)
+		if err != nil {
+			return fmt.Errorf("failed to encode event: %v", err)
+		}
+		payloads = append(payloads, string(payload))
+	}
+
+	_, err := exec.ExecContext(ctx, "SELECT pg_notify($1, e) FROM unnest($2::text[]) AS e", notifyChannel, pq.Array(payloads))
+	if err != nil {
+		return fmt.Errorf("failed to publish events: %v", err)
+	}
+
+	return nil
+}
+
+// Watch listens for the events published by the Daggo instances created with WithNotifications on the same
+// database, until ctx is done. The listener reconnects by itself; events published while it is disconnected
+// are lost, so consumers keeping caches should drop them when the channel reports a reconnection through a
+// DagEvent with an empty Kind.
+func (d *Daggo) Watch(ctx context.Context) (<-chan DagEvent, error) {
+	if err := d.requirePostgres("Watch"); err != nil {
+		return nil, err
+	}
+	if d.dsn == "" {
+		return nil, fmt.Errorf("cannot watch a Daggo created without a DSN")
+	}
+
+	listener := pq.NewListener(d.dsn, time.Second, time.Minute, nil)
+	err := listener.Listen(notifyChannel)
+	if err != nil {
+		listener.Close()
+		return nil, fmt.Errorf("failed to listen for events: %v", err)
+	}
+
+	events := make(chan DagEvent, 64)
+	go func() {
+		defer close(events)
+		defer listener.Close()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case notification, ok := <-listener.Notify:
+				if !ok {
+					return
+				}
+
+				// A nil notification tells that the connection was re-established
+				var event DagEvent
+				if notification != nil {
+					err := json.Unmarshal([]byte(notification.Extra), &event)
+					if err != nil {
+						continue
+					}
+				}
+
+				select {
+				case events <- event:
+				case <-ctx.Done():
+					return
+				}
+			case <-time.After(90 * time.Second):
+				// Check that the connection is alive; a dead one is re-established by the listener
+				go listener.Ping()
+			}
+		}
+	}()
+
+	return events, nil
+}
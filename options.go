@@ -0,0 +1,11 @@
+package daggo
+
+// Option configures optional behaviour of a Daggo
+type Option func(*Daggo)
+
+// WithQuotaEnforcement makes inserts fail with ErrQuotaExceeded when they would exceed a configured quota
+func WithQuotaEnforcement() Option {
+	return func(d *Daggo) {
+		d.enforceQuotas = true
+	}
+}
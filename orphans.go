@@ -0,0 +1,161 @@
+package daggo
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// OrphanFilter selects the nodes adopted by AdoptOrphans
+type OrphanFilter struct {
+	// RootID restricts adoption to the nodes claiming the graph rooted at RootID, 0 for any graph
+	RootID int
+	// Quarantine is the payload marker (JSONB containment) that imports leave on the nodes they set aside,
+	// e.g. map[string]interface{}{"quarantined": true}. Marked nodes are adopted even when their parents
+	// exist; nil only adopts orphans
+	Quarantine interface{}
+}
+
+// AdoptOrphans attaches orphaned nodes, and quarantined nodes when the filter names a marker, under
+// targetParentID, which becomes their only parent, and moves their subtrees into its graph. Orphans are the
+// nodes whose primary parent no longer exists and the non-root nodes without a parent, as left by partially
+// failed imports or writes made outside of daggo. The NodeIDs of the result are the adopted nodes; their
+// descendants follow them and are only counted as moved.
+func (d *Daggo) AdoptOrphans(targetParentID int, filter OrphanFilter) (*MutationResult, error) {
+	return d.AdoptOrphansContext(context.Background(), targetParentID, filter)
+}
+
+// AdoptOrphansContext is AdoptOrphans with a context bounding its queries
+func (d *Daggo) AdoptOrphansContext(ctx context.Context, targetParentID int, filter OrphanFilter) (*MutationResult, error) {
+	start := time.Now()
+
+	var quarantine interface{}
+	if filter.Quarantine != nil {
+		marker, err := json.Marshal(filter.Quarantine)
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode quarantine marker: %v", err)
+		}
+		quarantine = marker
+	}
+
+	// Start a transaction
+	tx, err := d.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %v", err)
+	}
+	defer func() {
+		// Rollback the transaction if it failed to commit
+		if p := recover(); p != nil {
+			tx.Rollback()
+			panic(p)
+		} else if err != nil {
+			tx.Rollback()
+		}
+	}()
+
+	err = d.setTxActor(ctx, tx)
+	if err != nil {
+		return nil, err
+	}
+
+	var rootID int
+	err = tx.GetContext(ctx, &rootID, "SELECT root_id FROM dag WHERE id = $1 FOR SHARE", targetParentID)
+	if err == sql.ErrNoRows {
+		err = fmt.Errorf("%w: %d", ErrParentNotFound, targetParentID)
+		return nil, err
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to get target parent node: %v", err)
+	}
+
+	// The payload marker is only looked at when given, so that the payload column is not required otherwise
+	args := []interface{}{targetParentID, filter.RootID}
+	quarantined := ""
+	if quarantine != nil {
+		quarantined = "OR dag.payload @> $3::jsonb"
+		args = append(args, quarantine)
+	}
+	query := fmt.Sprintf(`
+		SELECT dag.id, dag.root_id
+		FROM dag
+		WHERE dag.id <> $1
+			AND ($2 = 0 OR dag.root_id = $2)
+			AND (
+				(dag.parent_id IS NULL AND dag.root_id <> dag.id)
+				OR (dag.parent_id IS NOT NULL AND NOT EXISTS (SELECT 1 FROM dag p WHERE p.id = dag.parent_id))
+				%s
+			)
+		ORDER BY dag.id
+		FOR UPDATE
+	`, quarantined)
+	orphans := make([]struct {
+		ID     int `db:"id"`
+		RootID int `db:"root_id"`
+	}, 0)
+	err = tx.SelectContext(ctx, &orphans, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find orphans: %v", err)
+	}
+	result := newMutationResult()
+	if len(orphans) == 0 {
+		tx.Rollback()
+		result.Duration = time.Since(start)
+		return result, nil
+	}
+	adopted := make([]int, 0, len(orphans))
+	for _, orphan := range orphans {
+		adopted = append(adopted, orphan.ID)
+		result.addNode(orphan.ID)
+		result.addRoot(orphan.RootID)
+	}
+	result.addRoot(rootID)
+
+	for _, id := range adopted {
+		err = checkCycle(ctx, tx, targetParentID, id)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// The primary parent is updated first since the trigger mirroring it drops the edge to the old one
+	_, err = tx.ExecContext(ctx, "UPDATE dag SET parent_id = $2 WHERE id = ANY($1)", pq.Array(adopted), targetParentID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to adopt orphans: %v", err)
+	}
+	_, err = tx.ExecContext(ctx, "DELETE FROM dag_edge WHERE child_id = ANY($1) AND parent_id <> $2", pq.Array(adopted), targetParentID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to remove old parents: %v", err)
+	}
+
+	// Move the adopted subtrees into the graph of the target
+	var moved int64
+	err = tx.GetContext(ctx, &moved, `
+		WITH RECURSIVE subtree AS (
+			SELECT unnest($1::int[]) AS id
+			UNION
+			SELECT dag_edge.child_id FROM dag_edge JOIN subtree ON dag_edge.parent_id = subtree.id
+		),
+		updated AS (
+			UPDATE dag SET root_id = $2 WHERE id IN (SELECT id FROM subtree) AND root_id <> $2
+		)
+		SELECT count(*) FROM subtree
+	`, pq.Array(adopted), rootID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to update graph of adopted nodes: %v", err)
+	}
+
+	// Commit the transaction
+	err = tx.Commit()
+	if err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %v", err)
+	}
+
+	d.InvalidatePlanCache()
+	result.Counts[MutationMoved] = moved
+	result.Duration = time.Since(start)
+
+	return result, nil
+}
@@ -0,0 +1,141 @@
+package daggo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"time"
+)
+
+// ErrPartialResult is returned alongside the nodes a traversal streamed before its deadline, with
+// WithPartialResults
+var ErrPartialResult = errors.New("partial result")
+
+// PartialResultError carries the depth to pass to WithResumeDepth to continue a partial traversal.
+// It matches ErrPartialResult with errors.Is.
+type PartialResultError struct {
+	// ResumeDepth is the first level of the traversal that was not fully streamed: every node closer to the
+	// start node is in the partial result
+	ResumeDepth int
+	// Cause is the error of the context that cut the traversal short
+	Cause error
+}
+
+func (e *PartialResultError) Error() string {
+	return fmt.Sprintf("%v: resume at depth %d: %v", ErrPartialResult, e.ResumeDepth, e.Cause)
+}
+
+// Unwrap returns ErrPartialResult
+func (e *PartialResultError) Unwrap() error {
+	return ErrPartialResult
+}
+
+// WithStatementTimeout bounds the queries of GetDescendants, GetAncestors and Traverse to timeout, on top of the
+// deadline of their context
+func WithStatementTimeout(timeout time.Duration) TraversalOption {
+	return func(o *traversalOptions) {
+		o.timeout = timeout
+	}
+}
+
+// WithPartialResults makes the traversals of GetDescendants, GetAncestors and Traverse stream the nodes level by
+// level and, when their context or statement timeout expires, return the nodes streamed so far in ID order
+// together with a *PartialResultError instead of losing them. A Both traversal resumes at the lowest depth of
+// its two directions. The traversal follows the edge table whatever the layout; WithLimit, WithCursor and
+// WithMaxResults only apply to complete results.
+func WithPartialResults() TraversalOption {
+	return func(o *traversalOptions) {
+		o.partial = true
+	}
+}
+
+// WithResumeDepth continues a partial traversal at the ResumeDepth of its *PartialResultError, skipping the
+// nodes closer to the start node, which the partial result holds. Nodes of that level may be returned again.
+// Only traversals with WithPartialResults honour it.
+func WithResumeDepth(depth int) TraversalOption {
+	return func(o *traversalOptions) {
+		o.resumeDepth = depth
+	}
+}
+
+// withTimeout returns ctx bounded by the statement timeout of the traversal, if any
+func (o traversalOptions) withTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	if o.timeout > 0 {
+		return context.WithTimeout(ctx, o.timeout)
+	}
+	return context.WithCancel(ctx)
+}
+
+// traversePartial streams a Down or Up traversal from nodeID and salvages the nodes read before ctx ends
+func (d *Daggo) traversePartial(ctx context.Context, dir Direction, nodeID int, options traversalOptions) ([]DagNode, error) {
+	step, err := d.traversalStepFor(dir, options)
+	if err != nil {
+		return nil, err
+	}
+	maxDepth := options.maxDepth
+	if maxDepth <= 0 {
+		maxDepth = math.MaxInt32
+	}
+
+	// The recursion emits its rows one level after the other, without the sort holding them back until the end,
+	// so a node is first read at its shortest depth
+	query := `
+		WITH RECURSIVE reachable(id, depth) AS (
+			SELECT $1::int, 0
+			UNION
+			` + step.depthQuery("$2") + `
+		)
+		SELECT dag.*, reachable.depth
+		FROM reachable
+		JOIN dag ON dag.id = reachable.id
+		WHERE reachable.id <> $1
+	`
+	rows, err := d.reader(ctx, options.consistency).QueryxContext(ctx, query, nodeID, maxDepth)
+	if err != nil {
+		if ctx.Err() != nil {
+			return []DagNode{}, &PartialResultError{ResumeDepth: options.resumeDepth, Cause: ctx.Err()}
+		}
+		return nil, fmt.Errorf("failed to traverse %v from node %d: %v", dir, nodeID, err)
+	}
+	defer rows.Close()
+
+	nodes := make([]DagNode, 0)
+	seen := make(map[int]bool)
+	depth := 0
+	for rows.Next() {
+		var row struct {
+			DagNode
+			Depth int `db:"depth"`
+		}
+		err = rows.StructScan(&row)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read node: %v", err)
+		}
+
+		depth = row.Depth
+		if seen[row.ID] {
+			continue
+		}
+		seen[row.ID] = true
+		if row.Depth >= options.resumeDepth {
+			nodes = append(nodes, row.DagNode)
+		}
+	}
+	sort.Slice(nodes, func(i, j int) bool { return nodes[i].ID < nodes[j].ID })
+
+	err = rows.Err()
+	if err != nil {
+		if ctx.Err() == nil {
+			return nil, fmt.Errorf("failed to traverse %v from node %d: %v", dir, nodeID, err)
+		}
+		// The level being read when the deadline hit may miss nodes
+		if depth < options.resumeDepth {
+			depth = options.resumeDepth
+		}
+		return nodes, &PartialResultError{ResumeDepth: depth, Cause: ctx.Err()}
+	}
+
+	return options.truncate(nodes)
+}
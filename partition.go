@@ -0,0 +1,221 @@
+package daggo
+
+import (
+	"fmt"
+)
+
+// PartitionScheme selects how a partitioned dag table splits its rows
+type PartitionScheme int
+
+const (
+	// PartitionByRootHash spreads graphs over a fixed number of hash partitions of root_id
+	PartitionByRootHash PartitionScheme = iota
+	// PartitionByRoot gives every graph its own list partition, created with CreateGraphPartition,
+	// so deleting a graph is a partition drop
+	PartitionByRoot
+)
+
+// partitionedIDQuery keeps node IDs globally unique in a partitioned dag table, whose primary key must include
+// the partition key, by registering every ID in dag_node_id, so that reads, deletes and edges keyed by node ID
+// keep addressing a single node. A taken ID fails like a duplicate primary key. Nodes cannot move to another
+// graph, as Postgres moves rows between partitions by deleting and inserting them, which would drop the edges
+// of the moved nodes. For the same reason Compact, which renumbers graphs through a temporary root, refuses
+// partitioned tables.
+const partitionedIDQuery = `
+	CREATE TABLE IF NOT EXISTS dag_node_id (
+		id INTEGER PRIMARY KEY
+	);
+	INSERT INTO dag_node_id (id) SELECT id FROM dag ON CONFLICT DO NOTHING;
+
+	CREATE OR REPLACE FUNCTION dag_unique_id() RETURNS trigger AS $$
+	BEGIN
+		IF TG_OP = 'DELETE' THEN
+			DELETE FROM dag_node_id WHERE id = OLD.id;
+			RETURN OLD;
+		END IF;
+		IF TG_OP = 'UPDATE' THEN
+			IF NEW.root_id <> OLD.root_id THEN
+				RAISE EXCEPTION 'node % cannot move from graph % to graph % in a partitioned dag table',
+					OLD.id, OLD.root_id, NEW.root_id;
+			END IF;
+			IF NEW.id = OLD.id THEN
+				RETURN NEW;
+			END IF;
+			DELETE FROM dag_node_id WHERE id = OLD.id;
+		END IF;
+		INSERT INTO dag_node_id (id) VALUES (NEW.id) ON CONFLICT DO NOTHING;
+		IF NOT FOUND THEN
+			RAISE EXCEPTION 'duplicate node ID %', NEW.id
+				USING ERRCODE = 'unique_violation', CONSTRAINT = 'dag_pkey';
+		END IF;
+		RETURN NEW;
+	END;
+	$$ LANGUAGE plpgsql;
+
+	DROP TRIGGER IF EXISTS dag_unique_id_trigger ON dag;
+	CREATE TRIGGER dag_unique_id_trigger
+		BEFORE INSERT OR UPDATE OF id, root_id OR DELETE ON dag
+		FOR EACH ROW EXECUTE FUNCTION dag_unique_id();
+`
+
+// CreatePartitionedDagTable creates the dag table partitioned by root_id. With PartitionByRootHash,
+// hashPartitions partitions are created up front. Postgres requires the partition key in the primary key, so
+// node IDs are kept globally unique by a side table and a trigger instead, and nodes cannot move between graphs,
+// so graphs cannot be compacted either.
+// Queries filtering on root_id are pruned to a single partition.
+func (d *Daggo) CreatePartitionedDagTable(scheme PartitionScheme, hashPartitions int) error {
+	err := d.requirePostgres("partitioning")
+	if err != nil {
+		return err
+	}
+
+	var query string
+	switch scheme {
+	case PartitionByRootHash:
+		if hashPartitions <= 0 {
+			return fmt.Errorf("hash partition count must be positive")
+		}
+		query = "CREATE TABLE IF NOT EXISTS dag (id INTEGER NOT NULL, parent_id INTEGER, root_id INTEGER NOT NULL, " +
+			"PRIMARY KEY (root_id, id)) PARTITION BY HASH (root_id);"
+		for i := 0; i < hashPartitions; i++ {
+			query += fmt.Sprintf(" CREATE TABLE IF NOT EXISTS dag_p%d PARTITION OF dag FOR VALUES WITH (MODULUS %d, REMAINDER %d);",
+				i, hashPartitions, i)
+		}
+	case PartitionByRoot:
+		query = "CREATE TABLE IF NOT EXISTS dag (id INTEGER NOT NULL, parent_id INTEGER, root_id INTEGER NOT NULL, " +
+			"PRIMARY KEY (root_id, id)) PARTITION BY LIST (root_id);" +
+			" CREATE TABLE IF NOT EXISTS dag_default PARTITION OF dag DEFAULT;"
+	default:
+		return fmt.Errorf("unknown partition scheme %d", scheme)
+	}
+	query += " CREATE INDEX IF NOT EXISTS dag_parent_id_idx ON dag (parent_id);" + partitionedIDQuery
+
+	_, err = d.db.Exec(query)
+	if err != nil {
+		return fmt.Errorf("failed to create partitioned dag table: %v", err)
+	}
+
+	return nil
+}
+
+// CreateGraphPartition creates the list partition holding the graph rooted at rootID. Rows of the graph
+// already stored in the default partition are moved into it.
+func (d *Daggo) CreateGraphPartition(rootID int) error {
+	// Start a transaction
+	tx, err := d.db.Beginx()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %v", err)
+	}
+	defer func() {
+		// Rollback the transaction if it failed to commit
+		if p := recover(); p != nil {
+			tx.Rollback()
+			panic(p)
+		} else if err != nil {
+			tx.Rollback()
+		}
+	}()
+
+	// Postgres refuses to create a partition while matching rows sit in the default partition
+	_, err = tx.Exec("CREATE TEMP TABLE dag_partition_move ON COMMIT DROP AS SELECT * FROM dag_default WHERE root_id = $1", rootID)
+	if err != nil {
+		return fmt.Errorf("failed to stage graph rows: %v", err)
+	}
+	_, err = tx.Exec("DELETE FROM dag_default WHERE root_id = $1", rootID)
+	if err != nil {
+		return fmt.Errorf("failed to stage graph rows: %v", err)
+	}
+
+	_, err = tx.Exec(fmt.Sprintf("CREATE TABLE %s PARTITION OF dag FOR VALUES IN (%d)", graphPartitionName(rootID), rootID))
+	if err != nil {
+		return fmt.Errorf("failed to create graph partition: %v", err)
+	}
+	_, err = tx.Exec("INSERT INTO dag SELECT * FROM dag_partition_move")
+	if err != nil {
+		return fmt.Errorf("failed to move graph rows: %v", err)
+	}
+
+	// Commit the transaction
+	err = tx.Commit()
+	if err != nil {
+		return fmt.Errorf("failed to commit transaction: %v", err)
+	}
+
+	return nil
+}
+
+// DropGraph deletes every node of the graph rooted at rootID. When the graph has its own list partition the
+// partition is dropped instead of deleting rows one by one, after the edges and node IDs of the graph, which row
+// triggers would otherwise clear.
+func (d *Daggo) DropGraph(rootID int) error {
+	var hasPartition bool
+	err := d.db.Get(&hasPartition, "SELECT to_regclass($1) IS NOT NULL", graphPartitionName(rootID))
+	if err != nil {
+		return fmt.Errorf("failed to check graph partition: %v", err)
+	}
+	if !hasPartition {
+		_, err = d.db.Exec("DELETE FROM dag WHERE root_id = $1", rootID)
+		if err != nil {
+			return fmt.Errorf("failed to drop graph: %v", err)
+		}
+		return nil
+	}
+
+	// Start a transaction
+	tx, err := d.db.Beginx()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %v", err)
+	}
+	defer func() {
+		// Rollback the transaction if it failed to commit
+		if p := recover(); p != nil {
+			tx.Rollback()
+			panic(p)
+		} else if err != nil {
+			tx.Rollback()
+		}
+	}()
+
+	query := fmt.Sprintf("DELETE FROM dag_edge WHERE parent_id IN (SELECT id FROM %[1]s) OR child_id IN (SELECT id FROM %[1]s)",
+		graphPartitionName(rootID))
+	_, err = tx.Exec(query)
+	if err != nil {
+		return fmt.Errorf("failed to delete graph edges: %v", err)
+	}
+	query = fmt.Sprintf("DELETE FROM dag_node_id WHERE id IN (SELECT id FROM %s)", graphPartitionName(rootID))
+	_, err = tx.Exec(query)
+	if err != nil {
+		return fmt.Errorf("failed to release node IDs: %v", err)
+	}
+	// Dropping the partition deletes no rows the usage counters would see go
+	var counted bool
+	err = tx.Get(&counted, "SELECT to_regclass('dag_usage') IS NOT NULL")
+	if err != nil {
+		return fmt.Errorf("failed to check usage table: %v", err)
+	}
+	if counted {
+		_, err = tx.Exec("DELETE FROM dag_usage WHERE root_id = $1", rootID)
+		if err != nil {
+			return fmt.Errorf("failed to reset graph usage: %v", err)
+		}
+	}
+	_, err = tx.Exec(fmt.Sprintf("DROP TABLE %s", graphPartitionName(rootID)))
+	if err != nil {
+		return fmt.Errorf("failed to drop graph: %v", err)
+	}
+
+	// Commit the transaction
+	err = tx.Commit()
+	if err != nil {
+		return fmt.Errorf("failed to commit transaction: %v", err)
+	}
+
+	return nil
+}
+
+func graphPartitionName(rootID int) string {
+	if rootID < 0 {
+		return fmt.Sprintf("dag_graph_n%d", -rootID)
+	}
+	return fmt.Sprintf("dag_graph_%d", rootID)
+}
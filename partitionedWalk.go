@@ -0,0 +1,126 @@
+package daggo
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/lib/pq"
+)
+
+// PartitionMode selects how WalkPartitioned splits a graph
+type PartitionMode int
+
+const (
+	// PartitionByLevel visits the graph one depth level at a time, root first
+	PartitionByLevel PartitionMode = iota
+	// PartitionByBranch visits the root alone, then the subtree of each top-level branch
+	PartitionByBranch
+)
+
+// WalkPartitioned visits the graph rooted at rootID in partitions of at most maxPartitionSize nodes and hands
+// each one to fn, so graphs that do not fit in memory can be processed with predictable memory usage.
+// Only the current partition (and, by level, the IDs of the previous level) is held at a time. A branch
+// larger than maxPartitionSize is split into several consecutive partitions. Returning an error from fn
+// stops the walk.
+func (d *Daggo) WalkPartitioned(ctx context.Context, rootID int, mode PartitionMode, maxPartitionSize int,
+	fn func(partition []DagNode) error) error {
+	if maxPartitionSize <= 0 {
+		return fmt.Errorf("partition size must be positive")
+	}
+	ctx = WithOperation(ctx, OpWalk)
+
+	root := make([]DagNode, 0, 1)
+	err := d.db.SelectContext(ctx, &root, "SELECT * FROM dag WHERE id = $1", rootID)
+	if err != nil {
+		return fmt.Errorf("failed to get root node: %v", err)
+	}
+	if len(root) == 0 {
+		return fmt.Errorf("%w: %d", ErrNodeNotFound, rootID)
+	}
+	if err := fn(root); err != nil {
+		return err
+	}
+
+	switch mode {
+	case PartitionByLevel:
+		return d.walkLevels(ctx, rootID, maxPartitionSize, fn)
+	case PartitionByBranch:
+		return d.walkBranches(ctx, rootID, maxPartitionSize, fn)
+	default:
+		return fmt.Errorf("unknown partition mode %d", mode)
+	}
+}
+
+func (d *Daggo) walkLevels(ctx context.Context, rootID int, maxPartitionSize int, fn func([]DagNode) error) error {
+	level := []int64{int64(rootID)}
+	for len(level) > 0 {
+		next := make([]int64, 0)
+
+		// Page through the children of the current level by ID
+		cursor := int64(-1 << 31)
+		for {
+			partition := make([]DagNode, 0, maxPartitionSize)
+			query := "SELECT * FROM dag WHERE parent_id = ANY($1) AND id > $2 ORDER BY id ASC LIMIT $3"
+			err := d.db.SelectContext(ctx, &partition, query, pq.Int64Array(level), cursor, maxPartitionSize)
+			if err != nil {
+				return fmt.Errorf("failed to load level partition: %v", err)
+			}
+			if len(partition) == 0 {
+				break
+			}
+
+			for _, node := range partition {
+				next = append(next, int64(node.ID))
+			}
+			cursor = int64(partition[len(partition)-1].ID)
+			if err := fn(partition); err != nil {
+				return err
+			}
+			if len(partition) < maxPartitionSize {
+				break
+			}
+		}
+
+		level = next
+	}
+
+	return nil
+}
+
+func (d *Daggo) walkBranches(ctx context.Context, rootID int, maxPartitionSize int, fn func([]DagNode) error) error {
+	var branches []int
+	err := d.db.SelectContext(ctx, &branches, "SELECT id FROM dag WHERE parent_id = $1 ORDER BY id ASC", rootID)
+	if err != nil {
+		return fmt.Errorf("failed to get top-level branches: %v", err)
+	}
+
+	for _, branchID := range branches {
+		cursor := int64(-1 << 31)
+		for {
+			partition := make([]DagNode, 0, maxPartitionSize)
+			query := `
+				SELECT branch.* FROM (` + subtreeQuery + `) AS branch
+				WHERE branch.id > $2
+				ORDER BY branch.id ASC
+				LIMIT $3
+			`
+			err := d.db.SelectContext(ctx, &partition, query, branchID, cursor, maxPartitionSize)
+			if err != nil {
+				return fmt.Errorf("failed to load branch partition: %v", err)
+			}
+			if len(partition) == 0 {
+				break
+			}
+
+			cursor = int64(partition[len(partition)-1].ID)
+			if err := fn(partition); err != nil {
+				return err
+			}
+			if len(partition) < maxPartitionSize {
+				break
+			}
+		}
+	}
+
+	return nil
+}
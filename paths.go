@@ -0,0 +1,219 @@
+package daggo
+
+import (
+	"context"
+	"fmt"
+	"sort"
+)
+
+// maxPaths bounds the number of paths GetAllPaths enumerates, as their number grows exponentially with the
+// depth of diamond-shaped graphs
+const maxPaths = 10000
+
+// Only the nodes lying both below fromID ($1) and above toID ($2) are visited: the ancestors of toID are
+// collected first and the walk down from fromID never leaves them
+const pathEdgesQuery = `
+	WITH RECURSIVE up AS (
+		SELECT $2::int AS id
+		UNION
+		SELECT dag_edge.parent_id FROM dag_edge JOIN up ON dag_edge.child_id = up.id
+	), down AS (
+		SELECT id FROM up WHERE id = $1
+		UNION
+		SELECT dag_edge.child_id
+		FROM dag_edge
+		JOIN down ON dag_edge.parent_id = down.id
+		WHERE dag_edge.child_id IN (SELECT id FROM up)
+	)
+	SELECT parent_id, child_id
+	FROM dag_edge
+	WHERE parent_id IN (SELECT id FROM down) AND child_id IN (SELECT id FROM down)
+	ORDER BY parent_id, child_id
+`
+
+// IsAncestor reports whether ancestorID lies above nodeID through any chain of edges. A node is not its own
+// ancestor.
+func (d *Daggo) IsAncestor(ancestorID int, nodeID int) (bool, error) {
+	return d.IsAncestorContext(context.Background(), ancestorID, nodeID)
+}
+
+// IsAncestorContext is IsAncestor with a context bounding its queries
+func (d *Daggo) IsAncestorContext(ctx context.Context, ancestorID int, nodeID int) (bool, error) {
+	if ancestorID == nodeID {
+		return false, nil
+	}
+
+	var found bool
+
+	// EXISTS stops the walk up as soon as the ancestor shows up
+	query := `
+		WITH RECURSIVE up AS (
+			SELECT parent_id AS id FROM dag_edge WHERE child_id = $2
+			UNION
+			SELECT dag_edge.parent_id FROM dag_edge JOIN up ON dag_edge.child_id = up.id
+		)
+		SELECT EXISTS (SELECT 1 FROM up WHERE id = $1)
+	`
+	ctx = WithOperation(ctx, OpAncestors)
+	err := d.db.GetContext(ctx, &found, query, ancestorID, nodeID)
+	if err != nil {
+		return false, fmt.Errorf("failed to check ancestry: %v", err)
+	}
+
+	return found, nil
+}
+
+// GetPath returns a shortest chain of nodes from fromID down to toID, both included, breaking ties towards
+// lower node IDs. It returns a nil path if toID is not a descendant of fromID.
+func (d *Daggo) GetPath(fromID int, toID int) ([]DagNode, error) {
+	return d.GetPathContext(context.Background(), fromID, toID)
+}
+
+// GetPathContext is GetPath with a context bounding its queries
+func (d *Daggo) GetPathContext(ctx context.Context, fromID int, toID int) ([]DagNode, error) {
+	if fromID == toID {
+		node, err := d.GetNodeByIDContext(ctx, fromID)
+		if err != nil || node == nil {
+			return nil, err
+		}
+		return []DagNode{*node}, nil
+	}
+
+	children, err := d.pathEdges(ctx, fromID, toID)
+	if err != nil || children == nil {
+		return nil, err
+	}
+
+	// Breadth-first search over the edges between the two nodes; children are sorted so the first parent to
+	// reach a node has the lowest ID
+	prev := map[int]int{fromID: fromID}
+	queue := []int{fromID}
+	for len(queue) > 0 && !hasKey(prev, toID) {
+		id := queue[0]
+		queue = queue[1:]
+		for _, childID := range children[id] {
+			if !hasKey(prev, childID) {
+				prev[childID] = id
+				queue = append(queue, childID)
+			}
+		}
+	}
+	if !hasKey(prev, toID) {
+		return nil, nil // Target not reachable
+	}
+
+	ids := make([]int64, 0)
+	for id := toID; id != fromID; id = prev[id] {
+		ids = append(ids, int64(id))
+	}
+	ids = append(ids, int64(fromID))
+	for i, j := 0, len(ids)-1; i < j; i, j = i+1, j-1 {
+		ids[i], ids[j] = ids[j], ids[i]
+	}
+
+	return d.getNodesInOrderContext(ctx, ids)
+}
+
+// GetAllPaths returns every chain of nodes from fromID down to toID, both included, shortest first. Their
+// number grows exponentially with the diamonds of multi-parent graphs, so past 10000 paths the first ones are
+// returned with ErrResultTruncated.
+func (d *Daggo) GetAllPaths(fromID int, toID int) ([][]DagNode, error) {
+	return d.GetAllPathsContext(context.Background(), fromID, toID)
+}
+
+// GetAllPathsContext is GetAllPaths with a context bounding its queries
+func (d *Daggo) GetAllPathsContext(ctx context.Context, fromID int, toID int) ([][]DagNode, error) {
+	paths := make([][]DagNode, 0)
+	if fromID == toID {
+		path, err := d.GetPathContext(ctx, fromID, toID)
+		if err != nil || path == nil {
+			return paths, err
+		}
+		return append(paths, path), nil
+	}
+
+	children, err := d.pathEdges(ctx, fromID, toID)
+	if err != nil || children == nil {
+		return paths, err
+	}
+
+	// Every node kept by pathEdges leads to toID, so each branch of the walk ends with a path
+	idPaths := make([][]int, 0)
+	truncated := false
+	path := []int{fromID}
+	var walk func(id int)
+	walk = func(id int) {
+		if truncated {
+			return
+		}
+		if id == toID {
+			if len(idPaths) == maxPaths {
+				truncated = true
+				return
+			}
+			idPaths = append(idPaths, append([]int(nil), path...))
+			return
+		}
+		for _, childID := range children[id] {
+			path = append(path, childID)
+			walk(childID)
+			path = path[:len(path)-1]
+		}
+	}
+	walk(fromID)
+	sort.SliceStable(idPaths, func(i, j int) bool { return len(idPaths[i]) < len(idPaths[j]) })
+
+	ids := make([]int64, 0)
+	for id := range children {
+		ids = append(ids, int64(id))
+	}
+	ids = append(ids, int64(toID))
+	nodes, err := d.getNodesInOrderContext(ctx, ids)
+	if err != nil {
+		return nil, err
+	}
+	byID := make(map[int]DagNode, len(nodes))
+	for _, node := range nodes {
+		byID[node.ID] = node
+	}
+
+	for _, idPath := range idPaths {
+		nodePath := make([]DagNode, 0, len(idPath))
+		for _, id := range idPath {
+			nodePath = append(nodePath, byID[id])
+		}
+		paths = append(paths, nodePath)
+	}
+
+	if truncated {
+		return paths, fmt.Errorf("%w: more than %d paths from node %d to node %d", ErrResultTruncated, maxPaths, fromID, toID)
+	}
+	return paths, nil
+}
+
+// pathEdges returns the children of the nodes lying on a path from fromID down to toID, or nil if there is
+// no such path
+func (d *Daggo) pathEdges(ctx context.Context, fromID int, toID int) (map[int][]int, error) {
+	edges := make([]graphEdge, 0)
+
+	ctx = WithOperation(ctx, OpPath)
+	err := d.db.SelectContext(ctx, &edges, pathEdgesQuery, fromID, toID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get path edges: %v", err)
+	}
+	if len(edges) == 0 {
+		return nil, nil
+	}
+
+	children := make(map[int][]int)
+	for _, edge := range edges {
+		children[edge.ParentID] = append(children[edge.ParentID], edge.ChildID)
+	}
+
+	return children, nil
+}
+
+func hasKey(m map[int]int, key int) bool {
+	_, ok := m[key]
+	return ok
+}
@@ -0,0 +1,404 @@
+package daggo
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+)
+
+// The default keeps payloads non-null so they scan into json.RawMessage
+const createPayloadColumnQuery = `
+	ALTER TABLE dag ADD COLUMN IF NOT EXISTS payload JSONB NOT NULL DEFAULT '{}';
+`
+
+const createPayloadIndexQuery = `
+	CREATE INDEX IF NOT EXISTS dag_payload_idx ON dag USING GIN (payload jsonb_path_ops);
+`
+
+// CreatePayloadColumn adds the payload column storing a JSON document on every node, with the index used by
+// GetNodesByPayload
+func (d *Daggo) CreatePayloadColumn() error {
+	_, err := d.db.Exec(createPayloadColumnQuery + createPayloadIndexQuery)
+	if err != nil {
+		return fmt.Errorf("failed to create payload column: %v", err)
+	}
+
+	return nil
+}
+
+// Changes describes the update UpdateSubtree applies to the payload of every matching node
+type Changes struct {
+	// Payload is merged into the payload, replacing the top-level keys it contains
+	Payload map[string]interface{}
+	// RemoveKeys are top-level keys deleted from the payload
+	RemoveKeys []string
+}
+
+// UpdateSubtree applies set to the node with the given ID and those of its descendants whose payload contains
+// filter (JSONB containment, nil matches every node), e.g. to reassign the owner of a whole subtree. The update
+// is a single statement; it returns the number of updated nodes. It fails with ErrInvalidPayload, updating
+// nothing, when the updated payload of a typed node no longer matches the schema of its type.
+func (d *Daggo) UpdateSubtree(nodeID int, set Changes, filter interface{}) (int64, error) {
+	return d.UpdateSubtreeContext(context.Background(), nodeID, set, filter)
+}
+
+// UpdateSubtreeContext is UpdateSubtree with a context bounding its queries
+func (d *Daggo) UpdateSubtreeContext(ctx context.Context, nodeID int, set Changes, filter interface{}) (int64, error) {
+	if len(set.Payload) == 0 && len(set.RemoveKeys) == 0 {
+		return 0, fmt.Errorf("no changes to apply")
+	}
+
+	merge, err := json.Marshal(set.Payload)
+	if err != nil {
+		return 0, fmt.Errorf("failed to encode payload changes: %v", err)
+	}
+	if set.Payload == nil {
+		merge = []byte("{}")
+	}
+	// A NULL key array would null the whole payload
+	removeKeys := set.RemoveKeys
+	if removeKeys == nil {
+		removeKeys = []string{}
+	}
+	var payloadFilter interface{}
+	if filter != nil {
+		encoded, err := json.Marshal(filter)
+		if err != nil {
+			return 0, fmt.Errorf("failed to encode payload filter: %v", err)
+		}
+		payloadFilter = encoded
+	}
+
+	// Start a transaction
+	tx, err := d.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return 0, fmt.Errorf("failed to begin transaction: %v", err)
+	}
+	defer func() {
+		// Rollback the transaction if it failed to commit
+		if p := recover(); p != nil {
+			tx.Rollback()
+			panic(p)
+		} else if err != nil {
+			tx.Rollback()
+		}
+	}()
+
+	err = d.setTxActor(ctx, tx)
+	if err != nil {
+		return 0, err
+	}
+
+	query := `
+		WITH RECURSIVE subtree AS (
+			SELECT $1::int AS id
+			UNION
+			SELECT dag_edge.child_id FROM dag_edge JOIN subtree ON dag_edge.parent_id = subtree.id
+		)
+		UPDATE dag
+		SET payload = (payload || $2::jsonb) - $3::text[]
+		WHERE id IN (SELECT id FROM subtree) AND ($4::jsonb IS NULL OR payload @> $4::jsonb)
+	`
+	var updated int64
+	d.mu.RLock()
+	typed := len(d.nodeTypes) > 0
+	d.mu.RUnlock()
+	if typed {
+		updated, err = d.updateTypedSubtree(ctx, tx, query, nodeID, merge, pq.Array(removeKeys), payloadFilter)
+		if err != nil {
+			return 0, err
+		}
+	} else {
+		var result sql.Result
+		result, err = tx.ExecContext(ctx, query, nodeID, merge, pq.Array(removeKeys), payloadFilter)
+		if err != nil {
+			return 0, fmt.Errorf("failed to update subtree: %v", err)
+		}
+		updated, err = result.RowsAffected()
+		if err != nil {
+			return 0, fmt.Errorf("failed to count updated nodes: %v", err)
+		}
+	}
+
+	// Commit the transaction
+	err = tx.Commit()
+	if err != nil {
+		return 0, fmt.Errorf("failed to commit transaction: %v", err)
+	}
+
+	d.InvalidatePlanCache()
+
+	return updated, nil
+}
+
+// updateTypedSubtree runs the update of UpdateSubtree and validates the updated payloads of typed nodes against
+// the schema of their type, returning the number of updated nodes
+func (d *Daggo) updateTypedSubtree(ctx context.Context, tx *sqlx.Tx, query string, args ...interface{}) (int64, error) {
+	rows, err := tx.QueryxContext(ctx, query+" RETURNING id, node_type, payload", args...)
+	if err != nil {
+		return 0, fmt.Errorf("failed to update subtree: %v", err)
+	}
+	defer rows.Close()
+
+	var updated int64
+	for rows.Next() {
+		var row struct {
+			ID       int            `db:"id"`
+			NodeType sql.NullString `db:"node_type"`
+			Payload  []byte         `db:"payload"`
+		}
+		err = rows.StructScan(&row)
+		if err != nil {
+			return 0, fmt.Errorf("failed to read updated node: %v", err)
+		}
+		updated++
+
+		if row.NodeType.Valid {
+			err = d.ValidatePayload(row.NodeType.String, row.Payload)
+			if err != nil {
+				return 0, fmt.Errorf("node %d: %w", row.ID, err)
+			}
+		}
+	}
+	if err = rows.Err(); err != nil {
+		return 0, fmt.Errorf("failed to update subtree: %v", err)
+	}
+
+	return updated, nil
+}
+
+// SetNodePayload stores data, encoded as JSON, as the payload of the node with the given ID, replacing the
+// previous one. A nil data clears the payload. Payloads of typed nodes must match the schema of their type.
+func (d *Daggo) SetNodePayload(nodeID int, data interface{}) error {
+	return d.SetNodePayloadContext(context.Background(), nodeID, data)
+}
+
+// SetNodePayloadContext is SetNodePayload with a context bounding its queries
+func (d *Daggo) SetNodePayloadContext(ctx context.Context, nodeID int, data interface{}) error {
+	return d.setNodePayload(ctx, nodeID, "", data)
+}
+
+// setNodePayload stores data as the payload of nodeID, encoded by the codec of nodeType when not empty or else
+// of the graph of the node
+func (d *Daggo) setNodePayload(ctx context.Context, nodeID int, nodeType string, data interface{}) error {
+	// Payloads of typed nodes set without their type are still validated against it
+	codecType := nodeType
+	if nodeType == "" {
+		storedType, err := d.storedNodeType(ctx, nodeID)
+		if err != nil {
+			return err
+		}
+		if storedType != "" {
+			err = d.validateData(storedType, data)
+			if err != nil {
+				return err
+			}
+			codecType = storedType
+		}
+	}
+
+	codec, err := d.payloadCodec(ctx, nodeID, codecType)
+	if err != nil {
+		return err
+	}
+
+	// Start a transaction
+	tx, err := d.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %v", err)
+	}
+	defer func() {
+		// Rollback the transaction if it failed to commit
+		if p := recover(); p != nil {
+			tx.Rollback()
+			panic(p)
+		} else if err != nil {
+			tx.Rollback()
+		}
+	}()
+
+	err = d.setTxActor(ctx, tx)
+	if err != nil {
+		return err
+	}
+
+	var query string
+	var args []interface{}
+	switch {
+	case codec != nil && data != nil:
+		var encoded []byte
+		encoded, err = codec.Marshal(data)
+		if err != nil {
+			err = fmt.Errorf("failed to encode node payload with codec %s: %v", codec.Name(), err)
+			return err
+		}
+		query = "UPDATE dag SET payload = '{}', payload_bin = $2, payload_codec = $3 WHERE id = $1"
+		args = []interface{}{nodeID, encoded, codec.Name()}
+	default:
+		payload := []byte("{}")
+		if data != nil {
+			payload, err = json.Marshal(data)
+			if err != nil {
+				err = fmt.Errorf("failed to encode node payload: %v", err)
+				return err
+			}
+		}
+		query = "UPDATE dag SET payload = $2 WHERE id = $1"
+		if d.payloadCodecs {
+			// Drop the payload of another codec the node may have had
+			query = "UPDATE dag SET payload = $2, payload_bin = NULL, payload_codec = NULL WHERE id = $1"
+		}
+		args = []interface{}{nodeID, payload}
+	}
+	if nodeType != "" {
+		query = strings.Replace(query, " WHERE id = $1", fmt.Sprintf(", node_type = $%d WHERE id = $1", len(args)+1), 1)
+		args = append(args, nodeType)
+	}
+
+	result, err := tx.ExecContext(ctx, query, args...)
+	if err != nil {
+		return fmt.Errorf("failed to set node payload: %v", err)
+	}
+	updated, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to set node payload: %v", err)
+	}
+	if updated == 0 {
+		err = fmt.Errorf("%w: %d", ErrNodeNotFound, nodeID)
+		return err
+	}
+
+	// Commit the transaction
+	err = tx.Commit()
+	if err != nil {
+		return fmt.Errorf("failed to commit transaction: %v", err)
+	}
+
+	d.InvalidatePlanCache()
+
+	return nil
+}
+
+// SetTypedNodePayload is SetNodePayload for payloads of a node type registered with RegisterNodeType: data is
+// checked against its schema first and rejected with ErrInvalidPayload if it does not match. The type is recorded
+// on the node, so that its later payloads are validated too. With WithPayloadCodecs, it is encoded by the codec
+// of the type set with SetNodeTypeCodec, if any.
+func (d *Daggo) SetTypedNodePayload(nodeID int, nodeType string, data interface{}) error {
+	payload, err := json.Marshal(data)
+	if err != nil {
+		return fmt.Errorf("failed to encode node payload: %v", err)
+	}
+	err = d.ValidatePayload(nodeType, payload)
+	if err != nil {
+		return err
+	}
+
+	// Codecs encode data itself rather than its JSON
+	if d.payloadCodecs {
+		return d.setNodePayload(context.Background(), nodeID, nodeType, data)
+	}
+
+	return d.setNodePayload(context.Background(), nodeID, nodeType, json.RawMessage(payload))
+}
+
+// GetNodePayload decodes the payload of the node with the given ID into out. It returns false if the node does
+// not exist.
+func (d *Daggo) GetNodePayload(nodeID int, out interface{}) (bool, error) {
+	var row struct {
+		Payload        []byte         `db:"payload"`
+		EncodedPayload []byte         `db:"payload_bin"`
+		PayloadCodec   sql.NullString `db:"payload_codec"`
+	}
+
+	query := "SELECT payload FROM dag WHERE id = $1"
+	if d.payloadCodecs {
+		query = "SELECT payload, payload_bin, payload_codec FROM dag WHERE id = $1"
+	}
+	err := d.db.Get(&row, query, nodeID)
+	if err == sql.ErrNoRows {
+		return false, nil // Node not found
+	} else if err != nil {
+		return false, fmt.Errorf("failed to get node payload: %v", err)
+	}
+
+	err = decodePayload(row.Payload, row.EncodedPayload, row.PayloadCodec.String, out)
+	if err != nil {
+		return false, fmt.Errorf("failed to decode node payload: %v", err)
+	}
+
+	return true, nil
+}
+
+// GetNodesByPayload returns the nodes whose payload contains filter (JSONB containment), ordered by ID, e.g.
+// map[string]interface{}{"owner": "billing"}
+func (d *Daggo) GetNodesByPayload(filter interface{}, opts ...TraversalOption) ([]DagNode, error) {
+	return d.GetNodesByPayloadContext(context.Background(), filter, opts...)
+}
+
+// GetNodesByPayloadContext is GetNodesByPayload with a context bounding its queries
+func (d *Daggo) GetNodesByPayloadContext(ctx context.Context, filter interface{}, opts ...TraversalOption) ([]DagNode, error) {
+	nodes := make([]DagNode, 0)
+
+	payloadFilter, err := json.Marshal(filter)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode payload filter: %v", err)
+	}
+
+	query := "SELECT * FROM dag WHERE payload @> $1 ORDER BY id ASC"
+	err = d.reader(ctx, newTraversalOptions(opts).consistency).SelectContext(ctx, &nodes, query, payloadFilter)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get nodes by payload: %v", err)
+	}
+
+	return nodes, nil
+}
+
+// Node is a DagNode with its payload decoded into a T
+type Node[T any] struct {
+	DagNode
+	Data T
+}
+
+// DecodeNode decodes the payload of node into a T, with the codec that encoded it
+func DecodeNode[T any](node DagNode) (*Node[T], error) {
+	typed := &Node[T]{DagNode: node}
+	if len(node.Payload) == 0 && !node.PayloadCodec.Valid {
+		return typed, nil
+	}
+
+	err := decodePayload(node.Payload, node.EncodedPayload, node.PayloadCodec.String, &typed.Data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode payload of node %d: %v", node.ID, err)
+	}
+
+	return typed, nil
+}
+
+// DecodeNodes decodes the payloads of nodes, keeping their order
+func DecodeNodes[T any](nodes []DagNode) ([]Node[T], error) {
+	typed := make([]Node[T], 0, len(nodes))
+	for _, node := range nodes {
+		decoded, err := DecodeNode[T](node)
+		if err != nil {
+			return nil, err
+		}
+		typed = append(typed, *decoded)
+	}
+
+	return typed, nil
+}
+
+// GetTypedNode returns the node with the given ID with its payload decoded into a T, or nil if it does not exist
+func GetTypedNode[T any](d *Daggo, nodeID int) (*Node[T], error) {
+	node, err := d.GetNodeByID(nodeID)
+	if err != nil || node == nil {
+		return nil, err
+	}
+
+	return DecodeNode[T](*node)
+}
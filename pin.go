@@ -0,0 +1,85 @@
+package daggo
+
+import (
+	"fmt"
+	"time"
+)
+
+// PinnedNode is a node a principal pinned for quick access
+type PinnedNode struct {
+	Principal string    `db:"principal"`
+	NodeID    int       `db:"node_id"`
+	PinnedAt  time.Time `db:"pinned_at"`
+}
+
+const createPinTableQuery = `
+	CREATE TABLE IF NOT EXISTS dag_pin (
+		principal TEXT NOT NULL,
+		node_id INTEGER NOT NULL,
+		pinned_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+		PRIMARY KEY (principal, node_id)
+	);
+`
+
+// CreatePinTable creates the side table used to store pinned nodes
+func (d *Daggo) CreatePinTable() error {
+	_, err := d.db.Exec(createPinTableQuery)
+	if err != nil {
+		return fmt.Errorf("failed to create pin table: %v", err)
+	}
+
+	return nil
+}
+
+// PinNode pins the node with the given ID for principal; pinning an already pinned node is a no-op
+func (d *Daggo) PinNode(principal string, nodeID int) error {
+	if principal == "" {
+		return fmt.Errorf("principal cannot be empty")
+	}
+
+	// Check that the node being pinned exists
+	node, err := d.GetNodeByID(nodeID)
+	if err != nil {
+		return err
+	}
+	if node == nil {
+		return fmt.Errorf("%w: %d", ErrNodeNotFound, nodeID)
+	}
+
+	query := "INSERT INTO dag_pin (principal, node_id) VALUES ($1, $2) ON CONFLICT DO NOTHING"
+	_, err = d.db.Exec(query, principal, nodeID)
+	if err != nil {
+		return fmt.Errorf("failed to pin node: %v", err)
+	}
+
+	return nil
+}
+
+// UnpinNode removes the pin principal set on the node with the given ID
+func (d *Daggo) UnpinNode(principal string, nodeID int) error {
+	_, err := d.db.Exec("DELETE FROM dag_pin WHERE principal = $1 AND node_id = $2", principal, nodeID)
+	if err != nil {
+		return fmt.Errorf("failed to unpin node: %v", err)
+	}
+
+	return nil
+}
+
+// ListPinned returns the nodes pinned by principal, most recently pinned first. Pins of deleted nodes are skipped.
+func (d *Daggo) ListPinned(principal string) ([]DagNode, error) {
+	nodes := make([]DagNode, 0)
+
+	query := `
+		SELECT dag.*
+		FROM dag_pin p
+		JOIN dag ON dag.id = p.node_id
+		WHERE p.principal = $1
+		ORDER BY p.pinned_at DESC, dag.id ASC
+	`
+	err := d.db.Select(&nodes, query, principal)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list pinned nodes: %v", err)
+	}
+
+	return nodes, nil
+}
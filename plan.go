@@ -0,0 +1,139 @@
+package daggo
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// TraversalPlan is a traversal shape registered under a name so that its statement is prepared once and its
+// results can be cached
+type TraversalPlan struct {
+	Name      string
+	Direction Direction
+	// MaxResults caps the nodes returned per run, like WithMaxResults; zero means unlimited
+	MaxResults int
+	// CacheTTL keeps results for that long; zero disables result caching
+	CacheTTL time.Duration
+}
+
+// preparedPlan is a registered plan with its prepared statement and result cache
+type preparedPlan struct {
+	TraversalPlan
+	stmt *sqlx.Stmt
+
+	mu    sync.Mutex
+	cache map[int]cachedResult
+}
+
+type cachedResult struct {
+	nodes      []DagNode
+	err        error
+	generation uint64
+	expires    time.Time
+}
+
+// RegisterPlan prepares a named traversal plan, replacing any plan registered under the same name
+func (d *Daggo) RegisterPlan(plan TraversalPlan) error {
+	if plan.Name == "" {
+		return fmt.Errorf("plan name cannot be empty")
+	}
+	if plan.Direction == Both {
+		return fmt.Errorf("plan %q: a plan traverses a single direction", plan.Name)
+	}
+	step, err := d.traversalStep(plan.Direction)
+	if err != nil {
+		return err
+	}
+
+	stmt, err := d.db.Preparex(paginate(recursiveTraversalQuery(step)))
+	if err != nil {
+		return fmt.Errorf("failed to prepare plan %q: %v", plan.Name, err)
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.plans == nil {
+		d.plans = make(map[string]*preparedPlan)
+	}
+	if old, ok := d.plans[plan.Name]; ok {
+		old.stmt.Close()
+	}
+	d.plans[plan.Name] = &preparedPlan{TraversalPlan: plan, stmt: stmt, cache: make(map[int]cachedResult)}
+
+	return nil
+}
+
+// UnregisterPlan drops a named plan and its cached results
+func (d *Daggo) UnregisterPlan(name string) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	plan, ok := d.plans[name]
+	if !ok {
+		return fmt.Errorf("unknown plan %q", name)
+	}
+	delete(d.plans, name)
+
+	return plan.stmt.Close()
+}
+
+// Plans returns the registered plans ordered by name
+func (d *Daggo) Plans() []TraversalPlan {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	plans := make([]TraversalPlan, 0, len(d.plans))
+	for _, plan := range d.plans {
+		plans = append(plans, plan.TraversalPlan)
+	}
+	sort.Slice(plans, func(i, j int) bool { return plans[i].Name < plans[j].Name })
+
+	return plans
+}
+
+// RunPlan runs a named plan from the given node. Cached results are served until they expire or until the
+// graph is written through this Daggo; writes made elsewhere must be followed by InvalidatePlanCache.
+func (d *Daggo) RunPlan(name string, nodeID int) ([]DagNode, error) {
+	d.mu.RLock()
+	plan, ok := d.plans[name]
+	d.mu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("unknown plan %q", name)
+	}
+
+	generation := d.planGeneration.Load()
+	if plan.CacheTTL > 0 {
+		plan.mu.Lock()
+		cached, ok := plan.cache[nodeID]
+		plan.mu.Unlock()
+		if ok && cached.generation == generation && time.Now().Before(cached.expires) {
+			return append([]DagNode(nil), cached.nodes...), cached.err
+		}
+	}
+
+	nodes := make([]DagNode, 0)
+	options := traversalOptions{maxResults: plan.MaxResults}
+	cursor, limit := options.args()
+	err := plan.stmt.Select(&nodes, nodeID, cursor, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to run plan %q from node %d: %v", name, nodeID, err)
+	}
+	nodes, err = options.truncate(nodes)
+
+	if plan.CacheTTL > 0 {
+		plan.mu.Lock()
+		plan.cache[nodeID] = cachedResult{nodes: nodes, err: err, generation: generation, expires: time.Now().Add(plan.CacheTTL)}
+		plan.mu.Unlock()
+	}
+
+	return append([]DagNode(nil), nodes...), err
+}
+
+// InvalidatePlanCache discards the cached results of every plan
+func (d *Daggo) InvalidatePlanCache() {
+	d.planGeneration.Add(1)
+}
@@ -0,0 +1,68 @@
+package daggo
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+)
+
+const createClaimTableQuery = `
+	CREATE TABLE IF NOT EXISTS dag_claim (
+		node_id INTEGER PRIMARY KEY,
+		claimed_by TEXT,
+		claimed_at TIMESTAMPTZ NOT NULL DEFAULT now()
+	);
+`
+
+// CreateClaimTable creates the side table recording which children were claimed by DequeueChild
+func (d *Daggo) CreateClaimTable() error {
+	_, err := d.db.Exec(createClaimTableQuery)
+	if err != nil {
+		return fmt.Errorf("failed to create claim table: %v", err)
+	}
+
+	return nil
+}
+
+// DequeueChild atomically claims and returns the oldest unclaimed child of parentID, so that a parent can act
+// as a work queue shared by several consumers. Children locked by a concurrent DequeueChild are skipped rather
+// than waited for. It returns nil when no child is left to claim. Age is taken from the created_at column added
+// by CreateTimestampColumns.
+func (d *Daggo) DequeueChild(parentID int) (*DagNode, error) {
+	var node DagNode
+
+	query := `
+		WITH next AS (
+			SELECT dag.id
+			FROM dag
+			WHERE dag.parent_id = $1 AND NOT EXISTS (SELECT 1 FROM dag_claim c WHERE c.node_id = dag.id)
+			ORDER BY dag.created_at ASC, dag.id ASC
+			LIMIT 1
+			FOR UPDATE OF dag SKIP LOCKED
+		), claimed AS (
+			INSERT INTO dag_claim (node_id, claimed_by)
+			SELECT id, nullif($2, '') FROM next
+			ON CONFLICT DO NOTHING
+			RETURNING node_id
+		)
+		SELECT dag.* FROM dag JOIN claimed ON dag.id = claimed.node_id
+	`
+	err := d.db.Get(&node, query, parentID, d.actor(context.Background()))
+	if err == sql.ErrNoRows {
+		return nil, nil // The queue is empty
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to dequeue child of node %d: %v", parentID, err)
+	}
+
+	return &node, nil
+}
+
+// ReleaseChild returns a claimed child to its parent's queue
+func (d *Daggo) ReleaseChild(nodeID int) error {
+	_, err := d.db.Exec("DELETE FROM dag_claim WHERE node_id = $1", nodeID)
+	if err != nil {
+		return fmt.Errorf("failed to release node %d: %v", nodeID, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,323 @@
+package daggo
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// ErrQuotaExceeded is returned by inserts that would exceed a graph or tenant quota
+var ErrQuotaExceeded = errors.New("quota exceeded")
+
+// Quota scopes
+const (
+	QuotaScopeGraph  = "graph"
+	QuotaScopeTenant = "tenant"
+)
+
+// Usage reports how much of the database a graph or tenant occupies
+type Usage struct {
+	GraphCount   int64 `db:"graph_count"`
+	NodeCount    int64 `db:"node_count"`
+	StorageBytes int64 `db:"storage_bytes"`
+}
+
+// Quota limits the size of a graph or of all graphs owned by a tenant; zero means unlimited
+type Quota struct {
+	Scope    string `db:"scope"`
+	ScopeID  string `db:"scope_id"`
+	MaxNodes int64  `db:"max_nodes"`
+	MaxBytes int64  `db:"max_bytes"`
+}
+
+// dag_usage keeps the node count and storage of every graph up to date, so quota checks need not scan the graph.
+// Statement triggers apply the changes of a whole statement at once; rebuilding the counters locks out writers.
+const createQuotaTableQuery = `
+	CREATE TABLE IF NOT EXISTS dag_quota (
+		scope TEXT NOT NULL,
+		scope_id TEXT NOT NULL,
+		max_nodes BIGINT NOT NULL DEFAULT 0,
+		max_bytes BIGINT NOT NULL DEFAULT 0,
+		PRIMARY KEY (scope, scope_id)
+	);
+
+	CREATE TABLE IF NOT EXISTS dag_usage (
+		root_id INTEGER PRIMARY KEY,
+		node_count BIGINT NOT NULL DEFAULT 0,
+		storage_bytes BIGINT NOT NULL DEFAULT 0
+	);
+
+	CREATE OR REPLACE FUNCTION dag_usage_count() RETURNS trigger AS $$
+	BEGIN
+		IF TG_OP = 'TRUNCATE' THEN
+			DELETE FROM dag_usage;
+			RETURN NULL;
+		END IF;
+		IF TG_OP IN ('UPDATE', 'DELETE') THEN
+			INSERT INTO dag_usage AS u (root_id, node_count, storage_bytes)
+			SELECT root_id, -count(*), -sum(pg_column_size(o.*)) FROM old_rows o GROUP BY root_id
+			ON CONFLICT (root_id) DO UPDATE
+			SET node_count = u.node_count + EXCLUDED.node_count, storage_bytes = u.storage_bytes + EXCLUDED.storage_bytes;
+		END IF;
+		IF TG_OP IN ('INSERT', 'UPDATE') THEN
+			INSERT INTO dag_usage AS u (root_id, node_count, storage_bytes)
+			SELECT root_id, count(*), sum(pg_column_size(n.*)) FROM new_rows n GROUP BY root_id
+			ON CONFLICT (root_id) DO UPDATE
+			SET node_count = u.node_count + EXCLUDED.node_count, storage_bytes = u.storage_bytes + EXCLUDED.storage_bytes;
+		END IF;
+		IF TG_OP IN ('UPDATE', 'DELETE') THEN
+			DELETE FROM dag_usage WHERE root_id IN (SELECT root_id FROM old_rows) AND node_count = 0;
+		END IF;
+		RETURN NULL;
+	END;
+	$$ LANGUAGE plpgsql;
+
+	LOCK TABLE dag IN SHARE MODE;
+	DELETE FROM dag_usage;
+	INSERT INTO dag_usage (root_id, node_count, storage_bytes)
+	SELECT root_id, count(*), sum(pg_column_size(dag.*)) FROM dag GROUP BY root_id;
+
+	DROP TRIGGER IF EXISTS dag_usage_insert_trigger ON dag;
+	CREATE TRIGGER dag_usage_insert_trigger
+		AFTER INSERT ON dag REFERENCING NEW TABLE AS new_rows
+		FOR EACH STATEMENT EXECUTE FUNCTION dag_usage_count();
+	DROP TRIGGER IF EXISTS dag_usage_update_trigger ON dag;
+	CREATE TRIGGER dag_usage_update_trigger
+		AFTER UPDATE ON dag REFERENCING OLD TABLE AS old_rows NEW TABLE AS new_rows
+		FOR EACH STATEMENT EXECUTE FUNCTION dag_usage_count();
+	DROP TRIGGER IF EXISTS dag_usage_delete_trigger ON dag;
+	CREATE TRIGGER dag_usage_delete_trigger
+		AFTER DELETE ON dag REFERENCING OLD TABLE AS old_rows
+		FOR EACH STATEMENT EXECUTE FUNCTION dag_usage_count();
+	DROP TRIGGER IF EXISTS dag_usage_truncate_trigger ON dag;
+	CREATE TRIGGER dag_usage_truncate_trigger
+		AFTER TRUNCATE ON dag
+		FOR EACH STATEMENT EXECUTE FUNCTION dag_usage_count();
+`
+
+// CreateQuotaTable creates the side table used to store quotas, and the usage counters of the graphs maintained by
+// triggers that the quota checks read. Running it again rebuilds the counters.
+func (d *Daggo) CreateQuotaTable() error {
+	_, err := d.db.Exec(createQuotaTableQuery)
+	if err != nil {
+		return fmt.Errorf("failed to create quota table: %v", err)
+	}
+
+	return nil
+}
+
+// quotaTables tells which of the tables read by quota checks exist, checked up front as a failed query would
+// abort the transaction of the insert
+type quotaTables struct {
+	Quota bool `db:"quota"`
+	Graph bool `db:"graph"`
+	Usage bool `db:"usage"`
+}
+
+// getQuotaTables returns the quota tables that exist
+func getQuotaTables(ctx context.Context, q sqlx.QueryerContext) (*quotaTables, error) {
+	var tables quotaTables
+
+	query := `
+		SELECT to_regclass('dag_quota') IS NOT NULL AS quota,
+			to_regclass('dag_graph') IS NOT NULL AS graph,
+			to_regclass('dag_usage') IS NOT NULL AS usage
+	`
+	err := sqlx.GetContext(ctx, q, &tables, query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check quota tables: %v", err)
+	}
+
+	return &tables, nil
+}
+
+// Usage returns the node count and storage bytes of the graph rooted at graphID
+func (d *Daggo) Usage(graphID int) (*Usage, error) {
+	ctx := context.Background()
+	tables, err := getQuotaTables(ctx, d.db)
+	if err != nil {
+		return nil, err
+	}
+	return graphUsage(ctx, d.db, graphID, tables.Usage)
+}
+
+// graphUsage is Usage run on q, e.g. the transaction of an insert, reading the usage counters when counted is set
+// and scanning the graph otherwise
+func graphUsage(ctx context.Context, q sqlx.QueryerContext, graphID int, counted bool) (*Usage, error) {
+	var usage Usage
+
+	query := `
+		SELECT 1 AS graph_count, count(*) AS node_count, COALESCE(sum(pg_column_size(dag.*)), 0) AS storage_bytes
+		FROM dag
+		WHERE root_id = $1
+	`
+	if counted {
+		query = `
+			SELECT 1 AS graph_count, COALESCE(sum(node_count), 0) AS node_count,
+				COALESCE(sum(storage_bytes), 0) AS storage_bytes
+			FROM dag_usage
+			WHERE root_id = $1
+		`
+	}
+	err := sqlx.GetContext(ctx, q, &usage, query, graphID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get usage: %v", err)
+	}
+
+	return &usage, nil
+}
+
+// TenantUsage returns the aggregated usage of all registered graphs owned by the given tenant
+func (d *Daggo) TenantUsage(tenant string) (*Usage, error) {
+	ctx := context.Background()
+	tables, err := getQuotaTables(ctx, d.db)
+	if err != nil {
+		return nil, err
+	}
+	return tenantUsage(ctx, d.db, tenant, tables.Usage)
+}
+
+// tenantUsage is TenantUsage run on q, reading the usage counters when counted is set
+func tenantUsage(ctx context.Context, q sqlx.QueryerContext, tenant string, counted bool) (*Usage, error) {
+	var usage Usage
+
+	query := `
+		SELECT count(DISTINCT g.root_id) AS graph_count,
+			count(dag.root_id) AS node_count,
+			COALESCE(sum(pg_column_size(dag.*)), 0) AS storage_bytes
+		FROM dag_graph g
+		LEFT JOIN dag ON dag.root_id = g.root_id
+		WHERE g.owner = $1
+	`
+	if counted {
+		query = `
+			SELECT count(g.root_id) AS graph_count,
+				COALESCE(sum(u.node_count), 0) AS node_count,
+				COALESCE(sum(u.storage_bytes), 0) AS storage_bytes
+			FROM dag_graph g
+			LEFT JOIN dag_usage u ON u.root_id = g.root_id
+			WHERE g.owner = $1
+		`
+	}
+	err := sqlx.GetContext(ctx, q, &usage, query, tenant)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get tenant usage: %v", err)
+	}
+
+	return &usage, nil
+}
+
+// SetQuota creates or replaces the quota for the given scope
+func (d *Daggo) SetQuota(quota Quota) error {
+	if quota.Scope != QuotaScopeGraph && quota.Scope != QuotaScopeTenant {
+		return fmt.Errorf("unknown quota scope %q", quota.Scope)
+	}
+	if quota.MaxNodes < 0 || quota.MaxBytes < 0 {
+		return fmt.Errorf("quota limits cannot be negative")
+	}
+
+	query := `
+		INSERT INTO dag_quota (scope, scope_id, max_nodes, max_bytes)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT (scope, scope_id) DO UPDATE SET max_nodes = EXCLUDED.max_nodes, max_bytes = EXCLUDED.max_bytes
+	`
+	_, err := d.db.Exec(query, quota.Scope, quota.ScopeID, quota.MaxNodes, quota.MaxBytes)
+	if err != nil {
+		return fmt.Errorf("failed to set quota: %v", err)
+	}
+
+	return nil
+}
+
+// GetQuota returns the quota for the given scope, or nil if none is configured
+func (d *Daggo) GetQuota(scope string, scopeID string) (*Quota, error) {
+	return getQuota(context.Background(), d.db, scope, scopeID, false)
+}
+
+// getQuota is GetQuota run on q, locking the quota until the end of the transaction when forUpdate is set
+func getQuota(ctx context.Context, q sqlx.QueryerContext, scope string, scopeID string, forUpdate bool) (*Quota, error) {
+	var quota Quota
+
+	query := "SELECT * FROM dag_quota WHERE scope = $1 AND scope_id = $2"
+	if forUpdate {
+		query += " FOR UPDATE"
+	}
+	err := sqlx.GetContext(ctx, q, &quota, query, scope, scopeID)
+	if err == sql.ErrNoRows {
+		return nil, nil // No quota configured
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to get quota: %v", err)
+	}
+
+	return &quota, nil
+}
+
+// checkQuota returns ErrQuotaExceeded if adding newNodes nodes to the graph rooted at rootID
+// would exceed the graph quota or the quota of the tenant owning the graph. It reads through q, the transaction
+// of the insert, as the only connection of a Daggo from WithTx is held by that transaction. The quotas are locked
+// until the transaction ends, so that concurrent inserts are checked one after the other and each sees the nodes
+// the others added. Without the quota table there are no quotas, and without the graph table no tenant quotas.
+func checkQuota(ctx context.Context, q sqlx.QueryerContext, rootID int, newNodes int64) error {
+	tables, err := getQuotaTables(ctx, q)
+	if err != nil {
+		return err
+	}
+	if !tables.Quota {
+		return nil
+	}
+
+	graphQuota, err := getQuota(ctx, q, QuotaScopeGraph, fmt.Sprint(rootID), true)
+	if err != nil {
+		return err
+	}
+	if graphQuota != nil {
+		usage, err := graphUsage(ctx, q, rootID, tables.Usage)
+		if err != nil {
+			return err
+		}
+		if exceeds(graphQuota, usage, newNodes) {
+			return fmt.Errorf("graph %d: %w", rootID, ErrQuotaExceeded)
+		}
+	}
+
+	if !tables.Graph {
+		return nil
+	}
+	var owners []string
+	err = sqlx.SelectContext(ctx, q, &owners, "SELECT owner FROM dag_graph WHERE root_id = $1", rootID)
+	if err != nil {
+		return fmt.Errorf("failed to get graph: %v", err)
+	}
+	if len(owners) == 0 || owners[0] == "" {
+		return nil // Unregistered graphs and graphs without owner have no tenant quota
+	}
+	owner := owners[0]
+	tenantQuota, err := getQuota(ctx, q, QuotaScopeTenant, owner, true)
+	if err != nil {
+		return err
+	}
+	if tenantQuota != nil {
+		usage, err := tenantUsage(ctx, q, owner, tables.Usage)
+		if err != nil {
+			return err
+		}
+		if exceeds(tenantQuota, usage, newNodes) {
+			return fmt.Errorf("tenant %s: %w", owner, ErrQuotaExceeded)
+		}
+	}
+
+	return nil
+}
+
+func exceeds(quota *Quota, usage *Usage, newNodes int64) bool {
+	if quota.MaxNodes > 0 && usage.NodeCount+newNodes > quota.MaxNodes {
+		return true
+	}
+	if quota.MaxBytes > 0 && usage.StorageBytes > quota.MaxBytes {
+		return true
+	}
+	return false
+}
@@ -0,0 +1,242 @@
+package daggo
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ChangeEvent is a row change on one of the dag tables decoded from the Postgres write-ahead log
+type ChangeEvent struct {
+	LSN   string
+	Table string
+	// Op is INSERT, UPDATE or DELETE
+	Op string
+	// NodeID is the id column of the changed row, or 0 when the table has none
+	NodeID int
+	// Columns holds the raw text value of each column present in the change; NULL values are absent
+	Columns map[string]string
+}
+
+// ReplicationListener consumes a logical replication slot for the dag tables and emits ChangeEvents, so caches
+// and subscribers stay correct even when other services write to the tables directly. It uses the built-in
+// test_decoding output plugin and requires wal_level=logical on the server.
+type ReplicationListener struct {
+	d            *Daggo
+	slot         string
+	pollInterval time.Duration
+	batchSize    int
+}
+
+// NewReplicationListener returns a listener reading from the named replication slot every pollInterval
+func (d *Daggo) NewReplicationListener(slot string, pollInterval time.Duration) *ReplicationListener {
+	return &ReplicationListener{d: d, slot: slot, pollInterval: pollInterval, batchSize: 1000}
+}
+
+// CreateSlot creates the logical replication slot if it does not exist yet
+func (l *ReplicationListener) CreateSlot() error {
+	query := `
+		SELECT pg_create_logical_replication_slot($1, 'test_decoding')
+		WHERE NOT EXISTS (SELECT 1 FROM pg_replication_slots WHERE slot_name = $1)
+	`
+	_, err := l.d.db.Exec(query, l.slot)
+	if err != nil {
+		return fmt.Errorf("failed to create replication slot: %v", err)
+	}
+
+	return nil
+}
+
+// DropSlot drops the logical replication slot so the server stops retaining WAL for it
+func (l *ReplicationListener) DropSlot() error {
+	_, err := l.d.db.Exec("SELECT pg_drop_replication_slot($1)", l.slot)
+	if err != nil {
+		return fmt.Errorf("failed to drop replication slot: %v", err)
+	}
+
+	return nil
+}
+
+// Listen polls the slot until ctx is cancelled, sending decoded changes on the returned channel.
+// Changes are peeked from the slot and only consumed once every change of their batch has been received, so
+// changes are delivered at least once: a listener stopped mid-batch delivers the rest of the batch again, from
+// its first change, when it listens again. Errors are sent on the error channel; both channels are closed when
+// listening stops.
+func (l *ReplicationListener) Listen(ctx context.Context) (<-chan ChangeEvent, <-chan error) {
+	events := make(chan ChangeEvent)
+	errs := make(chan error, 1)
+
+	go func() {
+		defer close(events)
+		defer close(errs)
+
+		ticker := time.NewTicker(l.pollInterval)
+		defer ticker.Stop()
+		for {
+			changes, upto, err := l.poll(ctx)
+			if err != nil {
+				errs <- err
+				return
+			}
+			for _, change := range changes {
+				select {
+				case events <- change:
+				case <-ctx.Done():
+					return
+				}
+			}
+			if upto != "" {
+				err = l.advance(ctx, upto)
+				if err != nil {
+					if ctx.Err() == nil {
+						errs <- err
+					}
+					return
+				}
+			}
+
+			select {
+			case <-ticker.C:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	return events, errs
+}
+
+// poll peeks at the next batch of changes of the slot without consuming it, and returns the LSN up to which
+// the slot is to be advanced once they are delivered, or an empty string when there is nothing to consume.
+// Batches end with a commit, whose LSN is the end of the commit record.
+func (l *ReplicationListener) poll(ctx context.Context) ([]ChangeEvent, string, error) {
+	rows, err := l.d.db.QueryxContext(ctx,
+		"SELECT lsn::text, data FROM pg_logical_slot_peek_changes($1, NULL, $2)", l.slot, l.batchSize)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to read replication slot: %v", err)
+	}
+	defer rows.Close()
+
+	changes := make([]ChangeEvent, 0)
+	upto := ""
+	for rows.Next() {
+		var lsn, data string
+		err = rows.Scan(&lsn, &data)
+		if err != nil {
+			return nil, "", fmt.Errorf("failed to read replication slot: %v", err)
+		}
+		// Transactions without dag changes are consumed too, so that they do not hold the slot back
+		if strings.HasPrefix(data, "COMMIT") {
+			upto = lsn
+		}
+
+		change, ok := parseTestDecoding(data)
+		if !ok || !strings.HasPrefix(change.Table, "dag") {
+			continue
+		}
+		change.LSN = lsn
+		changes = append(changes, change)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, "", fmt.Errorf("failed to read replication slot: %v", err)
+	}
+
+	return changes, upto, nil
+}
+
+// advance consumes the changes of the slot up to the given LSN, once they have been delivered
+func (l *ReplicationListener) advance(ctx context.Context, upto string) error {
+	_, err := l.d.db.ExecContext(ctx, "SELECT pg_replication_slot_advance($1, $2::pg_lsn)", l.slot, upto)
+	if err != nil {
+		return fmt.Errorf("failed to advance replication slot: %v", err)
+	}
+
+	return nil
+}
+
+// parseTestDecoding parses a test_decoding line such as
+//
+//	table public.dag: INSERT: id[integer]:2 parent_id[integer]:1 root_id[integer]:1
+//
+// BEGIN and COMMIT lines are reported as not ok.
+func parseTestDecoding(data string) (ChangeEvent, bool) {
+	if !strings.HasPrefix(data, "table ") {
+		return ChangeEvent{}, false
+	}
+
+	parts := strings.SplitN(strings.TrimPrefix(data, "table "), ": ", 3)
+	if len(parts) < 2 {
+		return ChangeEvent{}, false
+	}
+
+	table := parts[0]
+	if i := strings.LastIndex(table, "."); i >= 0 {
+		table = table[i+1:]
+	}
+	change := ChangeEvent{Table: table, Op: strings.TrimSuffix(parts[1], ":"), Columns: make(map[string]string)}
+	if len(parts) < 3 {
+		return change, true
+	}
+
+	rest := parts[2]
+	for len(rest) > 0 {
+		rest = strings.TrimLeft(rest, " ")
+
+		// Column name up to the type in brackets
+		open := strings.IndexByte(rest, '[')
+		if open < 0 {
+			break
+		}
+		name := rest[:open]
+		closing := strings.Index(rest[open:], "]:")
+		if closing < 0 {
+			break
+		}
+		rest = rest[open+closing+2:]
+
+		// Quoted values may contain spaces and escape quotes by doubling them
+		var value string
+		if strings.HasPrefix(rest, "'") {
+			var b strings.Builder
+			i := 1
+			for i < len(rest) {
+				if rest[i] == '\'' {
+					if i+1 < len(rest) && rest[i+1] == '\'' {
+						b.WriteByte('\'')
+						i += 2
+						continue
+					}
+					break
+				}
+				b.WriteByte(rest[i])
+				i++
+			}
+			value = b.String()
+			if i < len(rest) {
+				i++
+			}
+			rest = rest[i:]
+		} else {
+			end := strings.IndexByte(rest, ' ')
+			if end < 0 {
+				end = len(rest)
+			}
+			value = rest[:end]
+			rest = rest[end:]
+			if value == "null" {
+				continue
+			}
+		}
+		change.Columns[name] = value
+	}
+
+	if id, ok := change.Columns["id"]; ok {
+		change.NodeID, _ = strconv.Atoi(id)
+	} else if id, ok := change.Columns["node_id"]; ok {
+		change.NodeID, _ = strconv.Atoi(id)
+	}
+
+	return change, true
+}
@@ -0,0 +1,209 @@
+package daggo
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// ReplaceParents atomically replaces the parent set of a node. The first new parent becomes its primary parent;
+// an empty set turns the node into a root. All parents must belong to the same graph, which the node and its
+// descendants join; descendants that also have parents outside of the subtree keep it from changing graph. The
+// whole change is validated for cycles once, before any edge is rewritten, and fails with ErrCycleDetected when
+// a new parent is a descendant of the node.
+func (d *Daggo) ReplaceParents(childID int, newParentIDs []int) error {
+	return d.ReplaceParentsContext(context.Background(), childID, newParentIDs)
+}
+
+// ReplaceParentsContext is ReplaceParents with a context bounding its queries
+func (d *Daggo) ReplaceParentsContext(ctx context.Context, childID int, newParentIDs []int) error {
+	_, err := d.replaceParents(ctx, childID, newParentIDs)
+	return err
+}
+
+// replaceParents replaces the parents of childID and counts the moved nodes
+func (d *Daggo) replaceParents(ctx context.Context, childID int, newParentIDs []int) (*MutationResult, error) {
+	start := time.Now()
+
+	seen := make(map[int]bool, len(newParentIDs))
+	for _, parentID := range newParentIDs {
+		if parentID == childID {
+			return nil, fmt.Errorf("%w: node %d", ErrSelfEdge, childID)
+		}
+		if seen[parentID] {
+			return nil, fmt.Errorf("%w: from %d to %d", ErrDuplicateEdge, parentID, childID)
+		}
+		seen[parentID] = true
+	}
+
+	tx, err := d.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %v", err)
+	}
+	defer func() {
+		// Rollback the transaction if it failed to commit
+		if p := recover(); p != nil {
+			tx.Rollback()
+			panic(p)
+		} else if err != nil {
+			tx.Rollback()
+		}
+	}()
+
+	err = d.setTxActor(ctx, tx)
+	if err != nil {
+		return nil, err
+	}
+
+	var oldRootID int
+	err = tx.GetContext(ctx, &oldRootID, "SELECT root_id FROM dag WHERE id = $1 FOR UPDATE", childID)
+	if err == sql.ErrNoRows {
+		err = fmt.Errorf("%w: %d", ErrNodeNotFound, childID)
+		return nil, err
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to lock node: %v", err)
+	}
+
+	missing := make([]int, 0)
+	err = tx.SelectContext(ctx, &missing, `
+		SELECT p.id
+		FROM unnest($1::int[]) AS p(id)
+		WHERE NOT EXISTS (SELECT 1 FROM dag WHERE dag.id = p.id)
+	`, pq.Array(newParentIDs))
+	if err != nil {
+		return nil, fmt.Errorf("failed to validate new parents: %v", err)
+	}
+	if len(missing) > 0 {
+		err = fmt.Errorf("%w: cannot make %v parents of node %d", ErrParentNotFound, missing, childID)
+		return nil, err
+	}
+
+	// Parents lying in the subtree of the child would make it its own ancestor
+	cyclic := make([]int, 0)
+	err = tx.SelectContext(ctx, &cyclic, `
+		WITH RECURSIVE subtree AS (
+			SELECT $1::int AS id
+			UNION
+			SELECT dag_edge.child_id FROM dag_edge JOIN subtree ON dag_edge.parent_id = subtree.id
+		)
+		SELECT p.id
+		FROM unnest($2::int[]) AS p(id)
+		WHERE p.id IN (SELECT id FROM subtree)
+	`, childID, pq.Array(newParentIDs))
+	if err != nil {
+		return nil, fmt.Errorf("failed to check for cycles: %v", err)
+	}
+	if len(cyclic) > 0 {
+		err = fmt.Errorf("%w: cannot make %v parents of node %d", ErrCycleDetected, cyclic, childID)
+		return nil, err
+	}
+
+	rootID := childID
+	var primary sql.NullInt64
+	if len(newParentIDs) > 0 {
+		rootIDs := make([]int, 0)
+		err = tx.SelectContext(ctx, &rootIDs, "SELECT DISTINCT root_id FROM dag WHERE id = ANY($1)", pq.Array(newParentIDs))
+		if err != nil {
+			return nil, fmt.Errorf("failed to get graphs of new parents: %v", err)
+		}
+		if len(rootIDs) != 1 {
+			err = fmt.Errorf("new parents of node %d belong to different graphs", childID)
+			return nil, err
+		}
+		rootID = rootIDs[0]
+		primary = sql.NullInt64{Int64: int64(newParentIDs[0]), Valid: true}
+	}
+
+	// A subtree changing graph must not take along nodes that other nodes of the old graph still point to
+	if rootID != oldRootID {
+		shared := make([]int, 0)
+		err = tx.SelectContext(ctx, &shared, `
+			WITH RECURSIVE subtree AS (
+				SELECT $1::int AS id
+				UNION
+				SELECT dag_edge.child_id FROM dag_edge JOIN subtree ON dag_edge.parent_id = subtree.id
+			)
+			SELECT DISTINCT dag_edge.child_id
+			FROM dag_edge
+			WHERE dag_edge.child_id IN (SELECT id FROM subtree)
+				AND dag_edge.child_id <> $1
+				AND dag_edge.parent_id NOT IN (SELECT id FROM subtree)
+			ORDER BY dag_edge.child_id
+		`, childID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to check for shared descendants: %v", err)
+		}
+		if len(shared) > 0 {
+			err = fmt.Errorf("cannot move node %d to graph %d: descendants %v have parents outside of its subtree", childID, rootID, shared)
+			return nil, err
+		}
+	}
+
+	// The primary parent is updated first since the trigger mirroring it drops the edge to the old one
+	_, err = tx.ExecContext(ctx, "UPDATE dag SET parent_id = $2 WHERE id = $1", childID, primary)
+	if err != nil {
+		return nil, fmt.Errorf("failed to update primary parent: %v", err)
+	}
+	_, err = tx.ExecContext(ctx, "DELETE FROM dag_edge WHERE child_id = $1", childID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to remove old parents: %v", err)
+	}
+	_, err = tx.ExecContext(ctx, "INSERT INTO dag_edge (parent_id, child_id) SELECT unnest($2::int[]), $1", childID, pq.Array(newParentIDs))
+	if err != nil {
+		return nil, fmt.Errorf("failed to add new parents: %w", edgeError(err, 0, childID))
+	}
+
+	// Propagate the graph of the new parents to the node and its descendants, which all count as moved
+	var moved int64
+	err = tx.GetContext(ctx, &moved, `
+		WITH RECURSIVE subtree AS (
+			SELECT $1::int AS id
+			UNION
+			SELECT dag_edge.child_id FROM dag_edge JOIN subtree ON dag_edge.parent_id = subtree.id
+		),
+		updated AS (
+			UPDATE dag SET root_id = $2 WHERE id IN (SELECT id FROM subtree) AND root_id <> $2
+		)
+		SELECT count(*) FROM subtree
+	`, childID, rootID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to update graph of moved nodes: %v", err)
+	}
+
+	err = d.notify(ctx, tx, DagEvent{Kind: DagEventNodeMoved, NodeID: childID, RootID: rootID, ParentIDs: newParentIDs})
+	if err != nil {
+		return nil, err
+	}
+
+	// Commit the transaction
+	err = tx.Commit()
+	if err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %v", err)
+	}
+
+	d.InvalidatePlanCache()
+
+	result := newMutationResult()
+	result.Counts[MutationMoved] = moved
+	result.addRoot(oldRootID)
+	result.addRoot(rootID)
+	result.addNode(childID)
+	result.Duration = time.Since(start)
+
+	return result, nil
+}
+
+// MoveSubtree moves a node and its descendants under newParentID, which becomes the only parent of the node.
+// The root ID of the whole subtree follows the new parent and moves creating a cycle fail with
+// ErrCycleDetected. The move is a single transaction; its result counts the node and its descendants as moved.
+func (d *Daggo) MoveSubtree(nodeID int, newParentID int) (*MutationResult, error) {
+	return d.MoveSubtreeContext(context.Background(), nodeID, newParentID)
+}
+
+// MoveSubtreeContext is MoveSubtree with a context bounding its queries
+func (d *Daggo) MoveSubtreeContext(ctx context.Context, nodeID int, newParentID int) (*MutationResult, error) {
+	return d.replaceParents(ctx, nodeID, []int{newParentID})
+}
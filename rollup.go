@@ -0,0 +1,267 @@
+package daggo
+
+import (
+	"database/sql"
+	"fmt"
+)
+
+// Roll-up kinds
+const (
+	// RollUpDescendantCount counts the descendants of each node
+	RollUpDescendantCount = "count"
+	// RollUpSum sums a numeric attribute (see SetAttribute) over each node and its descendants
+	RollUpSum = "sum"
+)
+
+// RollUp declares a value aggregated over the subtree of every node
+type RollUp struct {
+	Name string `db:"name"`
+	Kind string `db:"kind"`
+	// AttributeKey is the attribute summed by a RollUpSum
+	AttributeKey sql.NullString `db:"attr_key"`
+}
+
+// Roll-ups are maintained by adding the weight of each inserted, deleted or moved node to its ancestors rather
+// than by recomputing subtrees. Deletes are handled per statement since the lineage of a deleted node may be
+// deleted by the same statement.
+const createRollupTablesQuery = `
+	CREATE TABLE IF NOT EXISTS dag_rollup_def (
+		name TEXT PRIMARY KEY,
+		kind TEXT NOT NULL CHECK (kind IN ('count', 'sum')),
+		attr_key TEXT
+	);
+	CREATE TABLE IF NOT EXISTS dag_rollup (
+		node_id INTEGER NOT NULL,
+		name TEXT NOT NULL REFERENCES dag_rollup_def (name) ON DELETE CASCADE,
+		value NUMERIC NOT NULL DEFAULT 0,
+		PRIMARY KEY (node_id, name)
+	);
+
+	-- weight is what a node contributes to the roll-ups of its ancestors
+	CREATE OR REPLACE FUNCTION dag_rollup_weight(def_kind TEXT, def_key TEXT, node INTEGER) RETURNS NUMERIC AS $$
+		SELECT CASE WHEN def_kind = 'count' THEN 1 ELSE COALESCE((
+			SELECT value::text::numeric FROM dag_attr
+			WHERE node_id = node AND key = def_key AND jsonb_typeof(value) = 'number'
+		), 0) END
+	$$ LANGUAGE sql STABLE;
+
+	-- dag_rollup_apply adds delta to the roll-up of start and of all its ancestors
+	CREATE OR REPLACE FUNCTION dag_rollup_apply(start INTEGER, rollup TEXT, delta NUMERIC) RETURNS void AS $$
+		WITH RECURSIVE lineage AS (
+			SELECT id, parent_id FROM dag WHERE id = start
+			UNION ALL
+			SELECT dag.id, dag.parent_id FROM dag JOIN lineage ON dag.id = lineage.parent_id
+		)
+		INSERT INTO dag_rollup (node_id, name, value)
+		SELECT id, rollup, delta FROM lineage WHERE delta <> 0
+		ON CONFLICT (node_id, name) DO UPDATE SET value = dag_rollup.value + EXCLUDED.value
+	$$ LANGUAGE sql;
+
+	CREATE OR REPLACE FUNCTION dag_rollup_insert() RETURNS trigger AS $$
+	DECLARE
+		def RECORD;
+		node RECORD;
+	BEGIN
+		FOR def IN SELECT * FROM dag_rollup_def LOOP
+			FOR node IN SELECT id, parent_id FROM inserted LOOP
+				INSERT INTO dag_rollup (node_id, name, value)
+				VALUES (node.id, def.name, CASE WHEN def.kind = 'count' THEN 0 ELSE dag_rollup_weight(def.kind, def.attr_key, node.id) END)
+				ON CONFLICT (node_id, name) DO UPDATE SET value = dag_rollup.value + EXCLUDED.value;
+				PERFORM dag_rollup_apply(node.parent_id, def.name, dag_rollup_weight(def.kind, def.attr_key, node.id));
+			END LOOP;
+		END LOOP;
+		RETURN NULL;
+	END;
+	$$ LANGUAGE plpgsql;
+
+	CREATE OR REPLACE FUNCTION dag_rollup_delete() RETURNS trigger AS $$
+	BEGIN
+		WITH RECURSIVE lineage AS (
+			SELECT id AS source, parent_id AS ancestor FROM deleted WHERE parent_id IS NOT NULL
+			UNION ALL
+			SELECT lineage.source, up.parent_id
+			FROM lineage
+			JOIN LATERAL (
+				SELECT parent_id FROM dag WHERE dag.id = lineage.ancestor
+				UNION ALL
+				SELECT parent_id FROM deleted WHERE deleted.id = lineage.ancestor
+			) up ON up.parent_id IS NOT NULL
+		),
+		deltas AS (
+			SELECT lineage.ancestor, def.name, SUM(dag_rollup_weight(def.kind, def.attr_key, lineage.source)) AS delta
+			FROM lineage
+			CROSS JOIN dag_rollup_def def
+			WHERE lineage.ancestor NOT IN (SELECT id FROM deleted)
+			GROUP BY lineage.ancestor, def.name
+		)
+		UPDATE dag_rollup SET value = dag_rollup.value - deltas.delta
+		FROM deltas
+		WHERE dag_rollup.node_id = deltas.ancestor AND dag_rollup.name = deltas.name;
+
+		DELETE FROM dag_rollup WHERE node_id IN (SELECT id FROM deleted);
+		RETURN NULL;
+	END;
+	$$ LANGUAGE plpgsql;
+
+	CREATE OR REPLACE FUNCTION dag_rollup_move() RETURNS trigger AS $$
+	DECLARE
+		def RECORD;
+		moved NUMERIC;
+	BEGIN
+		FOR def IN SELECT * FROM dag_rollup_def LOOP
+			SELECT COALESCE((SELECT value FROM dag_rollup WHERE node_id = NEW.id AND name = def.name), 0)
+				+ CASE WHEN def.kind = 'count' THEN 1 ELSE 0 END
+			INTO moved;
+			PERFORM dag_rollup_apply(OLD.parent_id, def.name, -moved);
+			PERFORM dag_rollup_apply(NEW.parent_id, def.name, moved);
+		END LOOP;
+		RETURN NULL;
+	END;
+	$$ LANGUAGE plpgsql;
+
+	CREATE OR REPLACE FUNCTION dag_rollup_attr() RETURNS trigger AS $$
+	DECLARE
+		def RECORD;
+		old_value NUMERIC := 0;
+		new_value NUMERIC := 0;
+		node INTEGER;
+	BEGIN
+		IF TG_OP <> 'INSERT' AND jsonb_typeof(OLD.value) = 'number' THEN
+			old_value := OLD.value::text::numeric;
+		END IF;
+		IF TG_OP <> 'DELETE' AND jsonb_typeof(NEW.value) = 'number' THEN
+			new_value := NEW.value::text::numeric;
+		END IF;
+		node := CASE WHEN TG_OP = 'DELETE' THEN OLD.node_id ELSE NEW.node_id END;
+
+		FOR def IN SELECT * FROM dag_rollup_def
+			WHERE kind = 'sum' AND attr_key = CASE WHEN TG_OP = 'DELETE' THEN OLD.key ELSE NEW.key END
+		LOOP
+			PERFORM dag_rollup_apply(node, def.name, new_value - old_value);
+		END LOOP;
+		RETURN NULL;
+	END;
+	$$ LANGUAGE plpgsql;
+
+	DROP TRIGGER IF EXISTS dag_rollup_insert_trigger ON dag;
+	CREATE TRIGGER dag_rollup_insert_trigger
+		AFTER INSERT ON dag REFERENCING NEW TABLE AS inserted
+		FOR EACH STATEMENT EXECUTE FUNCTION dag_rollup_insert();
+	DROP TRIGGER IF EXISTS dag_rollup_delete_trigger ON dag;
+	CREATE TRIGGER dag_rollup_delete_trigger
+		AFTER DELETE ON dag REFERENCING OLD TABLE AS deleted
+		FOR EACH STATEMENT EXECUTE FUNCTION dag_rollup_delete();
+	-- Renumbering changes id together with parent_id and is not a move
+	DROP TRIGGER IF EXISTS dag_rollup_move_trigger ON dag;
+	CREATE TRIGGER dag_rollup_move_trigger
+		AFTER UPDATE OF parent_id ON dag
+		FOR EACH ROW WHEN (OLD.id = NEW.id AND OLD.parent_id IS DISTINCT FROM NEW.parent_id)
+		EXECUTE FUNCTION dag_rollup_move();
+	DROP TRIGGER IF EXISTS dag_rollup_attr_trigger ON dag_attr;
+	CREATE TRIGGER dag_rollup_attr_trigger
+		AFTER INSERT OR UPDATE OF value OR DELETE ON dag_attr
+		FOR EACH ROW EXECUTE FUNCTION dag_rollup_attr();
+`
+
+// Every node aggregates the weight of its whole subtree; counts leave the node itself out
+const backfillRollupQuery = `
+	WITH RECURSIVE pairs AS (
+		SELECT id AS ancestor, id AS node FROM dag
+		UNION ALL
+		SELECT pairs.ancestor, dag.id FROM pairs JOIN dag ON dag.parent_id = pairs.node
+	)
+	INSERT INTO dag_rollup (node_id, name, value)
+	SELECT ancestor, $1, SUM(dag_rollup_weight($2::text, $3::text, node)) - CASE WHEN $2::text = 'count' THEN 1 ELSE 0 END
+	FROM pairs
+	GROUP BY ancestor
+	ON CONFLICT (node_id, name) DO UPDATE SET value = EXCLUDED.value
+`
+
+// CreateRollupTables creates the roll-up tables and installs the triggers maintaining them. Sum roll-ups read
+// node attributes, so the attribute table is created as well.
+func (d *Daggo) CreateRollupTables() error {
+	_, err := d.db.Exec(createAttributeTableQuery + createRollupTablesQuery)
+	if err != nil {
+		return fmt.Errorf("failed to create roll-up tables: %v", err)
+	}
+
+	return nil
+}
+
+// DefineRollup declares a roll-up and computes it for every existing node. From then on it is maintained
+// incrementally as nodes are inserted, deleted or moved and as the summed attribute changes.
+func (d *Daggo) DefineRollup(rollup RollUp) error {
+	if rollup.Kind != RollUpDescendantCount && rollup.Kind != RollUpSum {
+		return fmt.Errorf("unknown roll-up kind %q", rollup.Kind)
+	}
+	if rollup.Kind == RollUpSum && !rollup.AttributeKey.Valid {
+		return fmt.Errorf("sum roll-up %q needs an attribute key", rollup.Name)
+	}
+
+	tx, err := d.db.Beginx()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %v", err)
+	}
+	defer func() {
+		// Rollback the transaction if it failed to commit
+		if p := recover(); p != nil {
+			tx.Rollback()
+			panic(p)
+		} else if err != nil {
+			tx.Rollback()
+		}
+	}()
+
+	_, err = tx.NamedExec("INSERT INTO dag_rollup_def (name, kind, attr_key) VALUES (:name, :kind, :attr_key)", rollup)
+	if err != nil {
+		return fmt.Errorf("failed to define roll-up: %v", err)
+	}
+	_, err = tx.Exec(backfillRollupQuery, rollup.Name, rollup.Kind, rollup.AttributeKey)
+	if err != nil {
+		return fmt.Errorf("failed to compute roll-up: %v", err)
+	}
+
+	// Commit the transaction
+	err = tx.Commit()
+	if err != nil {
+		return fmt.Errorf("failed to commit transaction: %v", err)
+	}
+
+	return nil
+}
+
+// DropRollup removes a roll-up and its values
+func (d *Daggo) DropRollup(name string) error {
+	_, err := d.db.Exec("DELETE FROM dag_rollup_def WHERE name = $1", name)
+	if err != nil {
+		return fmt.Errorf("failed to drop roll-up: %v", err)
+	}
+
+	return nil
+}
+
+// ListRollups returns the declared roll-ups ordered by name
+func (d *Daggo) ListRollups() ([]RollUp, error) {
+	rollups := make([]RollUp, 0)
+
+	err := d.db.Select(&rollups, "SELECT name, kind, attr_key FROM dag_rollup_def ORDER BY name")
+	if err != nil {
+		return nil, fmt.Errorf("failed to list roll-ups: %v", err)
+	}
+
+	return rollups, nil
+}
+
+// GetRollup returns the value of the named roll-up on the given node
+func (d *Daggo) GetRollup(nodeID int, name string) (float64, error) {
+	var value float64
+
+	err := d.db.Get(&value, "SELECT value FROM dag_rollup WHERE node_id = $1 AND name = $2", nodeID, name)
+	if err == sql.ErrNoRows {
+		return 0, fmt.Errorf("roll-up %q is not computed for node %d", name, nodeID)
+	} else if err != nil {
+		return 0, fmt.Errorf("failed to get roll-up: %v", err)
+	}
+
+	return value, nil
+}
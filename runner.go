@@ -0,0 +1,206 @@
+package daggo
+
+import (
+	"container/heap"
+	"context"
+	"fmt"
+	"sort"
+	"time"
+)
+
+// NodeHandler executes the work attached to a node
+type NodeHandler func(ctx context.Context, nodeID int) error
+
+// DurationFunc estimates how long the handler of a node takes to run
+type DurationFunc func(nodeID int) time.Duration
+
+// Runner executes a handler for every node of a graph, starting a node once all of its parents have finished
+type Runner struct {
+	daggo       *Daggo
+	handler     NodeHandler
+	concurrency int
+}
+
+// NewRunner creates a runner executing handler with at most concurrency nodes at a time; zero means unlimited
+func NewRunner(d *Daggo, handler NodeHandler, concurrency int) *Runner {
+	return &Runner{daggo: d, handler: handler, concurrency: concurrency}
+}
+
+// Run executes the graph rooted at rootID, stopping at the first handler error
+func (r *Runner) Run(ctx context.Context, rootID int) error {
+	order, children, parents, err := r.load(rootID)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	type result struct {
+		nodeID int
+		err    error
+	}
+	results := make(chan result)
+	pending := make(map[int]int, len(order))
+	ready := make([]int, 0)
+	for _, id := range order {
+		pending[id] = len(parents[id])
+		if pending[id] == 0 {
+			ready = append(ready, id)
+		}
+	}
+
+	running, done := 0, 0
+	var firstErr error
+	for done < len(order) {
+		for firstErr == nil && len(ready) > 0 && (r.concurrency <= 0 || running < r.concurrency) {
+			id := ready[0]
+			ready = ready[1:]
+			running++
+			go func(id int) {
+				results <- result{nodeID: id, err: r.handler(ctx, id)}
+			}(id)
+		}
+		if running == 0 {
+			break
+		}
+
+		res := <-results
+		running--
+		done++
+		if res.err != nil {
+			if firstErr == nil {
+				firstErr = fmt.Errorf("node %d failed: %v", res.nodeID, res.err)
+				cancel()
+			}
+			continue
+		}
+		for _, childID := range children[res.nodeID] {
+			pending[childID]--
+			if pending[childID] == 0 {
+				ready = append(ready, childID)
+			}
+		}
+	}
+
+	return firstErr
+}
+
+// ScheduledNode is the predicted execution window of a node, relative to the start of the run
+type ScheduledNode struct {
+	NodeID int
+	Start  time.Duration
+	Finish time.Duration
+}
+
+// ConcurrencyStep records how many nodes are running from At until the next step
+type ConcurrencyStep struct {
+	At      time.Duration
+	Running int
+}
+
+// Simulation is the predicted outcome of a run
+type Simulation struct {
+	Schedule        []ScheduledNode
+	Profile         []ConcurrencyStep
+	PeakConcurrency int
+	Makespan        time.Duration
+}
+
+// Simulate predicts the schedule of a run of the graph rooted at rootID from per-node duration estimates
+// without executing any handler. Nodes are started in the same order Run starts them.
+func (r *Runner) Simulate(rootID int, durations DurationFunc) (*Simulation, error) {
+	order, children, parents, err := r.load(rootID)
+	if err != nil {
+		return nil, err
+	}
+
+	pending := make(map[int]int, len(order))
+	ready := make([]int, 0)
+	for _, id := range order {
+		pending[id] = len(parents[id])
+		if pending[id] == 0 {
+			ready = append(ready, id)
+		}
+	}
+
+	sim := &Simulation{Schedule: make([]ScheduledNode, 0, len(order)), Profile: make([]ConcurrencyStep, 0)}
+	running := &finishQueue{}
+	var now time.Duration
+	for len(ready) > 0 || running.Len() > 0 {
+		for len(ready) > 0 && (r.concurrency <= 0 || running.Len() < r.concurrency) {
+			id := ready[0]
+			ready = ready[1:]
+			duration := durations(id)
+			if duration < 0 {
+				duration = 0
+			}
+			heap.Push(running, ScheduledNode{NodeID: id, Start: now, Finish: now + duration})
+		}
+		sim.record(now, running.Len())
+
+		// Advance to the next completion and release every node finishing at that instant
+		now = (*running)[0].Finish
+		for running.Len() > 0 && (*running)[0].Finish == now {
+			node := heap.Pop(running).(ScheduledNode)
+			sim.Schedule = append(sim.Schedule, node)
+			for _, childID := range children[node.NodeID] {
+				pending[childID]--
+				if pending[childID] == 0 {
+					ready = append(ready, childID)
+				}
+			}
+		}
+	}
+	sim.record(now, 0)
+	sim.Makespan = now
+
+	sort.SliceStable(sim.Schedule, func(i, j int) bool {
+		return sim.Schedule[i].Start < sim.Schedule[j].Start
+	})
+
+	return sim, nil
+}
+
+func (s *Simulation) record(at time.Duration, running int) {
+	if running > s.PeakConcurrency {
+		s.PeakConcurrency = running
+	}
+	if n := len(s.Profile); n > 0 {
+		if s.Profile[n-1].At == at {
+			s.Profile[n-1].Running = running
+			return
+		}
+		if s.Profile[n-1].Running == running {
+			return
+		}
+	}
+	s.Profile = append(s.Profile, ConcurrencyStep{At: at, Running: running})
+}
+
+func (r *Runner) load(rootID int) ([]int, map[int][]int, map[int][]int, error) {
+	edges, err := r.daggo.loadGraphEdges(rootID)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	return topoOrder(rootID, edges)
+}
+
+// finishQueue orders running nodes by finish time
+type finishQueue []ScheduledNode
+
+func (q finishQueue) Len() int { return len(q) }
+func (q finishQueue) Less(i, j int) bool {
+	if q[i].Finish == q[j].Finish {
+		return q[i].NodeID < q[j].NodeID
+	}
+	return q[i].Finish < q[j].Finish
+}
+func (q finishQueue) Swap(i, j int)       { q[i], q[j] = q[j], q[i] }
+func (q *finishQueue) Push(x interface{}) { *q = append(*q, x.(ScheduledNode)) }
+func (q *finishQueue) Pop() interface{} {
+	old := *q
+	item := old[len(old)-1]
+	*q = old[:len(old)-1]
+	return item
+}
@@ -0,0 +1,241 @@
+package daggo
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// Traversal kinds supported by saved views
+const (
+	TraversalChildren    = "children"
+	TraversalDescendants = "descendants"
+	TraversalAncestors   = "ancestors"
+)
+
+// ViewSpec describes the traversal and filter a saved view executes
+type ViewSpec struct {
+	// Traversal is one of TraversalChildren, TraversalDescendants or TraversalAncestors
+	Traversal string `json:"traversal"`
+	// FromNodeID is the node the traversal starts from
+	FromNodeID int `json:"from_node_id"`
+	// LeavesOnly keeps only nodes without children in the traversal result
+	LeavesOnly bool `json:"leaves_only,omitempty"`
+	// Payload keeps only nodes whose payload contains this JSON document (JSONB containment), e.g.
+	// {"status": "failed"} together with LeavesOnly for all failing leaf nodes
+	Payload json.RawMessage `json:"payload,omitempty"`
+	// Limit caps the number of returned nodes when greater than zero
+	Limit int `json:"limit,omitempty"`
+}
+
+// Value implements driver.Valuer so a ViewSpec is stored as JSONB
+func (s ViewSpec) Value() (driver.Value, error) {
+	return json.Marshal(s)
+}
+
+// Scan implements sql.Scanner so a ViewSpec can be read back from JSONB
+func (s *ViewSpec) Scan(src interface{}) error {
+	switch v := src.(type) {
+	case []byte:
+		return json.Unmarshal(v, s)
+	case string:
+		return json.Unmarshal([]byte(v), s)
+	default:
+		return fmt.Errorf("cannot scan %T into ViewSpec", src)
+	}
+}
+
+func (s ViewSpec) validate() error {
+	switch s.Traversal {
+	case TraversalChildren, TraversalDescendants, TraversalAncestors:
+	default:
+		return fmt.Errorf("unknown traversal %q", s.Traversal)
+	}
+	if s.Limit < 0 {
+		return fmt.Errorf("limit cannot be negative")
+	}
+	if len(s.Payload) > 0 && !json.Valid(s.Payload) {
+		return fmt.Errorf("payload filter is not valid JSON")
+	}
+	return nil
+}
+
+// SavedView is a named ViewSpec persisted for a graph so it can be shared and re-run
+type SavedView struct {
+	ID        int       `db:"id"`
+	RootID    int       `db:"root_id"`
+	Name      string    `db:"name"`
+	Spec      ViewSpec  `db:"spec"`
+	CreatedAt time.Time `db:"created_at"`
+}
+
+const createViewTableQuery = `
+	CREATE TABLE IF NOT EXISTS dag_view (
+		id SERIAL PRIMARY KEY,
+		root_id INTEGER NOT NULL,
+		name TEXT NOT NULL,
+		spec JSONB NOT NULL,
+		created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+		UNIQUE (root_id, name)
+	);
+`
+
+// CreateViewTable creates the side table used to store saved views
+func (d *Daggo) CreateViewTable() error {
+	_, err := d.db.Exec(createViewTableQuery)
+	if err != nil {
+		return fmt.Errorf("failed to create view table: %v", err)
+	}
+
+	return nil
+}
+
+// SaveView stores a named view for the graph rooted at rootID, replacing any view with the same name
+func (d *Daggo) SaveView(rootID int, name string, spec ViewSpec) (*SavedView, error) {
+	if name == "" {
+		return nil, fmt.Errorf("view name cannot be empty")
+	}
+	if err := spec.validate(); err != nil {
+		return nil, fmt.Errorf("invalid view spec: %v", err)
+	}
+
+	var view SavedView
+
+	query := `
+		INSERT INTO dag_view (root_id, name, spec)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (root_id, name) DO UPDATE SET spec = EXCLUDED.spec
+		RETURNING id, root_id, name, spec, created_at
+	`
+	err := d.db.Get(&view, query, rootID, name, spec)
+	if err != nil {
+		return nil, fmt.Errorf("failed to save view: %v", err)
+	}
+
+	return &view, nil
+}
+
+// GetView returns the saved view with the given ID, or nil if it does not exist
+func (d *Daggo) GetView(viewID int) (*SavedView, error) {
+	var view SavedView
+
+	err := d.db.Get(&view, "SELECT * FROM dag_view WHERE id = $1", viewID)
+	if err == sql.ErrNoRows {
+		return nil, nil // No view found
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to get view: %v", err)
+	}
+
+	return &view, nil
+}
+
+// ListViews returns the saved views of the graph rooted at rootID ordered by name
+func (d *Daggo) ListViews(rootID int) ([]SavedView, error) {
+	views := make([]SavedView, 0)
+
+	err := d.db.Select(&views, "SELECT * FROM dag_view WHERE root_id = $1 ORDER BY name ASC", rootID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list views: %v", err)
+	}
+
+	return views, nil
+}
+
+// DeleteView deletes the saved view with the given ID
+func (d *Daggo) DeleteView(viewID int) error {
+	_, err := d.db.Exec("DELETE FROM dag_view WHERE id = $1", viewID)
+	if err != nil {
+		return fmt.Errorf("failed to delete view: %v", err)
+	}
+
+	return nil
+}
+
+// RunView executes the saved view with the given ID and returns the matching nodes
+func (d *Daggo) RunView(viewID int) ([]DagNode, error) {
+	view, err := d.GetView(viewID)
+	if err != nil {
+		return nil, err
+	}
+	if view == nil {
+		return nil, fmt.Errorf("view with ID %d does not exist", viewID)
+	}
+
+	return d.runViewSpec(view.Spec)
+}
+
+func (d *Daggo) runViewSpec(spec ViewSpec) ([]DagNode, error) {
+	if err := spec.validate(); err != nil {
+		return nil, fmt.Errorf("invalid view spec: %v", err)
+	}
+
+	var nodes []DagNode
+	var err error
+	switch spec.Traversal {
+	case TraversalChildren:
+		nodes, err = d.GetNextChildrenNodes(spec.FromNodeID)
+	case TraversalDescendants:
+		nodes, err = d.GetDescendants(spec.FromNodeID)
+	case TraversalAncestors:
+		nodes, err = d.GetAncestors(spec.FromNodeID)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if spec.LeavesOnly || len(spec.Payload) > 0 {
+		nodes, err = d.filterNodes(nodes, spec)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if spec.Limit > 0 && len(nodes) > spec.Limit {
+		nodes = nodes[:spec.Limit]
+	}
+
+	return nodes, nil
+}
+
+// filterNodes keeps the nodes matching the leaf and payload filters of spec, in their traversal order, with a
+// single query
+func (d *Daggo) filterNodes(nodes []DagNode, spec ViewSpec) ([]DagNode, error) {
+	ids := make([]int, 0, len(nodes))
+	for _, node := range nodes {
+		ids = append(ids, node.ID)
+	}
+	var payload interface{}
+	if len(spec.Payload) > 0 {
+		payload = []byte(spec.Payload)
+	}
+
+	query := `
+		SELECT dag.id
+		FROM dag
+		WHERE dag.id = ANY($1)
+			AND (NOT $2 OR NOT EXISTS (SELECT 1 FROM dag_edge WHERE dag_edge.parent_id = dag.id))
+			AND ($3::jsonb IS NULL OR dag.payload @> $3::jsonb)
+	`
+	matching := make([]int, 0)
+	err := d.db.Select(&matching, query, pq.Array(ids), spec.LeavesOnly, payload)
+	if err != nil {
+		return nil, fmt.Errorf("failed to filter view nodes: %v", err)
+	}
+	keep := make(map[int]bool, len(matching))
+	for _, id := range matching {
+		keep[id] = true
+	}
+
+	filtered := make([]DagNode, 0, len(matching))
+	for _, node := range nodes {
+		if keep[node.ID] {
+			filtered = append(filtered, node)
+		}
+	}
+
+	return filtered, nil
+}
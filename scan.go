@@ -0,0 +1,43 @@
+package daggo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// ScanAll calls fn with every node of the database, in batches of at most batchSize nodes in ascending ID order,
+// together with the checkpoint to resume the scan after the batch: passing it to WithCursor starts a later scan
+// right after the batch, e.g. when an index rebuild was interrupted. Batches are read with keyset pagination on
+// the primary key, so the scan holds no lock and no connection between batches; nodes added behind the scan while
+// it runs are missed and nodes deleted ahead of it are skipped. WithConsistency lets a replica serve the scan.
+// An error returned by fn stops the scan and is returned as is.
+func (d *Daggo) ScanAll(ctx context.Context, batchSize int, fn func(batch []DagNode, checkpoint int) error, opts ...TraversalOption) error {
+	if batchSize <= 0 {
+		return errors.New("batch size must be positive")
+	}
+	options := newTraversalOptions(opts)
+	cursor := options.cursor
+
+	ctx = WithOperation(ctx, OpScan)
+	query := "SELECT * FROM dag WHERE $1::int IS NULL OR id > $1 ORDER BY id ASC LIMIT $2"
+	for {
+		batch := make([]DagNode, 0, batchSize)
+		err := d.reader(ctx, options.consistency).SelectContext(ctx, &batch, query, cursor, batchSize)
+		if err != nil {
+			return fmt.Errorf("failed to scan nodes: %v", err)
+		}
+		if len(batch) == 0 {
+			return nil
+		}
+
+		checkpoint := batch[len(batch)-1].ID
+		if err := fn(batch, checkpoint); err != nil {
+			return err
+		}
+		if len(batch) < batchSize {
+			return nil
+		}
+		cursor.Int64, cursor.Valid = int64(checkpoint), true
+	}
+}
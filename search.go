@@ -0,0 +1,255 @@
+package daggo
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/lib/pq"
+)
+
+// SearchDocument is the representation of a node sent to a search index
+type SearchDocument struct {
+	NodeID int                    `json:"node_id"`
+	RootID int                    `json:"root_id"`
+	Fields map[string]interface{} `json:"fields"`
+}
+
+// Indexer is implemented by full-text search backends kept in sync with the dag tables
+type Indexer interface {
+	// Index creates or replaces the given documents
+	Index(ctx context.Context, docs []SearchDocument) error
+	// Delete removes the documents of the given node IDs
+	Delete(ctx context.Context, nodeIDs []int) error
+	// Search returns the IDs of the best matching nodes, restricted to the graph rooted at rootID when it is non-zero
+	Search(ctx context.Context, query string, rootID int, limit int) ([]int, error)
+}
+
+// Search runs query against the index and resolves the hits back to DagNodes, keeping the index ranking
+func (d *Daggo) Search(ctx context.Context, indexer Indexer, query string, rootID int, limit int) ([]DagNode, error) {
+	ids, err := indexer.Search(ctx, query, rootID, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to search index: %v", err)
+	}
+	if len(ids) == 0 {
+		return []DagNode{}, nil
+	}
+
+	found := make([]DagNode, 0, len(ids))
+	err = d.db.SelectContext(ctx, &found, "SELECT * FROM dag WHERE id = ANY($1)", pq.Array(ids))
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve search hits: %v", err)
+	}
+
+	// Hits deleted since they were indexed are dropped
+	byID := make(map[int]DagNode, len(found))
+	for _, node := range found {
+		byID[node.ID] = node
+	}
+	nodes := make([]DagNode, 0, len(found))
+	for _, id := range ids {
+		if node, ok := byID[id]; ok {
+			nodes = append(nodes, node)
+		}
+	}
+
+	return nodes, nil
+}
+
+// SyncIndex applies the changes of the dag table to the index until the changefeed is closed or ctx is cancelled
+func (d *Daggo) SyncIndex(ctx context.Context, indexer Indexer, changes <-chan ChangeEvent) error {
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case change, ok := <-changes:
+			if !ok {
+				return nil
+			}
+			if change.Table != "dag" || change.NodeID == 0 {
+				continue
+			}
+
+			var err error
+			if change.Op == "DELETE" {
+				err = indexer.Delete(ctx, []int{change.NodeID})
+			} else {
+				err = indexer.Index(ctx, []SearchDocument{searchDocumentFromChange(change)})
+			}
+			if err != nil {
+				return fmt.Errorf("failed to sync node %d to index: %v", change.NodeID, err)
+			}
+		}
+	}
+}
+
+func searchDocumentFromChange(change ChangeEvent) SearchDocument {
+	doc := SearchDocument{NodeID: change.NodeID, Fields: make(map[string]interface{})}
+	for column, value := range change.Columns {
+		doc.Fields[column] = value
+	}
+	doc.RootID, _ = strconv.Atoi(change.Columns["root_id"])
+	return doc
+}
+
+// ElasticsearchIndexer indexes nodes in an Elasticsearch or OpenSearch index through the REST API
+type ElasticsearchIndexer struct {
+	// URL is the base URL of the cluster, e.g. http://localhost:9200
+	URL string
+	// IndexName is the index holding the node documents
+	IndexName string
+	// Client is used for requests; http.DefaultClient when nil
+	Client *http.Client
+}
+
+// Index creates or replaces the given documents with a bulk request
+func (e *ElasticsearchIndexer) Index(ctx context.Context, docs []SearchDocument) error {
+	if len(docs) == 0 {
+		return nil
+	}
+
+	var body bytes.Buffer
+	encoder := json.NewEncoder(&body)
+	for _, doc := range docs {
+		encoder.Encode(map[string]interface{}{"index": map[string]interface{}{"_index": e.IndexName, "_id": strconv.Itoa(doc.NodeID)}})
+		encoder.Encode(doc)
+	}
+
+	return e.bulk(ctx, &body)
+}
+
+// Delete removes the documents of the given node IDs with a bulk request
+func (e *ElasticsearchIndexer) Delete(ctx context.Context, nodeIDs []int) error {
+	if len(nodeIDs) == 0 {
+		return nil
+	}
+
+	var body bytes.Buffer
+	encoder := json.NewEncoder(&body)
+	for _, id := range nodeIDs {
+		encoder.Encode(map[string]interface{}{"delete": map[string]interface{}{"_index": e.IndexName, "_id": strconv.Itoa(id)}})
+	}
+
+	return e.bulk(ctx, &body)
+}
+
+// maxReportedBulkFailures caps the failed items listed in the error of a bulk request
+const maxReportedBulkFailures = 10
+
+// bulk sends a bulk request and reports the items that failed, as the request succeeds as a whole even when
+// some of its items do not
+func (e *ElasticsearchIndexer) bulk(ctx context.Context, body io.Reader) error {
+	var response struct {
+		Errors bool `json:"errors"`
+		// Items holds one object per action, keyed by the action, e.g. {"index": {...}}
+		Items []map[string]struct {
+			ID     string `json:"_id"`
+			Status int    `json:"status"`
+			Error  *struct {
+				Type   string `json:"type"`
+				Reason string `json:"reason"`
+			} `json:"error"`
+		} `json:"items"`
+	}
+	err := e.do(ctx, http.MethodPost, "/_bulk", "application/x-ndjson", body, &response)
+	if err != nil {
+		return err
+	}
+	if !response.Errors {
+		return nil
+	}
+
+	failures := make([]string, 0)
+	failed := 0
+	for _, item := range response.Items {
+		for action, result := range item {
+			if result.Error == nil {
+				continue
+			}
+			failed++
+			if len(failures) < maxReportedBulkFailures {
+				failures = append(failures, fmt.Sprintf("%s of node %s: %s: %s", action, result.ID, result.Error.Type, result.Error.Reason))
+			}
+		}
+	}
+	if failed == 0 {
+		return fmt.Errorf("search backend reported errors for the bulk request without failed items")
+	}
+	if failed > len(failures) {
+		failures = append(failures, fmt.Sprintf("and %d more", failed-len(failures)))
+	}
+
+	return fmt.Errorf("search backend failed %d of %d bulk items: %s", failed, len(response.Items), strings.Join(failures, "; "))
+}
+
+// Search runs a query_string query over the document fields
+func (e *ElasticsearchIndexer) Search(ctx context.Context, query string, rootID int, limit int) ([]int, error) {
+	must := []interface{}{
+		map[string]interface{}{"query_string": map[string]interface{}{"query": query, "default_field": "fields.*"}},
+	}
+	if rootID != 0 {
+		must = append(must, map[string]interface{}{"term": map[string]interface{}{"root_id": rootID}})
+	}
+	request := map[string]interface{}{
+		"size":    limit,
+		"_source": []string{"node_id"},
+		"query":   map[string]interface{}{"bool": map[string]interface{}{"must": must}},
+	}
+
+	body, err := json.Marshal(request)
+	if err != nil {
+		return nil, err
+	}
+
+	var response struct {
+		Hits struct {
+			Hits []struct {
+				Source SearchDocument `json:"_source"`
+			} `json:"hits"`
+		} `json:"hits"`
+	}
+	err = e.do(ctx, http.MethodPost, "/"+e.IndexName+"/_search", "application/json", bytes.NewReader(body), &response)
+	if err != nil {
+		return nil, err
+	}
+
+	ids := make([]int, 0, len(response.Hits.Hits))
+	for _, hit := range response.Hits.Hits {
+		ids = append(ids, hit.Source.NodeID)
+	}
+
+	return ids, nil
+}
+
+func (e *ElasticsearchIndexer) do(ctx context.Context, method, path, contentType string, body io.Reader, out interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, method, strings.TrimSuffix(e.URL, "/")+path, body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", contentType)
+
+	client := e.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("search backend returned %s: %s", resp.Status, msg)
+	}
+	if out != nil {
+		return json.NewDecoder(resp.Body).Decode(out)
+	}
+
+	return nil
+}
@@ -0,0 +1,59 @@
+package daggo
+
+import (
+	"fmt"
+	"strings"
+)
+
+// CommonDescendants returns the nodes that descend from both a and b, ordered by ID
+func (d *Daggo) CommonDescendants(a int, b int) ([]DagNode, error) {
+	return d.setOperation(Down, "INTERSECT", a, b)
+}
+
+// CommonAncestors returns the nodes that are ancestors of both a and b, ordered by ID
+func (d *Daggo) CommonAncestors(a int, b int) ([]DagNode, error) {
+	return d.setOperation(Up, "INTERSECT", a, b)
+}
+
+// DescendantsDifference returns the descendants of a that do not descend from b, ordered by ID
+func (d *Daggo) DescendantsDifference(a int, b int) ([]DagNode, error) {
+	return d.setOperation(Down, "EXCEPT", a, b)
+}
+
+// setOperation combines the nodes reached from a and from b in the given direction with a SQL set operator,
+// in a single query
+func (d *Daggo) setOperation(dir Direction, operator string, a int, b int) ([]DagNode, error) {
+	nodes := make([]DagNode, 0)
+
+	step, err := d.traversalStep(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	query := `
+		WITH RECURSIVE reachable_a AS (
+			SELECT $1::int AS id
+			UNION
+			` + strings.ReplaceAll(step.query(), "reachable", "reachable_a") + `
+		),
+		reachable_b AS (
+			SELECT $2::int AS id
+			UNION
+			` + strings.ReplaceAll(step.query(), "reachable", "reachable_b") + `
+		)
+		SELECT dag.*
+		FROM dag
+		WHERE dag.id IN (
+			SELECT id FROM reachable_a WHERE id <> $1
+			` + operator + `
+			SELECT id FROM reachable_b WHERE id <> $2
+		)
+		ORDER BY dag.id ASC
+	`
+	err = d.db.Select(&nodes, query, a, b)
+	if err != nil {
+		return nil, fmt.Errorf("failed to compute %s of nodes %d and %d: %v", strings.ToLower(operator), a, b, err)
+	}
+
+	return nodes, nil
+}
@@ -0,0 +1,148 @@
+package daggo
+
+import (
+	"fmt"
+	"hash/fnv"
+	"sort"
+	"strconv"
+	"sync"
+)
+
+// ShardStrategy maps the root ID of a graph to the index of the shard holding it
+type ShardStrategy interface {
+	ShardFor(rootID int, shardCount int) (int, error)
+}
+
+// HashSharding spreads graphs over the shards by hashing their root ID
+type HashSharding struct{}
+
+// ShardFor returns the shard of rootID by FNV-1a hash
+func (HashSharding) ShardFor(rootID int, shardCount int) (int, error) {
+	h := fnv.New32a()
+	h.Write([]byte(strconv.Itoa(rootID)))
+	return int(h.Sum32() % uint32(shardCount)), nil
+}
+
+// ShardRange assigns the root IDs in [From, To] to a shard
+type ShardRange struct {
+	From  int
+	To    int
+	Shard int
+}
+
+// RangeSharding assigns graphs to shards by root ID ranges
+type RangeSharding []ShardRange
+
+// ShardFor returns the shard of the range containing rootID
+func (r RangeSharding) ShardFor(rootID int, shardCount int) (int, error) {
+	for _, rng := range r {
+		if rootID >= rng.From && rootID <= rng.To {
+			if rng.Shard < 0 || rng.Shard >= shardCount {
+				return 0, fmt.Errorf("range [%d, %d] points to unknown shard %d", rng.From, rng.To, rng.Shard)
+			}
+			return rng.Shard, nil
+		}
+	}
+	return 0, fmt.Errorf("no shard configured for root ID %d", rootID)
+}
+
+// ShardedDaggo routes graphs to several Postgres instances by root ID. A graph lives entirely on one shard,
+// so every single-graph operation runs on the Daggo returned by Shard.
+type ShardedDaggo struct {
+	shards   []*Daggo
+	strategy ShardStrategy
+}
+
+// NewShardedDaggo connects to every DSN, in shard order, with the same options
+func NewShardedDaggo(dsns []string, strategy ShardStrategy, opts ...Option) (*ShardedDaggo, error) {
+	if len(dsns) == 0 {
+		return nil, fmt.Errorf("at least one shard is required")
+	}
+	if strategy == nil {
+		strategy = HashSharding{}
+	}
+
+	s := &ShardedDaggo{strategy: strategy}
+	for i, dsn := range dsns {
+		d, err := NewDaggo(dsn, opts...)
+		if err != nil {
+			s.Close()
+			return nil, fmt.Errorf("failed to connect to shard %d: %v", i, err)
+		}
+		s.shards = append(s.shards, d)
+	}
+
+	return s, nil
+}
+
+// Shard returns the Daggo holding the graph rooted at rootID
+func (s *ShardedDaggo) Shard(rootID int) (*Daggo, error) {
+	i, err := s.strategy.ShardFor(rootID, len(s.shards))
+	if err != nil {
+		return nil, err
+	}
+	return s.shards[i], nil
+}
+
+// Shards returns every shard in order
+func (s *ShardedDaggo) Shards() []*Daggo {
+	return s.shards
+}
+
+// ForEachShard runs fn on every shard concurrently and returns the first error
+func (s *ShardedDaggo) ForEachShard(fn func(shard int, d *Daggo) error) error {
+	errs := make([]error, len(s.shards))
+	var wg sync.WaitGroup
+	for i, d := range s.shards {
+		wg.Add(1)
+		go func(i int, d *Daggo) {
+			defer wg.Done()
+			errs[i] = fn(i, d)
+		}(i, d)
+	}
+	wg.Wait()
+
+	for i, err := range errs {
+		if err != nil {
+			return fmt.Errorf("shard %d: %w", i, err)
+		}
+	}
+	return nil
+}
+
+// ListGraphs lists the matching graphs of every shard, ordered by name
+func (s *ShardedDaggo) ListGraphs(filter GraphFilter) ([]GraphMeta, error) {
+	results := make([][]GraphMeta, len(s.shards))
+	err := s.ForEachShard(func(i int, d *Daggo) error {
+		graphs, err := d.ListGraphs(filter)
+		results[i] = graphs
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	graphs := make([]GraphMeta, 0)
+	for _, shardGraphs := range results {
+		graphs = append(graphs, shardGraphs...)
+	}
+	sort.Slice(graphs, func(i, j int) bool {
+		if graphs[i].Name != graphs[j].Name {
+			return graphs[i].Name < graphs[j].Name
+		}
+		return graphs[i].RootID < graphs[j].RootID
+	})
+
+	return graphs, nil
+}
+
+// Close closes the connections to every shard
+func (s *ShardedDaggo) Close() error {
+	var first error
+	for _, d := range s.shards {
+		if err := d.Close(); err != nil && first == nil {
+			first = err
+		}
+	}
+	return first
+}
@@ -0,0 +1,57 @@
+package daggo_test
+
+import (
+	"testing"
+
+	"daggo"
+)
+
+func TestRangeShardingShardFor(t *testing.T) {
+	sharding := daggo.RangeSharding{
+		{From: 1, To: 100, Shard: 0},
+		{From: 101, To: 200, Shard: 1},
+		{From: 201, To: 300, Shard: 5},
+	}
+
+	tests := []struct {
+		name    string
+		rootID  int
+		want    int
+		wantErr bool
+	}{
+		{"first ID of range", 1, 0, false},
+		{"last ID of range", 100, 0, false},
+		{"next range", 101, 1, false},
+		{"inside range", 150, 1, false},
+		{"below every range", 0, 0, true},
+		{"above every range", 301, 0, true},
+		{"range pointing to unknown shard", 250, 0, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := sharding.ShardFor(tt.rootID, 2)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ShardFor(%d) error = %v, want error %v", tt.rootID, err, tt.wantErr)
+			}
+			if err == nil && got != tt.want {
+				t.Errorf("ShardFor(%d) = %d, want %d", tt.rootID, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRangeShardingFirstRangeWins(t *testing.T) {
+	sharding := daggo.RangeSharding{
+		{From: 1, To: 100, Shard: 1},
+		{From: 50, To: 150, Shard: 0},
+	}
+
+	got, err := sharding.ShardFor(75, 2)
+	if err != nil {
+		t.Fatalf("ShardFor failed: %v", err)
+	}
+	if got != 1 {
+		t.Errorf("ShardFor(75) = %d, want 1", got)
+	}
+}
@@ -0,0 +1,256 @@
+package daggo
+
+import (
+	"container/heap"
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/lib/pq"
+)
+
+// CostExpr describes the cost of following an edge: the numeric payload field EdgeField of the edge (Default when
+// missing), plus the numeric payload field NodeField of the child it leads to (NodeDefault when missing), plus a
+// fixed PerHop cost. Fields hold numbers or numeric strings; other values count as missing.
+type CostExpr struct {
+	EdgeField   string
+	Default     float64
+	NodeField   string
+	NodeDefault float64
+	PerHop      float64
+}
+
+// CostFunc computes the cost of following the edge from parent to child in Go; edgePayload is nil when
+// the edge carries no payload. Costs must not be negative.
+type CostFunc func(parent DagNode, child DagNode, edgePayload json.RawMessage) float64
+
+// costEdge is an edge below the start of a path search with the cost fields of the edge and of its child
+type costEdge struct {
+	ParentID  int    `db:"parent_id"`
+	ChildID   int    `db:"child_id"`
+	EdgeValue []byte `db:"edge_value"`
+	NodeValue []byte `db:"node_value"`
+}
+
+// costEdgesQuery selects the edges reachable from $1 with the payload field $2 of the edge and $3 of the child,
+// or without edge fields when the edge payload table was never created
+func costEdgesQuery(edgePayloads bool) string {
+	edgeValue, edgeJoin := "NULL::jsonb", ""
+	if edgePayloads {
+		edgeValue = "e.payload->$2"
+		edgeJoin = "LEFT JOIN dag_edge_payload e ON e.parent_id = dag_edge.parent_id AND e.child_id = dag_edge.child_id"
+	}
+	return `
+		WITH RECURSIVE reachable AS (
+			SELECT $1::int AS id
+			UNION
+			SELECT dag_edge.child_id FROM dag_edge JOIN reachable ON dag_edge.parent_id = reachable.id
+		)
+		SELECT dag_edge.parent_id, dag_edge.child_id, ` + edgeValue + ` AS edge_value, child.payload->$3 AS node_value
+		FROM dag_edge
+		JOIN reachable ON reachable.id = dag_edge.parent_id
+		JOIN dag child ON child.id = dag_edge.child_id
+		` + edgeJoin + `
+	`
+}
+
+// ShortestPathBy returns the least-cost chain of nodes from fromID down to toID, both included, with its
+// total cost. The edges below fromID are loaded with the fields of cost in one query and searched with
+// Dijkstra's algorithm, so every node is settled once. It returns a nil path if toID is not reachable from fromID.
+func (d *Daggo) ShortestPathBy(fromID int, toID int, cost CostExpr) ([]DagNode, float64, error) {
+	ctx := WithOperation(context.Background(), OpShortestPath)
+
+	edges := make([]costEdge, 0)
+	err := d.db.SelectContext(ctx, &edges, costEdgesQuery(true), fromID, cost.EdgeField, cost.NodeField)
+	if err != nil && isUndefinedTable(err) {
+		err = d.db.SelectContext(ctx, &edges, costEdgesQuery(false), fromID, cost.EdgeField, cost.NodeField)
+	}
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to load edges: %v", err)
+	}
+
+	children := make(map[int][]int)
+	costs := make(map[[2]int]float64)
+	for _, edge := range edges {
+		children[edge.ParentID] = append(children[edge.ParentID], edge.ChildID)
+		costs[[2]int{edge.ParentID, edge.ChildID}] = jsonNumber(edge.EdgeValue, cost.Default) +
+			jsonNumber(edge.NodeValue, cost.NodeDefault) + cost.PerHop
+	}
+
+	ids, total, err := dijkstra(fromID, toID, children, func(parentID int, childID int) float64 {
+		return costs[[2]int{parentID, childID}]
+	})
+	if err != nil || ids == nil {
+		return nil, 0, err
+	}
+
+	path, err := d.getNodesInOrderContext(ctx, ids)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return path, total, nil
+}
+
+// jsonNumber returns the number held by a JSON value, or def when it holds none
+func jsonNumber(raw []byte, def float64) float64 {
+	var value interface{}
+	if len(raw) == 0 || json.Unmarshal(raw, &value) != nil {
+		return def
+	}
+	return numericValue(value, def)
+}
+
+// ShortestPathByFunc returns the least-cost chain of nodes from fromID down to toID using Dijkstra's
+// algorithm in Go, for costs that cannot be expressed with a CostExpr. The descendants of fromID and their
+// edge payloads are loaded once. It returns a nil path if toID is not reachable from fromID.
+func (d *Daggo) ShortestPathByFunc(fromID int, toID int, cost CostFunc) ([]DagNode, float64, error) {
+	from, err := d.GetNodeByID(fromID)
+	if err != nil {
+		return nil, 0, err
+	}
+	if from == nil {
+		return nil, 0, fmt.Errorf("%w: %d", ErrNodeNotFound, fromID)
+	}
+
+	descendants, err := d.Traverse(fromID, Down)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	nodes := map[int]DagNode{fromID: *from}
+	for _, node := range descendants {
+		nodes[node.ID] = node
+	}
+	ids := make([]int64, 0, len(nodes))
+	for id := range nodes {
+		ids = append(ids, int64(id))
+	}
+
+	// Every edge between the loaded nodes is followed, with its payload if it has one
+	edges := make([]graphEdge, 0)
+	query := `
+		SELECT dag_edge.parent_id, dag_edge.child_id, e.payload
+		FROM dag_edge
+		LEFT JOIN dag_edge_payload e ON e.parent_id = dag_edge.parent_id AND e.child_id = dag_edge.child_id
+		WHERE dag_edge.child_id = ANY($1) AND dag_edge.parent_id = ANY($1)
+	`
+	err = d.db.Select(&edges, query, pq.Int64Array(ids))
+	if err != nil && isUndefinedTable(err) {
+		query = "SELECT parent_id, child_id, NULL::jsonb AS payload FROM dag_edge WHERE child_id = ANY($1) AND parent_id = ANY($1)"
+		err = d.db.Select(&edges, query, pq.Int64Array(ids))
+	}
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to load edges: %v", err)
+	}
+	children := make(map[int][]int)
+	payloads := make(map[[2]int]json.RawMessage)
+	for _, edge := range edges {
+		children[edge.ParentID] = append(children[edge.ParentID], edge.ChildID)
+		payloads[[2]int{edge.ParentID, edge.ChildID}] = json.RawMessage(edge.Payload)
+	}
+
+	pathIDs, total, err := dijkstra(fromID, toID, children, func(parentID int, childID int) float64 {
+		return cost(nodes[parentID], nodes[childID], payloads[[2]int{parentID, childID}])
+	})
+	if err != nil || pathIDs == nil {
+		return nil, 0, err
+	}
+
+	path := make([]DagNode, 0, len(pathIDs))
+	for _, id := range pathIDs {
+		path = append(path, nodes[int(id)])
+	}
+
+	return path, total, nil
+}
+
+// dijkstra returns the IDs of the least-cost chain from fromID down to toID over the children edges, and its
+// total cost, or nil IDs when toID is not reachable. It fails on negative edge costs.
+func dijkstra(fromID int, toID int, children map[int][]int, cost func(parentID int, childID int) float64) ([]int64, float64, error) {
+	dist := map[int]float64{fromID: 0}
+	prev := make(map[int]int)
+	queue := &costQueue{{id: fromID, cost: 0}}
+	for queue.Len() > 0 {
+		current := heap.Pop(queue).(costItem)
+		if current.cost > dist[current.id] {
+			continue
+		}
+		if current.id == toID {
+			break
+		}
+		for _, childID := range children[current.id] {
+			edgeCost := cost(current.id, childID)
+			if edgeCost < 0 {
+				return nil, 0, fmt.Errorf("negative cost on edge from %d to %d", current.id, childID)
+			}
+			next := current.cost + edgeCost
+			if known, ok := dist[childID]; !ok || next < known {
+				dist[childID] = next
+				prev[childID] = current.id
+				heap.Push(queue, costItem{id: childID, cost: next})
+			}
+		}
+	}
+
+	total, ok := dist[toID]
+	if !ok {
+		return nil, 0, nil // Target not reachable
+	}
+
+	path := make([]int64, 0)
+	for id := toID; ; id = prev[id] {
+		path = append([]int64{int64(id)}, path...)
+		if id == fromID {
+			break
+		}
+	}
+
+	return path, total, nil
+}
+
+// getNodesInOrder fetches the nodes with the given IDs and returns them in the same order
+func (d *Daggo) getNodesInOrder(ids []int64) ([]DagNode, error) {
+	return d.getNodesInOrderContext(context.Background(), ids)
+}
+
+// getNodesInOrderContext is getNodesInOrder with a context bounding its query
+func (d *Daggo) getNodesInOrderContext(ctx context.Context, ids []int64) ([]DagNode, error) {
+	found := make([]DagNode, 0, len(ids))
+	err := d.db.SelectContext(ctx, &found, "SELECT * FROM dag WHERE id = ANY($1)", pq.Int64Array(ids))
+	if err != nil {
+		return nil, fmt.Errorf("failed to get nodes: %v", err)
+	}
+
+	byID := make(map[int]DagNode, len(found))
+	for _, node := range found {
+		byID[node.ID] = node
+	}
+	nodes := make([]DagNode, 0, len(ids))
+	for _, id := range ids {
+		if node, ok := byID[int(id)]; ok {
+			nodes = append(nodes, node)
+		}
+	}
+
+	return nodes, nil
+}
+
+type costItem struct {
+	id   int
+	cost float64
+}
+
+// costQueue is a min-heap of nodes ordered by tentative cost
+type costQueue []costItem
+
+func (q costQueue) Len() int            { return len(q) }
+func (q costQueue) Less(i, j int) bool  { return q[i].cost < q[j].cost }
+func (q costQueue) Swap(i, j int)       { q[i], q[j] = q[j], q[i] }
+func (q *costQueue) Push(x interface{}) { *q = append(*q, x.(costItem)) }
+func (q *costQueue) Pop() interface{} {
+	old := *q
+	item := old[len(old)-1]
+	*q = old[:len(old)-1]
+	return item
+}
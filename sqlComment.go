@@ -0,0 +1,171 @@
+package daggo
+
+import (
+	"context"
+	"database/sql/driver"
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+)
+
+type queryTagsKey struct{}
+
+// WithQueryTags returns a context carrying tags (e.g. trace or request IDs) appended as an SQL comment to the
+// queries run with it when the Daggo was created with WithSQLComments. Tags already in ctx are kept unless
+// overridden.
+func WithQueryTags(ctx context.Context, tags map[string]string) context.Context {
+	merged := make(map[string]string)
+	if existing, ok := ctx.Value(queryTagsKey{}).(map[string]string); ok {
+		for k, v := range existing {
+			merged[k] = v
+		}
+	}
+	for k, v := range tags {
+		merged[k] = v
+	}
+	return context.WithValue(ctx, queryTagsKey{}, merged)
+}
+
+// WithSQLComments appends the query tags found in the context of each query, plus the given static tags
+// (e.g. the application name), as a sanitized comment in the sqlcommenter format:
+//
+//	SELECT ... /*application='billing',request_id='4bf92f35'*/
+//
+// so DBAs can attribute slow queries in pg_stat_statements and the logs to specific callers
+func WithSQLComments(static map[string]string) Option {
+	return func(d *Daggo) {
+		d.sqlComments = true
+		d.staticQueryTags = static
+	}
+}
+
+// sqlComment renders the tags of ctx and the static tags as a comment, or "" when there are none
+func sqlComment(ctx context.Context, static map[string]string) string {
+	tags := make(map[string]string, len(static))
+	for k, v := range static {
+		tags[k] = v
+	}
+	if fromCtx, ok := ctx.Value(queryTagsKey{}).(map[string]string); ok {
+		for k, v := range fromCtx {
+			tags[k] = v
+		}
+	}
+	if len(tags) == 0 {
+		return ""
+	}
+
+	pairs := make([]string, 0, len(tags))
+	for k, v := range tags {
+		key := sanitizeTagKey(k)
+		if key == "" {
+			continue
+		}
+		// URL encoding removes quotes and comment terminators from values
+		pairs = append(pairs, fmt.Sprintf("%s='%s'", key, url.QueryEscape(v)))
+	}
+	if len(pairs) == 0 {
+		return ""
+	}
+	sort.Strings(pairs)
+
+	return " /*" + strings.Join(pairs, ",") + "*/"
+}
+
+func sanitizeTagKey(key string) string {
+	var b strings.Builder
+	for _, r := range key {
+		if r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '_' || r == '-' || r == '.' {
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+// commentConnector wraps a driver connector so every statement sent on its connections is tagged
+type commentConnector struct {
+	driver.Connector
+	static          map[string]string
+	applicationName string
+}
+
+func (c *commentConnector) Connect(ctx context.Context) (driver.Conn, error) {
+	conn, err := c.Connector.Connect(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if c.applicationName != "" {
+		if e, ok := conn.(driver.ExecerContext); ok {
+			_, err = e.ExecContext(ctx, "SELECT set_config('application_name', $1, false)",
+				[]driver.NamedValue{{Ordinal: 1, Value: c.applicationName}})
+			if err != nil {
+				conn.Close()
+				return nil, err
+			}
+		}
+	}
+
+	return &commentConn{Conn: conn, static: c.static}, nil
+}
+
+// commentConn forwards to the wrapped connection after appending the comment to the query text
+type commentConn struct {
+	driver.Conn
+	static map[string]string
+}
+
+func (c *commentConn) tag(ctx context.Context, query string) string {
+	return query + sqlComment(ctx, c.static)
+}
+
+func (c *commentConn) PrepareContext(ctx context.Context, query string) (driver.Stmt, error) {
+	if p, ok := c.Conn.(driver.ConnPrepareContext); ok {
+		return p.PrepareContext(ctx, c.tag(ctx, query))
+	}
+	return c.Conn.Prepare(c.tag(ctx, query))
+}
+
+func (c *commentConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	q, ok := c.Conn.(driver.QueryerContext)
+	if !ok {
+		return nil, driver.ErrSkip
+	}
+	return q.QueryContext(ctx, c.tag(ctx, query), args)
+}
+
+func (c *commentConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	e, ok := c.Conn.(driver.ExecerContext)
+	if !ok {
+		return nil, driver.ErrSkip
+	}
+	return e.ExecContext(ctx, c.tag(ctx, query), args)
+}
+
+func (c *commentConn) BeginTx(ctx context.Context, opts driver.TxOptions) (driver.Tx, error) {
+	if b, ok := c.Conn.(driver.ConnBeginTx); ok {
+		return b.BeginTx(ctx, opts)
+	}
+	return c.Conn.Begin()
+}
+
+func (c *commentConn) Ping(ctx context.Context) error {
+	if p, ok := c.Conn.(driver.Pinger); ok {
+		return p.Ping(ctx)
+	}
+	return nil
+}
+
+func (c *commentConn) ResetSession(ctx context.Context) error {
+	if r, ok := c.Conn.(driver.SessionResetter); ok {
+		return r.ResetSession(ctx)
+	}
+	return nil
+}
+
+func (c *commentConn) IsValid() bool {
+	if v, ok := c.Conn.(driver.Validator); ok {
+		return v.IsValid()
+	}
+	return true
+}
@@ -0,0 +1,43 @@
+package daggo
+
+import (
+	"database/sql"
+	"errors"
+	"strings"
+
+	"github.com/lib/pq"
+)
+
+func isNoRows(err error) bool {
+	return errors.Is(err, sql.ErrNoRows)
+}
+
+// isUndefinedTable reports whether err is the database complaining about a missing table, which happens when
+// an optional side table was never created
+func isUndefinedTable(err error) bool {
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) {
+		return pqErr.Code == "42P01"
+	}
+	// SQLite and MySQL (error 1146) drivers only tell through the message
+	return err != nil && (strings.Contains(err.Error(), "no such table") || strings.Contains(err.Error(), "Error 1146"))
+}
+
+// isConstraintViolation reports whether err is the database rejecting a row because of the named constraint
+func isConstraintViolation(err error, constraint string) bool {
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) {
+		return pqErr.Constraint == constraint
+	}
+	return err != nil && strings.Contains(err.Error(), constraint)
+}
+
+// isUndefinedColumn reports whether err is the database complaining about a missing column, which happens when
+// an optional column was never added
+func isUndefinedColumn(err error) bool {
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) {
+		return pqErr.Code == "42703"
+	}
+	return err != nil && (strings.Contains(err.Error(), "no such column") || strings.Contains(err.Error(), "Unknown column"))
+}
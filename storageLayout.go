@@ -0,0 +1,294 @@
+package daggo
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+)
+
+// Storage layout migration phases
+const (
+	// LayoutDualWrite means the layout is installed and written along with the dag table, but not read
+	LayoutDualWrite = "dual_write"
+	// LayoutVerified means the last verification pass found the layout consistent with the dag table
+	LayoutVerified = "verified"
+	// LayoutActive means traversals read the layout
+	LayoutActive = "active"
+)
+
+const verificationSampleSize = 100
+
+// StorageLayout is a way of storing the edges that traversals follow. The parent_id column of the dag table is
+// always written; other layouts are kept in sync with it by triggers once installed, which lets deployments
+// move to a new layout without downtime: BeginDualWrite, VerifyLayout, then Cutover.
+type StorageLayout struct {
+	name string
+	// install creates the layout, its dual-write triggers and backfills it, idempotently
+	install string
+	// verify selects up to $1 IDs of nodes the layout disagrees with the dag table about
+	verify string
+	// down and up are the recursive steps of a traversal over the reachable CTE
+	down recursiveStep
+	up   recursiveStep
+	// closure layouts answer GetAncestors, GetDescendants and Traverse from the dag_closure table
+	closure bool
+	// pathIndex layouts answer them from the dag_path table when they are not bounded by a depth
+	pathIndex bool
+}
+
+// Name returns the name of the layout
+func (l StorageLayout) Name() string {
+	return l.name
+}
+
+// LayoutAdjacency reads the parent_id column of the dag table. Traversals only follow primary parents.
+var LayoutAdjacency = StorageLayout{
+	name: "adjacency",
+	down: recursiveStep{column: "dag.id", from: "dag JOIN reachable ON dag.parent_id = reachable.id"},
+	up: recursiveStep{
+		column: "dag.parent_id",
+		from:   "dag JOIN reachable ON dag.id = reachable.id",
+		where:  "dag.parent_id IS NOT NULL",
+	},
+}
+
+// LayoutEdgeTable reads the dag_edge table, which holds every parent of a node. It is the default layout.
+var LayoutEdgeTable = StorageLayout{
+	name:    "edges",
+	install: createEdgeTableQuery,
+	verify: `
+		SELECT id FROM (
+			SELECT dag.id
+			FROM dag
+			WHERE dag.parent_id IS NOT NULL
+				AND NOT EXISTS (SELECT 1 FROM dag_edge e WHERE e.parent_id = dag.parent_id AND e.child_id = dag.id)
+			UNION
+			SELECT e.child_id
+			FROM dag_edge e
+			WHERE NOT EXISTS (SELECT 1 FROM dag WHERE dag.id = e.child_id)
+				OR NOT EXISTS (SELECT 1 FROM dag WHERE dag.id = e.parent_id)
+		) mismatched
+		ORDER BY id
+		LIMIT $1
+	`,
+	down: recursiveStep{column: "dag_edge.child_id", from: "dag_edge JOIN reachable ON dag_edge.parent_id = reachable.id"},
+	up:   recursiveStep{column: "dag_edge.parent_id", from: "dag_edge JOIN reachable ON dag_edge.child_id = reachable.id"},
+}
+
+// storageLayouts indexes the known layouts by name
+var storageLayouts = map[string]StorageLayout{
+	LayoutAdjacency.name: LayoutAdjacency,
+	LayoutEdgeTable.name: LayoutEdgeTable,
+	LayoutClosure.name:   LayoutClosure,
+	LayoutPathIndex.name: LayoutPathIndex,
+}
+
+const createStorageLayoutTableQuery = `
+	CREATE TABLE IF NOT EXISTS dag_storage_layout (
+		name TEXT PRIMARY KEY,
+		phase TEXT NOT NULL,
+		updated_at TIMESTAMPTZ NOT NULL DEFAULT now()
+	)
+`
+
+// LayoutVerification is the outcome of VerifyLayout
+type LayoutVerification struct {
+	Layout string
+	// Mismatched lists up to 100 IDs of nodes the layout disagrees with the dag table about
+	Mismatched []int
+}
+
+// Consistent reports whether the verification found no mismatch
+func (v *LayoutVerification) Consistent() bool {
+	return len(v.Mismatched) == 0
+}
+
+// layout returns the layout traversals read
+func (d *Daggo) layout() StorageLayout {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	if d.readLayout == nil {
+		return LayoutEdgeTable
+	}
+	return *d.readLayout
+}
+
+// ActiveLayout returns the name of the layout traversals of this Daggo read
+func (d *Daggo) ActiveLayout() string {
+	return d.layout().name
+}
+
+// BeginDualWrite installs layout, backfills it from the dag table and keeps it written along with it from then
+// on. Traversals keep reading the active layout until Cutover.
+func (d *Daggo) BeginDualWrite(ctx context.Context, layout StorageLayout) error {
+	// Start a transaction
+	tx, err := d.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %v", err)
+	}
+	defer func() {
+		// Rollback the transaction if it failed to commit
+		if p := recover(); p != nil {
+			tx.Rollback()
+			panic(p)
+		} else if err != nil {
+			tx.Rollback()
+		}
+	}()
+
+	_, err = tx.ExecContext(ctx, createStorageLayoutTableQuery)
+	if err != nil {
+		return fmt.Errorf("failed to create storage layout table: %v", err)
+	}
+	if layout.install != "" {
+		_, err = tx.ExecContext(ctx, layout.install)
+		if err != nil {
+			return fmt.Errorf("failed to install layout %s: %v", layout.name, err)
+		}
+	}
+
+	// An active layout stays active
+	query := `
+		INSERT INTO dag_storage_layout (name, phase) VALUES ($1, $2)
+		ON CONFLICT (name) DO UPDATE SET phase = EXCLUDED.phase, updated_at = now()
+		WHERE dag_storage_layout.phase <> $3
+	`
+	_, err = tx.ExecContext(ctx, query, layout.name, LayoutDualWrite, LayoutActive)
+	if err != nil {
+		return fmt.Errorf("failed to record layout %s: %v", layout.name, err)
+	}
+
+	// Commit the transaction
+	err = tx.Commit()
+	if err != nil {
+		return fmt.Errorf("failed to commit transaction: %v", err)
+	}
+	d.invalidateStrategies()
+
+	return nil
+}
+
+// VerifyLayout compares layout with the dag table. A consistent layout in the dual-write phase moves to the
+// verified phase, which allows Cutover.
+func (d *Daggo) VerifyLayout(ctx context.Context, layout StorageLayout) (*LayoutVerification, error) {
+	verification := &LayoutVerification{Layout: layout.name, Mismatched: make([]int, 0)}
+
+	if layout.verify != "" {
+		err := d.db.SelectContext(ctx, &verification.Mismatched, layout.verify, verificationSampleSize)
+		if err != nil {
+			return nil, fmt.Errorf("failed to verify layout %s: %v", layout.name, err)
+		}
+	}
+	if !verification.Consistent() {
+		return verification, nil
+	}
+
+	query := "UPDATE dag_storage_layout SET phase = $2, updated_at = now() WHERE name = $1 AND phase = $3"
+	_, err := d.db.ExecContext(ctx, query, layout.name, LayoutVerified, LayoutDualWrite)
+	if err != nil {
+		return nil, fmt.Errorf("failed to record verification of layout %s: %v", layout.name, err)
+	}
+	d.invalidateStrategies()
+
+	return verification, nil
+}
+
+// Cutover makes traversals read layout, which must have been verified since it was installed. The adjacency
+// layout can always be cut over to, which is the way back from a faulty layout. The previously active layout
+// stays written. Other Daggo instances pick the change up with LoadStorageLayout.
+func (d *Daggo) Cutover(ctx context.Context, layout StorageLayout) error {
+	// Start a transaction
+	tx, err := d.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %v", err)
+	}
+	defer func() {
+		// Rollback the transaction if it failed to commit
+		if p := recover(); p != nil {
+			tx.Rollback()
+			panic(p)
+		} else if err != nil {
+			tx.Rollback()
+		}
+	}()
+
+	_, err = tx.ExecContext(ctx, createStorageLayoutTableQuery)
+	if err != nil {
+		return fmt.Errorf("failed to create storage layout table: %v", err)
+	}
+
+	if layout.name != LayoutAdjacency.name {
+		var phase string
+		err = tx.GetContext(ctx, &phase, "SELECT phase FROM dag_storage_layout WHERE name = $1 FOR UPDATE", layout.name)
+		if err == sql.ErrNoRows {
+			err = fmt.Errorf("layout %s is not installed, begin dual writes first", layout.name)
+			return err
+		} else if err != nil {
+			return fmt.Errorf("failed to get phase of layout %s: %v", layout.name, err)
+		}
+		if phase == LayoutDualWrite {
+			err = fmt.Errorf("layout %s must be verified before cutover", layout.name)
+			return err
+		}
+	}
+
+	_, err = tx.ExecContext(ctx, "UPDATE dag_storage_layout SET phase = $1, updated_at = now() WHERE phase = $2", LayoutDualWrite, LayoutActive)
+	if err != nil {
+		return fmt.Errorf("failed to demote active layout: %v", err)
+	}
+	query := `
+		INSERT INTO dag_storage_layout (name, phase) VALUES ($1, $2)
+		ON CONFLICT (name) DO UPDATE SET phase = EXCLUDED.phase, updated_at = now()
+	`
+	_, err = tx.ExecContext(ctx, query, layout.name, LayoutActive)
+	if err != nil {
+		return fmt.Errorf("failed to activate layout %s: %v", layout.name, err)
+	}
+
+	// Commit the transaction
+	err = tx.Commit()
+	if err != nil {
+		return fmt.Errorf("failed to commit transaction: %v", err)
+	}
+
+	return d.useLayout(layout)
+}
+
+// LoadStorageLayout makes traversals read the layout recorded as active in the database, or the edge table
+// when none is
+func (d *Daggo) LoadStorageLayout(ctx context.Context) error {
+	var name string
+	err := d.db.GetContext(ctx, &name, "SELECT name FROM dag_storage_layout WHERE phase = $1", LayoutActive)
+	if err == sql.ErrNoRows || isUndefinedTable(err) {
+		return d.useLayout(LayoutEdgeTable)
+	} else if err != nil {
+		return fmt.Errorf("failed to get active layout: %v", err)
+	}
+
+	layout, ok := storageLayouts[name]
+	if !ok {
+		return fmt.Errorf("unknown storage layout %s", name)
+	}
+	return d.useLayout(layout)
+}
+
+// useLayout switches the layout traversals read and prepares the registered plans again against it
+func (d *Daggo) useLayout(layout StorageLayout) error {
+	d.mu.Lock()
+	d.readLayout = &layout
+	d.strategies = nil
+	plans := make([]TraversalPlan, 0, len(d.plans))
+	for _, plan := range d.plans {
+		plans = append(plans, plan.TraversalPlan)
+	}
+	d.mu.Unlock()
+
+	for _, plan := range plans {
+		if err := d.RegisterPlan(plan); err != nil {
+			return err
+		}
+	}
+	d.InvalidatePlanCache()
+
+	return nil
+}
@@ -0,0 +1,446 @@
+package daggo
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// ServerReplicaID identifies changes made directly against the Postgres source in version vectors
+const ServerReplicaID = "server"
+
+// ErrGraphChange is returned by Push for changes that would move a node to another graph
+var ErrGraphChange = errors.New("node cannot change graph")
+
+// VersionVector counts the changes each replica made to a node
+type VersionVector map[string]int64
+
+// Descends reports whether v has seen every change recorded in other
+func (v VersionVector) Descends(other VersionVector) bool {
+	for replica, counter := range other {
+		if v[replica] < counter {
+			return false
+		}
+	}
+	return true
+}
+
+// Merge returns the pairwise maximum of v and other
+func (v VersionVector) Merge(other VersionVector) VersionVector {
+	merged := make(VersionVector, len(v))
+	for replica, counter := range v {
+		merged[replica] = counter
+	}
+	for replica, counter := range other {
+		if counter > merged[replica] {
+			merged[replica] = counter
+		}
+	}
+	return merged
+}
+
+// Value implements driver.Valuer so a VersionVector is stored as JSONB
+func (v VersionVector) Value() (driver.Value, error) {
+	if v == nil {
+		return []byte("{}"), nil
+	}
+	return json.Marshal(v)
+}
+
+// Scan implements sql.Scanner so a VersionVector can be read back from JSONB
+func (v *VersionVector) Scan(src interface{}) error {
+	switch b := src.(type) {
+	case []byte:
+		return json.Unmarshal(b, v)
+	case string:
+		return json.Unmarshal([]byte(b), v)
+	default:
+		return fmt.Errorf("cannot scan %T into VersionVector", src)
+	}
+}
+
+// NodeChange is the unit exchanged by the sync protocol: the latest known state of a node and its version vector
+type NodeChange struct {
+	NodeID   int           `db:"node_id" json:"node_id"`
+	RootID   int           `db:"root_id" json:"root_id"`
+	ParentID sql.NullInt64 `db:"parent_id" json:"-"`
+	Deleted  bool          `db:"deleted" json:"deleted"`
+	Vector   VersionVector `db:"vector" json:"vector"`
+	// Seq orders changes on the server; clients pass the highest one they saw as the next pull cursor
+	Seq int64 `db:"seq" json:"seq"`
+	// Parent mirrors ParentID for the JSON wire format; nil for roots
+	Parent *int `db:"-" json:"parent_id"`
+}
+
+// PullResponse carries the changes a replica has not seen yet
+type PullResponse struct {
+	Changes []NodeChange `json:"changes"`
+	Cursor  int64        `json:"cursor"`
+}
+
+// PushResult tells a replica which of its changes were applied and which conflicted with concurrent changes.
+// Conflicts carry the server version of the node so the replica can resolve and push again.
+type PushResult struct {
+	Applied   []int        `json:"applied"`
+	Conflicts []NodeChange `json:"conflicts"`
+}
+
+// Writes made outside of the sync protocol bump the server counter of the node's vector. The push path sets
+// daggo.sync_replica for its transaction and maintains the vectors itself.
+const createSyncTableQuery = `
+	CREATE SEQUENCE IF NOT EXISTS dag_sync_seq;
+	CREATE TABLE IF NOT EXISTS dag_sync (
+		node_id INTEGER PRIMARY KEY,
+		root_id INTEGER NOT NULL,
+		parent_id INTEGER,
+		deleted BOOLEAN NOT NULL DEFAULT FALSE,
+		vector JSONB NOT NULL DEFAULT '{}',
+		seq BIGINT NOT NULL DEFAULT nextval('dag_sync_seq')
+	);
+	CREATE INDEX IF NOT EXISTS dag_sync_root_seq_idx ON dag_sync (root_id, seq);
+
+	CREATE OR REPLACE FUNCTION dag_sync_record() RETURNS trigger AS $$
+	DECLARE
+		row_data dag;
+	BEGIN
+		IF COALESCE(current_setting('daggo.sync_replica', true), '') <> '' THEN
+			RETURN NULL;
+		END IF;
+		IF TG_OP = 'DELETE' THEN
+			row_data := OLD;
+		ELSE
+			row_data := NEW;
+		END IF;
+		INSERT INTO dag_sync (node_id, root_id, parent_id, deleted, vector)
+		VALUES (row_data.id, row_data.root_id, row_data.parent_id, TG_OP = 'DELETE', jsonb_build_object('server', 1))
+		ON CONFLICT (node_id) DO UPDATE
+		SET root_id = EXCLUDED.root_id,
+			parent_id = EXCLUDED.parent_id,
+			deleted = EXCLUDED.deleted,
+			vector = dag_sync.vector || jsonb_build_object('server', COALESCE((dag_sync.vector->>'server')::bigint, 0) + 1),
+			seq = nextval('dag_sync_seq');
+		RETURN NULL;
+	END;
+	$$ LANGUAGE plpgsql;
+
+	DROP TRIGGER IF EXISTS dag_sync_trigger ON dag;
+	CREATE TRIGGER dag_sync_trigger
+		AFTER INSERT OR UPDATE OR DELETE ON dag
+		FOR EACH ROW EXECUTE FUNCTION dag_sync_record();
+`
+
+// CreateSyncTable creates the table tracking version vectors per node and installs the trigger maintaining it
+func (d *Daggo) CreateSyncTable() error {
+	_, err := d.db.Exec(createSyncTableQuery)
+	if err != nil {
+		return fmt.Errorf("failed to create sync table: %v", err)
+	}
+
+	return nil
+}
+
+// Pull returns up to limit changes to the graph rooted at rootID made after the given cursor
+func (d *Daggo) Pull(rootID int, cursor int64, limit int) (*PullResponse, error) {
+	changes := make([]NodeChange, 0)
+
+	query := "SELECT * FROM dag_sync WHERE root_id = $1 AND seq > $2 ORDER BY seq ASC LIMIT $3"
+	err := d.db.Select(&changes, query, rootID, cursor, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to pull changes: %v", err)
+	}
+
+	response := &PullResponse{Changes: changes, Cursor: cursor}
+	for i := range changes {
+		changes[i].fillParent()
+		response.Cursor = changes[i].Seq
+	}
+
+	return response, nil
+}
+
+// Push applies the changes made by replicaID. A change is applied when its vector descends from the server
+// version, ignored when the server already saw it, and reported as a conflict when both sides changed the node.
+// Changes cannot move a node to another graph: the push fails with ErrGraphChange. It fails with ErrParentNotFound
+// for a parent missing from the graph, ErrNodeNotFound for a new node of a graph that does not exist and
+// ErrCycleDetected for a parent that descends from the node.
+func (d *Daggo) Push(replicaID string, changes []NodeChange) (*PushResult, error) {
+	return d.PushContext(context.Background(), replicaID, changes)
+}
+
+// PushContext is Push with a context bounding its queries. When ctx carries an API key, see APIKeyFromContext,
+// the push fails with ErrAPIKeyForbidden unless the key covers the graphs the changed nodes are stored in, rather
+// than the graphs the changes claim.
+func (d *Daggo) PushContext(ctx context.Context, replicaID string, changes []NodeChange) (*PushResult, error) {
+	if replicaID == "" || replicaID == ServerReplicaID {
+		return nil, fmt.Errorf("invalid replica ID %q", replicaID)
+	}
+	key := APIKeyFromContext(ctx)
+
+	// Start a transaction
+	tx, err := d.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %v", err)
+	}
+	defer func() {
+		// Rollback the transaction if it failed to commit
+		if p := recover(); p != nil {
+			tx.Rollback()
+			panic(p)
+		} else if err != nil {
+			tx.Rollback()
+		}
+	}()
+
+	err = d.setTxActor(ctx, tx)
+	if err != nil {
+		return nil, err
+	}
+
+	// Let the sync trigger know this transaction maintains the vectors itself
+	_, err = tx.ExecContext(ctx, "SELECT set_config('daggo.sync_replica', $1, true)", replicaID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to tag sync transaction: %v", err)
+	}
+
+	result := &PushResult{Applied: make([]int, 0), Conflicts: make([]NodeChange, 0)}
+	inserted := make(map[int]int64)
+	for _, change := range changes {
+		change.fillParentID()
+
+		var current NodeChange
+		err = tx.GetContext(ctx, &current, "SELECT * FROM dag_sync WHERE node_id = $1 FOR UPDATE", change.NodeID)
+		exists := true
+		if err == sql.ErrNoRows {
+			exists = false
+			err = nil
+		} else if err != nil {
+			return nil, fmt.Errorf("failed to read node version: %v", err)
+		}
+
+		// Changes are keyed by node ID, so they are checked against the graph the node is stored in
+		err = checkPushGraph(ctx, tx, key, change, exists, current.RootID)
+		if err != nil {
+			return nil, err
+		}
+
+		if exists && current.Vector.Descends(change.Vector) {
+			continue // Already seen
+		}
+		if exists && !change.Vector.Descends(current.Vector) {
+			current.fillParent()
+			result.Conflicts = append(result.Conflicts, current)
+			continue
+		}
+
+		if !change.Deleted && change.ParentID.Valid {
+			err = checkCycle(ctx, tx, int(change.ParentID.Int64), change.NodeID)
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		// The node is locked and keeps its graph, so it is updated when it exists rather than upserted, which a
+		// partitioned dag table without a unique index on id would refuse
+		var res sql.Result
+		if change.Deleted {
+			_, err = tx.ExecContext(ctx, "DELETE FROM dag WHERE id = $1", change.NodeID)
+		} else {
+			res, err = tx.ExecContext(ctx, "UPDATE dag SET parent_id = $2 WHERE id = $1", change.NodeID, change.ParentID)
+			var updated int64
+			if err == nil {
+				updated, err = res.RowsAffected()
+			}
+			if err == nil && updated == 0 {
+				_, err = tx.ExecContext(ctx, "INSERT INTO dag (id, parent_id, root_id) VALUES ($1, $2, $3)",
+					change.NodeID, change.ParentID, change.RootID)
+				inserted[change.RootID]++
+			}
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to apply change to node %d: %v", change.NodeID, err)
+		}
+
+		_, err = tx.ExecContext(ctx, `
+			INSERT INTO dag_sync (node_id, root_id, parent_id, deleted, vector)
+			VALUES ($1, $2, $3, $4, $5)
+			ON CONFLICT (node_id) DO UPDATE
+			SET root_id = EXCLUDED.root_id,
+				parent_id = EXCLUDED.parent_id,
+				deleted = EXCLUDED.deleted,
+				vector = EXCLUDED.vector,
+				seq = nextval('dag_sync_seq')
+		`, change.NodeID, change.RootID, change.ParentID, change.Deleted, change.Vector.Merge(current.Vector))
+		if err != nil {
+			return nil, fmt.Errorf("failed to record node version: %v", err)
+		}
+		result.Applied = append(result.Applied, change.NodeID)
+	}
+
+	// Refuse the push if its new nodes exceed the graph or tenant quotas; the usage already counts them
+	if d.enforceQuotas {
+		for rootID := range inserted {
+			err = checkQuota(ctx, tx, rootID, 0)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	// Commit the transaction
+	err = tx.Commit()
+	if err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %v", err)
+	}
+
+	d.InvalidatePlanCache()
+
+	return result, nil
+}
+
+// checkPushGraph returns ErrGraphChange if change would move its node, or attach it below a parent, to another
+// graph than the one the node is stored in, and ErrAPIKeyForbidden if key, when not nil, does not cover that graph.
+// The parent must exist, and so must the graph of a new node unless the node is its root. synced tells whether the
+// node has a version, whose root is syncedRootID, which outlives deleted nodes.
+func checkPushGraph(ctx context.Context, tx *sqlx.Tx, key *APIKey, change NodeChange, synced bool, syncedRootID int) error {
+	rootIDs := make([]int, 0, 1)
+	err := tx.SelectContext(ctx, &rootIDs, "SELECT root_id FROM dag WHERE id = $1 FOR UPDATE", change.NodeID)
+	if err != nil {
+		return fmt.Errorf("failed to get node %d: %v", change.NodeID, err)
+	}
+	if !change.Deleted && len(rootIDs) == 0 && change.NodeID != change.RootID {
+		var graphExists bool
+		query := "SELECT EXISTS (SELECT 1 FROM dag WHERE id = $1 AND root_id = $1)"
+		err = tx.GetContext(ctx, &graphExists, query, change.RootID)
+		if err != nil {
+			return fmt.Errorf("failed to get node %d: %v", change.RootID, err)
+		}
+		if !graphExists {
+			return fmt.Errorf("%w: root %d of node %d", ErrNodeNotFound, change.RootID, change.NodeID)
+		}
+	}
+	if synced {
+		rootIDs = append(rootIDs, syncedRootID)
+	}
+	for _, rootID := range rootIDs {
+		if !change.Deleted && rootID != change.RootID {
+			return fmt.Errorf("%w: node %d belongs to graph %d, not %d", ErrGraphChange, change.NodeID, rootID, change.RootID)
+		}
+	}
+	if !change.Deleted && change.ParentID.Valid {
+		parentRootIDs := make([]int, 0, 1)
+		err = tx.SelectContext(ctx, &parentRootIDs, "SELECT root_id FROM dag WHERE id = $1", change.ParentID.Int64)
+		if err != nil {
+			return fmt.Errorf("failed to get node %d: %v", change.ParentID.Int64, err)
+		}
+		if len(parentRootIDs) == 0 {
+			return fmt.Errorf("%w: %d of node %d", ErrParentNotFound, change.ParentID.Int64, change.NodeID)
+		}
+		if parentRootIDs[0] != change.RootID {
+			return fmt.Errorf("%w: parent %d of node %d belongs to graph %d, not %d", ErrGraphChange,
+				change.ParentID.Int64, change.NodeID, parentRootIDs[0], change.RootID)
+		}
+	}
+
+	if key == nil {
+		return nil
+	}
+	if !change.Deleted || len(rootIDs) == 0 {
+		rootIDs = append(rootIDs, change.RootID)
+	}
+	for _, rootID := range rootIDs {
+		if !key.AllowsGraph(rootID) {
+			return fmt.Errorf("%w: key %s does not cover graph %d", ErrAPIKeyForbidden, key.Prefix, rootID)
+		}
+	}
+
+	return nil
+}
+
+// SyncHandler exposes the sync protocol over HTTP:
+//
+//	GET  /pull?root_id=1&cursor=0&limit=500
+//	POST /push?replica_id=laptop-1 with a JSON array of NodeChange
+func SyncHandler(d *Daggo) http.Handler {
+	mux := http.NewServeMux()
+
+	mux.HandleFunc("/pull", func(w http.ResponseWriter, r *http.Request) {
+		rootID, err := strconv.Atoi(r.URL.Query().Get("root_id"))
+		if err != nil {
+			http.Error(w, "invalid root_id", http.StatusBadRequest)
+			return
+		}
+		cursor, _ := strconv.ParseInt(r.URL.Query().Get("cursor"), 10, 64)
+		limit, err := strconv.Atoi(r.URL.Query().Get("limit"))
+		if err != nil || limit <= 0 {
+			limit = 500
+		}
+
+		response, err := d.Pull(rootID, cursor, limit)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		writeJSON(w, response)
+	})
+
+	mux.HandleFunc("/push", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		var changes []NodeChange
+		if err := json.NewDecoder(r.Body).Decode(&changes); err != nil {
+			http.Error(w, "invalid request body", http.StatusBadRequest)
+			return
+		}
+
+		// The API key of the request is checked against the graphs the changed nodes are stored in
+		result, err := d.PushContext(r.Context(), r.URL.Query().Get("replica_id"), changes)
+		if errors.Is(err, ErrAPIKeyForbidden) {
+			http.Error(w, err.Error(), http.StatusForbidden)
+			return
+		} else if errors.Is(err, ErrGraphChange) || errors.Is(err, ErrCycleDetected) {
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
+		} else if errors.Is(err, ErrParentNotFound) || errors.Is(err, ErrNodeNotFound) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		} else if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		writeJSON(w, result)
+	})
+
+	return mux
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
+
+// fillParent copies ParentID into the wire field
+func (c *NodeChange) fillParent() {
+	if c.ParentID.Valid {
+		parent := int(c.ParentID.Int64)
+		c.Parent = &parent
+	} else {
+		c.Parent = nil
+	}
+}
+
+// fillParentID copies the wire field into ParentID
+func (c *NodeChange) fillParentID() {
+	if c.Parent != nil {
+		c.ParentID = sql.NullInt64{Int64: int64(*c.Parent), Valid: true}
+	}
+}
@@ -0,0 +1,77 @@
+package daggo_test
+
+import (
+	"reflect"
+	"testing"
+
+	"daggo"
+)
+
+func TestVersionVectorDescends(t *testing.T) {
+	tests := []struct {
+		name  string
+		v     daggo.VersionVector
+		other daggo.VersionVector
+		want  bool
+	}{
+		{"equal", daggo.VersionVector{"a": 2, "b": 1}, daggo.VersionVector{"a": 2, "b": 1}, true},
+		{"ahead", daggo.VersionVector{"a": 3, "b": 1}, daggo.VersionVector{"a": 2, "b": 1}, true},
+		{"behind", daggo.VersionVector{"a": 1, "b": 1}, daggo.VersionVector{"a": 2, "b": 1}, false},
+		{"concurrent", daggo.VersionVector{"a": 2, "b": 0}, daggo.VersionVector{"a": 1, "b": 1}, false},
+		{"replica missing from v", daggo.VersionVector{"a": 2}, daggo.VersionVector{"a": 2, "b": 1}, false},
+		{"replica missing from other", daggo.VersionVector{"a": 2, "b": 1}, daggo.VersionVector{"a": 2}, true},
+		{"zero counter of missing replica", daggo.VersionVector{"a": 2}, daggo.VersionVector{"a": 2, "b": 0}, true},
+		{"empty other", daggo.VersionVector{"a": 1}, daggo.VersionVector{}, true},
+		{"nil vectors", nil, nil, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.v.Descends(tt.other); got != tt.want {
+				t.Errorf("%v.Descends(%v) = %v, want %v", tt.v, tt.other, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestVersionVectorMerge(t *testing.T) {
+	tests := []struct {
+		name  string
+		v     daggo.VersionVector
+		other daggo.VersionVector
+		want  daggo.VersionVector
+	}{
+		{"equal", daggo.VersionVector{"a": 2, "b": 1}, daggo.VersionVector{"a": 2, "b": 1}, daggo.VersionVector{"a": 2, "b": 1}},
+		{"concurrent", daggo.VersionVector{"a": 2, "b": 0}, daggo.VersionVector{"a": 1, "b": 3}, daggo.VersionVector{"a": 2, "b": 3}},
+		{"replica missing from v", daggo.VersionVector{"a": 2}, daggo.VersionVector{"b": 1}, daggo.VersionVector{"a": 2, "b": 1}},
+		{"replica missing from other", daggo.VersionVector{"a": 2, "b": 1}, daggo.VersionVector{"a": 1}, daggo.VersionVector{"a": 2, "b": 1}},
+		{"nil v", nil, daggo.VersionVector{"a": 1}, daggo.VersionVector{"a": 1}},
+		{"nil vectors", nil, nil, daggo.VersionVector{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := tt.v.Merge(tt.other)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("%v.Merge(%v) = %v, want %v", tt.v, tt.other, got, tt.want)
+			}
+			if !got.Descends(tt.v) || !got.Descends(tt.other) {
+				t.Errorf("merge %v does not descend from both %v and %v", got, tt.v, tt.other)
+			}
+		})
+	}
+}
+
+func TestVersionVectorMergeLeavesInputs(t *testing.T) {
+	v := daggo.VersionVector{"a": 1}
+	other := daggo.VersionVector{"a": 2, "b": 1}
+
+	v.Merge(other)
+
+	if !reflect.DeepEqual(v, daggo.VersionVector{"a": 1}) {
+		t.Errorf("merge changed its receiver to %v", v)
+	}
+	if !reflect.DeepEqual(other, daggo.VersionVector{"a": 2, "b": 1}) {
+		t.Errorf("merge changed its argument to %v", other)
+	}
+}
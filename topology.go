@@ -0,0 +1,101 @@
+package daggo
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"github.com/lib/pq"
+)
+
+// TopologicalSort returns the nodes of the graph rooted at rootID in dependency order: every node comes after
+// all of its parents. Nodes of the same execution level are ordered by ID.
+func (d *Daggo) TopologicalSort(rootID int, opts ...TraversalOption) ([]DagNode, error) {
+	return d.TopologicalSortContext(context.Background(), rootID, opts...)
+}
+
+// TopologicalSortContext is TopologicalSort with a context bounding its queries
+func (d *Daggo) TopologicalSortContext(ctx context.Context, rootID int, opts ...TraversalOption) ([]DagNode, error) {
+	levels, err := d.GetExecutionLevelsContext(ctx, rootID, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	order := make([]DagNode, 0)
+	for _, level := range levels {
+		order = append(order, level...)
+	}
+
+	return order, nil
+}
+
+// GetExecutionLevels groups the nodes of the graph rooted at rootID into levels that can run in parallel: the
+// first level holds the root and every later level the nodes whose parents all belong to earlier levels.
+// Nodes are ordered by ID within a level. The graph is loaded with a single query.
+func (d *Daggo) GetExecutionLevels(rootID int, opts ...TraversalOption) ([][]DagNode, error) {
+	return d.GetExecutionLevelsContext(context.Background(), rootID, opts...)
+}
+
+// GetExecutionLevelsContext is GetExecutionLevels with a context bounding its queries
+func (d *Daggo) GetExecutionLevelsContext(ctx context.Context, rootID int, opts ...TraversalOption) ([][]DagNode, error) {
+	type nodeWithParents struct {
+		DagNode
+		ParentIDs pq.Int64Array `db:"parent_ids"`
+	}
+	rows := make([]nodeWithParents, 0)
+
+	// Grouping by root_id too keeps the query valid on partitioned dag tables
+	query := `
+		SELECT dag.*, COALESCE(array_agg(dag_edge.parent_id) FILTER (WHERE dag_edge.parent_id IS NOT NULL), '{}') AS parent_ids
+		FROM dag
+		LEFT JOIN dag_edge ON dag_edge.child_id = dag.id
+		WHERE dag.root_id = $1
+		GROUP BY dag.root_id, dag.id
+	`
+	err := d.reader(ctx, newTraversalOptions(opts).consistency).SelectContext(ctx, &rows, query, rootID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load graph: %v", err)
+	}
+
+	nodes := make(map[int]DagNode, len(rows))
+	children := make(map[int][]int)
+	pending := make(map[int]int, len(rows))
+	for _, row := range rows {
+		nodes[row.ID] = row.DagNode
+		pending[row.ID] = len(row.ParentIDs)
+		for _, parentID := range row.ParentIDs {
+			children[int(parentID)] = append(children[int(parentID)], row.ID)
+		}
+	}
+	if _, ok := nodes[rootID]; !ok {
+		return nil, fmt.Errorf("node with ID %d is not the root of a graph", rootID)
+	}
+
+	// Kahn's algorithm, one level at a time; nodes left pending lie on a cycle or below one
+	levels := make([][]DagNode, 0)
+	current := []int{rootID}
+	for len(current) > 0 {
+		sort.Ints(current)
+		level := make([]DagNode, 0, len(current))
+		next := make([]int, 0)
+		for _, id := range current {
+			level = append(level, nodes[id])
+			for _, childID := range children[id] {
+				pending[childID]--
+				if pending[childID] == 0 {
+					next = append(next, childID)
+				}
+			}
+		}
+		levels = append(levels, level)
+		current = next
+	}
+
+	for id, count := range pending {
+		if count > 0 && id != rootID {
+			return nil, fmt.Errorf("%w: graph rooted at %d contains a cycle through node %d", ErrCycleDetected, rootID, id)
+		}
+	}
+
+	return levels, nil
+}
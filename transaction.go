@@ -0,0 +1,299 @@
+package daggo
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// WithTx returns a Daggo running every operation inside tx, a transaction the caller opened on the same
+// database and commits or rolls back itself, so that its own writes and the graph changes are atomic. Operations
+// that use a transaction of their own run in a savepoint of tx: when one fails, its changes are rolled back and
+// tx stays usable. The returned Daggo must not be used concurrently nor after tx ends; Close releases it without
+// touching tx. Replicas, SQL comments and fault injection are not used inside tx.
+func (d *Daggo) WithTx(tx *sqlx.Tx) *Daggo {
+	var connector driver.Connector = &txConnector{tx: tx}
+	if d.Dialect() != DialectPostgres {
+		connector = &dialectConnector{Connector: connector, dialect: d.dialect}
+	}
+	db := sqlx.NewDb(sql.OpenDB(connector), "postgres")
+	// Statements run one after the other on tx, like on any connection
+	db.SetMaxOpenConns(1)
+
+	txDaggo := &Daggo{
+		db:                db,
+		driverName:        d.driverName,
+		dialect:           d.dialect,
+		enforceQuotas:     d.enforceQuotas,
+		adaptiveThreshold: d.adaptiveThreshold,
+		attribution:       d.attribution,
+		defaultActor:      d.defaultActor,
+		notifications:     d.notifications,
+		payloadCodecs:     d.payloadCodecs,
+	}
+
+	d.mu.RLock()
+	txDaggo.readLayout = d.readLayout
+	txDaggo.strategies = d.strategies
+	if d.nodeTypes != nil {
+		txDaggo.nodeTypes = make(map[string]*JSONSchema, len(d.nodeTypes))
+		for name, schema := range d.nodeTypes {
+			txDaggo.nodeTypes[name] = schema
+		}
+	}
+	if d.typeCodecs != nil {
+		txDaggo.typeCodecs = make(map[string]string, len(d.typeCodecs))
+		for nodeType, codec := range d.typeCodecs {
+			txDaggo.typeCodecs[nodeType] = codec
+		}
+	}
+	d.mu.RUnlock()
+
+	return txDaggo
+}
+
+// Tx runs fn with a Daggo whose operations all run in one transaction, committed when fn returns nil and rolled
+// back otherwise, e.g. to add several nodes and move a subtree atomically
+func (d *Daggo) Tx(ctx context.Context, fn func(txDaggo *Daggo) error) error {
+	// Start a transaction
+	tx, err := d.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %v", err)
+	}
+	defer func() {
+		// Rollback the transaction if it failed to commit
+		if p := recover(); p != nil {
+			tx.Rollback()
+			panic(p)
+		} else if err != nil {
+			tx.Rollback()
+		}
+	}()
+
+	txDaggo := d.WithTx(tx)
+	defer txDaggo.Close()
+
+	err = fn(txDaggo)
+	if err != nil {
+		return err
+	}
+
+	// Commit the transaction
+	err = tx.Commit()
+	if err != nil {
+		return fmt.Errorf("failed to commit transaction: %v", err)
+	}
+
+	d.InvalidatePlanCache()
+
+	return nil
+}
+
+// BeginSnapshot returns a read-only Daggo whose reads all observe the graph as it was when the snapshot was
+// taken, pinned to a repeatable read transaction, so that workflows of several queries such as an export, a
+// diff or a report see one consistent graph while writers go on. Writes through it fail. The snapshot lasts
+// until Close or until ctx is done; meanwhile it holds a connection and keeps the database from vacuuming the
+// rows it may read, so snapshots should stay short. Like WithTx, it must not be used concurrently.
+func (d *Daggo) BeginSnapshot(ctx context.Context) (*Daggo, error) {
+	tx, err := d.db.BeginTxx(ctx, &sql.TxOptions{Isolation: sql.LevelRepeatableRead, ReadOnly: true})
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin snapshot: %v", err)
+	}
+
+	// The snapshot is taken by the first statement of the transaction rather than by BEGIN
+	_, err = tx.ExecContext(ctx, "SELECT 1")
+	if err != nil {
+		tx.Rollback()
+		return nil, fmt.Errorf("failed to take snapshot: %v", err)
+	}
+
+	snapshot := d.WithTx(tx)
+	snapshot.snapshotTx = tx
+
+	return snapshot, nil
+}
+
+// txConnector hands out connections running their statements in a transaction opened by the caller
+type txConnector struct {
+	tx *sqlx.Tx
+
+	mu         sync.Mutex
+	savepoints int
+}
+
+func (c *txConnector) Connect(context.Context) (driver.Conn, error) {
+	return &txConn{connector: c}, nil
+}
+
+func (c *txConnector) Driver() driver.Driver {
+	return txDriver{}
+}
+
+// txDriver only exists to satisfy driver.Connector; connections come from txConnector
+type txDriver struct{}
+
+func (txDriver) Open(string) (driver.Conn, error) {
+	return nil, errors.New("transaction connections cannot be opened by name")
+}
+
+// txConn runs statements on the transaction of its connector and turns nested transactions into savepoints
+type txConn struct {
+	connector *txConnector
+}
+
+func (c *txConn) Prepare(query string) (driver.Stmt, error) {
+	return &txStmt{conn: c, query: query}, nil
+}
+
+func (c *txConn) Close() error {
+	return nil
+}
+
+func (c *txConn) Begin() (driver.Tx, error) {
+	return c.BeginTx(context.Background(), driver.TxOptions{})
+}
+
+func (c *txConn) BeginTx(ctx context.Context, opts driver.TxOptions) (driver.Tx, error) {
+	c.connector.mu.Lock()
+	c.connector.savepoints++
+	name := fmt.Sprintf("daggo_savepoint_%d", c.connector.savepoints)
+	c.connector.mu.Unlock()
+
+	_, err := c.connector.tx.ExecContext(ctx, "SAVEPOINT "+name)
+	if err != nil {
+		return nil, err
+	}
+	return &txSavepoint{tx: c.connector.tx, name: name}, nil
+}
+
+func (c *txConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	rows, err := c.connector.tx.QueryContext(ctx, query, namedValuesToArgs(args)...)
+	if err != nil {
+		return nil, err
+	}
+	columns, err := rows.Columns()
+	if err != nil {
+		rows.Close()
+		return nil, err
+	}
+	return &txRows{rows: rows, columns: columns}, nil
+}
+
+func (c *txConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	return c.connector.tx.ExecContext(ctx, query, namedValuesToArgs(args)...)
+}
+
+// CheckNamedValue passes every argument through untouched; the driver of the transaction converts them
+func (c *txConn) CheckNamedValue(*driver.NamedValue) error {
+	return nil
+}
+
+// txSavepoint is a nested transaction of a txConn
+type txSavepoint struct {
+	tx   *sqlx.Tx
+	name string
+}
+
+func (s *txSavepoint) Commit() error {
+	_, err := s.tx.Exec("RELEASE SAVEPOINT " + s.name)
+	return err
+}
+
+func (s *txSavepoint) Rollback() error {
+	_, err := s.tx.Exec("ROLLBACK TO SAVEPOINT " + s.name)
+	if err != nil {
+		return err
+	}
+	_, err = s.tx.Exec("RELEASE SAVEPOINT " + s.name)
+	return err
+}
+
+// txStmt defers to its connection; the driver of the transaction prepares the statement on every use
+type txStmt struct {
+	conn  *txConn
+	query string
+}
+
+func (s *txStmt) Close() error {
+	return nil
+}
+
+func (s *txStmt) NumInput() int {
+	return -1
+}
+
+func (s *txStmt) Exec(args []driver.Value) (driver.Result, error) {
+	return s.conn.ExecContext(context.Background(), s.query, valuesToNamedValues(args))
+}
+
+func (s *txStmt) Query(args []driver.Value) (driver.Rows, error) {
+	return s.conn.QueryContext(context.Background(), s.query, valuesToNamedValues(args))
+}
+
+func (s *txStmt) ExecContext(ctx context.Context, args []driver.NamedValue) (driver.Result, error) {
+	return s.conn.ExecContext(ctx, s.query, args)
+}
+
+func (s *txStmt) QueryContext(ctx context.Context, args []driver.NamedValue) (driver.Rows, error) {
+	return s.conn.QueryContext(ctx, s.query, args)
+}
+
+// txRows reads the rows of a query run on the transaction
+type txRows struct {
+	rows    *sql.Rows
+	columns []string
+}
+
+func (r *txRows) Columns() []string {
+	return r.columns
+}
+
+func (r *txRows) Close() error {
+	return r.rows.Close()
+}
+
+func (r *txRows) Next(dest []driver.Value) error {
+	if !r.rows.Next() {
+		if err := r.rows.Err(); err != nil {
+			return err
+		}
+		return io.EOF
+	}
+
+	values := make([]interface{}, len(dest))
+	pointers := make([]interface{}, len(dest))
+	for i := range values {
+		pointers[i] = &values[i]
+	}
+	err := r.rows.Scan(pointers...)
+	if err != nil {
+		return err
+	}
+	for i, value := range values {
+		dest[i] = value
+	}
+
+	return nil
+}
+
+func namedValuesToArgs(named []driver.NamedValue) []interface{} {
+	args := make([]interface{}, 0, len(named))
+	for _, v := range named {
+		args = append(args, v.Value)
+	}
+	return args
+}
+
+func valuesToNamedValues(values []driver.Value) []driver.NamedValue {
+	named := make([]driver.NamedValue, 0, len(values))
+	for i, v := range values {
+		named = append(named, driver.NamedValue{Ordinal: i + 1, Value: v})
+	}
+	return named
+}
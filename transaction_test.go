@@ -0,0 +1,131 @@
+package daggo_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"daggo"
+	"daggo/daggotest"
+
+	"github.com/jmoiron/sqlx"
+	_ "github.com/lib/pq"
+)
+
+// setupTx connects to the test database and empties the dag tables
+func setupTx(t *testing.T, opts ...daggo.Option) (*daggo.Daggo, *sqlx.DB) {
+	t.Helper()
+
+	dsn := daggotest.PostgresDSN(t)
+	db, err := sqlx.Connect("postgres", dsn)
+	if err != nil {
+		t.Fatalf("failed to connect: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	d, err := daggo.NewDaggo(dsn, opts...)
+	if err != nil {
+		t.Fatalf("failed to create daggo: %v", err)
+	}
+	t.Cleanup(func() { d.Close() })
+
+	if err := d.Migrate(context.Background()); err != nil {
+		t.Fatalf("failed to migrate schema: %v", err)
+	}
+	if _, err := db.Exec("TRUNCATE dag, dag_edge"); err != nil {
+		t.Fatalf("failed to truncate dag tables: %v", err)
+	}
+
+	return d, db
+}
+
+func TestWithTxAddChildNode(t *testing.T) {
+	d, db := setupTx(t)
+
+	// A deadlock holds the only connection of the transaction forever, so bound the test
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	tx, err := db.BeginTxx(ctx, nil)
+	if err != nil {
+		t.Fatalf("failed to begin transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	txDaggo := d.WithTx(tx)
+	defer txDaggo.Close()
+
+	if err := txDaggo.AddRootNodeContext(ctx, 1); err != nil {
+		t.Fatalf("failed to add root node: %v", err)
+	}
+	if err := txDaggo.AddChildNodeContext(ctx, 2, 1); err != nil {
+		t.Fatalf("failed to add child node: %v", err)
+	}
+	if err := txDaggo.AddChildNodeContext(ctx, 3, 2); err != nil {
+		t.Fatalf("failed to add grandchild node: %v", err)
+	}
+	if err := txDaggo.AddEdgeContext(ctx, 1, 3); err != nil {
+		t.Fatalf("failed to add edge: %v", err)
+	}
+
+	children, err := txDaggo.GetNextChildrenNodesContext(ctx, 1)
+	if err != nil {
+		t.Fatalf("failed to get children: %v", err)
+	}
+	if len(children) != 2 {
+		t.Fatalf("expected 2 children of the root inside the transaction, got %d", len(children))
+	}
+
+	// The nodes stay invisible outside of the transaction until it commits
+	node, err := d.GetNodeByIDContext(ctx, 2)
+	if err != nil {
+		t.Fatalf("failed to get node: %v", err)
+	}
+	if node != nil {
+		t.Fatalf("node 2 is visible before the transaction commits")
+	}
+
+	if err := tx.Commit(); err != nil {
+		t.Fatalf("failed to commit transaction: %v", err)
+	}
+	node, err = d.GetNodeByIDContext(ctx, 3)
+	if err != nil {
+		t.Fatalf("failed to get node: %v", err)
+	}
+	if node == nil || node.RootID != 1 {
+		t.Fatalf("expected node 3 in graph 1 after commit, got %+v", node)
+	}
+}
+
+func TestWithTxAddChildNodeQuota(t *testing.T) {
+	d, db := setupTx(t, daggo.WithQuotaEnforcement())
+	if err := d.CreateGraphTable(); err != nil {
+		t.Fatalf("failed to create graph table: %v", err)
+	}
+	if err := d.CreateQuotaTable(); err != nil {
+		t.Fatalf("failed to create quota table: %v", err)
+	}
+	if _, err := db.Exec("TRUNCATE dag_quota"); err != nil {
+		t.Fatalf("failed to truncate quota table: %v", err)
+	}
+	if err := d.SetQuota(daggo.Quota{Scope: daggo.QuotaScopeGraph, ScopeID: "1", MaxNodes: 2}); err != nil {
+		t.Fatalf("failed to set quota: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	err := d.Tx(ctx, func(txDaggo *daggo.Daggo) error {
+		if err := txDaggo.AddRootNodeContext(ctx, 1); err != nil {
+			return err
+		}
+		if err := txDaggo.AddChildNodeContext(ctx, 2, 1); err != nil {
+			return err
+		}
+		return txDaggo.AddChildNodeContext(ctx, 3, 1)
+	})
+	if !errors.Is(err, daggo.ErrQuotaExceeded) {
+		t.Fatalf("expected ErrQuotaExceeded for the third node of the graph, got %v", err)
+	}
+}
@@ -0,0 +1,183 @@
+package daggo
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ErrResultTruncated is returned alongside a partial result when a traversal hits its MaxResults guard
+var ErrResultTruncated = errors.New("result truncated")
+
+// ResultTruncatedError carries the cursor to pass to WithCursor to continue a truncated traversal.
+// It matches ErrResultTruncated with errors.Is.
+type ResultTruncatedError struct {
+	NextCursor int
+}
+
+func (e *ResultTruncatedError) Error() string {
+	return fmt.Sprintf("%v: continue after node %d", ErrResultTruncated, e.NextCursor)
+}
+
+// Unwrap returns ErrResultTruncated
+func (e *ResultTruncatedError) Unwrap() error {
+	return ErrResultTruncated
+}
+
+// TraversalOption configures a traversal query
+type TraversalOption func(*traversalOptions)
+
+type traversalOptions struct {
+	maxResults  int
+	limit       int
+	maxDepth    int
+	cursor      sql.NullInt64
+	order       NodeOrder
+	orderSet    bool
+	consistency ReadConsistency
+	boundary    GraphBoundary
+	timeout     time.Duration
+	partial     bool
+	resumeDepth int
+}
+
+// WithMaxResults caps the number of nodes a traversal materializes. When more nodes match, the first n are
+// returned in ID order together with a *ResultTruncatedError.
+func WithMaxResults(n int) TraversalOption {
+	return func(o *traversalOptions) {
+		o.maxResults = n
+	}
+}
+
+// WithLimit returns at most n nodes in ID order, without an error when more match. Pass the ID of the last node
+// to WithCursor to fetch the next page.
+func WithLimit(n int) TraversalOption {
+	return func(o *traversalOptions) {
+		o.limit = n
+	}
+}
+
+// WithMaxDepth only follows n edges from the start node, so WithMaxDepth(1) returns its children or parents
+func WithMaxDepth(n int) TraversalOption {
+	return func(o *traversalOptions) {
+		o.maxDepth = n
+	}
+}
+
+// WithCursor resumes a traversal after the given node ID, such as the one returned in
+// ResultTruncatedError.NextCursor or the last node of a page returned with WithLimit
+func WithCursor(cursor int) TraversalOption {
+	return func(o *traversalOptions) {
+		o.cursor = sql.NullInt64{Int64: int64(cursor), Valid: true}
+	}
+}
+
+// NodeOrder sorts the nodes returned by list queries
+type NodeOrder int
+
+const (
+	// OrderByID sorts nodes by ascending ID
+	OrderByID NodeOrder = iota
+	// NewestFirst sorts nodes by descending creation time
+	NewestFirst
+	// OldestFirst sorts nodes by ascending creation time
+	OldestFirst
+	// RecentlyUpdatedFirst sorts nodes by descending update time
+	RecentlyUpdatedFirst
+)
+
+// orderBy returns the ORDER BY clause of the order; ties are broken by ID
+func (o NodeOrder) orderBy() string {
+	switch o {
+	case NewestFirst:
+		return "created_at DESC, id DESC"
+	case OldestFirst:
+		return "created_at ASC, id ASC"
+	case RecentlyUpdatedFirst:
+		return "updated_at DESC, id DESC"
+	default:
+		return "id ASC"
+	}
+}
+
+// WithOrder sorts the nodes returned by GetNextChildrenNodes, overriding the Order setting of the graph.
+// Orders other than OrderByID rely on the timestamp columns added by CreateTimestampColumns.
+func WithOrder(order NodeOrder) TraversalOption {
+	return func(o *traversalOptions) {
+		o.order = order
+		o.orderSet = true
+	}
+}
+
+func newTraversalOptions(opts []TraversalOption) traversalOptions {
+	var o traversalOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return o
+}
+
+// paginate wraps a traversal query returning nodes ordered by ID so that it starts after the cursor ($2)
+// and stops one row past the limit ($3), which tells whether the result was truncated
+func paginate(query string) string {
+	return `
+		SELECT page.*
+		FROM (` + query + `) AS page
+		WHERE $2::int IS NULL OR page.id > $2
+		ORDER BY page.id ASC
+		LIMIT $3
+	`
+}
+
+// fetchLimit returns the number of nodes a query fetches for the limit or the guard to apply, one past the guard
+// to tell whether the result was truncated, or 0 when every node is fetched
+func (o traversalOptions) fetchLimit() int {
+	if o.limit > 0 && (o.maxResults <= 0 || o.limit <= o.maxResults) {
+		return o.limit
+	}
+	if o.maxResults > 0 {
+		return o.maxResults + 1
+	}
+	return 0
+}
+
+// args returns the cursor and limit arguments of a paginated query
+func (o traversalOptions) args() (interface{}, interface{}) {
+	var limit sql.NullInt64
+	if fetch := o.fetchLimit(); fetch > 0 {
+		limit = sql.NullInt64{Int64: int64(fetch), Valid: true}
+	}
+	return o.cursor, limit
+}
+
+// traversalQuery returns the paginated query following step from nodeID, down to the maximum depth if any,
+// together with its arguments
+func (o traversalOptions) traversalQuery(step recursiveStep, nodeID int) (string, []interface{}) {
+	cursor, limit := o.args()
+	if o.maxDepth > 0 {
+		return paginate(depthLimitedTraversalQuery(step)), []interface{}{nodeID, cursor, limit, o.maxDepth}
+	}
+	return paginate(recursiveTraversalQuery(step)), []interface{}{nodeID, cursor, limit}
+}
+
+// truncate applies the guard to nodes ordered by ID, returning a *ResultTruncatedError if some were cut off
+func (o traversalOptions) truncate(nodes []DagNode) ([]DagNode, error) {
+	if o.cursor.Valid {
+		start := 0
+		for start < len(nodes) && int64(nodes[start].ID) <= o.cursor.Int64 {
+			start++
+		}
+		nodes = nodes[start:]
+	}
+
+	if o.limit > 0 && len(nodes) > o.limit {
+		nodes = nodes[:o.limit]
+	}
+	if o.maxResults > 0 && len(nodes) > o.maxResults {
+		nodes = nodes[:o.maxResults]
+		return nodes, &ResultTruncatedError{NextCursor: nodes[len(nodes)-1].ID}
+	}
+
+	return nodes, nil
+}
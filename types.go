@@ -1,13 +1,30 @@
 package daggo
 
-import "database/sql"
+import (
+	"database/sql"
+	"encoding/json"
+	"time"
+)
 
 // DagNode represents a node in the DAG.
 type DagNode struct {
-	ID       int
-	ParentID sql.NullInt64
-	ChildIDs []int
-	RootID   int
+	ID       int           `db:"id"`
+	ParentID sql.NullInt64 `db:"parent_id"`
+	// ChildIDs is only filled for nodes of an in-memory Dag
+	ChildIDs  []int     `db:"-"`
+	RootID    int       `db:"root_id"`
+	CreatedAt time.Time `db:"created_at"`
+	UpdatedAt time.Time `db:"updated_at"`
+	// CreatedBy and UpdatedBy are only recorded when attribution is enabled
+	CreatedBy sql.NullString `db:"created_by"`
+	UpdatedBy sql.NullString `db:"updated_by"`
+	// Payload is the JSON document stored on the node, {} when it has none
+	Payload json.RawMessage `db:"payload"`
+	// EncodedPayload is the payload encoded by the codec named PayloadCodec, for codecs other than JSONCodec
+	EncodedPayload []byte         `db:"payload_bin"`
+	PayloadCodec   sql.NullString `db:"payload_codec"`
+	// NodeType is the registered type the payload was last set with, whose schema later payloads must match
+	NodeType sql.NullString `db:"node_type"`
 }
 
 // GetID returns the ID of the node.
@@ -35,6 +52,7 @@ func (n *DagNode) GetRootID() int {
 
 // Dag represents a tree structure of DagNodes
 type Dag struct {
-	Root  *DagNode
+	Root *DagNode
+	// Nodes maps a parent ID to its children
 	Nodes map[int][]*DagNode
 }
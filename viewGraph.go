@@ -0,0 +1,384 @@
+package daggo
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// ViewGraphSpec describes a graph projected from a source graph
+type ViewGraphSpec struct {
+	// RootID is the root of the source graph; it is always part of the view
+	RootID int
+	// Filter keeps the nodes whose payload contains it, as GetNodesByPayload does; nil keeps every node
+	Filter interface{}
+	// Contract links each kept node to the nearest kept nodes below it through the dropped ones. Otherwise the
+	// view only holds the nodes reachable from the root through kept nodes, and the edges between them.
+	Contract bool
+}
+
+// ViewGraph is a projection of a source graph materialized in side tables
+type ViewGraph struct {
+	ID          int             `db:"id"`
+	Name        string          `db:"name"`
+	RootID      int             `db:"root_id"`
+	Filter      json.RawMessage `db:"filter"`
+	Contract    bool            `db:"contract"`
+	Dirty       bool            `db:"dirty"`
+	RefreshedAt time.Time       `db:"refreshed_at"`
+}
+
+// Every write to the dag or edge table marks the views of the graph it touches as dirty, and the statement
+// refreshes the dirty views once it completes. A refresh recomputes the whole view, so writes to large source
+// graphs with views pay for it, and concurrent writers of a graph with views wait for each other.
+const createViewGraphTablesQuery = `
+	CREATE TABLE IF NOT EXISTS dag_view_graph (
+		id SERIAL PRIMARY KEY,
+		name TEXT NOT NULL UNIQUE,
+		root_id INTEGER NOT NULL,
+		filter JSONB NOT NULL DEFAULT '{}',
+		contract BOOLEAN NOT NULL DEFAULT false,
+		dirty BOOLEAN NOT NULL DEFAULT false,
+		refreshed_at TIMESTAMPTZ NOT NULL DEFAULT now()
+	);
+	CREATE INDEX IF NOT EXISTS dag_view_graph_root_id_idx ON dag_view_graph (root_id);
+	CREATE TABLE IF NOT EXISTS dag_view_graph_node (
+		view_id INTEGER NOT NULL REFERENCES dag_view_graph (id) ON DELETE CASCADE,
+		node_id INTEGER NOT NULL,
+		PRIMARY KEY (view_id, node_id)
+	);
+	CREATE TABLE IF NOT EXISTS dag_view_graph_edge (
+		view_id INTEGER NOT NULL REFERENCES dag_view_graph (id) ON DELETE CASCADE,
+		parent_id INTEGER NOT NULL,
+		child_id INTEGER NOT NULL,
+		PRIMARY KEY (view_id, parent_id, child_id)
+	);
+	CREATE INDEX IF NOT EXISTS dag_view_graph_edge_child_idx ON dag_view_graph_edge (view_id, child_id);
+
+	CREATE OR REPLACE FUNCTION dag_view_graph_refresh(v INTEGER) RETURNS void AS $$
+	DECLARE
+		def dag_view_graph%ROWTYPE;
+	BEGIN
+		SELECT * INTO def FROM dag_view_graph WHERE id = v;
+		DELETE FROM dag_view_graph_edge WHERE view_id = v;
+		DELETE FROM dag_view_graph_node WHERE view_id = v;
+
+		IF def.contract THEN
+			INSERT INTO dag_view_graph_node (view_id, node_id)
+			SELECT v, id FROM dag WHERE root_id = def.root_id AND (id = def.root_id OR payload @> def.filter);
+
+			-- Walk down from every kept node through the dropped ones; the kept nodes reached become its children
+			INSERT INTO dag_view_graph_edge (view_id, parent_id, child_id)
+			WITH RECURSIVE walk (start, id, kept) AS (
+				SELECT n.node_id, dag_edge.child_id, k.node_id IS NOT NULL
+				FROM dag_view_graph_node n
+				JOIN dag_edge ON dag_edge.parent_id = n.node_id
+				LEFT JOIN dag_view_graph_node k ON k.view_id = v AND k.node_id = dag_edge.child_id
+				WHERE n.view_id = v
+				UNION
+				SELECT walk.start, dag_edge.child_id, k.node_id IS NOT NULL
+				FROM walk
+				JOIN dag_edge ON dag_edge.parent_id = walk.id
+				LEFT JOIN dag_view_graph_node k ON k.view_id = v AND k.node_id = dag_edge.child_id
+				WHERE NOT walk.kept
+			)
+			SELECT DISTINCT v, start, id FROM walk WHERE kept;
+		ELSE
+			INSERT INTO dag_view_graph_node (view_id, node_id)
+			WITH RECURSIVE kept (id) AS (
+				SELECT id FROM dag WHERE id = def.root_id
+				UNION
+				SELECT dag.id
+				FROM kept
+				JOIN dag_edge ON dag_edge.parent_id = kept.id
+				JOIN dag ON dag.id = dag_edge.child_id
+				WHERE dag.payload @> def.filter
+			)
+			SELECT v, id FROM kept;
+
+			INSERT INTO dag_view_graph_edge (view_id, parent_id, child_id)
+			SELECT v, dag_edge.parent_id, dag_edge.child_id
+			FROM dag_edge
+			JOIN dag_view_graph_node p ON p.view_id = v AND p.node_id = dag_edge.parent_id
+			JOIN dag_view_graph_node c ON c.view_id = v AND c.node_id = dag_edge.child_id;
+		END IF;
+
+		UPDATE dag_view_graph SET dirty = false, refreshed_at = now() WHERE id = v;
+	END;
+	$$ LANGUAGE plpgsql;
+
+	CREATE OR REPLACE FUNCTION dag_view_graph_mark() RETURNS trigger AS $$
+	BEGIN
+		IF TG_TABLE_NAME = 'dag' THEN
+			IF TG_OP <> 'DELETE' THEN
+				UPDATE dag_view_graph SET dirty = true WHERE root_id = NEW.root_id AND NOT dirty;
+			END IF;
+			IF TG_OP <> 'INSERT' THEN
+				UPDATE dag_view_graph SET dirty = true WHERE root_id = OLD.root_id AND NOT dirty;
+			END IF;
+		ELSE
+			IF TG_OP <> 'DELETE' THEN
+				UPDATE dag_view_graph SET dirty = true
+				WHERE NOT dirty AND root_id IN (SELECT root_id FROM dag WHERE id IN (NEW.parent_id, NEW.child_id));
+			END IF;
+			IF TG_OP <> 'INSERT' THEN
+				UPDATE dag_view_graph SET dirty = true
+				WHERE NOT dirty AND root_id IN (SELECT root_id FROM dag WHERE id IN (OLD.parent_id, OLD.child_id));
+			END IF;
+		END IF;
+		RETURN NULL;
+	END;
+	$$ LANGUAGE plpgsql;
+
+	CREATE OR REPLACE FUNCTION dag_view_graph_sync() RETURNS trigger AS $$
+	DECLARE
+		v INTEGER;
+	BEGIN
+		-- Statements run by other triggers leave the refresh to the statement that fired them
+		IF pg_trigger_depth() > 1 THEN
+			RETURN NULL;
+		END IF;
+		FOR v IN SELECT id FROM dag_view_graph WHERE dirty LOOP
+			PERFORM dag_view_graph_refresh(v);
+		END LOOP;
+		RETURN NULL;
+	END;
+	$$ LANGUAGE plpgsql;
+
+	DROP TRIGGER IF EXISTS dag_view_graph_mark_trigger ON dag;
+	CREATE TRIGGER dag_view_graph_mark_trigger
+		AFTER INSERT OR UPDATE OR DELETE ON dag
+		FOR EACH ROW EXECUTE FUNCTION dag_view_graph_mark();
+	DROP TRIGGER IF EXISTS dag_view_graph_sync_trigger ON dag;
+	CREATE TRIGGER dag_view_graph_sync_trigger
+		AFTER INSERT OR UPDATE OR DELETE ON dag
+		FOR EACH STATEMENT EXECUTE FUNCTION dag_view_graph_sync();
+	DROP TRIGGER IF EXISTS dag_edge_view_graph_mark_trigger ON dag_edge;
+	CREATE TRIGGER dag_edge_view_graph_mark_trigger
+		AFTER INSERT OR UPDATE OR DELETE ON dag_edge
+		FOR EACH ROW EXECUTE FUNCTION dag_view_graph_mark();
+	DROP TRIGGER IF EXISTS dag_edge_view_graph_sync_trigger ON dag_edge;
+	CREATE TRIGGER dag_edge_view_graph_sync_trigger
+		AFTER INSERT OR UPDATE OR DELETE ON dag_edge
+		FOR EACH STATEMENT EXECUTE FUNCTION dag_view_graph_sync();
+`
+
+// CreateViewGraphTables creates the side tables materializing view graphs and installs the triggers keeping
+// them up to date
+func (d *Daggo) CreateViewGraphTables() error {
+	_, err := d.db.Exec(createViewGraphTablesQuery)
+	if err != nil {
+		return fmt.Errorf("failed to create view graph tables: %v", err)
+	}
+
+	return nil
+}
+
+// CreateViewGraph defines a named projection of a source graph and materializes it. The view follows every
+// later change of the source graph, so traversing it costs no more than traversing a graph of its size.
+func (d *Daggo) CreateViewGraph(name string, spec ViewGraphSpec) (*ViewGraph, error) {
+	if name == "" {
+		return nil, fmt.Errorf("view graph name cannot be empty")
+	}
+
+	filter := []byte("{}")
+	if spec.Filter != nil {
+		var err error
+		filter, err = json.Marshal(spec.Filter)
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode view graph filter: %v", err)
+		}
+	}
+
+	var view ViewGraph
+
+	// Start a transaction
+	tx, err := d.db.Beginx()
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %v", err)
+	}
+	defer func() {
+		// Rollback the transaction if it failed to commit
+		if p := recover(); p != nil {
+			tx.Rollback()
+			panic(p)
+		} else if err != nil {
+			tx.Rollback()
+		}
+	}()
+
+	query := `
+		INSERT INTO dag_view_graph (name, root_id, filter, contract)
+		VALUES ($1, $2, $3, $4)
+		RETURNING id
+	`
+	err = tx.Get(&view.ID, query, name, spec.RootID, filter, spec.Contract)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create view graph: %v", err)
+	}
+	_, err = tx.Exec("SELECT dag_view_graph_refresh($1)", view.ID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to materialize view graph: %v", err)
+	}
+	err = tx.Get(&view, "SELECT * FROM dag_view_graph WHERE id = $1", view.ID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get view graph: %v", err)
+	}
+
+	// Commit the transaction
+	err = tx.Commit()
+	if err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %v", err)
+	}
+
+	return &view, nil
+}
+
+// GetViewGraph returns the view graph with the given name, or nil if it does not exist
+func (d *Daggo) GetViewGraph(name string) (*ViewGraph, error) {
+	var view ViewGraph
+
+	err := d.db.Get(&view, "SELECT * FROM dag_view_graph WHERE name = $1", name)
+	if err == sql.ErrNoRows {
+		return nil, nil // No view graph found
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to get view graph: %v", err)
+	}
+
+	return &view, nil
+}
+
+// ListViewGraphs returns the view graphs projected from the graph rooted at rootID ordered by name
+func (d *Daggo) ListViewGraphs(rootID int) ([]ViewGraph, error) {
+	views := make([]ViewGraph, 0)
+
+	err := d.db.Select(&views, "SELECT * FROM dag_view_graph WHERE root_id = $1 ORDER BY name ASC", rootID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list view graphs: %v", err)
+	}
+
+	return views, nil
+}
+
+// DropViewGraph deletes the view graph with the given name and its materialized nodes and edges
+func (d *Daggo) DropViewGraph(name string) error {
+	_, err := d.db.Exec("DELETE FROM dag_view_graph WHERE name = $1", name)
+	if err != nil {
+		return fmt.Errorf("failed to drop view graph: %v", err)
+	}
+
+	return nil
+}
+
+// RefreshViewGraph recomputes the view graph with the given name, which the triggers already do after every
+// write; it repairs views whose source was changed with the triggers disabled
+func (d *Daggo) RefreshViewGraph(name string) error {
+	result, err := d.db.Exec("SELECT dag_view_graph_refresh(id) FROM dag_view_graph WHERE name = $1", name)
+	if err != nil {
+		return fmt.Errorf("failed to refresh view graph: %v", err)
+	}
+	refreshed, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to refresh view graph: %v", err)
+	}
+	if refreshed == 0 {
+		return fmt.Errorf("view graph %q does not exist", name)
+	}
+
+	return nil
+}
+
+// GetViewGraphNodes returns the nodes of the view graph with the given name, ordered by ID
+func (d *Daggo) GetViewGraphNodes(name string) ([]DagNode, error) {
+	nodes := make([]DagNode, 0)
+
+	query := `
+		SELECT dag.*
+		FROM dag_view_graph v
+		JOIN dag_view_graph_node n ON n.view_id = v.id
+		JOIN dag ON dag.id = n.node_id
+		WHERE v.name = $1
+		ORDER BY dag.id ASC
+	`
+	err := d.db.Select(&nodes, query, name)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get view graph nodes: %v", err)
+	}
+
+	return nodes, nil
+}
+
+// GetViewGraphChildren returns the children of the given node ID in the view graph with the given name,
+// ordered by ID
+func (d *Daggo) GetViewGraphChildren(name string, nodeID int) ([]DagNode, error) {
+	nodes := make([]DagNode, 0)
+
+	query := `
+		SELECT dag.*
+		FROM dag_view_graph v
+		JOIN dag_view_graph_edge e ON e.view_id = v.id
+		JOIN dag ON dag.id = e.child_id
+		WHERE v.name = $1 AND e.parent_id = $2
+		ORDER BY dag.id ASC
+	`
+	err := d.db.Select(&nodes, query, name, nodeID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get view graph children: %v", err)
+	}
+
+	return nodes, nil
+}
+
+// GetViewGraphDescendants returns the descendants of the given node ID in the view graph with the given name,
+// ordered by ID
+func (d *Daggo) GetViewGraphDescendants(name string, nodeID int) ([]DagNode, error) {
+	nodes := make([]DagNode, 0)
+
+	query := `
+		WITH RECURSIVE target AS (
+			SELECT id FROM dag_view_graph WHERE name = $1
+		), reachable AS (
+			SELECT $2::int AS id
+			UNION
+			SELECT e.child_id
+			FROM dag_view_graph_edge e
+			JOIN reachable ON e.parent_id = reachable.id
+			WHERE e.view_id = (SELECT id FROM target)
+		)
+		SELECT dag.*
+		FROM dag
+		JOIN reachable ON dag.id = reachable.id
+		WHERE dag.id <> $2
+		ORDER BY dag.id ASC
+	`
+	err := d.db.Select(&nodes, query, name, nodeID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get view graph descendants: %v", err)
+	}
+
+	return nodes, nil
+}
+
+// refreshViewGraphsOf rebuilds the view graphs of the graph rooted at rootID inside tx, for writes that rewrite
+// node IDs under the triggers, if view graphs are in use
+func refreshViewGraphsOf(ctx context.Context, tx *sqlx.Tx, rootID int) error {
+	var exists bool
+	err := tx.GetContext(ctx, &exists, "SELECT to_regclass('dag_view_graph') IS NOT NULL")
+	if err != nil {
+		return fmt.Errorf("failed to check view graph table: %v", err)
+	}
+	if !exists {
+		return nil
+	}
+
+	_, err = tx.ExecContext(ctx, "SELECT dag_view_graph_refresh(id) FROM dag_view_graph WHERE root_id = $1", rootID)
+	if err != nil {
+		return fmt.Errorf("failed to refresh view graphs: %v", err)
+	}
+
+	return nil
+}
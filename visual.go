@@ -0,0 +1,93 @@
+package daggo
+
+import (
+	"database/sql"
+	"fmt"
+)
+
+// VisualHints are optional presentation hints honored by the exporters
+type VisualHints struct {
+	// Color is a color name or #rrggbb value
+	Color string `db:"color" json:"color,omitempty"`
+	// Shape is one of box, ellipse, circle, diamond or any Graphviz shape name
+	Shape string `db:"shape" json:"shape,omitempty"`
+	// Group clusters nodes together in the rendered diagram
+	Group string `db:"group_name" json:"group,omitempty"`
+}
+
+const createVisualTableQuery = `
+	CREATE TABLE IF NOT EXISTS dag_visual (
+		node_id INTEGER PRIMARY KEY,
+		color TEXT NOT NULL DEFAULT '',
+		shape TEXT NOT NULL DEFAULT '',
+		group_name TEXT NOT NULL DEFAULT ''
+	);
+`
+
+// CreateVisualTable creates the side table used to store visual hints
+func (d *Daggo) CreateVisualTable() error {
+	_, err := d.db.Exec(createVisualTableQuery)
+	if err != nil {
+		return fmt.Errorf("failed to create visual table: %v", err)
+	}
+
+	return nil
+}
+
+// SetVisualHints stores the visual hints of the given node ID, replacing any previous ones
+func (d *Daggo) SetVisualHints(nodeID int, hints VisualHints) error {
+	query := `
+		INSERT INTO dag_visual (node_id, color, shape, group_name)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT (node_id) DO UPDATE
+		SET color = EXCLUDED.color, shape = EXCLUDED.shape, group_name = EXCLUDED.group_name
+	`
+	_, err := d.db.Exec(query, nodeID, hints.Color, hints.Shape, hints.Group)
+	if err != nil {
+		return fmt.Errorf("failed to set visual hints: %v", err)
+	}
+
+	return nil
+}
+
+// GetVisualHints returns the visual hints of the given node ID, or nil if it has none
+func (d *Daggo) GetVisualHints(nodeID int) (*VisualHints, error) {
+	var hints VisualHints
+
+	query := "SELECT color, shape, group_name FROM dag_visual WHERE node_id = $1"
+	err := d.db.Get(&hints, query, nodeID)
+	if err == sql.ErrNoRows {
+		return nil, nil // No hints for this node
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to get visual hints: %v", err)
+	}
+
+	return &hints, nil
+}
+
+// loadVisualHints returns the visual hints of the nodes of the graph rooted at rootID. It returns no hints
+// when the visual table was never created.
+func (d *Daggo) loadVisualHints(rootID int) (map[int]VisualHints, error) {
+	var rows []struct {
+		NodeID int `db:"node_id"`
+		VisualHints
+	}
+
+	query := `
+		SELECT v.node_id, v.color, v.shape, v.group_name
+		FROM dag_visual v
+		JOIN dag ON dag.id = v.node_id
+		WHERE dag.root_id = $1
+	`
+	err := d.db.Select(&rows, query, rootID)
+	if err != nil && !isUndefinedTable(err) {
+		return nil, fmt.Errorf("failed to load visual hints: %v", err)
+	}
+
+	hints := make(map[int]VisualHints, len(rows))
+	for _, row := range rows {
+		hints[row.NodeID] = row.VisualHints
+	}
+
+	return hints, nil
+}